@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/pincode"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const ErrAddressTypeTaken = "this profile already has an address of that type"
+
+// ValidateAddress checks a submitted address and fills in its district and
+// state from the PIN code where the client left them empty.
+func ValidateAddress(a *models.Address, dir *pincode.Directory) *utils.Validator {
+	a.Line1, a.State, a.District = strings.TrimSpace(a.Line1), strings.TrimSpace(a.State), strings.TrimSpace(a.District)
+
+	validate := utils.NewValidator()
+	validate.Check(utils.In(a.Type, models.AddressTypes...), "type", "type must be one of permanent, current or office")
+	validate.Check(a.Line1 != "", "line1", "line1 is required")
+	validate.Check(len(a.Line1) <= 200, "line1", "line1 must be at most 200 characters")
+	validate.Check(len(a.Line2) <= 200, "line2", "line2 must be at most 200 characters")
+	validate.Check(len(a.Locality) <= 100, "locality", "locality must be at most 100 characters")
+	if !pincode.Valid(a.PinCode) {
+		validate.AddError("pin_code", "pin code must be 6 digits and not start with 0")
+		return validate
+	}
+
+	place, err := dir.Resolve(a.PinCode, a.State)
+	switch {
+	case errors.Is(err, pincode.ErrStateMismatch), errors.Is(err, pincode.ErrAmbiguousState):
+		validate.AddError("state", err.Error())
+	case err != nil:
+		validate.AddError("pin_code", err.Error())
+	default:
+		a.State = place.State
+		if a.District == "" {
+			a.District = place.District
+		}
+	}
+	return validate
+}
+
+// addressIDParam reads the :addressID of the address routes.
+func addressIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("addressID"))
+	return id, err == nil && id > 0
+}
+
+// ListAddresses returns the addresses of the profile in the path, or of the
+// primary profile.
+func (app *Application) ListAddresses(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	addresses, err := app.repo.Addresses.List(c.Request().Context(), profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing addresses \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, addresses)
+}
+
+func (app *Application) CreateAddress(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	var a models.Address
+	if err := c.Bind(&a); err != nil {
+		app.logger.Errorf("error binding json to type address \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if validate := ValidateAddress(&a, app.pincodes); !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	a.ID, a.ProfileID = 0, profile.ID
+	ctx := c.Request().Context()
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Addresses.Create(ctx, &a); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldAddress})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrAddressTypeTaken})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating address \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionAddressCreate)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	return c.JSON(http.StatusCreated, a)
+}
+
+func (app *Application) UpdateAddress(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := addressIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "address not found"})
+	}
+
+	var a models.Address
+	if err := c.Bind(&a); err != nil {
+		app.logger.Errorf("error binding json to type address \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if validate := ValidateAddress(&a, app.pincodes); !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	a.ID, a.ProfileID = id, profile.ID
+	ctx := c.Request().Context()
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Addresses.Update(ctx, &a); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldAddress})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "address not found"})
+		}
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrAddressTypeTaken})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error updating address \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionAddressUpdate)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	return c.JSON(http.StatusOK, a)
+}
+
+func (app *Application) DeleteAddress(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := addressIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "address not found"})
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	ctx := c.Request().Context()
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Addresses.Delete(ctx, profile.ID, id); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldAddress})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "address not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting address \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionAddressDelete)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	return c.JSON(http.StatusOK, map[string]string{"message": "address deleted successfully"})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// recordAdminAudit records an action an admin took on another user's data.
+// The record is filed under the affected user, with the admin in the details.
+func (app *Application) recordAdminAudit(c echo.Context, targetID int, action string) {
+	adminID, _ := app.GetUserJWT(c)
+	details := map[string]string{"ip": c.RealIP(), "admin_id": strconv.Itoa(adminID)}
+	if err := app.audit.Log(c.Request().Context(), targetID, action, details); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing audit record \n%w", err)
+	}
+}
+
+func userIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	return id, err == nil && id > 0
+}
+
+// RestoreUser undoes an account deletion, together with the profiles that were
+// deleted with it, as long as the purge worker has not erased them yet.
+func (app *Application) RestoreUser(c echo.Context) error {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	if err := app.repo.Users.Restore(c.Request().Context(), userID); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no deleted user with this id"})
+		}
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "email, username, phone no. or a document number is now used by another account"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error restoring user \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordAdminAudit(c, userID, audit.ActionAccountRestore)
+	return c.JSON(http.StatusOK, map[string]string{"message": "user restored successfully"})
+}
+
+// RestoreProfile brings back one of a user's deleted profiles.
+func (app *Application) RestoreProfile(c echo.Context) error {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	profileID, err := strconv.Atoi(c.Param("profileID"))
+	if err != nil || profileID < 1 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no such deleted profile for this user"})
+	}
+
+	if err := app.repo.Profiles.Restore(c.Request().Context(), userID, profileID); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no such deleted profile for this user"})
+		}
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "user already has a profile, or its phone no., aadhaar number or a document number is in use"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error restoring profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordAdminAudit(c, userID, audit.ActionProfileRestore)
+	return c.JSON(http.StatusOK, map[string]string{"message": "profile restored successfully"})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxAttachmentSize caps a single upload.
+	maxAttachmentSize = 10 << 20
+	// maxAttachments caps the files on one profile.
+	maxAttachments = 20
+)
+
+// attachmentTypes are the content types accepted for upload. The type is
+// sniffed from the file's first bytes; what the client claims is ignored.
+var attachmentTypes = []string{"application/pdf", "image/jpeg", "image/png"}
+
+const (
+	ErrAttachmentTooLarge = "files can be at most 10 MiB"
+	ErrAttachmentType     = "only PDF, JPEG and PNG files are accepted"
+	ErrAttachmentLimit    = "this profile already has the maximum number of attachments"
+)
+
+// attachmentIDParam reads the :attachmentID of the attachment routes.
+func attachmentIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("attachmentID"))
+	return id, err == nil && id > 0
+}
+
+// attachmentFileName keeps the last path element of an uploaded file's name,
+// without control characters, for the Content-Disposition of downloads.
+func attachmentFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// newBlobKey picks a random key under the profile's prefix. Keys are never
+// reused, so a blob can only ever be opened with the data key stored next to
+// it.
+func newBlobKey(profileID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", profileID, hex.EncodeToString(b)), nil
+}
+
+func (app *Application) ListAttachments(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	list, err := app.repo.Attachments.List(c.Request().Context(), profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing attachments \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// UploadAttachment takes a PDF, JPEG or PNG as the multipart "file" and its
+// "kind". The file is sealed under a fresh data key before it reaches the
+// blob store; only the wrapped key and a hash of the plaintext go in the
+// database.
+func (app *Application) UploadAttachment(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	if err := app.checkConsent(c.Request().Context(), userID, consent.PurposeKYC); err != nil {
+		return app.consentError(c, err)
+	}
+
+	// leave room for the multipart framing and the other fields
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxAttachmentSize+64<<10)
+	file, err := c.FormFile("file")
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrAttachmentTooLarge})
+	}
+	kind := c.FormValue("kind")
+	if kind == "" {
+		kind = models.AttachmentOther
+	}
+	validate := utils.NewValidator()
+	validate.Check(slices.Contains(models.AttachmentKinds, kind), "kind", "must be one of "+strings.Join(models.AttachmentKinds, ", "))
+	validate.Check(err == nil, "file", utils.ErrFieldRequired.Message)
+	if !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+	if file.Size > maxAttachmentSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrAttachmentTooLarge})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxAttachmentSize+1))
+	f.Close()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if len(data) > maxAttachmentSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrAttachmentTooLarge})
+	}
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"file": "the file is empty"})
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if !slices.Contains(attachmentTypes, contentType) {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": ErrAttachmentType})
+	}
+
+	ctx := req.Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	existing, err := app.repo.Attachments.List(ctx, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing attachments \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if len(existing) >= maxAttachments {
+		return c.JSON(http.StatusConflict, map[string]string{"error": ErrAttachmentLimit})
+	}
+
+	sum := sha256.Sum256(data)
+	a := models.Attachment{
+		ProfileID:   profile.ID,
+		Kind:        kind,
+		FileName:    attachmentFileName(file.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	if a.BlobKey, err = newBlobKey(profile.ID); err != nil {
+		app.logger.Errorf("error generating blob key \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	sealed, dataKey, err := blob.Seal(data, a.BlobKey)
+	if err == nil {
+		a.DataKey, err = app.wrapDataKey(dataKey)
+	}
+	if err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	if err := app.blobs.Put(ctx, a.BlobKey, bytes.NewReader(sealed), int64(len(sealed))); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error storing attachment \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if err := app.repo.Attachments.Create(ctx, &a); err != nil {
+		app.deleteBlob(ctx, a.BlobKey)
+		if errors.Is(err, models.NotFound) {
+			return app.profileLoadError(c, err)
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating attachment \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionAttachmentCreate)
+	return c.JSON(http.StatusCreated, a)
+}
+
+func (app *Application) DeleteAttachment(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	id, ok := attachmentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+	}
+
+	ctx := c.Request().Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	a, err := app.repo.Attachments.Get(ctx, profile.ID, id)
+	if err == nil {
+		err = app.repo.Attachments.Delete(ctx, profile.ID, id)
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting attachment \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.deleteBlob(ctx, a.BlobKey)
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionAttachmentDelete)
+	return c.JSON(http.StatusOK, map[string]string{"message": "attachment deleted successfully"})
+}
+
+// AttachmentURL returns a short-lived URL the file can be downloaded from
+// without the bearer token, for links and <img> tags.
+func (app *Application) AttachmentURL(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	id, ok := attachmentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	a, err := app.repo.Attachments.Get(c.Request().Context(), profile.ID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching attachment \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	token, expires := app.downloads.Sign(fileSubject(fileAttachment, a.ProfileID, a.ID), app.downloadTTL)
+	return c.JSON(http.StatusOK, map[string]any{
+		"url":        "/api/files/" + token,
+		"expires_at": expires,
+	})
+}
+
+func (app *Application) serveAttachment(c echo.Context, profileID, id int) error {
+	a, err := app.repo.Attachments.Get(c.Request().Context(), profileID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching attachment \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return app.serveBlob(c, a.BlobKey, a.DataKey, a.Size, a.ContentType, "attachment", a.FileName)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
@@ -48,8 +49,9 @@ func (app *Application) LoadMiddleware(e *echo.Echo) {
 			"http://localhost:3000",// docker service
 		},
 		AllowCredentials: true,
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, HeaderIfMatch, HeaderSharePIN},
+		ExposeHeaders:    []string{HeaderETag, echo.HeaderLocation},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 	}))
 
 	config := middleware.RateLimiterConfig{
@@ -70,14 +72,8 @@ func (app *Application) LoadMiddleware(e *echo.Echo) {
 	e.Use(middleware.RateLimiterWithConfig(config))
 }
 
-func (app *Application) RegisterRoutes(e *echo.Echo) {
-    e.GET("/api/health", app.health.Handler)
-    e.POST("/api/login", app.Login)
-    e.POST("/api/register", app.Register)
-
-    // Protected routes - Everything under /api/restricted/...
-    r := e.Group("/api/restricted") 
-    r.Use(echojwt.WithConfig(echojwt.Config{
+func (app *Application) jwtMiddleware() echo.MiddlewareFunc {
+    return echojwt.WithConfig(echojwt.Config{
         SigningKey: []byte(app.env[env.JWT_SECRET]),
 		TokenLookup: "header:Authorization:Bearer ", 
         NewClaimsFunc: func(c echo.Context) jwt.Claims {
@@ -87,9 +83,135 @@ func (app *Application) RegisterRoutes(e *echo.Echo) {
         fmt.Printf("DEBUG: JWT Error: %v\n", err) // This will tell us if it's signature, expiry, or format
         return err
     },
-    }))
+    })
+}
+
+func (app *Application) RegisterRoutes(e *echo.Echo) {
+    e.GET("/api/health", app.health.Handler)
+    e.POST("/api/login", app.Login)
+    e.POST("/api/register", app.Register)
+    // the signed token in the path is the credential, see DownloadFile
+    e.GET("/api/files/:token", app.DownloadFile)
+    // and so is the one of a profile share link, see ViewShare
+    e.GET("/api/share/:token", app.ViewShare)
+    // the issuer's DID document, status lists and a verifier for the
+    // credentials it signs are public too
+    e.GET("/.well-known/did.json", app.DIDDocument)
+    e.GET("/api/credentials/status/:list", app.CredentialStatusList)
+    e.POST("/api/credentials/verify", app.VerifyCredential)
+
+    // Protected routes - Everything under /api/restricted/...
+    r := e.Group("/api/restricted") 
+    r.Use(app.jwtMiddleware())
+    r.Use(app.RequireActiveSession)
 
     r.GET("/profile", app.GetProfile)    
     r.POST("/profile", app.CreateProfile) 
     r.PUT("/profile", app.UpdateProfile)  
+    r.PATCH("/profile", app.PatchProfile)
+    r.DELETE("/profile", app.DeleteProfile)
+    r.GET("/profile/history", app.GetProfileHistory)
+    r.GET("/profile/addresses", app.ListAddresses)
+    r.POST("/profile/addresses", app.CreateAddress)
+    r.PUT("/profile/addresses/:addressID", app.UpdateAddress)
+    r.DELETE("/profile/addresses/:addressID", app.DeleteAddress)
+    r.GET("/profile/documents", app.ListDocuments)
+    r.POST("/profile/documents", app.CreateDocument)
+    r.GET("/profile/documents/:documentID", app.GetDocument)
+    r.PUT("/profile/documents/:documentID", app.UpdateDocument)
+    r.DELETE("/profile/documents/:documentID", app.DeleteDocument)
+    r.GET("/profile/ekyc", app.ListEKYC)
+    r.POST("/profile/ekyc", app.UploadEKYC)
+    r.POST("/profile/aadhaar-qr", app.DecodeAadhaarQR)
+    r.GET("/profile/kyc", app.GetKYC)
+    r.POST("/profile/kyc/submit", app.SubmitKYC)
+    r.POST("/profile/kyc/withdraw", app.WithdrawKYC)
+    r.GET("/profile/attachments", app.ListAttachments)
+    r.POST("/profile/attachments", app.UploadAttachment)
+    r.DELETE("/profile/attachments/:attachmentID", app.DeleteAttachment)
+    r.GET("/profile/attachments/:attachmentID/url", app.AttachmentURL)
+    r.PUT("/profile/photo", app.PutPhoto)
+    r.DELETE("/profile/photo", app.DeletePhoto)
+    r.GET("/profile/shares", app.ListShareLinks)
+    r.POST("/profile/shares", app.CreateShareLink)
+    r.DELETE("/profile/shares/:shareID", app.RevokeShareLink)
+    r.GET("/profile/credentials", app.ListCredentials)
+    r.POST("/profile/credentials", app.IssueCredential)
+    r.DELETE("/profile/credentials/:credentialID", app.RevokeCredential)
+
+    // An account can manage several profiles; /profile is its primary one
+    r.GET("/profiles", app.ListProfiles)
+    r.POST("/profiles", app.CreateProfile)
+    r.GET("/profiles/:id", app.GetProfile)
+    r.PUT("/profiles/:id", app.UpdateProfile)
+    r.PATCH("/profiles/:id", app.PatchProfile)
+    r.DELETE("/profiles/:id", app.DeleteProfile)
+    r.GET("/profiles/:id/history", app.GetProfileHistory)
+    r.POST("/profiles/:id/primary", app.SetPrimaryProfile)
+    r.GET("/profiles/:id/addresses", app.ListAddresses)
+    r.POST("/profiles/:id/addresses", app.CreateAddress)
+    r.PUT("/profiles/:id/addresses/:addressID", app.UpdateAddress)
+    r.DELETE("/profiles/:id/addresses/:addressID", app.DeleteAddress)
+    r.GET("/profiles/:id/documents", app.ListDocuments)
+    r.POST("/profiles/:id/documents", app.CreateDocument)
+    r.GET("/profiles/:id/documents/:documentID", app.GetDocument)
+    r.PUT("/profiles/:id/documents/:documentID", app.UpdateDocument)
+    r.DELETE("/profiles/:id/documents/:documentID", app.DeleteDocument)
+    r.GET("/profiles/:id/ekyc", app.ListEKYC)
+    r.POST("/profiles/:id/ekyc", app.UploadEKYC)
+    r.POST("/profiles/:id/aadhaar-qr", app.DecodeAadhaarQR)
+    r.GET("/profiles/:id/kyc", app.GetKYC)
+    r.POST("/profiles/:id/kyc/submit", app.SubmitKYC)
+    r.POST("/profiles/:id/kyc/withdraw", app.WithdrawKYC)
+    r.GET("/profiles/:id/attachments", app.ListAttachments)
+    r.POST("/profiles/:id/attachments", app.UploadAttachment)
+    r.DELETE("/profiles/:id/attachments/:attachmentID", app.DeleteAttachment)
+    r.GET("/profiles/:id/attachments/:attachmentID/url", app.AttachmentURL)
+    r.PUT("/profiles/:id/photo", app.PutPhoto)
+    r.DELETE("/profiles/:id/photo", app.DeletePhoto)
+    r.GET("/profiles/:id/shares", app.ListShareLinks)
+    r.POST("/profiles/:id/shares", app.CreateShareLink)
+    r.DELETE("/profiles/:id/shares/:shareID", app.RevokeShareLink)
+    r.GET("/profiles/:id/credentials", app.ListCredentials)
+    r.POST("/profiles/:id/credentials", app.IssueCredential)
+    r.DELETE("/profiles/:id/credentials/:credentialID", app.RevokeCredential)
+    r.DELETE("/account", app.DeleteAccount)
+    r.POST("/account/export", app.CreateExport)
+    r.GET("/account/export/:exportID", app.GetExport)
+    r.GET("/consents", app.ListConsents)
+    r.GET("/consents/history", app.ConsentHistory)
+    r.GET("/consents/history/:consentID/receipt", app.ConsentReceipt)
+    r.PUT("/consents/:purpose", app.GrantConsent)
+    r.DELETE("/consents/:purpose", app.WithdrawConsent)
+
+    // Admin routes - role is checked against the database on every request
+    a := e.Group("/api/admin")
+    a.Use(app.jwtMiddleware())
+    a.Use(app.RequireActiveSession)
+    a.Use(app.RequireRole(models.RoleAdmin))
+
+    a.POST("/users/:id/restore", app.RestoreUser)
+    a.POST("/users/:id/profiles/:profileID/restore", app.RestoreProfile)
+    a.GET("/users/:id/profile", app.GetProfileAsOf)
+    a.GET("/duplicates", app.DuplicateQueue)
+    a.GET("/duplicates/:duplicateID", app.ReviewDuplicate)
+    a.POST("/duplicates/:duplicateID/resolve", app.ResolveDuplicate)
+    a.POST("/imports", app.CreateImport)
+    a.GET("/imports/:importID", app.GetImport)
+    a.POST("/imports/:importID", app.ResumeImport)
+    a.GET("/imports/:importID/errors", app.ImportErrorReport)
+
+    // Support routes - the KYC reviewer queue, open to support and admin users
+    s := e.Group("/api/support")
+    s.Use(app.jwtMiddleware())
+    s.Use(app.RequireActiveSession)
+    s.Use(app.RequireRole(models.RoleSupport, models.RoleAdmin))
+
+    s.GET("/kyc/queue", app.KYCQueue)
+    s.POST("/kyc/queue/claim", app.ClaimNextKYC)
+    s.GET("/kyc/:profileID", app.ReviewKYC)
+    s.POST("/kyc/:profileID/claim", app.ClaimKYC)
+    s.POST("/kyc/:profileID/release", app.ReleaseKYC)
+    s.POST("/kyc/:profileID/approve", app.ApproveKYC)
+    s.POST("/kyc/:profileID/reject", app.RejectKYC)
 }
\ No newline at end of file
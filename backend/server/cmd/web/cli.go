@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/importer"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/migrations"
+)
+
+const usage = `usage: api [command]
+
+Without a command the API server is started.
+
+commands:
+  migrate up [--dry-run]        apply all pending schema migrations
+  migrate down [N] [--dry-run]  roll back the latest N migrations (default 1)
+  migrate status                list migrations and whether they are applied
+  verify-audit                  walk the audit hash chain and report the first broken link,
+                                checking checkpoints against AUDIT_VERIFY_KEY
+  audit-verify-key              print the public key of AUDIT_SIGNING_KEY to set as
+                                AUDIT_VERIFY_KEY wherever the chain is verified
+  grant-role EMAIL ROLE         set a user's role to user, support or admin
+  backfill-addresses [--dry-run]
+                                fill PIN code, district and state of addresses
+                                copied from the old free-text column
+  backfill-indexes [--dry-run]  compute the Aadhaar and phone blind indexes of
+                                profiles written before duplicate detection
+  import [--dry-run] [--format csv|ndjson] [--resume ID] [--errors FILE] FILE
+                                create accounts and profiles from a CSV or NDJSON
+                                file, writing rejected rows to the errors file
+`
+
+// runCommand runs one of the administrative subcommands against the same
+// database and configuration the server uses, and returns the exit code.
+func runCommand(ctx context.Context, db *database, envMap map[string]string, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return migrate(ctx, db.migrator, args[1:])
+	case "verify-audit":
+		return verifyAudit(ctx, db.repo, envMap)
+	case "audit-verify-key":
+		return auditVerifyKey(envMap)
+	case "grant-role":
+		return grantRole(ctx, db.repo, envMap, args[1:])
+	case "backfill-addresses":
+		return backfillAddresses(ctx, db.repo, envMap, args[1:])
+	case "backfill-indexes":
+		return backfillIndexes(ctx, db.repo, envMap, args[1:])
+	case "import":
+		return importFile(ctx, db.repo, envMap, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// verifyAudit needs only the public key, so an auditor can run it without
+// being able to sign checkpoints, and the checkpoint interval the chain was
+// written with.
+func verifyAudit(ctx context.Context, repo *repository.Repository, envMap map[string]string) int {
+	pub, err := audit.ParseVerifyKey(envMap[env.AUDIT_VERIFY_KEY])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	interval, err := checkpointInterval(envMap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report, err := audit.Verify(ctx, repo.Audit, pub, interval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading audit log: %v\n", err)
+		return 2
+	}
+	if !report.Intact() {
+		fmt.Printf("audit chain BROKEN at record %d: %s\n", report.BrokenAt, report.Reason)
+		return 1
+	}
+	fmt.Printf("audit chain intact: %d records, %d signed checkpoints\n", report.Records, report.Checkpoints)
+	return 0
+}
+
+func auditVerifyKey(envMap map[string]string) int {
+	key, err := audit.ParseSigningKey(envMap[env.AUDIT_SIGNING_KEY])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Println(audit.VerifyKey(key))
+	return 0
+}
+
+func migrate(ctx context.Context, migrator migrator, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the migrations that would run without applying them")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	// Parse stops at the first positional argument, so flags may still follow
+	// the step count of down; parse them too, or "down 3 --dry-run" would
+	// really roll back
+	positional := flags.Args()
+	if len(positional) > 0 {
+		first := positional[0]
+		if err := flags.Parse(positional[1:]); err != nil {
+			return 2
+		}
+		positional = append([]string{first}, flags.Args()...)
+	}
+	maxArgs := 0
+	if args[0] == "down" {
+		maxArgs = 1
+	}
+	if len(positional) > maxArgs {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", positional[maxArgs])
+		return 2
+	}
+
+	var done []migrations.Migration
+	var err error
+	switch args[0] {
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading migration status: %v\n", err)
+			return 1
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d  %-40s %s\n", s.Version, s.Name, state)
+		}
+		return 0
+	case "up":
+		done, err = migrator.Up(ctx, *dryRun)
+	case "down":
+		steps := 1
+		if len(positional) > 0 {
+			if steps, err = strconv.Atoi(positional[0]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid step count %q\n", positional[0])
+				return 2
+			}
+		}
+		done, err = migrator.Down(ctx, steps, *dryRun)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	for _, mig := range done {
+		sql := mig.Up
+		if args[0] == "down" {
+			sql = mig.Down
+		}
+		if *dryRun {
+			fmt.Printf("-- would %s %06d_%s\n%s\n", args[0], mig.Version, mig.Name, sql)
+		} else {
+			fmt.Printf("%s %06d_%s\n", args[0], mig.Version, mig.Name)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(done) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return 0
+}
+
+func grantRole(ctx context.Context, repo *repository.Repository, envMap map[string]string, args []string) int {
+	if len(args) != 2 || !slices.Contains([]string{models.RoleUser, models.RoleSupport, models.RoleAdmin}, args[1]) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	email, role := args[0], args[1]
+
+	auditLogger, err := newAuditLogger(repo, envMap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	// the role change and its audit record commit together or not at all
+	err = repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Users.SetRole(ctx, email, role); err != nil {
+			return err
+		}
+		user, err := tx.Users.GetByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		return auditLogger.WithRepo(tx.Audit).Log(ctx, user.ID, audit.ActionRoleChange, map[string]string{"role": role, "by": "cli"})
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			fmt.Fprintf(os.Stderr, "no user with email %s\n", email)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "error setting role: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s is now %s\n", email, role)
+	return 0
+}
+
+// pinInText finds a six digit PIN code standing on its own in free text, as in
+// "12 MG Road, Bengaluru - 560001".
+var pinInText = regexp.MustCompile(`(?:^|[^0-9])([1-9][0-9]{2} ?[0-9]{3})(?:[^0-9]|$)`)
+
+const backfillPageSize = 200
+
+// backfillAddresses takes the PIN code out of each unchecked address line and
+// fills in the district and state it resolves to. Addresses whose PIN is
+// missing, unknown or shared by two states are left for the user to edit.
+func backfillAddresses(ctx context.Context, repo *repository.Repository, envMap map[string]string, args []string) int {
+	flags := flag.NewFlagSet("backfill-addresses", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing it")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	dir, err := loadPincodes(envMap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading PIN code directory: %v\n", err)
+		return 2
+	}
+
+	var filled, skipped int
+	for afterID := 0; ; {
+		page, err := repo.Addresses.Unchecked(ctx, afterID, backfillPageSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading addresses: %v\n", err)
+			return 1
+		}
+		for _, a := range page {
+			afterID = a.ID
+			m := pinInText.FindStringSubmatch(a.Line1)
+			if m == nil {
+				skipped++
+				continue
+			}
+			pin := strings.ReplaceAll(m[1], " ", "")
+			place, err := dir.Resolve(pin, a.State)
+			if err != nil {
+				fmt.Printf("address %d: %s: %v\n", a.ID, pin, err)
+				skipped++
+				continue
+			}
+			a.PinCode, a.State = pin, place.State
+			if a.District == "" {
+				a.District = place.District
+			}
+			if !*dryRun {
+				if err := repo.Addresses.Update(ctx, &a); err != nil {
+					fmt.Fprintf(os.Stderr, "error updating address %d: %v\n", a.ID, err)
+					return 1
+				}
+			}
+			filled++
+		}
+		if len(page) < backfillPageSize {
+			break
+		}
+	}
+	verb := "filled"
+	if *dryRun {
+		verb = "would fill"
+	}
+	fmt.Printf("%s %d addresses, %d left without a usable PIN code\n", verb, filled, skipped)
+	return 0
+}
+
+// backfillIndexes sets the duplicate detection indexes of profiles that have
+// not been written since they were added. It does not look for duplicates
+// among them; a profile is compared with the others when it is next written.
+func backfillIndexes(ctx context.Context, repo *repository.Repository, envMap map[string]string, args []string) int {
+	flags := flag.NewFlagSet("backfill-indexes", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing it")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var filled int
+	for afterID := 0; ; {
+		page, err := repo.Duplicates.Unindexed(ctx, afterID, backfillPageSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading profiles: %v\n", err)
+			return 1
+		}
+		for _, p := range page {
+			afterID = p.ID
+			err := DecryptFields(envMap[env.AES_KEY], &p.AadhaarNumber, &p.VID)
+			if err == nil {
+				err = indexProfile(envMap[env.BLIND_INDEX_KEY], &p)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error indexing profile %d: %v\n", p.ID, err)
+				return 1
+			}
+			if !*dryRun {
+				if err := repo.Duplicates.SetIndexes(ctx, &p); err != nil {
+					fmt.Fprintf(os.Stderr, "error updating profile %d: %v\n", p.ID, err)
+					return 1
+				}
+			}
+			filled++
+		}
+		if len(page) < backfillPageSize {
+			break
+		}
+	}
+	verb := "indexed"
+	if *dryRun {
+		verb = "would index"
+	}
+	fmt.Printf("%s %d profiles\n", verb, filled)
+	return 0
+}
+
+// importFile runs an import job over a file, as POST /api/admin/imports does.
+// A job that stops part way is resumed with --resume and the same file.
+func importFile(ctx context.Context, repo *repository.Repository, envMap map[string]string, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check every row and report the errors without creating anything")
+	format := flags.String("format", "", "csv or ndjson; taken from the file extension by default")
+	resume := flags.Int("resume", 0, "the ID of an import to resume")
+	errorsPath := flags.String("errors", "", "write the rejected rows of the import to this CSV file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = models.ImportCSV
+		case ".ndjson", ".jsonl":
+			*format = models.ImportNDJSON
+		}
+	}
+
+	auditLogger, err := newAuditLogger(repo, envMap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	var job *models.ImportJob
+	if *resume > 0 {
+		if job, err = repo.Imports.Get(ctx, *resume); err != nil {
+			if errors.Is(err, models.NotFound) {
+				fmt.Fprintf(os.Stderr, "no import with id %d\n", *resume)
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "error reading import: %v\n", err)
+			return 1
+		}
+	}
+	if job == nil && *format != models.ImportCSV && *format != models.ImportNDJSON {
+		fmt.Fprintln(os.Stderr, "--format must be csv or ndjson")
+		return 2
+	}
+	if job != nil {
+		*format = job.Format
+	}
+	rd, err := importer.NewReader(f, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	if job == nil {
+		job = &models.ImportJob{Format: *format, DryRun: *dryRun}
+		if err := repo.Imports.Create(ctx, job); err != nil {
+			fmt.Fprintf(os.Stderr, "error creating import: %v\n", err)
+			return 1
+		}
+	}
+
+	runner := &importRunner{repo: repo, audit: auditLogger, env: envMap, by: map[string]string{"by": "cli"}}
+	runErr := runner.run(ctx, job, rd)
+	verb := "created"
+	if job.DryRun {
+		verb = "would create"
+	}
+	fmt.Printf("import %d: read %d records up to line %d, %s %d accounts and %d profiles, rejected %d rows\n",
+		job.ID, job.Records, job.Line, verb, job.Users, job.Profiles, job.Failed)
+	if *errorsPath != "" {
+		if err := writeImportErrorFile(ctx, repo, job.ID, *errorsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing %s: %v\n", *errorsPath, err)
+			return 1
+		}
+	}
+	if errors.Is(runErr, errImportCompleted) || errors.Is(runErr, errImportMismatch) {
+		fmt.Fprintf(os.Stderr, "import %d: %v\n", job.ID, runErr)
+		return 1
+	}
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "import %d stopped: %v\nresume it with --resume %d\n", job.ID, runErr, job.ID)
+		return 1
+	}
+	return 0
+}
+
+func writeImportErrorFile(ctx context.Context, repo *repository.Repository, id int, path string) error {
+	errs, err := repo.Imports.Errors(ctx, id)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeImportErrors(f, errs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/store/memory"
+	"github.com/Raaffs/profileManager/server/migrations"
+)
+
+// fakeMigrator records how it was called.
+type fakeMigrator struct {
+	steps  int
+	dryRun bool
+	calls  int
+}
+
+func (m *fakeMigrator) Status(ctx context.Context) ([]migrations.Status, error) {
+	return nil, nil
+}
+
+func (m *fakeMigrator) Up(ctx context.Context, dryRun bool) ([]migrations.Migration, error) {
+	m.calls++
+	m.dryRun = dryRun
+	return nil, nil
+}
+
+func (m *fakeMigrator) Down(ctx context.Context, steps int, dryRun bool) ([]migrations.Migration, error) {
+	m.calls++
+	m.steps, m.dryRun = steps, dryRun
+	return nil, nil
+}
+
+func TestMigrate_Flags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		steps  int
+		dryRun bool
+	}{
+		{[]string{"down"}, 0, 1, false},
+		{[]string{"down", "3"}, 0, 3, false},
+		{[]string{"down", "--dry-run", "3"}, 0, 3, true},
+		{[]string{"down", "3", "--dry-run"}, 0, 3, true},
+		{[]string{"up", "--dry-run"}, 0, 0, true},
+		{[]string{"down", "3", "4"}, 2, 0, false},
+		{[]string{"down", "0"}, 2, 0, false},
+		{[]string{"up", "now"}, 2, 0, false},
+	}
+	for _, tt := range tests {
+		m := &fakeMigrator{}
+		code := migrate(context.Background(), m, tt.args)
+		if code != tt.code {
+			t.Errorf("migrate %v = %d; want %d", tt.args, code, tt.code)
+			continue
+		}
+		if code != 0 {
+			if m.calls != 0 {
+				t.Errorf("migrate %v ran the migrator", tt.args)
+			}
+			continue
+		}
+		if m.calls != 1 || m.steps != tt.steps || m.dryRun != tt.dryRun {
+			t.Errorf("migrate %v ran with %d steps, dry run %v; want %d, %v", tt.args, m.steps, m.dryRun, tt.steps, tt.dryRun)
+		}
+	}
+}
+
+func TestVerifyAudit_PublicKeyOnly(t *testing.T) {
+	ctx := context.Background()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := memory.NewRepo()
+	logger := audit.NewLogger(repo.Audit, key, 1)
+	for range 3 {
+		if err := logger.Log(ctx, 1, audit.ActionLogin, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		envMap map[string]string
+		code   int
+	}{
+		{"public key", map[string]string{env.AUDIT_VERIFY_KEY: audit.VerifyKey(key), env.AUDIT_CHECKPOINT_INTERVAL: "1"}, 0},
+		{"another key", map[string]string{env.AUDIT_VERIFY_KEY: base64.StdEncoding.EncodeToString(other), env.AUDIT_CHECKPOINT_INTERVAL: "1"}, 1},
+		{"default interval", map[string]string{env.AUDIT_VERIFY_KEY: audit.VerifyKey(key)}, 0},
+		{"invalid interval", map[string]string{env.AUDIT_VERIFY_KEY: audit.VerifyKey(key), env.AUDIT_CHECKPOINT_INTERVAL: "0"}, 2},
+		{"signing seed only", map[string]string{env.AUDIT_SIGNING_KEY: base64.StdEncoding.EncodeToString(key.Seed())}, 2},
+	}
+	for _, tt := range tests {
+		if code := verifyAudit(ctx, repo, tt.envMap); code != tt.code {
+			t.Errorf("verifyAudit() with %s = %d; want %d", tt.name, code, tt.code)
+		}
+	}
+}
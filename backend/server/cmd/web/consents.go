@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// consentRequiredError is returned by checkConsent when the user has not
+// consented to the purpose's current notice.
+type consentRequiredError struct {
+	purpose consent.Purpose
+}
+
+func (e consentRequiredError) Error() string {
+	return fmt.Sprintf("no consent to %s notice version %d", e.purpose.ID, e.purpose.Current().Version)
+}
+
+// purposeState is a purpose with its current notice and the user's consent to
+// it, if any.
+type purposeState struct {
+	Purpose string          `json:"purpose"`
+	Title   string          `json:"title"`
+	Notice  consent.Notice  `json:"notice"`
+	Consent *models.Consent `json:"consent"`
+	// Covered is whether the consent covers the notice in force
+	Covered bool `json:"covered"`
+}
+
+type grantRequest struct {
+	NoticeVersion int `json:"notice_version"`
+}
+
+// consentIDParam reads the :consentID of the receipt route.
+func consentIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("consentID"))
+	return id, err == nil && id > 0
+}
+
+// checkConsent returns nil if the user consented to the current notice of
+// purpose, and a consentRequiredError if not. Handlers call it before
+// processing data for a purpose and answer errors with consentError.
+func (app *Application) checkConsent(ctx context.Context, userID int, purpose string) error {
+	p, ok := app.consents.Purpose(purpose)
+	if !ok {
+		return fmt.Errorf("unknown consent purpose %q", purpose)
+	}
+	current, err := app.repo.Consents.Current(ctx, userID, purpose)
+	if errors.Is(err, models.NotFound) {
+		return consentRequiredError{p}
+	}
+	if err != nil {
+		return err
+	}
+	if !app.consents.Covers(current) {
+		return consentRequiredError{p}
+	}
+	return nil
+}
+
+// consentError answers a failed checkConsent. The response names the notice
+// to show, so the client can ask for consent and retry.
+func (app *Application) consentError(c echo.Context, err error) error {
+	var required consentRequiredError
+	if errors.As(err, &required) {
+		return c.JSON(http.StatusForbidden, map[string]any{
+			"error":          "consent to " + required.purpose.Title + " is required",
+			"purpose":        required.purpose.ID,
+			"notice_version": required.purpose.Current().Version,
+		})
+	}
+	app.health.SetStatus(StatusDegraded)
+	app.logger.Errorf("error checking consent \n%w", err)
+	return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+}
+
+// recordConsentAudit is recordAudit naming the purpose and notice version.
+func (app *Application) recordConsentAudit(c echo.Context, userID int, action string, given *models.Consent) {
+	details := map[string]string{
+		"ip":             c.RealIP(),
+		"purpose":        given.Purpose,
+		"notice_version": strconv.Itoa(given.NoticeVersion),
+	}
+	if err := app.audit.Log(c.Request().Context(), userID, action, details); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing audit record \n%w", err)
+	}
+}
+
+// ListConsents returns every purpose with the notice in force and where the
+// user stands on it.
+func (app *Application) ListConsents(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	ctx := c.Request().Context()
+	states := []purposeState{}
+	for _, p := range app.consents.Purposes() {
+		state := purposeState{Purpose: p.ID, Title: p.Title, Notice: p.Current()}
+		current, err := app.repo.Consents.Current(ctx, userID, p.ID)
+		switch {
+		case err == nil:
+			state.Consent = current
+			state.Covered = app.consents.Covers(current)
+		case !errors.Is(err, models.NotFound):
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error fetching consent \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		states = append(states, state)
+	}
+	return c.JSON(http.StatusOK, states)
+}
+
+// ConsentHistory returns every consent the user gave, including withdrawn
+// ones, oldest first.
+func (app *Application) ConsentHistory(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	list, err := app.repo.Consents.List(c.Request().Context(), userID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing consents \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if list == nil {
+		list = []models.Consent{}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// GrantConsent records consent to a purpose. The client sends the version of
+// the notice it showed; if that is no longer the one in force the grant is
+// refused, so nobody consents to a text they did not see. Granting again to
+// the same version changes nothing.
+func (app *Application) GrantConsent(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	p, ok := app.consents.Purpose(c.Param("purpose"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "unknown purpose"})
+	}
+	var input grantRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to consent request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if input.NoticeVersion != p.Current().Version {
+		return c.JSON(http.StatusConflict, map[string]any{
+			"error":          "the notice has changed, show the current one and ask again",
+			"notice_version": p.Current().Version,
+		})
+	}
+
+	ctx := c.Request().Context()
+	current, err := app.repo.Consents.Current(ctx, userID, p.ID)
+	if err == nil && current.NoticeVersion == input.NoticeVersion {
+		return c.JSON(http.StatusOK, current)
+	}
+	if err != nil && !errors.Is(err, models.NotFound) {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching consent \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	given := models.Consent{UserID: userID, Purpose: p.ID, NoticeVersion: input.NoticeVersion}
+	if err := app.repo.Consents.Grant(ctx, &given); err != nil {
+		switch {
+		case errors.Is(err, models.AlreadyExists):
+			return c.JSON(http.StatusConflict, map[string]string{"error": "consent to this purpose changed, reload and try again"})
+		case errors.Is(err, models.NotFound):
+			return c.JSON(http.StatusNotFound, map[string]HttpResponseMsg{"error": ErrNotFound})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error granting consent \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordConsentAudit(c, userID, audit.ActionConsentGrant, &given)
+	return c.JSON(http.StatusCreated, given)
+}
+
+// WithdrawConsent ends the user's consent to a purpose. Withdrawing is as
+// easy as consenting: no password and no reason.
+func (app *Application) WithdrawConsent(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	p, ok := app.consents.Purpose(c.Param("purpose"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "unknown purpose"})
+	}
+
+	withdrawn, err := app.repo.Consents.Withdraw(c.Request().Context(), userID, p.ID)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no consent to withdraw"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error withdrawing consent \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordConsentAudit(c, userID, audit.ActionConsentWithdraw, withdrawn)
+	return c.JSON(http.StatusOK, withdrawn)
+}
+
+// ConsentReceipt downloads the receipt of one consent as JSON.
+func (app *Application) ConsentReceipt(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := consentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "consent not found"})
+	}
+
+	ctx := c.Request().Context()
+	given, err := app.repo.Consents.Get(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "consent not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching consent \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	user, err := app.repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching user \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	receipt, err := app.consents.Receipt(user, given, time.Now().UTC())
+	if err != nil {
+		// the catalogue lost a purpose or a notice version it once published
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error making consent receipt \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="consent-receipt-%d.json"`, given.ID))
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, data)
+}
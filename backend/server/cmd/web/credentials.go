@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/vc"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ErrCredentialsOff = "credentials are not configured"
+	ErrNotVerified    = "only a verified profile can be issued a credential"
+)
+
+// credentialFields are what a credential may vouch for: the fields a KYC
+// review verifies, in models.ShareFields order. The free-form address is left
+// out, and so is the phone number, which reviews do not cover.
+var credentialFields = []string{
+	models.FieldFullName,
+	models.FieldDateOfBirth,
+	models.ShareYearOfBirth,
+	models.FieldAadhaarNumber,
+	models.FieldVID,
+}
+
+// Statuses the verification endpoint reports.
+const (
+	CredentialActive  = "active"
+	CredentialRevoked = "revoked"
+	CredentialExpired = "expired"
+	CredentialInvalid = "invalid"
+)
+
+// mediaTypeVCJWT is the media type of a credential in its JWT encoding.
+const mediaTypeVCJWT = "application/vc+jwt"
+
+// errNotVerified is returned out of the issuing transaction when the profile
+// is not verified.
+var errNotVerified = errors.New("profile is not verified")
+
+type credentialRequest struct {
+	Fields []string `json:"fields"`
+}
+
+type verifyRequest struct {
+	Credential string `json:"credential"`
+}
+
+func credentialIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("credentialID"))
+	return id, err == nil && id > 0
+}
+
+// credentialsOff answers credential requests when VC_ISSUER_DOMAIN or
+// VC_SIGNING_KEY is unset.
+func (app *Application) credentialsOff(c echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": ErrCredentialsOff})
+}
+
+// fieldsEdited is kyc FieldsEdited that also revokes the credentials of a
+// profile an edit sends back for review, since they vouch for the old values.
+func (app *Application) fieldsEdited(ctx context.Context, tx *repository.Repository, profileID int, changed []string) (bool, error) {
+	reopened, err := app.kyc.In(tx).FieldsEdited(ctx, profileID, changed)
+	if err != nil || !reopened {
+		return reopened, err
+	}
+	_, err = tx.Credentials.RevokeProfile(ctx, profileID)
+	return true, err
+}
+
+// recordCredentialAudit is recordProfileAudit naming the credential as well.
+func (app *Application) recordCredentialAudit(c echo.Context, cred *models.Credential, action string) {
+	details := map[string]string{
+		"ip":            c.RealIP(),
+		"profile_id":    strconv.Itoa(cred.ProfileID),
+		"credential_id": strconv.Itoa(cred.ID),
+	}
+	if err := app.audit.Log(c.Request().Context(), cred.UserID, action, details); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing audit record \n%w", err)
+	}
+}
+
+// IssueCredential signs the chosen fields of a verified profile as a
+// Verifiable Credential, valid until the verification expires. The signed
+// credential is returned once and not kept.
+func (app *Application) IssueCredential(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	var input credentialRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to credential request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	fields, err := pickFields(credentialFields, input.Fields, "included in a credential")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	// The KYC row stays locked until the credential is recorded. An edit that
+	// reopens the profile either commits first, and the profile is found not
+	// verified, or waits for the lock and then revokes the new credential.
+	// The profile is read again under the lock, so the credential vouches for
+	// the values that were verified.
+	ctx := c.Request().Context()
+	cred := models.Credential{UserID: userID, ProfileID: profile.ID, Fields: fields}
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		k, err := tx.KYC.GetForUpdate(ctx, profile.ID)
+		if errors.Is(err, models.NotFound) || (err == nil && k.Status != models.KYCVerified) {
+			return errNotVerified
+		}
+		if err != nil {
+			return err
+		}
+		// the expiry worker may not have run yet
+		if cred.ExpiresAt = app.kyc.ValidUntil(k); !time.Now().Before(cred.ExpiresAt) {
+			return errNotVerified
+		}
+		profile, err := tx.Profiles.Get(ctx, userID, profile.ID)
+		if err != nil {
+			return err
+		}
+		if err := DecryptFields(app.env[env.AES_KEY], &profile.AadhaarNumber, &profile.VID); err != nil {
+			return cipherError{err}
+		}
+		if err := tx.Credentials.Create(ctx, &cred); err != nil {
+			return err
+		}
+
+		subject := map[string]any{"kyc_verified_at": k.VerifiedAt.UTC().Format(time.RFC3339)}
+		for f, v := range projectProfile(profile, fields) {
+			subject[f] = v
+		}
+		cred.JWT, err = app.issuer.Issue(subject, cred.ID, cred.IssuedAt, cred.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errNotVerified) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrNotVerified})
+		}
+		if errors.Is(err, models.NotFound) {
+			return app.profileLoadError(c, err)
+		}
+		var cerr cipherError
+		if errors.As(err, &cerr) {
+			app.health.SetStatus(StatusCritical)
+			app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", cerr.err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error issuing credential \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordCredentialAudit(c, &cred, audit.ActionCredentialIssue)
+	return c.JSON(http.StatusCreated, cred)
+}
+
+// ListCredentials returns the credentials issued for a profile, newest first.
+func (app *Application) ListCredentials(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	credentials, err := app.repo.Credentials.List(c.Request().Context(), userID, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing credentials \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if credentials == nil {
+		credentials = []models.Credential{}
+	}
+	return c.JSON(http.StatusOK, credentials)
+}
+
+// RevokeCredential sets the bit of a credential in its status list, so that
+// verifiers stop accepting it.
+func (app *Application) RevokeCredential(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	id, ok := credentialIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "credential not found"})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	ctx := c.Request().Context()
+	cred, err := app.repo.Credentials.Get(ctx, id)
+	if err == nil && (cred.UserID != userID || cred.ProfileID != profile.ID) {
+		err = models.NotFound
+	}
+	if err == nil {
+		cred, err = app.repo.Credentials.Revoke(ctx, userID, id)
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "credential not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error revoking credential \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordCredentialAudit(c, cred, audit.ActionCredentialRevoke)
+	return c.JSON(http.StatusOK, cred)
+}
+
+// DIDDocument serves the issuer's DID document, which is where did:web
+// resolves to and where verifiers find its public key.
+func (app *Application) DIDDocument(c echo.Context) error {
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	return c.JSON(http.StatusOK, app.issuer.Document())
+}
+
+// CredentialStatusList serves a signed StatusList2021 credential. Bits are
+// set for revoked credentials and for those whose profile is gone.
+func (app *Application) CredentialStatusList(c echo.Context) error {
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	list, err := strconv.Atoi(c.Param("list"))
+	if err != nil || list < 1 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "status list not found"})
+	}
+	first := vc.ID(list, 0)
+	ids, err := app.repo.Credentials.Revoked(c.Request().Context(), first, vc.ID(list, vc.ListSize-1))
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error reading revoked credentials \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	indexes := make([]int, len(ids))
+	for i, id := range ids {
+		indexes[i] = id - first
+	}
+	token, err := app.issuer.StatusList(list, indexes, time.Now())
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error signing status list \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	// revocations show up within a minute
+	c.Response().Header().Set("Cache-Control", "public, max-age=60")
+	return c.Blob(http.StatusOK, mediaTypeVCJWT, []byte(token))
+}
+
+// VerifyCredential checks a credential for a verifier that does not resolve
+// the DID and status list itself: the signature and issuer, the expiration
+// date, and whether it was revoked.
+func (app *Application) VerifyCredential(c echo.Context) error {
+	if app.issuer == nil {
+		return app.credentialsOff(c)
+	}
+	var input verifyRequest
+	if err := c.Bind(&input); err != nil || input.Credential == "" {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	status := CredentialActive
+	claims, err := app.issuer.Verify(input.Credential, time.Now())
+	if errors.Is(err, vc.ErrExpired) {
+		status, err = CredentialExpired, nil
+	}
+	var id int
+	if err == nil {
+		id, err = claims.CredentialID()
+	}
+	if err != nil {
+		return c.JSON(http.StatusOK, map[string]any{"verified": false, "status": CredentialInvalid})
+	}
+
+	cred, err := app.repo.Credentials.Get(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusOK, map[string]any{"verified": false, "status": CredentialInvalid})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching credential \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if cred.RevokedAt != nil || cred.ProfileID == 0 {
+		status = CredentialRevoked
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"verified":           status == CredentialActive,
+		"status":             status,
+		"issuer":             claims.Issuer,
+		"issued_at":          claims.IssuedAt.Time,
+		"expires_at":         claims.ExpiresAt.Time,
+		"credential_subject": claims.VC.CredentialSubject,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/store/postgres"
+	"github.com/Raaffs/profileManager/server/internal/store/sqlite"
+	"github.com/Raaffs/profileManager/server/migrations"
+)
+
+// migrator is implemented by each store's schema migrator.
+type migrator interface {
+	Status(ctx context.Context) ([]migrations.Status, error)
+	Up(ctx context.Context, dryRun bool) ([]migrations.Migration, error)
+	Down(ctx context.Context, steps int, dryRun bool) ([]migrations.Migration, error)
+}
+
+type database struct {
+	repo     *repository.Repository
+	migrator migrator
+	close    func()
+}
+
+// openDatabase picks the store from the DB_URL scheme: sqlite: URLs open a
+// SQLite file, anything else is handed to pgx.
+func openDatabase(ctx context.Context, dbURL string) (*database, error) {
+	if strings.HasPrefix(dbURL, "sqlite:") {
+		db, err := sqlite.Open(ctx, dbURL)
+		if err != nil {
+			return nil, err
+		}
+		m, err := sqlite.NewMigrator(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &database{repo: sqlite.NewRepo(db), migrator: m, close: func() { db.Close() }}, nil
+	}
+
+	pool, err := connectWithRetry(ctx, dbURL)
+	if err != nil {
+		return nil, err
+	}
+	m, err := store.NewMigrator(pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &database{repo: store.NewPostgresRepo(pool), migrator: m, close: pool.Close}, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/cipher"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ErrDocumentTypeTaken   = "this profile already has a document of that type"
+	ErrDocumentNumberTaken = "this document number is already registered"
+)
+
+// ValidateDocument normalizes the document number in place and checks it
+// against the format of its type. Only passports and driving licences expire.
+func ValidateDocument(d *models.IdentityDocument) *utils.Validator {
+	d.Number = utils.NormalizeDocumentNumber(d.Number)
+
+	validate := utils.NewValidator()
+	validate.IdentityDocument(d.Type, d.Number)
+	validate.Check(
+		d.ExpiresOn == nil || d.Type == models.DocumentPassport || d.Type == models.DocumentDrivingLicence,
+		"expires_on", "only passports and driving licences have an expiry date",
+	)
+	return validate
+}
+
+// sealDocument fills in the blind index of d's number and encrypts it. The
+// index is keyed by type, so it only ever matches a number of the same type.
+func (app *Application) sealDocument(d *models.IdentityDocument) error {
+	index, err := cipher.BlindIndex(app.env[env.BLIND_INDEX_KEY], "document:"+d.Type, d.Number)
+	if err != nil {
+		return err
+	}
+	d.NumberIndex = index
+	return EncryptFields(app.env[env.AES_KEY], &d.Number)
+}
+
+// documentIDParam reads the :documentID of the document routes.
+func documentIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("documentID"))
+	return id, err == nil && id > 0
+}
+
+// ListDocuments returns the identity documents of the profile in the path, or
+// of the primary profile, with their numbers decrypted.
+func (app *Application) ListDocuments(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	docs, err := app.repo.Documents.List(c.Request().Context(), profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing identity documents \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	for i := range docs {
+		if err := DecryptFields(app.env[env.AES_KEY], &docs[i].Number); err != nil {
+			app.health.SetStatus(StatusCritical)
+			app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+	}
+	return c.JSON(http.StatusOK, docs)
+}
+
+func (app *Application) GetDocument(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := documentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	doc, err := app.repo.Documents.Get(c.Request().Context(), profile.ID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching identity document \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if err := DecryptFields(app.env[env.AES_KEY], &doc.Number); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, doc)
+}
+
+func (app *Application) CreateDocument(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	var doc models.IdentityDocument
+	if err := c.Bind(&doc); err != nil {
+		app.logger.Errorf("error binding json to type identity document \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if validate := ValidateDocument(&doc); !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+
+	ctx := c.Request().Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	// both unique constraints surface as AlreadyExists, so tell them apart
+	// here to give a useful message
+	existing, err := app.repo.Documents.List(ctx, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing identity documents \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if slices.ContainsFunc(existing, func(d models.IdentityDocument) bool { return d.Type == doc.Type }) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": ErrDocumentTypeTaken})
+	}
+
+	number := doc.Number
+	doc.ID, doc.ProfileID = 0, profile.ID
+	if err := app.sealDocument(&doc); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Documents.Create(ctx, &doc); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldDocuments})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrDocumentNumberTaken})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating identity document \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionDocumentCreate)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	doc.Number = number
+	return c.JSON(http.StatusCreated, doc)
+}
+
+// UpdateDocument replaces the number and expiry of a document, for example
+// after a passport is renewed. The type is fixed at creation.
+func (app *Application) UpdateDocument(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := documentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+	}
+
+	var doc models.IdentityDocument
+	if err := c.Bind(&doc); err != nil {
+		app.logger.Errorf("error binding json to type identity document \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	ctx := c.Request().Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	current, err := app.repo.Documents.Get(ctx, profile.ID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching identity document \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if doc.Type != "" && doc.Type != current.Type {
+		return c.JSON(http.StatusBadRequest, map[string]string{"type": "the type of a document cannot change"})
+	}
+	doc.Type = current.Type
+	if validate := ValidateDocument(&doc); !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+
+	number := doc.Number
+	doc.ID, doc.ProfileID = id, profile.ID
+	if err := app.sealDocument(&doc); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Documents.Update(ctx, &doc); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldDocuments})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+		}
+		if errors.Is(err, models.AlreadyExists) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrDocumentNumberTaken})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error updating identity document \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionDocumentUpdate)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	doc.Number = number
+	return c.JSON(http.StatusOK, doc)
+}
+
+func (app *Application) DeleteDocument(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := documentIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	ctx := c.Request().Context()
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Documents.Delete(ctx, profile.ID, id); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, profile.ID, []string{models.FieldDocuments})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting identity document \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionDocumentDelete)
+	app.reopenKYC(c, userID, profile.ID, reopened)
+	return c.JSON(http.StatusOK, map[string]string{"message": "document deleted successfully"})
+}
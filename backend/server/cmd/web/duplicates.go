@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/dedupe"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxDuplicateCandidates bounds the profiles a write is compared with.
+	// Index matches come first, so only same-birthday name comparisons are
+	// cut short on a very common date of birth.
+	maxDuplicateCandidates = 500
+	// maxDuplicateQueue caps a page of the review queue.
+	maxDuplicateQueue = 100
+)
+
+// identityFields are the fields duplicate detection looks at; an edit to
+// any other field is not checked again.
+var identityFields = []string{models.FieldFullName, models.FieldDateOfBirth, models.FieldAadhaarNumber, models.FieldPhoneNumber}
+
+// flagDuplicates compares a profile that was just written with the profiles
+// of other accounts and puts likely duplicates in the admin review queue.
+// The write itself stands either way, so a failure here is logged rather
+// than returned. p must carry its blind indexes and plaintext name.
+func (app *Application) flagDuplicates(c echo.Context, userID int, p *models.Profile) {
+	pending, err := findDuplicates(c.Request().Context(), app.repo, p)
+	for range pending {
+		app.recordProfileAudit(c, userID, p.ID, audit.ActionDuplicateFlag)
+	}
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error flagging duplicate profiles \n%w", err)
+	}
+}
+
+// findDuplicates is the work of flagDuplicates against repo, which may be a
+// transaction. It returns the pairs it left pending review, including those
+// it flagged before an error.
+func findDuplicates(ctx context.Context, repo *repository.Repository, p *models.Profile) ([]models.Duplicate, error) {
+	candidates, err := repo.Duplicates.Candidates(ctx, p, maxDuplicateCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("finding duplicate candidates: %w", err)
+	}
+	var pending []models.Duplicate
+	for _, other := range candidates {
+		reasons, score := dedupe.Compare(p, &other)
+		if len(reasons) == 0 {
+			continue
+		}
+		d := models.Duplicate{
+			ProfileID: min(p.ID, other.ID),
+			MatchID:   max(p.ID, other.ID),
+			Reasons:   reasons,
+			Score:     score,
+		}
+		if err := repo.Duplicates.Flag(ctx, &d); err != nil {
+			if errors.Is(err, models.NotFound) {
+				// one of the two was purged in the meantime
+				continue
+			}
+			return pending, err
+		}
+		if d.Status == models.DuplicatePending {
+			pending = append(pending, d)
+		}
+	}
+	return pending, nil
+}
+
+// flagEditedDuplicates is flagDuplicates for an update, skipped when no
+// identity field changed.
+func (app *Application) flagEditedDuplicates(c echo.Context, userID int, p *models.Profile, changed []string) {
+	if slices.ContainsFunc(changed, func(f string) bool { return slices.Contains(identityFields, f) }) {
+		app.flagDuplicates(c, userID, p)
+	}
+}
+
+func duplicateIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("duplicateID"))
+	return id, err == nil && id > 0
+}
+
+// DuplicateQueue lists the pending pairs of likely duplicate profiles, oldest
+// first, up to ?limit.
+func (app *Application) DuplicateQueue(c echo.Context) error {
+	limit := maxDuplicateQueue
+	if param := c.QueryParam("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxDuplicateQueue {
+			return c.JSON(http.StatusBadRequest, map[string]string{"limit": "must be between 1 and " + strconv.Itoa(maxDuplicateQueue)})
+		}
+		limit = n
+	}
+	queue, err := app.repo.Duplicates.Queue(c.Request().Context(), limit)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing the duplicate queue \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, queue)
+}
+
+// ReviewDuplicate returns a pair with both profiles side by side, their
+// Aadhaar numbers and VIDs masked to the last four digits. The pair's
+// reasons say whether the full numbers match.
+func (app *Application) ReviewDuplicate(c echo.Context) error {
+	id, ok := duplicateIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "duplicate not found"})
+	}
+	ctx := c.Request().Context()
+	d, err := app.repo.Duplicates.Get(ctx, id)
+	var profiles []models.Profile
+	if err == nil {
+		profiles, err = app.repo.Duplicates.Pair(ctx, d)
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "duplicate not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching duplicate \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	for i := range profiles {
+		p := &profiles[i]
+		if err := DecryptFields(app.env[env.AES_KEY], &p.AadhaarNumber, &p.VID); err != nil {
+			app.health.SetStatus(StatusCritical)
+			app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		if p.AadhaarNumber != "" {
+			p.AadhaarNumber = utils.MaskAadhaar(p.AadhaarNumber)
+		}
+		if p.VID != "" {
+			p.VID = utils.MaskVID(p.VID)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"duplicate": d,
+		"profiles":  profiles,
+	})
+}
+
+// ResolveDuplicate records an admin's decision on a pending pair: status
+// "duplicate" if the two profiles are the same person, "distinct" if not.
+// Acting on a duplicate, such as deleting one of the accounts, is left to
+// the admin.
+func (app *Application) ResolveDuplicate(c echo.Context) error {
+	adminID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, ok := duplicateIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "duplicate not found"})
+	}
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		app.logger.Errorf("error binding json to type duplicate resolution \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if req.Status != models.DuplicateSame && req.Status != models.DuplicateDistinct {
+		return c.JSON(http.StatusBadRequest, map[string]string{"status": "must be duplicate or distinct"})
+	}
+
+	ctx := c.Request().Context()
+	d := models.Duplicate{ID: id, Status: req.Status, ReviewerID: &adminID, Note: req.Note}
+	if err := app.repo.Duplicates.Resolve(ctx, &d); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "duplicate not found"})
+		}
+		if errors.Is(err, models.VersionConflict) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "this pair has already been resolved"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error resolving duplicate \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	// file the decision under both accounts
+	profiles, err := app.repo.Duplicates.Pair(ctx, &d)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching duplicate profiles \n%w", err)
+	}
+	for _, p := range profiles {
+		app.recordAdminAudit(c, p.UserID, audit.ActionDuplicateResolve)
+	}
+	return c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/ekyc"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// maxEKYCArchive caps eKYC uploads. Archives are compressed, so this is well
+// above ekyc.MaxDocumentSize in practice.
+const maxEKYCArchive = 2 << 20
+
+const (
+	ekycVerify  = "verify"
+	ekycPrefill = "prefill"
+)
+
+// ekycFields are the profile fields a verified eKYC document can prefill.
+var ekycFields = []string{models.FieldFullName, models.FieldDateOfBirth, models.FieldAddress}
+
+// sameName compares names ignoring case, dots and extra spaces, so
+// "A. K. Rao" matches "a k rao".
+func sameName(a, b string) bool {
+	norm := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(s, ".", " "))), " ")
+	}
+	return norm(a) == norm(b)
+}
+
+// matchEKYC compares a decrypted profile against a verified document. The
+// free-text and structured addresses are too varied to compare line by line,
+// so an address matches on its PIN code.
+func matchEKYC(p *models.Profile, addresses []models.Address, rec *ekyc.Record, shareCode string) models.EKYCVerification {
+	pin := rec.Address.PinCode
+	v := models.EKYCVerification{
+		ProfileID:        p.ID,
+		ReferenceHash:    rec.ReferenceHash(),
+		DocumentHash:     rec.Digest,
+		MobileHash:       rec.MobileHash,
+		EmailHash:        rec.EmailHash,
+		GeneratedAt:      rec.GeneratedAt,
+		NameMatch:        sameName(p.FullName, rec.Name),
+		DateOfBirthMatch: p.DateOfBirth.Format("2006-01-02") == rec.DateOfBirth.Format("2006-01-02"),
+		AddressMatch: pin != "" && (strings.Contains(p.Address, pin) ||
+			slices.ContainsFunc(addresses, func(a models.Address) bool { return a.PinCode == pin })),
+		AadhaarMatch: p.AadhaarNumber != "" && strings.HasSuffix(p.AadhaarNumber, rec.Last4),
+		MobileMatch:  rec.MatchMobile(p.PhoneNumber, shareCode),
+	}
+	v.Verified = v.NameMatch && v.DateOfBirthMatch && v.AadhaarMatch
+	return v
+}
+
+// UploadEKYC takes a UIDAI offline eKYC archive as the multipart "file" with
+// its "share_code", verifies the signature and checks the document against
+// the profile, prefilling it first with mode=prefill. Only hashes of the
+// document are kept.
+func (app *Application) UploadEKYC(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.ekyc == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "offline eKYC is not configured"})
+	}
+	if err := app.checkConsent(c.Request().Context(), userID, consent.PurposeKYC); err != nil {
+		return app.consentError(c, err)
+	}
+
+	mode := c.FormValue("mode")
+	if mode == "" {
+		mode = ekycVerify
+	}
+	shareCode := c.FormValue("share_code")
+	validate := utils.NewValidator()
+	validate.Check(mode == ekycVerify || mode == ekycPrefill, "mode", "must be verify or prefill")
+	validate.Check(shareCode != "", "share_code", utils.ErrFieldRequired.Message)
+	file, err := c.FormFile("file")
+	validate.Check(err == nil, "file", utils.ErrFieldRequired.Message)
+	if !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+	if file.Size > maxEKYCArchive {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "eKYC archive is too large"})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	archive, err := io.ReadAll(io.LimitReader(f, maxEKYCArchive))
+	f.Close()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	rec, err := app.ekyc.ReadArchive(archive, shareCode)
+	switch {
+	case errors.Is(err, ekyc.ErrShareCode):
+		return c.JSON(http.StatusBadRequest, map[string]string{"share_code": "the share code does not open this archive"})
+	case errors.Is(err, ekyc.ErrSignature):
+		app.logger.Errorf("eKYC signature rejected \n%w", err)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "the eKYC document is not signed by UIDAI"})
+	case err != nil:
+		return c.JSON(http.StatusBadRequest, map[string]string{"file": err.Error()})
+	}
+
+	return app.checkEKYC(c, userID, rec, models.EKYCSourceXML, shareCode, mode)
+}
+
+// ekycDocument is what a verified document says, as returned to its holder.
+// Only the last four digits of the Aadhaar number are shown.
+type ekycDocument struct {
+	Name        string       `json:"name"`
+	DateOfBirth string       `json:"date_of_birth"`
+	Gender      string       `json:"gender"`
+	Reference   string       `json:"reference"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Address     ekyc.Address `json:"address"`
+}
+
+// checkEKYC cross-checks a verified document against the profile in the
+// request and records the outcome. With mode prefill the profile's name, date
+// of birth and address are first overwritten from the document.
+func (app *Application) checkEKYC(c echo.Context, userID int, rec *ekyc.Record, source, shareCode, mode string) error {
+	ctx := c.Request().Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	addresses, err := app.repo.Addresses.List(ctx, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing addresses \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	// Patch writes only the prefilled fields, so the encrypted numbers in
+	// profile go back untouched
+	var changed []string
+	if mode == ekycPrefill {
+		validate := utils.NewValidator()
+		validate.NameLength(rec.Name, 3, 20)
+		if !validate.Valid() {
+			return c.JSON(http.StatusBadRequest, validate.Errors)
+		}
+		before := *profile
+		profile.FullName = rec.Name
+		profile.DateOfBirth = rec.DateOfBirth
+		profile.Address = rec.Address.String()
+		changed = changedFields(&before, profile)
+	}
+	plain := *profile
+	if err := DecryptFields(app.env[env.AES_KEY], &plain.AadhaarNumber); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	verification := matchEKYC(&plain, addresses, rec, shareCode)
+	verification.Source = source
+
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if mode == ekycPrefill {
+			if err := tx.Profiles.Patch(ctx, profile, ekycFields); err != nil {
+				return err
+			}
+			if reopened, err = app.fieldsEdited(ctx, tx, profile.ID, changed); err != nil {
+				return err
+			}
+		}
+		return tx.EKYC.Create(ctx, &verification)
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		if errors.Is(err, models.VersionConflict) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrStaleProfile})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error recording eKYC verification \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionEKYCVerify)
+	prefilled := []string{}
+	if mode == ekycPrefill {
+		app.recordProfileAudit(c, userID, profile.ID, audit.ActionProfileUpdate)
+		app.reopenKYC(c, userID, profile.ID, reopened)
+		c.Response().Header().Set(HeaderETag, profileETag(profile))
+		prefilled = ekycFields
+	}
+	return c.JSON(http.StatusCreated, map[string]any{
+		"document": ekycDocument{
+			Name:        rec.Name,
+			DateOfBirth: rec.DateOfBirth.Format("2006-01-02"),
+			Gender:      rec.Gender,
+			Reference:   utils.MaskAadhaar("XXXXXXXX" + rec.Last4),
+			GeneratedAt: rec.GeneratedAt,
+			Address:     rec.Address,
+		},
+		"verification": verification,
+		"prefilled":    prefilled,
+	})
+}
+
+// DecodeAadhaarQR takes the decimal payload of the Secure QR code on an
+// Aadhaar letter, as read by the client's scanner, verifies its signature and
+// checks it against the profile the same way as UploadEKYC. The code holds no
+// share code, so mode=prefill needs nothing more.
+func (app *Application) DecodeAadhaarQR(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.aadhaarQR == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Aadhaar QR verification is not configured"})
+	}
+	if err := app.checkConsent(c.Request().Context(), userID, consent.PurposeKYC); err != nil {
+		return app.consentError(c, err)
+	}
+
+	var req struct {
+		Payload string `json:"payload"`
+		Mode    string `json:"mode"`
+	}
+	if err := c.Bind(&req); err != nil {
+		app.logger.Errorf("error binding json to type aadhaar qr request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if req.Mode == "" {
+		req.Mode = ekycVerify
+	}
+	validate := utils.NewValidator()
+	validate.Check(req.Mode == ekycVerify || req.Mode == ekycPrefill, "mode", "must be verify or prefill")
+	validate.Check(req.Payload != "", "payload", utils.ErrFieldRequired.Message)
+	if !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+
+	rec, err := app.aadhaarQR.Decode(req.Payload)
+	switch {
+	case errors.Is(err, ekyc.ErrSignature):
+		app.logger.Errorf("Aadhaar QR signature rejected \n%w", err)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "the QR code is not signed by UIDAI"})
+	case err != nil:
+		return c.JSON(http.StatusBadRequest, map[string]string{"payload": err.Error()})
+	}
+	return app.checkEKYC(c, userID, rec, models.EKYCSourceQR, "", req.Mode)
+}
+
+// ListEKYC returns the eKYC verifications of a profile, newest first.
+func (app *Application) ListEKYC(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	list, err := app.repo.EKYC.List(c.Request().Context(), profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing eKYC verifications \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, list)
+}
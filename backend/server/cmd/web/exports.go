@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/photo"
+	"github.com/Raaffs/profileManager/server/internal/takeout"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// exportTimeout bounds building one archive. Exports still pending after
+	// it were cut off by a restart and are failed by the purge worker.
+	exportTimeout = 15 * time.Minute
+	// exportTTL is how long a finished archive waits to be downloaded.
+	exportTTL = 72 * time.Hour
+	// auditPageSize is how many audit records are read at a time.
+	auditPageSize = 1000
+
+	minPassphraseLength = 12
+	maxPassphraseLength = 128
+)
+
+const (
+	ErrExportPending    = "an export of this account is already being prepared"
+	ErrExportPassphrase = "the passphrase must be 12 to 128 characters"
+)
+
+type exportRequest struct {
+	Password   string `json:"password"`
+	Passphrase string `json:"passphrase"`
+}
+
+// exportStatus is an export with, once it is ready, the link to download it.
+type exportStatus struct {
+	models.Export
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// exportIDParam reads the :exportID of the export routes.
+func exportIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("exportID"))
+	return id, err == nil && id > 0
+}
+
+// newExportBlobKey picks a random key under the account's prefix.
+func newExportBlobKey(userID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("exports/%d/%s", userID, hex.EncodeToString(b)), nil
+}
+
+// CreateExport starts building a copy of everything held about the account.
+// The password is checked again, since the archive holds every decrypted
+// field. The archive is encrypted with the passphrase, which is never stored:
+// losing it means asking for a new export.
+func (app *Application) CreateExport(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+
+	var input exportRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to export request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if n := utf8.RuneCountInString(input.Passphrase); n < minPassphraseLength || n > maxPassphraseLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{"passphrase": ErrExportPassphrase})
+	}
+
+	ctx := c.Request().Context()
+	if _, err := app.reauthenticate(ctx, userID, input.Password); err != nil {
+		if errors.Is(err, ErrReauthFailed) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "incorrect password"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error re-authenticating user \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	e := models.Export{UserID: userID}
+	if err := app.repo.Exports.Create(ctx, &e); err != nil {
+		switch {
+		case errors.Is(err, models.AlreadyExists):
+			return c.JSON(http.StatusConflict, map[string]string{"error": ErrExportPending})
+		case errors.Is(err, models.NotFound):
+			return c.JSON(http.StatusNotFound, map[string]HttpResponseMsg{"error": ErrNotFound})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating export \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordAudit(c, userID, audit.ActionAccountExport)
+
+	// the request is over long before the archive is, so the job keeps the
+	// request's values but not its cancellation
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), exportTimeout)
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		defer cancel()
+		app.buildExport(jobCtx, e, input.Passphrase)
+	}()
+
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/restricted/account/export/%d", e.ID))
+	return c.JSON(http.StatusAccepted, e)
+}
+
+// GetExport reports how an export is going. Once it is ready it carries a
+// short-lived link; the archive itself can be downloaded only once.
+func (app *Application) GetExport(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	id, ok := exportIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found"})
+	}
+
+	e, err := app.repo.Exports.Get(c.Request().Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching export \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	status := exportStatus{Export: *e}
+	if e.Status == models.ExportReady && e.ExpiresAt.After(time.Now()) {
+		token, expires := app.downloads.Sign(fileSubject(fileExport, userID, e.ID), app.downloadTTL)
+		status.URL = "/api/files/" + token
+		status.URLExpiresAt = &expires
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// serveExport sends an archive and deletes it. The export is marked
+// downloaded before it is sent, so two uses of one link cannot both get it; a
+// download that fails half way means asking for a new export.
+func (app *Application) serveExport(c echo.Context, userID, id int) error {
+	ctx := c.Request().Context()
+	e, err := app.repo.Exports.Download(ctx, userID, id, time.Now())
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusGone, map[string]string{"error": ErrDownloadURLExpired})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching export \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordAudit(c, userID, audit.ActionAccountExportDownload)
+
+	err = app.serveBlob(c, e.BlobKey, e.DataKey, e.Size, "application/zip", "attachment", fmt.Sprintf("account-%d-export-%d.zip", userID, e.ID))
+	app.deleteBlob(context.WithoutCancel(ctx), e.BlobKey)
+	return err
+}
+
+// buildExport assembles the archive of an export and stores it sealed in the
+// blob store. Whatever happens, the export ends ready or failed.
+func (app *Application) buildExport(ctx context.Context, e models.Export, passphrase string) {
+	if err := app.writeExport(ctx, &e, passphrase); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error building export %d \n%w", e.ID, err)
+		if e.BlobKey != "" {
+			app.deleteBlob(ctx, e.BlobKey)
+		}
+		failed := models.Export{ID: e.ID, Status: models.ExportFailed}
+		if err := app.repo.Exports.Finish(ctx, &failed); err != nil && !errors.Is(err, models.NotFound) {
+			app.logger.Errorf("error failing export %d \n%w", e.ID, err)
+		}
+	}
+}
+
+func (app *Application) writeExport(ctx context.Context, e *models.Export, passphrase string) error {
+	data, err := app.collectExport(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+	var archive bytes.Buffer
+	if err := takeout.Write(&archive, passphrase, data); err != nil {
+		return err
+	}
+
+	key, err := newExportBlobKey(e.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, dataKey, err := blob.Seal(archive.Bytes(), key)
+	if err == nil {
+		e.DataKey, err = app.wrapDataKey(dataKey)
+	}
+	if err != nil {
+		app.health.SetStatus(StatusCritical)
+		return fmt.Errorf("CRITICAL ERROR: cipher failure: %w", err)
+	}
+	if err := app.blobs.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed))); err != nil {
+		return err
+	}
+	e.BlobKey = key
+
+	expires := time.Now().Add(exportTTL)
+	e.Status = models.ExportReady
+	e.Size = int64(archive.Len())
+	e.ExpiresAt = &expires
+	return app.repo.Exports.Finish(ctx, e)
+}
+
+// collectExport gathers everything held about an account, decrypted.
+func (app *Application) collectExport(ctx context.Context, userID int) (*takeout.Data, error) {
+	user, err := app.repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	d := &takeout.Data{GeneratedAt: time.Now().UTC(), Account: *user}
+
+	profiles, err := app.repo.Profiles.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	d.Profiles = []takeout.Profile{}
+	for _, p := range profiles {
+		tp, err := app.collectProfile(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("profile %d: %w", p.ID, err)
+		}
+		d.Profiles = append(d.Profiles, *tp)
+	}
+
+	if d.Consents, err = app.repo.Consents.List(ctx, userID); err != nil {
+		return nil, err
+	}
+	if d.Consents == nil {
+		d.Consents = []models.Consent{}
+	}
+
+	d.Logins, d.Audit = []takeout.Login{}, []models.AuditRecord{}
+	for after := int64(0); ; {
+		page, err := app.repo.Audit.ForUser(ctx, userID, after, auditPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range page {
+			d.Audit = append(d.Audit, rec)
+			if rec.Action == audit.ActionLogin || rec.Action == audit.ActionLoginFailed {
+				var details struct {
+					IP string `json:"ip"`
+				}
+				json.Unmarshal([]byte(rec.Details), &details)
+				d.Logins = append(d.Logins, takeout.Login{At: rec.CreatedAt, Succeeded: rec.Action == audit.ActionLogin, IP: details.IP})
+			}
+		}
+		if len(page) < auditPageSize {
+			break
+		}
+		after = page[len(page)-1].Seq
+	}
+	return d, nil
+}
+
+func (app *Application) collectProfile(ctx context.Context, p models.Profile) (*takeout.Profile, error) {
+	key := app.env[env.AES_KEY]
+	if err := DecryptFields(key, &p.AadhaarNumber, &p.VID); err != nil {
+		return nil, err
+	}
+	tp := &takeout.Profile{Profile: p}
+
+	var err error
+	if tp.Addresses, err = app.repo.Addresses.List(ctx, p.ID); err != nil {
+		return nil, err
+	}
+	if tp.Documents, err = app.repo.Documents.List(ctx, p.ID); err != nil {
+		return nil, err
+	}
+	for i := range tp.Documents {
+		if err := DecryptFields(key, &tp.Documents[i].Number); err != nil {
+			return nil, err
+		}
+	}
+	if tp.EKYC, err = app.repo.EKYC.List(ctx, p.ID); err != nil {
+		return nil, err
+	}
+	switch tp.KYC, err = app.repo.KYC.Get(ctx, p.ID); {
+	case errors.Is(err, models.NotFound):
+		tp.KYC = nil
+	case err != nil:
+		return nil, err
+	}
+
+	attachments, err := app.repo.Attachments.List(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	tp.Attachments = []takeout.Attachment{}
+	for _, a := range attachments {
+		data, err := app.readBlob(ctx, a.BlobKey, a.DataKey, a.Size)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", a.ID, err)
+		}
+		tp.Attachments = append(tp.Attachments, takeout.Attachment{Attachment: a, Data: data})
+	}
+	switch ph, err := app.repo.Photos.Get(ctx, p.ID); {
+	case errors.Is(err, models.NotFound):
+	case err != nil:
+		return nil, err
+	default:
+		// the largest size is the closest to what was uploaded; the original
+		// is not kept
+		data, err := app.readBlob(ctx, photoBlobKey(ph.BlobPrefix, photo.Sizes[len(photo.Sizes)-1]), ph.DataKey, maxPhotoSize)
+		if err != nil {
+			return nil, fmt.Errorf("photo: %w", err)
+		}
+		tp.Photo = &takeout.File{Data: data}
+	}
+
+	if tp.Addresses == nil {
+		tp.Addresses = []models.Address{}
+	}
+	if tp.Documents == nil {
+		tp.Documents = []models.IdentityDocument{}
+	}
+	if tp.EKYC == nil {
+		tp.EKYC = []models.EKYCVerification{}
+	}
+	return tp, nil
+}
+
+// expireExports deletes the archives nobody downloaded in time, or whose
+// account was deleted, and fails the exports a restart cut off.
+func (app *Application) expireExports(ctx context.Context) {
+	expired, err := app.repo.Exports.Expire(ctx, time.Now())
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error expiring exports \n%w", err)
+		return
+	}
+	for _, e := range expired {
+		app.deleteBlob(ctx, e.BlobKey)
+	}
+	abandoned, err := app.repo.Exports.Abandon(ctx, time.Now().Add(-exportTimeout))
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error failing abandoned exports \n%w", err)
+		return
+	}
+	if len(expired) > 0 || abandoned > 0 {
+		app.logger.Infof("exports: expired %d, failed %d abandoned", len(expired), abandoned)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/cipher"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultDownloadURLTTL is used when DOWNLOAD_URL_TTL is unset.
+const defaultDownloadURLTTL = 5 * time.Minute
+
+const (
+	ErrBlobsOff           = "file storage is not configured"
+	ErrDownloadURL        = "this download link is invalid"
+	ErrDownloadURLExpired = "this download link has expired"
+)
+
+// What a download token can name.
+const (
+	fileAttachment = "attachment"
+	filePhoto      = "photo"
+	fileExport     = "export"
+)
+
+// fileSubject names a file in a download token: an attachment by profile and
+// attachment ID, a profile photo by profile and size, or a data export by
+// user and export ID.
+func fileSubject(kind string, id, n int) string {
+	return fmt.Sprintf("%s:%d:%d", kind, id, n)
+}
+
+func parseFileSubject(subject string) (kind string, id, n int, ok bool) {
+	parts := strings.Split(subject, ":")
+	if len(parts) != 3 {
+		return "", 0, 0, false
+	}
+	id, err1 := strconv.Atoi(parts[1])
+	n, err2 := strconv.Atoi(parts[2])
+	return parts[0], id, n, err1 == nil && err2 == nil
+}
+
+// blobsOff answers requests that need the blob store when BLOB_URL is unset.
+func (app *Application) blobsOff(c echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": ErrBlobsOff})
+}
+
+// wrapDataKey encrypts the data key of a blob with the master key, for
+// storing next to the blob's metadata.
+func (app *Application) wrapDataKey(key []byte) (string, error) {
+	return cipher.Encrypt(app.env[env.AES_KEY], base64.StdEncoding.EncodeToString(key))
+}
+
+func (app *Application) unwrapDataKey(wrapped string) ([]byte, error) {
+	key, err := cipher.Decrypt(app.env[env.AES_KEY], wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(key)
+}
+
+// deleteBlob removes a blob whose row is gone. A failure only leaves garbage
+// behind: without the wrapped data key in its row the blob cannot be opened.
+func (app *Application) deleteBlob(ctx context.Context, key string) {
+	if err := app.blobs.Delete(ctx, key); err != nil {
+		app.logger.Errorf("error deleting blob %s \n%w", key, err)
+	}
+}
+
+// DownloadFile serves the file a download token names. The token is the only
+// credential, so it is checked before anything is looked up.
+func (app *Application) DownloadFile(c echo.Context) error {
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	subject, err := app.downloads.Verify(c.Param("token"))
+	if errors.Is(err, blob.ErrTokenExpired) {
+		return c.JSON(http.StatusGone, map[string]string{"error": ErrDownloadURLExpired})
+	}
+	kind, id, n, ok := parseFileSubject(subject)
+	if err != nil || !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": ErrDownloadURL})
+	}
+	switch kind {
+	case fileAttachment:
+		return app.serveAttachment(c, id, n)
+	case filePhoto:
+		return app.servePhoto(c, id, n)
+	case fileExport:
+		return app.serveExport(c, id, n)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": ErrDownloadURL})
+}
+
+// cipherError is a failure to decrypt, which handlers report as critical
+// where other failures only degrade the service.
+type cipherError struct {
+	err error
+}
+
+func (e cipherError) Error() string { return e.err.Error() }
+
+func (e cipherError) Unwrap() error { return e.err }
+
+// readBlob reads and decrypts a blob of at most size bytes. A blob that does
+// not decrypt is a cipherError.
+func (app *Application) readBlob(ctx context.Context, blobKey, wrappedKey string, size int64) ([]byte, error) {
+	r, err := app.blobs.Get(ctx, blobKey)
+	if err != nil {
+		return nil, err
+	}
+	// GCM adds a nonce and a tag; anything longer than that is not our blob
+	sealed, err := io.ReadAll(io.LimitReader(r, size+64))
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := app.unwrapDataKey(wrappedKey)
+	if err != nil {
+		return nil, cipherError{err}
+	}
+	data, err := blob.Unseal(sealed, dataKey, blobKey)
+	if err != nil {
+		return nil, cipherError{err}
+	}
+	return data, nil
+}
+
+// serveBlob decrypts a blob of at most size bytes and sends it with the given
+// Content-Disposition.
+func (app *Application) serveBlob(c echo.Context, blobKey, wrappedKey string, size int64, contentType, disposition, fileName string) error {
+	data, err := app.readBlob(c.Request().Context(), blobKey, wrappedKey, size)
+	if cerr := (cipherError{}); errors.As(err, &cerr) {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", cerr.err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error reading blob \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "private, no-store")
+	return c.Blob(http.StatusOK, contentType, data)
+}
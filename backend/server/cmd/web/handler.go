@@ -2,11 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
-	"github.com/Raaffs/profileManager/server/internal/cipher"
+	"github.com/Raaffs/profileManager/server/internal/audit"
 	"github.com/Raaffs/profileManager/server/internal/env"
 	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
 	"github.com/Raaffs/profileManager/server/internal/utils"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -32,7 +34,9 @@ func (app *Application) Login(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		// an imported account without a password hash cannot log in until one is set
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || user.PasswordHash == "" {
+			app.recordAudit(c, user.ID, audit.ActionLoginFailed)
 			return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": "invalid username or password"})
 		}
 		app.health.SetStatus(StatusDegraded)
@@ -46,6 +50,7 @@ func (app *Application) Login(c echo.Context) error {
 		app.logger.Errorf("error generating token \n%w", err)
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
+	app.recordAudit(c, user.ID, audit.ActionLogin)
 	return c.JSON(http.StatusOK, echo.Map{
 		"token": token,
 	})
@@ -83,7 +88,15 @@ func (app *Application) Register(c echo.Context) error {
 	user.Username=u.Username
 	user.PasswordHash=hashedPassword
 
-	if err := app.repo.Users.Create(c.Request().Context(), &user); err != nil {
+	// an account must never exist without its registration record
+	ctx := c.Request().Context()
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Users.Create(ctx, &user); err != nil {
+			return err
+		}
+		return app.audit.WithRepo(tx.Audit).Log(ctx, user.ID, audit.ActionRegister, map[string]string{"ip": c.RealIP()})
+	})
+	if err != nil {
 		if errors.Is(err, models.AlreadyExists) {
 			return c.JSON(http.StatusConflict, map[string]string{"error": "email or username already exists"})
 		}
@@ -109,25 +122,36 @@ func (app *Application) CreateProfile(c echo.Context) error {
 		app.logger.Errorf("error getting user from jwt \n%w", err)
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 	}
-	if validate := ValidateProfile(p); !validate.Valid(){
+	// the account holder's own profile unless it says otherwise
+	if p.Relationship == "" {
+		p.Relationship = models.RelationshipSelf
+	}
+	normalizeAadhaar(&p)
+	validate := ValidateProfile(p)
+	validate.Relationship(p.Relationship)
+	if !validate.Valid(){
 		return c.JSON(http.StatusBadRequest, validate.Errors)
 	}
 
 	p.UserID = userID
+	ctx := c.Request().Context()
 
-	if err := EncryptFields(app.env[env.AES_KEY],&p.AadhaarNumber); err!=nil{
+	if err := app.sealProfile(&p); err!=nil{
 		app.health.SetStatus(StatusCritical)
 		app.logger.Errorf("CRITICAL ERROR : cipher failure \n%w", err)	
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
 
-	if err := app.repo.Profiles.Create(c.Request().Context(), p); err != nil {
+	if err := app.repo.Profiles.Create(ctx, &p); err != nil {
 		if errors.Is(err, models.NotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
 		}
 
 		if errors.Is(err, models.AlreadyExists) {
-			return c.JSON(http.StatusConflict, map[string]string{"error": "phone no. already exists"})
+			if app.aadhaarOnAccount(ctx, userID, 0, p.AadhaarIndex) {
+				return c.JSON(http.StatusConflict, map[string]string{"error": ErrAadhaarOnAccount})
+			}
+			return c.JSON(http.StatusConflict, map[string]string{"error": "phone no. or VID already exists, or the account already has a self profile"})
 		}
 		
 		app.health.SetStatus(StatusDegraded)
@@ -135,7 +159,11 @@ func (app *Application) CreateProfile(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
 
-	return c.JSON(http.StatusOK,map[string]string{"message":"profile created successfully"})
+	app.recordProfileAudit(c, userID, p.ID, audit.ActionProfileCreate)
+	app.flagDuplicates(c, userID, &p)
+	c.Response().Header().Set(HeaderETag, profileETag(&p))
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/restricted/profiles/%d", p.ID))
+	return c.JSON(http.StatusOK,map[string]any{"message":"profile created successfully", "id": p.ID})
 }
 
 func (app *Application) GetProfile(c echo.Context) error {
@@ -145,20 +173,26 @@ func (app *Application) GetProfile(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
 	}
 
-	profile, err := app.repo.Profiles.GetByUserID(c.Request().Context(), userID)
+	profile, err := app.loadProfile(c, userID)
 	if err != nil {
 		if errors.Is(err, models.NotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
 		}
-		app.logger.Errorf("error fetching profile by user id \n%w", err)
+		app.logger.Errorf("error fetching profile \n%w", err)
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
 
-	if err := DecryptFields(app.env[env.AES_KEY], &profile.AadhaarNumber);err != nil {
+	if err := DecryptFields(app.env[env.AES_KEY], &profile.AadhaarNumber, &profile.VID);err != nil {
 		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
 		app.health.SetStatus(StatusCritical)
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
+	if profile.PhotoURLs, err = app.photoURLs(c.Request().Context(), profile.ID); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	c.Response().Header().Set(HeaderETag, profileETag(profile))
 	return c.JSON(http.StatusOK, profile)
 }
 
@@ -169,39 +203,199 @@ func (app *Application) UpdateProfile(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 	}
 
+	// Updates must name the version they were based on, so that two tabs
+	// editing the same profile cannot silently overwrite each other.
+	profileID, version, err := ifMatchProfile(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
 	var p models.Profile
 	if err := c.Bind(&p); err != nil {
 		app.logger.Errorf("error binding json to type profile \n%w", err)
 		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
 	}
 
+	normalizeAadhaar(&p)
 	if validate := ValidateProfile(p); !validate.Valid(){
 		return c.JSON(http.StatusBadRequest, validate.Errors)
 	}
 
-	p.UserID = userID
-	p.AadhaarNumber, err = cipher.Encrypt(app.env[env.AES_KEY],p.AadhaarNumber)
+	ctx := c.Request().Context()
+	current, err := app.loadProfile(c, userID)
 	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	// an ETag for one profile must not update another
+	if current.ID != profileID {
+		return preconditionFailed(c, ErrStaleETag)
+	}
+
+	// editing a field a KYC review vouched for sends the profile back to review
+	if err := DecryptFields(app.env[env.AES_KEY], &current.AadhaarNumber, &current.VID); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	changed := changedFields(current, &p)
+
+	p.UserID = userID
+	p.ID, p.Version = profileID, version
+	if err := app.sealProfile(&p); err != nil {
 		app.health.SetStatus(StatusCritical)
 		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
 
-	if err := app.repo.Profiles.Update(c.Request().Context(), p); err != nil {
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Profiles.Update(ctx, &p); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, p.ID, changed)
+		return err
+	})
+	if err != nil {
 		if errors.Is(err, models.NotFound) {
 			return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrNotFound})
 		}
+		if errors.Is(err, models.VersionConflict) {
+			return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": ErrStaleProfile})
+		}
 		if errors.Is(err, models.AlreadyExists) {
-			//the phone number is the only unique field that can cause conflict here
-			//that's why we return this specific message
-			return c.JSON(http.StatusConflict, map[string]string{"error": "phone no. already exists"})
+			if app.aadhaarOnAccount(ctx, userID, p.ID, p.AadhaarIndex) {
+				return c.JSON(http.StatusConflict, map[string]string{"error": ErrAadhaarOnAccount})
+			}
+			//the phone number and VID are the only other unique fields that can
+			//cause conflict here, that's why we return this specific message
+			return c.JSON(http.StatusConflict, map[string]string{"error": "phone no. or VID already exists"})
 		}
 		app.health.SetStatus(StatusDegraded)
 		app.logger.Errorf("error updating profile \n%w", err)
 		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
 	}
+	app.recordProfileAudit(c, userID, p.ID, audit.ActionProfileUpdate)
+	app.reopenKYC(c, userID, p.ID, reopened)
+	app.flagEditedDuplicates(c, userID, &p, changed)
+	c.Response().Header().Set(HeaderETag, profileETag(&p))
 	return c.JSON(http.StatusOK,map[string]string{
 		"message":"profile updated successfully",
 	})
 }
 
+// deleteRequest is the body of the DELETE endpoints, which require the account
+// password again before anything is erased.
+type deleteRequest struct {
+	Password string `json:"password"`
+}
+
+func (app *Application) DeleteProfile(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	var input deleteRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to delete request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	if _, err := app.reauthenticate(c.Request().Context(), userID, input.Password); err != nil {
+		if errors.Is(err, ErrReauthFailed) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "incorrect password"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error re-authenticating user \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	// the profile's credentials are revoked with it, for good: restoring the
+	// profile does not bring them back
+	profile, err := app.loadProfile(c, userID)
+	if err == nil {
+		ctx := c.Request().Context()
+		err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+			if err := tx.Profiles.Delete(ctx, userID, profile.ID); err != nil {
+				return err
+			}
+			_, err := tx.Credentials.RevokeProfile(ctx, profile.ID)
+			return err
+		})
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionProfileDelete)
+	return c.JSON(http.StatusOK, map[string]string{"message": "profile deleted successfully"})
+}
+
+// DeleteAccount erases the account and everything attached to it. Sessions and
+// credentials are revoked first so that a failure part way through never
+// leaves a deleted account with working tokens.
+func (app *Application) DeleteAccount(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	var input deleteRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to delete request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	ctx := c.Request().Context()
+	if _, err := app.reauthenticate(ctx, userID, input.Password); err != nil {
+		if errors.Is(err, ErrReauthFailed) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "incorrect password"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error re-authenticating user \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	if err := app.repo.Sessions.RevokeAll(ctx, userID); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error revoking sessions \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if _, err := app.repo.Credentials.RevokeUser(ctx, userID); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error revoking credentials \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	// The account and its profiles are soft-deleted here and erased for good by
+	// the purge worker once DELETED_RETENTION has passed. The wrapped data keys
+	// of attachments, photos and exports are kept until then so an admin
+	// restore can still open the blobs; they are erased with their rows, which
+	// leaves the blobs unreadable even where the store keeps a copy.
+	if err := app.repo.Users.Delete(ctx, userID); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]HttpResponseMsg{"error": ErrNotFound})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting account \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	if err := app.audit.Tombstone(ctx, userID); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing account tombstone \n%w", err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "account deleted successfully"})
+}
@@ -0,0 +1,1493 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/ekyc"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/kyc"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/pincode"
+	"github.com/Raaffs/profileManager/server/internal/store/memory"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/Raaffs/profileManager/server/internal/vc"
+	"github.com/labstack/echo/v4"
+)
+
+// testQRKey stands in for UIDAI's Secure QR signing key.
+var testQRKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// newTestServer wires the routes to an in-memory repository.
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	e, _ := newTestApp(t)
+	return e
+}
+
+// newTestApp is newTestServer for tests that also need to reach into the
+// application, such as to grant a role.
+func newTestApp(t *testing.T) (*echo.Echo, *Application) {
+	t.Helper()
+	aesKey := make([]byte, 32)
+	if _, err := rand.Read(aesKey); err != nil {
+		t.Fatal(err)
+	}
+	indexKey := make([]byte, 32)
+	if _, err := rand.Read(indexKey); err != nil {
+		t.Fatal(err)
+	}
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloads, err := blob.NewSigner(indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := blob.NewSigner(aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, issuerKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := vc.NewIssuer("id.example.com", issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	repo := memory.NewRepo()
+	app := &Application{
+		env: map[string]string{
+			env.JWT_SECRET:      "test-secret",
+			env.AES_KEY:         base64.StdEncoding.EncodeToString(aesKey),
+			env.BLIND_INDEX_KEY: base64.StdEncoding.EncodeToString(indexKey),
+		},
+		repo:        repo,
+		logger:      e.Logger,
+		health:      &HealthChecker{status: StatusHealthy},
+		audit:       audit.NewLogger(repo.Audit, signingKey, 100),
+		pincodes:    pincode.Default(),
+		aadhaarQR:   ekyc.NewQRVerifier(&testQRKey().PublicKey),
+		kyc:         kyc.NewService(repo.KYC, defaultKYCClaimTTL, defaultKYCValidity),
+		blobs:       blobs,
+		downloads:   downloads,
+		downloadTTL: defaultDownloadURLTTL,
+		consents:    consent.Default(),
+		shares:      shares,
+		issuer:      issuer,
+	}
+	app.RegisterRoutes(e)
+	return e, app
+}
+
+func do(e *echo.Echo, method, path, token, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// signUp registers and logs in a user and returns their token.
+func signUp(t *testing.T, e *echo.Echo) string {
+	t.Helper()
+	if rec := do(e, http.MethodPost, "/api/register", "", `{"email":"asha@example.com","username":"asha","password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("register: %d %s", rec.Code, rec.Body)
+	}
+	rec := do(e, http.MethodPost, "/api/login", "", `{"email":"asha@example.com","password":"correct horse"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	var out struct{ Token string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Token == "" {
+		t.Fatalf("login response %s: %v", rec.Body, err)
+	}
+	return out.Token
+}
+
+// consentToKYC gives the consent that KYC submissions and document uploads
+// need.
+func consentToKYC(t *testing.T, e *echo.Echo, token string) {
+	t.Helper()
+	if rec := do(e, http.MethodPut, "/api/restricted/consents/kyc", token, `{"notice_version":1}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("consent to kyc: %d %s", rec.Code, rec.Body)
+	}
+}
+
+const testProfile = `{"full_name":"Asha Rao","date_of_birth":"1990-03-14T00:00:00Z","aadhaar_number":"234567890124","phone_number":"9876543210","address":"12 MG Road"}`
+
+func TestRegister_Duplicate_Conflict(t *testing.T) {
+	e := newTestServer(t)
+	signUp(t, e)
+	rec := do(e, http.MethodPost, "/api/register", "", `{"email":"asha@example.com","username":"asha","password":"x"}`, nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second register = %d; want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestProfile_Lifecycle(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET before create = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	etag := rec.Header().Get(HeaderETag)
+
+	rec = do(e, http.MethodGet, "/api/restricted/profile", token, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "234567890124") {
+		t.Errorf("GET did not return the decrypted Aadhaar number: %s", rec.Body)
+	}
+	if got := rec.Header().Get(HeaderETag); got != etag {
+		t.Errorf("GET ETag = %s; want %s", got, etag)
+	}
+
+	if rec := do(e, http.MethodPut, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("PUT without If-Match = %d; want %d", rec.Code, http.StatusPreconditionRequired)
+	}
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: etag}
+	rec = do(e, http.MethodPatch, "/api/restricted/profile", token, `{"address":"4 Park St"}`, patch)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"address":"lost"}`, patch); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with stale ETag = %d; want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+
+	if rec := do(e, http.MethodDelete, "/api/restricted/profile", token, `{"password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after delete = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestProfiles_Dependents(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+
+	rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST self = %d %s", rec.Code, rec.Body)
+	}
+	selfETag := rec.Header().Get(HeaderETag)
+
+	// same phone as the account holder, own Aadhaar number
+	child := `{"full_name":"Mira Rao","date_of_birth":"2015-06-01T00:00:00Z","aadhaar_number":"345678901238","phone_number":"9876543210","relationship":"child"}`
+	rec = do(e, http.MethodPost, "/api/restricted/profiles", token, child, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST child = %d %s", rec.Code, rec.Body)
+	}
+	childURL := rec.Header().Get(echo.HeaderLocation)
+	childETag := rec.Header().Get(HeaderETag)
+
+	if rec := do(e, http.MethodPost, "/api/restricted/profiles", token, strings.Replace(child, `"child"`, `"parent"`, 1), nil); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), ErrAadhaarOnAccount) {
+		t.Errorf("POST with an Aadhaar already on the account = %d %s; want %d", rec.Code, rec.Body, http.StatusConflict)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profiles", token, strings.Replace(child, `"child"`, `"cousin"`, 1), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST with an unknown relationship = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = do(e, http.MethodGet, "/api/restricted/profiles", token, "", nil)
+	var list []struct {
+		ID           int    `json:"id"`
+		Relationship string `json:"relationship"`
+		IsPrimary    bool   `json:"is_primary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("GET /profiles = %d %s", rec.Code, rec.Body)
+	}
+	if !list[0].IsPrimary || list[0].Relationship != "self" || list[1].Relationship != "child" {
+		t.Errorf("GET /profiles = %+v; want the primary self profile, then the child", list)
+	}
+
+	// an ETag names one profile and cannot be replayed against another
+	if rec := do(e, http.MethodPut, childURL, token, child, map[string]string{HeaderIfMatch: selfETag}); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT child with the self ETag = %d; want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	if rec := do(e, http.MethodPut, childURL, token, child, map[string]string{HeaderIfMatch: childETag}); rec.Code != http.StatusOK {
+		t.Errorf("PUT child = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(e, http.MethodPost, childURL+"/primary", token, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST primary = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(e, http.MethodGet, "/api/restricted/profile", token, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Mira Rao") {
+		t.Errorf("GET /profile after switching primary = %d %s; want the child", rec.Code, rec.Body)
+	}
+
+	other := do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	if other.Code != http.StatusOK {
+		t.Fatalf("register: %d %s", other.Code, other.Body)
+	}
+	rec = do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	if rec := do(e, http.MethodGet, childURL, login.Token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET another account's profile = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST profile = %d %s", rec.Code, rec.Body)
+	}
+
+	// the legacy free-text address was not copied because the profile is new
+	rec := do(e, http.MethodPost, "/api/restricted/profile/addresses", token, `{"type":"permanent","line1":"12 MG Road","pin_code":"560001"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST address = %d %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		ID       int    `json:"id"`
+		District string `json:"district"`
+		State    string `json:"state"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.District != "Bengaluru Urban" || created.State != "Karnataka" {
+		t.Errorf("POST address filled in %q, %q; want Bengaluru Urban, Karnataka", created.District, created.State)
+	}
+
+	for body, want := range map[string]int{
+		`{"type":"permanent","line1":"4 Park St","pin_code":"700016"}`:                http.StatusConflict,
+		`{"type":"current","line1":"4 Park St","pin_code":"700016","state":"Kerala"}`: http.StatusBadRequest,
+		`{"type":"current","line1":"4 Park St","pin_code":"070016"}`:                  http.StatusBadRequest,
+		`{"type":"current","line1":"Sector 17","pin_code":"160017"}`:                  http.StatusBadRequest,
+		`{"type":"current","line1":"Sector 17","pin_code":"160017","state":"Punjab"}`: http.StatusCreated,
+	} {
+		if rec := do(e, http.MethodPost, "/api/restricted/profile/addresses", token, body, nil); rec.Code != want {
+			t.Errorf("POST %s = %d %s; want %d", body, rec.Code, rec.Body, want)
+		}
+	}
+
+	// each field that is too long is reported under its own name
+	for field, max := range map[string]int{"line1": 200, "line2": 200, "locality": 100} {
+		body := fmt.Sprintf(`{"type":"office","line1":"1 Main St","pin_code":"560001",%q:%q}`, field, strings.Repeat("x", max+1))
+		rec := do(e, http.MethodPost, "/api/restricted/profile/addresses", token, body, nil)
+		var errs map[string]string
+		if json.Unmarshal(rec.Body.Bytes(), &errs); rec.Code != http.StatusBadRequest || len(errs) != 1 || errs[field] == "" {
+			t.Errorf("POST with a long %s = %d %s; want an error for %s alone", field, rec.Code, rec.Body, field)
+		}
+	}
+
+	url := fmt.Sprintf("/api/restricted/profile/addresses/%d", created.ID)
+	if rec := do(e, http.MethodPut, url, token, `{"type":"permanent","line1":"4 Park St","pin_code":"700016"}`, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "West Bengal") {
+		t.Errorf("PUT address = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, url, token, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("DELETE address = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, url, token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE deleted address = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST profile = %d %s", rec.Code, rec.Body)
+	}
+
+	rec := do(e, http.MethodPost, "/api/restricted/profile/documents", token, `{"type":"pan","number":"abcpd 1234 f"}`, nil)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"number":"ABCPD1234F"`) {
+		t.Fatalf("POST pan = %d %s", rec.Code, rec.Body)
+	}
+	var created struct{ ID int }
+	json.Unmarshal(rec.Body.Bytes(), &created)
+
+	for body, want := range map[string]int{
+		`{"type":"pan","number":"ABCPE1234F"}`:                                          http.StatusConflict,
+		`{"type":"voter_id","number":"ABC12345"}`:                                       http.StatusBadRequest,
+		`{"type":"ration_card","number":"ABC1234567"}`:                                  http.StatusBadRequest,
+		`{"type":"voter_id","number":"ABC1234567","expires_on":"2030-01-01T00:00:00Z"}`: http.StatusBadRequest,
+		`{"type":"driving_licence","number":"XX14 20110062821"}`:                        http.StatusBadRequest,
+		`{"type":"driving_licence","number":"MH14 2011-0062821"}`:                       http.StatusCreated,
+		`{"type":"passport","number":"J8369854","expires_on":"2031-05-17T00:00:00Z"}`:   http.StatusCreated,
+	} {
+		if rec := do(e, http.MethodPost, "/api/restricted/profile/documents", token, body, nil); rec.Code != want {
+			t.Errorf("POST %s = %d %s; want %d", body, rec.Code, rec.Body, want)
+		}
+	}
+	// the X entity type character does not exist
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/documents", token, `{"type":"pan","number":"ABCXD1234F"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST pan with unknown entity type = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// another account cannot register the same PAN
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	rec = do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	other := strings.NewReplacer("234567890124", "345678901238", "9876543210", "9876543211").Replace(testProfile)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", login.Token, other, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST other profile = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/documents", login.Token, `{"type":"pan","number":"ABCPD1234F"}`, nil); rec.Code != http.StatusConflict {
+		t.Errorf("POST a PAN held by another account = %d %s; want %d", rec.Code, rec.Body, http.StatusConflict)
+	}
+
+	url := fmt.Sprintf("/api/restricted/profile/documents/%d", created.ID)
+	if rec := do(e, http.MethodGet, url, login.Token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET another account's document = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodPut, url, token, `{"number":"ABCPD9999F"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(e, http.MethodGet, "/api/restricted/profile/documents", token, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ABCPD9999F") || !strings.Contains(rec.Body.String(), "MH1420110062821") {
+		t.Errorf("GET documents = %d %s; want the decrypted numbers", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, url, token, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestProfile_VID(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+
+	// a 16-digit number given as the Aadhaar number is taken to be a VID
+	vidOnly := strings.Replace(testProfile, `"234567890124"`, `"9123 4567 8901 2346"`, 1)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, vidOnly, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, `"vid":"9123456789012346"`) || !strings.Contains(body, `"aadhaar_form":"vid"`) {
+		t.Fatalf("GET = %d %s; want the VID in its own field", rec.Code, body)
+	}
+
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: rec.Header().Get(HeaderETag)}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"vid":null}`, patch); rec.Code != http.StatusBadRequest {
+		t.Errorf("PATCH removing the only number = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"vid":"9123456789012345"}`, patch); rec.Code != http.StatusBadRequest {
+		t.Errorf("PATCH with a bad check digit = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"aadhaar_number":"234567890124"}`, patch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH adding the Aadhaar number = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); !strings.Contains(rec.Body.String(), `"aadhaar_form":"both"`) {
+		t.Errorf("GET after PATCH = %s; want aadhaar_form both", rec.Body)
+	}
+
+	// the blind index keeps a VID on one profile only
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	rec = do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	other := strings.NewReplacer(`"aadhaar_number":"234567890124"`, `"vid":"9123456789012346"`, "9876543210", "9876543211").Replace(testProfile)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", login.Token, other, nil); rec.Code != http.StatusConflict {
+		t.Errorf("POST a VID held by another account = %d %s; want %d", rec.Code, rec.Body, http.StatusConflict)
+	}
+}
+
+// aadhaarQR builds a signed version 2 Secure QR payload without email or
+// mobile hashes.
+func aadhaarQR(t *testing.T, referenceID, name, dob string) string {
+	t.Helper()
+	fields := []string{"V2", "0", referenceID, name, dob, "F", "", "Bengaluru", "", "12", "MG Road", "560001", "", "Karnataka", "", "", "Bengaluru"}
+	data := []byte(strings.Join(fields, "\xff") + "\xffphoto")
+	digest := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testQRKey(), crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(append(data, sig...))
+	zw.Close()
+	return new(big.Int).SetBytes(zipped.Bytes()).String()
+}
+
+func TestAadhaarQR(t *testing.T) {
+	e := newTestServer(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST profile = %d %s", rec.Code, rec.Body)
+	}
+	body := fmt.Sprintf(`{"payload":%q}`, aadhaarQR(t, "012420190305123456789", "ASHA  RAO", "14-03-1990"))
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/aadhaar-qr", token, body, nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"purpose":"kyc"`) {
+		t.Fatalf("POST qr without consent = %d %s; want %d naming the purpose", rec.Code, rec.Body, http.StatusForbidden)
+	}
+	consentToKYC(t, e, token)
+
+	// the profile's Aadhaar number ends in 0124
+	body = fmt.Sprintf(`{"payload":%q}`, aadhaarQR(t, "012420190305123456789", "ASHA  RAO", "14-03-1990"))
+	rec := do(e, http.MethodPost, "/api/restricted/profile/aadhaar-qr", token, body, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST qr = %d %s", rec.Code, rec.Body)
+	}
+	var out struct {
+		Document     struct{ Reference string }
+		Verification struct{ Source string }
+	}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	if out.Document.Reference != "XXXX XXXX 0124" || out.Verification.Source != "secure_qr" {
+		t.Errorf("POST qr = %s", rec.Body)
+	}
+	if b := rec.Body.String(); !strings.Contains(b, `"name_match":true`) || !strings.Contains(b, `"address_match":false`) || !strings.Contains(b, `"verified":true`) {
+		t.Errorf("POST qr = %s; want the name and Aadhaar number to match but not the address", b)
+	}
+
+	// prefilling takes the name and address from the code
+	body = fmt.Sprintf(`{"payload":%q,"mode":"prefill"}`, aadhaarQR(t, "012420190305123456789", "Asha K Rao", "14-03-1990"))
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/aadhaar-qr", token, body, nil); rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"address_match":true`) {
+		t.Fatalf("POST qr prefill = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); !strings.Contains(rec.Body.String(), `"full_name":"Asha K Rao"`) || !strings.Contains(rec.Body.String(), "560001") {
+		t.Errorf("GET after prefill = %s", rec.Body)
+	}
+
+	// another Aadhaar number's code is not a match, and a forged one is refused
+	body = fmt.Sprintf(`{"payload":%q}`, aadhaarQR(t, "999920190305123456789", "Asha K Rao", "14-03-1990"))
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/aadhaar-qr", token, body, nil); !strings.Contains(rec.Body.String(), `"verified":false`) {
+		t.Errorf("POST qr for another Aadhaar number = %s; want verified false", rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/aadhaar-qr", token, `{"payload":"123456789"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST qr with a bad payload = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = do(e, http.MethodGet, "/api/restricted/profile/ekyc", token, "", nil)
+	var list []json.RawMessage
+	if json.Unmarshal(rec.Body.Bytes(), &list); rec.Code != http.StatusOK || len(list) != 3 {
+		t.Errorf("GET ekyc = %d %s; want three verifications", rec.Code, rec.Body)
+	}
+}
+
+func TestKYC_Review(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"status":"draft"`) {
+		t.Fatalf("GET kyc = %d %s; want draft", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/kyc/submit", token, "", nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"purpose":"kyc"`) {
+		t.Fatalf("submit without consent = %d %s; want %d naming the purpose", rec.Code, rec.Body, http.StatusForbidden)
+	}
+	consentToKYC(t, e, token)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/kyc/submit", token, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("submit = %d %s", rec.Code, rec.Body)
+	}
+
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	rec := do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	reviewer := login.Token
+	if rec := do(e, http.MethodGet, "/api/support/kyc/queue", reviewer, "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("queue without the support role = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+	if err := app.repo.Users.SetRole(context.Background(), "ravi@example.com", models.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = do(e, http.MethodPost, "/api/support/kyc/queue/claim", reviewer, "", nil)
+	var claimed models.KYC
+	if err := json.Unmarshal(rec.Body.Bytes(), &claimed); rec.Code != http.StatusOK || err != nil || claimed.Status != models.KYCUnderReview {
+		t.Fatalf("claim next = %d %s", rec.Code, rec.Body)
+	}
+	path := fmt.Sprintf("/api/support/kyc/%d", claimed.ProfileID)
+	if rec := do(e, http.MethodGet, path, reviewer, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "XXXX XXXX 0124") {
+		t.Errorf("review = %d %s; want the masked profile", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, path+"/reject", reviewer, `{"reason_code":"looks_off"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("reject with an unknown reason = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPost, path+"/reject", reviewer, `{"reason_code":"name_mismatch"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("reject = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"reason_code":"name_mismatch"`) || strings.Contains(rec.Body.String(), "reviewer") {
+		t.Errorf("GET kyc after rejection = %s; want the reason and no reviewer", rec.Body)
+	}
+
+	do(e, http.MethodPost, "/api/restricted/profile/kyc/submit", token, "", nil)
+	if rec := do(e, http.MethodPost, path+"/approve", reviewer, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("approve without a claim = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+	do(e, http.MethodPost, path+"/claim", reviewer, "", nil)
+	if rec := do(e, http.MethodPost, path+"/approve", reviewer, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve = %d %s", rec.Code, rec.Body)
+	}
+
+	// the phone number is not a verified field; the address is
+	etag := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil).Header().Get(HeaderETag)
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: etag}
+	rec = do(e, http.MethodPatch, "/api/restricted/profile", token, `{"phone_number":"9876543211"}`, patch)
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"status":"verified"`) {
+		t.Errorf("GET kyc after a phone number edit = %s; want verified", rec.Body)
+	}
+	patch[HeaderIfMatch] = rec.Header().Get(HeaderETag)
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"address":"14 MG Road"}`, patch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH address = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"status":"submitted"`) {
+		t.Errorf("GET kyc after an address edit = %s; want submitted", rec.Body)
+	}
+
+	// an edit under review drops the claim, so the reviewer cannot approve
+	// a document they have not seen
+	do(e, http.MethodPost, path+"/claim", reviewer, "", nil)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/documents", token, `{"type":"pan","number":"ABCPD1234F"}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("POST document = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"status":"submitted"`) {
+		t.Errorf("GET kyc after a document edit under review = %s; want submitted", rec.Body)
+	}
+	if rec := do(e, http.MethodPost, path+"/approve", reviewer, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("approve after the owner's edit = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// so do the structured addresses of a verified profile
+	do(e, http.MethodPost, path+"/claim", reviewer, "", nil)
+	if rec := do(e, http.MethodPost, path+"/approve", reviewer, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/addresses", token, `{"type":"permanent","line1":"12 MG Road","pin_code":"560001"}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("POST address = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/kyc", token, "", nil); !strings.Contains(rec.Body.String(), `"status":"submitted"`) {
+		t.Errorf("GET kyc after adding an address = %s; want submitted", rec.Body)
+	}
+}
+
+// fileUpload builds a multipart body with a "file" part and form fields, and
+// the headers to send it with.
+func fileUpload(t *testing.T, name string, data []byte, fields map[string]string) (string, map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+	return buf.String(), map[string]string{echo.HeaderContentType: w.FormDataContentType()}
+}
+
+func TestAttachments(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	consentToKYC(t, e, token)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	body, headers := fileUpload(t, `C:\scans\bill.png`, png, map[string]string{"kind": "address_proof"})
+	rec := do(e, http.MethodPost, "/api/restricted/profile/attachments", token, body, headers)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	var a models.Attachment
+	json.Unmarshal(rec.Body.Bytes(), &a)
+	if a.ContentType != "image/png" || a.FileName != "bill.png" || a.Size != int64(len(png)) {
+		t.Errorf("upload = %s; want a PNG named bill.png", rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "blob_key") || strings.Contains(rec.Body.String(), "data_key") {
+		t.Errorf("upload = %s; want no keys", rec.Body)
+	}
+
+	// the stored blob is not the file
+	stored, _ := app.repo.Attachments.Get(context.Background(), a.ProfileID, a.ID)
+	r, err := app.blobs.Get(context.Background(), stored.BlobKey)
+	if err != nil {
+		t.Fatalf("blob: %v", err)
+	}
+	sealed := new(bytes.Buffer)
+	sealed.ReadFrom(r)
+	r.Close()
+	if bytes.Contains(sealed.Bytes(), []byte("PNG")) {
+		t.Error("blob holds the plaintext")
+	}
+
+	// a text file named .png is still text
+	body, headers = fileUpload(t, "notes.png", []byte("just some notes"), nil)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/attachments", token, body, headers); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("upload text = %d; want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	body, headers = fileUpload(t, "big.pdf", append([]byte("%PDF-1.7\n"), make([]byte, maxAttachmentSize)...), nil)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/attachments", token, body, headers); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload 10 MiB = %d; want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	if rec := do(e, http.MethodGet, "/api/restricted/profile/attachments", token, "", nil); !strings.Contains(rec.Body.String(), `"file_name":"bill.png"`) {
+		t.Errorf("list = %s", rec.Body)
+	}
+
+	path := fmt.Sprintf("/api/restricted/profile/attachments/%d", a.ID)
+	rec = do(e, http.MethodGet, path+"/url", token, "", nil)
+	var link struct{ URL string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil || !strings.HasPrefix(link.URL, "/api/files/") {
+		t.Fatalf("url = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(e, http.MethodGet, link.URL, "", "", nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Fatalf("download = %d; want the file", rec.Code)
+	}
+	if rec.Header().Get(echo.HeaderContentType) != "image/png" || !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), "bill.png") {
+		t.Errorf("download headers = %v", rec.Header())
+	}
+	if rec := do(e, http.MethodGet, link.URL+"x", "", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("download with a tampered token = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := do(e, http.MethodDelete, path, token, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if _, err := app.blobs.Get(context.Background(), stored.BlobKey); err != blob.ErrNotFound {
+		t.Errorf("blob after delete: %v; want %v", err, blob.ErrNotFound)
+	}
+	if rec := do(e, http.MethodGet, link.URL, "", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("download after delete = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPhoto(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	consentToKYC(t, e, token)
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 300, 200)))
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		body, headers := fileUpload(t, "me.png", data, nil)
+		return do(e, http.MethodPut, "/api/restricted/profile/photo", token, body, headers)
+	}
+	if rec := upload([]byte("GIF89a not really")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("upload GIF = %d; want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	if rec := upload(buf.Bytes()); rec.Code != http.StatusOK {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	first, _ := app.repo.Photos.Get(context.Background(), 1)
+
+	var profile models.Profile
+	json.Unmarshal(do(e, http.MethodGet, "/api/restricted/profile", token, "", nil).Body.Bytes(), &profile)
+	if len(profile.PhotoURLs) != 3 {
+		t.Fatalf("photo_urls = %v; want three sizes", profile.PhotoURLs)
+	}
+	rec := do(e, http.MethodGet, profile.PhotoURLs[64], "", "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/jpeg" {
+		t.Fatalf("GET 64px = %d %s", rec.Code, rec.Header())
+	}
+	if cfg, err := jpeg.DecodeConfig(rec.Body); err != nil || cfg.Width != 64 || cfg.Height != 64 {
+		t.Errorf("64px thumbnail = %+v, %v", cfg, err)
+	}
+
+	// a new photo replaces every size of the old one
+	if rec := upload(buf.Bytes()); rec.Code != http.StatusOK {
+		t.Fatalf("second upload = %d %s", rec.Code, rec.Body)
+	}
+	if _, err := app.blobs.Get(context.Background(), photoBlobKey(first.BlobPrefix, 256)); err != blob.ErrNotFound {
+		t.Errorf("old 256px blob: %v; want %v", err, blob.ErrNotFound)
+	}
+
+	if rec := do(e, http.MethodDelete, "/api/restricted/profile/photo", token, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); strings.Contains(rec.Body.String(), "photo_urls") {
+		t.Errorf("GET after delete = %s; want no photo_urls", rec.Body)
+	}
+	if rec := do(e, http.MethodGet, profile.PhotoURLs[64], "", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET 64px after delete = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodDelete, "/api/restricted/profile/photo", token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE again = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	// a second account with the name spelled differently and the same birthday
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	rec := do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	admin := login.Token
+	variant := `{"full_name":"Aasha Rao","date_of_birth":"1990-03-14T00:00:00Z","aadhaar_number":"345678901238","phone_number":"9123456780","address":"8 Hill Rd"}`
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", admin, variant, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST variant = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(e, http.MethodGet, "/api/admin/duplicates", admin, "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("queue without the admin role = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+	if err := app.repo.Users.SetRole(context.Background(), "ravi@example.com", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	rec = do(e, http.MethodGet, "/api/admin/duplicates", admin, "", nil)
+	var queue []models.Duplicate
+	if err := json.Unmarshal(rec.Body.Bytes(), &queue); rec.Code != http.StatusOK || err != nil || len(queue) != 1 {
+		t.Fatalf("queue = %d %s; want one pair", rec.Code, rec.Body)
+	}
+	if got := queue[0].Reasons; len(got) != 1 || got[0] != models.DuplicateNameDOB {
+		t.Errorf("reasons = %v; want [%s]", got, models.DuplicateNameDOB)
+	}
+
+	path := fmt.Sprintf("/api/admin/duplicates/%d", queue[0].ID)
+	rec = do(e, http.MethodGet, path, admin, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "XXXX XXXX 0124") || strings.Contains(rec.Body.String(), "234567890124") {
+		t.Errorf("review = %d %s; want both profiles masked", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, path+"/resolve", admin, `{"status":"maybe"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("resolve with an unknown status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPost, path+"/resolve", admin, `{"status":"distinct","note":"sisters"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("resolve = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, path+"/resolve", admin, `{"status":"duplicate"}`, nil); rec.Code != http.StatusConflict {
+		t.Errorf("second resolve = %d; want %d", rec.Code, http.StatusConflict)
+	}
+
+	// an edit does not bring a resolved pair back
+	etag := do(e, http.MethodGet, "/api/restricted/profile", admin, "", nil).Header().Get(HeaderETag)
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: etag}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", admin, `{"full_name":"Asha Rao"}`, patch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/admin/duplicates", admin, "", nil); strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("queue after resolving = %s; want empty", rec.Body)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(e, http.MethodDelete, "/api/restricted/account", token, `{"password":"wrong"}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with a wrong password = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET after a failed delete = %d %s; want the account untouched", rec.Code, rec.Body)
+	}
+
+	if rec := do(e, http.MethodDelete, "/api/restricted/account", token, `{"password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	// the token is still well formed and unexpired, but its session is revoked
+	if rec := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with the old token = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := do(e, http.MethodPost, "/api/login", "", `{"email":"asha@example.com","password":"correct horse"}`, nil); rec.Code == http.StatusOK {
+		t.Errorf("login after delete = %d; want it refused", rec.Code)
+	}
+
+	records, err := app.repo.Audit.ForUser(context.Background(), 1, 0, 100)
+	if err != nil || len(records) == 0 {
+		t.Fatalf("ForUser() = %v, %v", records, err)
+	}
+	if last := records[len(records)-1]; last.Action != audit.ActionAccountDelete || last.Details != "{}" {
+		t.Errorf("last audit record = %+v; want a tombstone with no details", last)
+	}
+}
+
+func TestRequireActiveSession(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if err := app.repo.Sessions.RevokeAll(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profiles", token, "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with a revoked token = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// tokens carry whole seconds, so only one issued after the second of the
+	// revocation is let through
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	rec := do(e, http.MethodPost, "/api/login", "", `{"email":"asha@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("login = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profiles", login.Token, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET with a new token = %d %s; want %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/profiles", token, "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with the revoked token after logging in again = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPurgeRetention(t *testing.T) {
+	e, app := newTestApp(t)
+	ctx := context.Background()
+	admin := signUp(t, e)
+	if err := app.repo.Users.SetRole(ctx, "asha@example.com", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	rec := do(e, http.MethodPost, "/api/login", "", `{"email":"ravi@example.com","password":"correct horse"}`, nil)
+	var login struct{ Token string }
+	json.Unmarshal(rec.Body.Bytes(), &login)
+	variant := `{"full_name":"Ravi Kumar","date_of_birth":"1988-07-09T00:00:00Z","aadhaar_number":"345678901238","phone_number":"9123456780","address":"8 Hill Rd"}`
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", login.Token, variant, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", admin, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	// the cutoff is an hour ago, so both are kept and come back
+	if rec := do(e, http.MethodDelete, "/api/restricted/account", login.Token, `{"password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE account = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, "/api/restricted/profile", admin, `{"password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE profile = %d %s", rec.Code, rec.Body)
+	}
+	app.purgeDeleted(ctx, time.Hour)
+	if rec := do(e, http.MethodPost, "/api/admin/users/2/restore", admin, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("restore user within retention = %d %s", rec.Code, rec.Body)
+	}
+	if p, err := app.repo.Profiles.GetByUserID(ctx, 2); err != nil || p.FullName != "Ravi Kumar" {
+		t.Errorf("profile of the restored user = %+v, %v; want it back with the account", p, err)
+	}
+	if rec := do(e, http.MethodPost, "/api/admin/users/1/profiles/2/restore", admin, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("restore profile within retention = %d %s", rec.Code, rec.Body)
+	}
+
+	// with no retention the cutoff is now, so both are erased for good
+	if err := app.repo.Users.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.repo.Profiles.Delete(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	app.purgeDeleted(ctx, 0)
+	if rec := do(e, http.MethodPost, "/api/admin/users/2/restore", admin, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("restore user after retention = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodPost, "/api/admin/users/1/profiles/2/restore", admin, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("restore profile after retention = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if _, err := app.repo.Users.GetByID(ctx, 1); err != nil {
+		t.Errorf("the admin's live account after the purge: %v", err)
+	}
+}
+
+func TestProfileHistory(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if err := app.repo.Users.SetRole(context.Background(), "asha@example.com", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	beforeCreate := time.Now().UTC()
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	time.Sleep(time.Millisecond)
+	beforeEdit := time.Now().UTC()
+	time.Sleep(time.Millisecond)
+	etag := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil).Header().Get(HeaderETag)
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: etag}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"full_name":"Asha K Rao","phone_number":"9123456789"}`, patch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+
+	rec := do(e, http.MethodGet, "/api/restricted/profile/history", token, "", nil)
+	var history []historyEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); rec.Code != http.StatusOK || err != nil || len(history) != 2 {
+		t.Fatalf("history = %d %s; want the create and the edit", rec.Code, rec.Body)
+	}
+	want := []fieldChange{
+		{Field: "full_name", Old: "Asha Rao", New: "Asha K Rao"},
+		{Field: "phone_number", Old: "XXXXXX3210", New: "XXXXXX6789"},
+	}
+	if history[0].Change != models.ProfileCreated || history[1].Change != models.ProfileUpdated || !slices.Equal(history[1].Changes, want) {
+		t.Errorf("history = %+v; want the edit diffed as %+v", history, want)
+	}
+	if b := rec.Body.String(); strings.Contains(b, "234567890124") || strings.Contains(b, "9876543210") || strings.Contains(b, "9123456789") {
+		t.Errorf("history = %s; want identifiers masked", b)
+	}
+
+	asOf := func(at time.Time) *httptest.ResponseRecorder {
+		return do(e, http.MethodGet, "/api/admin/users/1/profile?at="+at.Format(time.RFC3339Nano), token, "", nil)
+	}
+	if rec := asOf(beforeCreate); rec.Code != http.StatusNotFound {
+		t.Errorf("as of before the profile existed = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	for _, tt := range []struct {
+		at          time.Time
+		name, phone string
+	}{
+		{beforeEdit, "Asha Rao", "XXXXXX3210"},
+		{time.Now().UTC(), "Asha K Rao", "XXXXXX6789"},
+	} {
+		rec := asOf(tt.at)
+		var version models.ProfileVersion
+		if err := json.Unmarshal(rec.Body.Bytes(), &version); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("as of %v = %d %s", tt.at, rec.Code, rec.Body)
+		}
+		if p := version.Profile; p.FullName != tt.name || p.PhoneNumber != tt.phone || p.AadhaarNumber != "XXXX XXXX 0124" {
+			t.Errorf("as of %v = %+v; want %s, %s and the Aadhaar number masked", tt.at, p, tt.name, tt.phone)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	e, app := newTestApp(t)
+	admin := signUp(t, e)
+	if err := app.repo.Users.SetRole(context.Background(), "asha@example.com", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "email,username,password_hash,full_name,date_of_birth,aadhaar_number,vid,phone_number,relationship\n" +
+		"kiran@example.com,kiran," + hash + ",Kiran Shah,1985-01-20,3456 7890 1238,,9123456780,\n" +
+		"kiran@example.com,,,Meera Shah,2015-06-01,,9123 4567 8901 2346,9123456780,child\n" +
+		"nobody@example,nobody,,Nobody,20/01/1985,234567890124,,9000000000,\n" +
+		"kiran@example.com,,,Kiran Again,1985-01-20,345678901238,,9123456781,spouse\n" +
+		"asha@example.com,,,Asha Rao,1990-03-14,234567890124,,9876543210,self\n" +
+		"dev@example.com,dev,,Dev Patel,1992-11-02,,9123456789012379,9000000001,\n" +
+		"lata@example.com,lata,,Lata Iyer,1970-05-05,,,9000000002,\n"
+	csvType := map[string]string{echo.HeaderContentType: "text/csv"}
+
+	var job models.ImportJob
+	rec := do(e, http.MethodPost, "/api/admin/imports?dry_run=true", admin, file, csvType)
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("dry run = %d %s", rec.Code, rec.Body)
+	}
+	if job.Status != models.ImportCompleted || job.Records != 7 || job.Users != 2 || job.Profiles != 4 || job.Failed != 3 {
+		t.Errorf("dry run = %+v; want 7 records, 2 accounts, 4 profiles and 3 errors", job)
+	}
+	if rec := do(e, http.MethodPost, "/api/login", "", `{"email":"kiran@example.com","password":"correct horse"}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("login after a dry run = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = do(e, http.MethodPost, "/api/admin/imports", admin, file, csvType)
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); rec.Code != http.StatusOK || err != nil || job.Profiles != 4 {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/login", "", `{"email":"kiran@example.com","password":"correct horse"}`, nil); rec.Code != http.StatusOK {
+		t.Errorf("login as an imported account = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/login", "", `{"email":"dev@example.com","password":""}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login as an account imported without a password = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = do(e, http.MethodGet, "/api/restricted/profiles", admin, "", nil)
+	if !strings.Contains(rec.Body.String(), `"aadhaar_number":"234567890124"`) {
+		t.Errorf("profiles = %s; want the imported profile on the existing account", rec.Body)
+	}
+
+	path := fmt.Sprintf("/api/admin/imports/%d", job.ID)
+	rec = do(e, http.MethodGet, path+"/errors", admin, "", nil)
+	want := "line,field,message\n" +
+		"4,date_of_birth,must be a date in the form YYYY-MM-DD\n" +
+		"5,aadhaar_number,another profile on this account already has this aadhaar number\n" +
+		"8,aadhaar_number,an aadhaar number or a VID is required\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("error report = %d\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+	if rec := do(e, http.MethodPost, path, admin, file, csvType); rec.Code != http.StatusConflict {
+		t.Errorf("resume a completed import = %d; want %d", rec.Code, http.StatusConflict)
+	}
+
+	// an unreadable line stops the import after saving what came before it
+	first := `{"email":"lata@example.com","username":"lata","full_name":"Lata Iyer","date_of_birth":"1970-05-05","vid":"9123456789012351","phone_number":"9000000002"}` + "\n"
+	ndjson := map[string]string{echo.HeaderContentType: "application/x-ndjson"}
+	rec = do(e, http.MethodPost, "/api/admin/imports", admin, first+strings.Repeat("x", 70<<10)+"\n", ndjson)
+	var stopped struct{ Import models.ImportJob }
+	if err := json.Unmarshal(rec.Body.Bytes(), &stopped); rec.Code != http.StatusBadRequest || err != nil || stopped.Import.Records != 1 {
+		t.Fatalf("import with a long line = %d %s; want it stopped after one record", rec.Code, rec.Body)
+	}
+	path = fmt.Sprintf("/api/admin/imports/%d", stopped.Import.ID)
+	second := `{"email":"lata@example.com","full_name":"Arun Iyer","date_of_birth":"1968-02-02","vid":"9123456789012367","phone_number":"9000000003","relationship":"spouse"}` + "\n"
+	if rec := do(e, http.MethodPost, path, admin, `{"email":"someone@example.com"}`+"\n"+second, ndjson); rec.Code != http.StatusConflict {
+		t.Errorf("resume with another file = %d; want %d", rec.Code, http.StatusConflict)
+	}
+	rec = do(e, http.MethodPost, path, admin, first+second, ndjson)
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); rec.Code != http.StatusOK || err != nil || job.Records != 2 || job.Users != 1 || job.Profiles != 2 {
+		t.Errorf("resume = %d %s; want both records of one account", rec.Code, rec.Body)
+	}
+}
+
+func TestImport_FlagsDuplicates(t *testing.T) {
+	e, app := newTestApp(t)
+	admin := signUp(t, e)
+	if err := app.repo.Users.SetRole(context.Background(), "asha@example.com", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", admin, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	// another account with the same aadhaar number
+	file := "email,username,full_name,date_of_birth,aadhaar_number,phone_number\n" +
+		"ravi@example.com,ravi,Ravi Kumar,1988-07-09,2345 6789 0124,9000000009\n"
+	rec := do(e, http.MethodPost, "/api/admin/imports", admin, file, map[string]string{echo.HeaderContentType: "text/csv"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"profiles":1`) {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do(e, http.MethodGet, "/api/admin/duplicates", admin, "", nil)
+	var queue []models.Duplicate
+	if err := json.Unmarshal(rec.Body.Bytes(), &queue); rec.Code != http.StatusOK || err != nil || len(queue) != 1 {
+		t.Fatalf("queue = %d %s; want the imported profile paired with the existing one", rec.Code, rec.Body)
+	}
+	if got := queue[0].Reasons; len(got) != 1 || got[0] != models.DuplicateAadhaar {
+		t.Errorf("reasons = %v; want [%s]", got, models.DuplicateAadhaar)
+	}
+}
+
+func TestExport(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	consentToKYC(t, e, token)
+	scan := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("scan "), 100)...)
+	body, headers := fileUpload(t, "pan.pdf", scan, nil)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/attachments", token, body, headers); rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(e, http.MethodPost, "/api/restricted/account/export", token, `{"password":"correct horse","passphrase":"short"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("export with a short passphrase = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/account/export", token, `{"password":"wrong","passphrase":"a long enough passphrase"}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("export with a wrong password = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec := do(e, http.MethodPost, "/api/restricted/account/export", token, `{"password":"correct horse","passphrase":"a long enough passphrase"}`, nil)
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"status":"pending"`) {
+		t.Fatalf("export = %d %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get(echo.HeaderLocation)
+	app.jobs.Wait()
+
+	rec = do(e, http.MethodGet, location, token, "", nil)
+	var status exportStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.Status != models.ExportReady || !strings.HasPrefix(status.URL, "/api/files/") {
+		t.Fatalf("status = %d %s; want ready with a link", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "blob_key") || strings.Contains(rec.Body.String(), "data_key") {
+		t.Errorf("status = %s; want no keys", rec.Body)
+	}
+
+	rec = do(e, http.MethodGet, status.URL, "", "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "application/zip" {
+		t.Fatalf("download = %d %v", rec.Code, rec.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("download is not a ZIP: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 7 || names[0] != "account.json" || names[5] != "summary.html" || !strings.HasSuffix(names[6], "-pan.pdf") {
+		t.Errorf("archive holds %v; want the JSON files, the summary and the attachment", names)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("234567890124")) || bytes.Contains(rec.Body.Bytes(), []byte("asha@example.com")) {
+		t.Error("the archive is not encrypted")
+	}
+
+	if rec := do(e, http.MethodGet, status.URL, "", "", nil); rec.Code != http.StatusGone {
+		t.Errorf("second download = %d; want %d", rec.Code, http.StatusGone)
+	}
+	rec = do(e, http.MethodGet, location, token, "", nil)
+	if !strings.Contains(rec.Body.String(), `"status":"downloaded"`) || strings.Contains(rec.Body.String(), `"url"`) {
+		t.Errorf("status after download = %s", rec.Body)
+	}
+	user, _ := app.repo.Users.GetByEmail(context.Background(), "asha@example.com")
+	stored, err := app.repo.Exports.Get(context.Background(), user.ID, status.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.blobs.Get(context.Background(), stored.BlobKey); err != blob.ErrNotFound {
+		t.Errorf("archive after the download: %v; want %v", err, blob.ErrNotFound)
+	}
+}
+
+func TestConsents(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+
+	rec := do(e, http.MethodGet, "/api/restricted/consents", token, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"purpose":"marketing"`) || strings.Contains(rec.Body.String(), `"covered":true`) {
+		t.Fatalf("GET consents = %d %s; want every purpose, none covered", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPut, "/api/restricted/consents/telemetry", token, `{"notice_version":1}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("grant an unknown purpose = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodPut, "/api/restricted/consents/marketing", token, `{"notice_version":0}`, nil); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"notice_version":1`) {
+		t.Errorf("grant an old notice = %d %s; want %d naming the current version", rec.Code, rec.Body, http.StatusConflict)
+	}
+
+	rec = do(e, http.MethodPut, "/api/restricted/consents/marketing", token, `{"notice_version":1}`, nil)
+	var given models.Consent
+	if err := json.Unmarshal(rec.Body.Bytes(), &given); rec.Code != http.StatusCreated || err != nil || given.ID == 0 {
+		t.Fatalf("grant = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPut, "/api/restricted/consents/marketing", token, `{"notice_version":1}`, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), fmt.Sprintf(`"id":%d`, given.ID)) {
+		t.Errorf("grant again = %d %s; want the same consent", rec.Code, rec.Body)
+	}
+	user, _ := app.repo.Users.GetByEmail(context.Background(), "asha@example.com")
+	if err := app.checkConsent(context.Background(), user.ID, consent.PurposeMarketing); err != nil {
+		t.Errorf("checkConsent() after the grant = %v", err)
+	}
+
+	marketing, _ := consent.Default().Purpose(consent.PurposeMarketing)
+	rec = do(e, http.MethodGet, fmt.Sprintf("/api/restricted/consents/history/%d/receipt", given.ID), token, "", nil)
+	var receipt consent.Receipt
+	if err := json.Unmarshal(rec.Body.Bytes(), &receipt); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("receipt = %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), "attachment") || receipt.Principal.Email != "asha@example.com" ||
+		receipt.Status != consent.StatusActive || receipt.NoticeHash != marketing.Current().Hash() {
+		t.Errorf("receipt = %v %s", rec.Header(), rec.Body)
+	}
+
+	if rec := do(e, http.MethodDelete, "/api/restricted/consents/marketing", token, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "withdrawn_at") {
+		t.Fatalf("withdraw = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, "/api/restricted/consents/marketing", token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("withdraw twice = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := app.checkConsent(context.Background(), user.ID, consent.PurposeMarketing); err == nil {
+		t.Error("checkConsent() after the withdrawal = nil; want an error")
+	}
+	rec = do(e, http.MethodGet, fmt.Sprintf("/api/restricted/consents/history/%d/receipt", given.ID), token, "", nil)
+	if !strings.Contains(rec.Body.String(), `"status": "withdrawn"`) {
+		t.Errorf("receipt after the withdrawal = %s", rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/api/restricted/consents/history", token, "", nil); strings.Count(rec.Body.String(), `"purpose"`) != 1 {
+		t.Errorf("history = %s; want one consent", rec.Body)
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+
+	for _, body := range []string{`{"fields":[]}`, `{"fields":["address"]}`, `{"fields":["full_name"],"expires_in":"1000h"}`, `{"fields":["full_name"],"pin":"12ab"}`} {
+		if rec := do(e, http.MethodPost, "/api/restricted/profile/shares", token, body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s = %d; want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := do(e, http.MethodPost, "/api/restricted/profile/shares", token, `{"fields":["aadhaar_number","full_name","full_name"],"expires_in":"1h"}`, nil)
+	var open models.ShareLink
+	if err := json.Unmarshal(rec.Body.Bytes(), &open); rec.Code != http.StatusCreated || err != nil || open.URL == "" || len(open.Fields) != 2 || open.PINRequired {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(e, http.MethodGet, open.URL, "", "", nil)
+	var view struct {
+		Profile map[string]string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &view); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("view = %d %s", rec.Code, rec.Body)
+	}
+	if len(view.Profile) != 2 || view.Profile["full_name"] != "Asha Rao" || view.Profile["aadhaar_number"] != "XXXX XXXX 0124" {
+		t.Errorf("view = %s; want the name and the masked Aadhaar number only", rec.Body)
+	}
+	if rec := do(e, http.MethodGet, open.URL+"x", "", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("view with a tampered token = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodGet, "/api/files/"+strings.TrimPrefix(open.URL, "/api/share/"), "", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("share token as a download token = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = do(e, http.MethodPost, "/api/restricted/profile/shares", token, `{"fields":["phone_number","year_of_birth"],"pin":"4821"}`, nil)
+	var locked models.ShareLink
+	if err := json.Unmarshal(rec.Body.Bytes(), &locked); rec.Code != http.StatusCreated || err != nil || !locked.PINRequired {
+		t.Fatalf("create with a PIN = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, locked.URL, "", "", nil); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"pin_required":true`) {
+		t.Errorf("view without the PIN = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(e, http.MethodGet, locked.URL, "", "", map[string]string{HeaderSharePIN: "4821"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"phone_number":"XXXXXX3210"`) || !strings.Contains(rec.Body.String(), `"year_of_birth":"1990"`) {
+		t.Errorf("view with the PIN = %d %s", rec.Code, rec.Body)
+	}
+	for i := range maxSharePINFailures {
+		want := http.StatusUnauthorized
+		if i == maxSharePINFailures-1 {
+			want = http.StatusGone
+		}
+		if rec := do(e, http.MethodGet, locked.URL, "", "", map[string]string{HeaderSharePIN: "0000"}); rec.Code != want {
+			t.Errorf("wrong PIN %d = %d; want %d", i+1, rec.Code, want)
+		}
+	}
+	if rec := do(e, http.MethodGet, locked.URL, "", "", map[string]string{HeaderSharePIN: "4821"}); rec.Code != http.StatusGone {
+		t.Errorf("view after the lockout = %d; want %d", rec.Code, http.StatusGone)
+	}
+
+	rec = do(e, http.MethodGet, "/api/restricted/profile/shares", token, "", nil)
+	var list []models.ShareLink
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); rec.Code != http.StatusOK || err != nil || len(list) != 2 {
+		t.Fatalf("list = %d %s", rec.Code, rec.Body)
+	}
+	if list[0].ID != locked.ID || list[0].URL != "" || list[0].PINFailures != maxSharePINFailures || list[1].URL != open.URL || list[1].Accesses != 1 {
+		t.Errorf("list = %s; want the locked link without a URL and the open one viewed once", rec.Body)
+	}
+
+	path := fmt.Sprintf("/api/restricted/profile/shares/%d", open.ID)
+	if rec := do(e, http.MethodDelete, path, token, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "revoked_at") {
+		t.Fatalf("revoke = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, path, token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke twice = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(e, http.MethodGet, open.URL, "", "", nil); rec.Code != http.StatusGone {
+		t.Errorf("view after revoking = %d; want %d", rec.Code, http.StatusGone)
+	}
+
+	user, _ := app.repo.Users.GetByEmail(context.Background(), "asha@example.com")
+	records, _ := app.repo.Audit.ForUser(context.Background(), user.ID, 0, 100)
+	counts := map[string]int{}
+	for _, r := range records {
+		counts[r.Action]++
+	}
+	if counts[audit.ActionShareAccess] != 2 || counts[audit.ActionSharePINFailed] != maxSharePINFailures || counts[audit.ActionShareRevoke] != 1 {
+		t.Errorf("audit actions = %v; want every view, wrong PIN and revocation", counts)
+	}
+}
+
+func TestShareLinks_ParallelPINGuesses(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	rec := do(e, http.MethodPost, "/api/restricted/profile/shares", token, `{"fields":["full_name"],"pin":"4821"}`, nil)
+	var l models.ShareLink
+	if err := json.Unmarshal(rec.Body.Bytes(), &l); rec.Code != http.StatusCreated || err != nil {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	// a burst of guesses gets no more tries than the limit, however it races
+	const guesses = 4 * maxSharePINFailures
+	var wg sync.WaitGroup
+	for i := range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do(e, http.MethodGet, l.URL, "", "", map[string]string{HeaderSharePIN: fmt.Sprintf("%04d", i)})
+		}()
+	}
+	wg.Wait()
+
+	if rec := do(e, http.MethodGet, l.URL, "", "", map[string]string{HeaderSharePIN: "4821"}); rec.Code != http.StatusGone {
+		t.Errorf("view after the burst = %d; want %d", rec.Code, http.StatusGone)
+	}
+	user, _ := app.repo.Users.GetByEmail(context.Background(), "asha@example.com")
+	records, _ := app.repo.Audit.ForUser(context.Background(), user.ID, 0, 100)
+	failed := 0
+	for _, r := range records {
+		if r.Action == audit.ActionSharePINFailed {
+			failed++
+		}
+	}
+	if failed != maxSharePINFailures {
+		t.Errorf("%d PINs were checked; want %d", failed, maxSharePINFailures)
+	}
+}
+
+// statusBit reads a credential's bit from the status list the server serves.
+// The signature of the list is left to the vc package tests.
+func statusBit(t *testing.T, e *echo.Echo, id int) bool {
+	t.Helper()
+	list, index := vc.Entry(id)
+	rec := do(e, http.MethodGet, fmt.Sprintf("/api/credentials/status/%d", list), "", "", nil)
+	parts := strings.Split(rec.Body.String(), ".")
+	if rec.Code != http.StatusOK || len(parts) != 3 {
+		t.Fatalf("status list = %d %s", rec.Code, rec.Body)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims vc.Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	bits, err := vc.DecodeBitstring(claims.VC.CredentialSubject["encodedList"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bits.Get(index)
+}
+
+func TestCredentials(t *testing.T) {
+	e, app := newTestApp(t)
+	token := signUp(t, e)
+	if rec := do(e, http.MethodPost, "/api/restricted/profile", token, testProfile, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/credentials", token, `{"fields":["phone_number"]}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("issue with the phone number = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(e, http.MethodPost, "/api/restricted/profile/credentials", token, `{"fields":["full_name"]}`, nil); rec.Code != http.StatusConflict {
+		t.Errorf("issue before verification = %d; want %d", rec.Code, http.StatusConflict)
+	}
+
+	ctx := context.Background()
+	do(e, http.MethodPost, "/api/register", "", `{"email":"ravi@example.com","username":"ravi","password":"correct horse"}`, nil)
+	reviewer, _ := app.repo.Users.GetByEmail(ctx, "ravi@example.com")
+	user, _ := app.repo.Users.GetByEmail(ctx, "asha@example.com")
+	profile, _ := app.repo.Profiles.GetByUserID(ctx, user.ID)
+	if _, err := app.kyc.Submit(ctx, profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.kyc.Claim(ctx, profile.ID, reviewer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.kyc.Approve(ctx, profile.ID, reviewer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(e, http.MethodPost, "/api/restricted/profile/credentials", token, `{"fields":["aadhaar_number","full_name","year_of_birth"]}`, nil)
+	var cred models.Credential
+	if err := json.Unmarshal(rec.Body.Bytes(), &cred); rec.Code != http.StatusCreated || err != nil || cred.JWT == "" || len(cred.Fields) != 3 {
+		t.Fatalf("issue = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodGet, "/.well-known/did.json", "", "", nil); !strings.Contains(rec.Body.String(), `"id":"did:web:id.example.com"`) {
+		t.Errorf("DID document = %d %s", rec.Code, rec.Body)
+	}
+
+	verify := func(jwt string) (status string, subject map[string]string) {
+		t.Helper()
+		rec := do(e, http.MethodPost, "/api/credentials/verify", "", fmt.Sprintf(`{"credential":%q}`, jwt), nil)
+		var out struct {
+			Status            string
+			CredentialSubject map[string]string `json:"credential_subject"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("verify = %d %s", rec.Code, rec.Body)
+		}
+		return out.Status, out.CredentialSubject
+	}
+	status, subject := verify(cred.JWT)
+	if status != CredentialActive || subject["full_name"] != "Asha Rao" || subject["aadhaar_number"] != "XXXX XXXX 0124" || subject["year_of_birth"] != "1990" || subject["kyc_verified_at"] == "" {
+		t.Errorf("verify = %s %v; want an active credential with the masked Aadhaar number", status, subject)
+	}
+	if status, _ := verify(cred.JWT + "x"); status != CredentialInvalid {
+		t.Errorf("verify with a tampered signature = %s; want %s", status, CredentialInvalid)
+	}
+	if statusBit(t, e, cred.ID) {
+		t.Errorf("status bit of a valid credential is set")
+	}
+
+	path := fmt.Sprintf("/api/restricted/profile/credentials/%d", cred.ID)
+	if rec := do(e, http.MethodDelete, path, token, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "revoked_at") {
+		t.Fatalf("revoke = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(e, http.MethodDelete, path, token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke twice = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if status, _ := verify(cred.JWT); status != CredentialRevoked || !statusBit(t, e, cred.ID) {
+		t.Errorf("verify after revoking = %s; want %s and the bit set", status, CredentialRevoked)
+	}
+
+	// an edit sending the profile back for review revokes what it vouched for
+	rec = do(e, http.MethodPost, "/api/restricted/profile/credentials", token, `{"fields":["date_of_birth"]}`, nil)
+	var second models.Credential
+	if err := json.Unmarshal(rec.Body.Bytes(), &second); rec.Code != http.StatusCreated || err != nil {
+		t.Fatalf("second issue = %d %s", rec.Code, rec.Body)
+	}
+	etag := do(e, http.MethodGet, "/api/restricted/profile", token, "", nil).Header().Get(HeaderETag)
+	patch := map[string]string{echo.HeaderContentType: "application/merge-patch+json", HeaderIfMatch: etag}
+	if rec := do(e, http.MethodPatch, "/api/restricted/profile", token, `{"full_name":"Asha R. Rao"}`, patch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if status, _ := verify(second.JWT); status != CredentialRevoked || !statusBit(t, e, second.ID) {
+		t.Errorf("verify after an edit = %s; want %s and the bit set", status, CredentialRevoked)
+	}
+
+	rec = do(e, http.MethodGet, "/api/restricted/profile/credentials", token, "", nil)
+	var list []models.Credential
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); rec.Code != http.StatusOK || err != nil || len(list) != 2 {
+		t.Fatalf("list = %d %s", rec.Code, rec.Body)
+	}
+	if list[0].ID != second.ID || list[0].JWT != "" || list[1].RevokedAt == nil {
+		t.Errorf("list = %s; want both, newest first, without the signed credentials", rec.Body)
+	}
+
+	records, _ := app.repo.Audit.ForUser(ctx, user.ID, 0, 100)
+	counts := map[string]int{}
+	for _, r := range records {
+		counts[r.Action]++
+	}
+	if counts[audit.ActionCredentialIssue] != 2 || counts[audit.ActionCredentialRevoke] != 1 {
+		t.Errorf("audit actions = %v; want two issues and a revocation", counts)
+	}
+}
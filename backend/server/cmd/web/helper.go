@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Raaffs/profileManager/server/internal/cipher"
@@ -12,6 +16,7 @@ import (
 	"github.com/Raaffs/profileManager/server/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type HttpResponseMsg string
@@ -20,8 +25,20 @@ var ErrInternalServer=HttpResponseMsg("internal server error")
 var ErrBadRequest=HttpResponseMsg("bad request")
 var ErrUnauthorized=HttpResponseMsg("you're not authorized to perform this action")
 var ErrNotFound=HttpResponseMsg("not found")
+
+// echo has no constants for the conditional request headers
+const (
+    HeaderETag    = "ETag"
+    HeaderIfMatch = "If-Match"
+)
+
+const ErrStaleProfile = "profile was changed since you loaded it, reload and try again"
+const ErrAadhaarOnAccount = "another profile on this account already has this aadhaar number"
 var(
     ErrInvalidToken=errors.New("invalid token claims")
+    ErrMissingIfMatch=errors.New("missing If-Match header")
+    ErrStaleETag=errors.New("If-Match does not match the current profile")
+    ErrReauthFailed=errors.New("re-authentication failed")
 )
 
 type JwtCustomClaims struct {
@@ -32,7 +49,9 @@ func (app *Application) GenerateToken(userID int) (string, error) {
     claims:=&JwtCustomClaims{
 		userID,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),		},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
 	}
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString([]byte(app.env[env.JWT_SECRET]))
@@ -52,6 +71,82 @@ func (app *Application) GetUserJWT(c echo.Context) (int, error) {
     return int(userID), nil
 }
 
+// reauthenticate checks the account password again before destructive actions,
+// so a stolen token on its own cannot erase an account.
+func (app *Application) reauthenticate(ctx context.Context, userID int, password string) (*models.User, error) {
+    user, err := app.repo.Users.GetByID(ctx, userID)
+    if err != nil {
+        if errors.Is(err, models.NotFound) {
+            return nil, ErrReauthFailed
+        }
+        return nil, err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+        if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || user.PasswordHash == "" {
+            return nil, ErrReauthFailed
+        }
+        return nil, err
+    }
+    return user, nil
+}
+
+// recordAudit appends an entry to the audit chain. Failures are logged and
+// degrade health rather than failing the request that triggered them.
+func (app *Application) recordAudit(c echo.Context, userID int, action string) {
+    details := map[string]string{"ip": c.RealIP()}
+    if err := app.audit.Log(c.Request().Context(), userID, action, details); err != nil {
+        app.health.SetStatus(StatusDegraded)
+        app.logger.Errorf("error writing audit record \n%w", err)
+    }
+}
+
+// profileETag identifies one version of one profile row. Including the row id
+// means an ETag from a profile that was deleted and re-created never matches.
+func profileETag(p *models.Profile) string {
+    return fmt.Sprintf(`"%d.%d"`, p.ID, p.Version)
+}
+
+func parseProfileETag(tag string) (id, version int, ok bool) {
+    tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+    if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+        return 0, 0, false
+    }
+    idPart, versionPart, found := strings.Cut(tag[1:len(tag)-1], ".")
+    if !found {
+        return 0, 0, false
+    }
+    id, err := strconv.Atoi(idPart)
+    if err != nil {
+        return 0, 0, false
+    }
+    version, err = strconv.Atoi(versionPart)
+    if err != nil {
+        return 0, 0, false
+    }
+    return id, version, true
+}
+
+// ifMatchProfile reads the profile version a write was based on from If-Match.
+func ifMatchProfile(c echo.Context) (id, version int, err error) {
+    ifMatch := c.Request().Header.Get(HeaderIfMatch)
+    if ifMatch == "" {
+        return 0, 0, ErrMissingIfMatch
+    }
+    id, version, ok := parseProfileETag(ifMatch)
+    if !ok {
+        return 0, 0, ErrStaleETag
+    }
+    return id, version, nil
+}
+
+// preconditionFailed answers a write whose If-Match was missing (428) or stale (412).
+func preconditionFailed(c echo.Context, err error) error {
+    if errors.Is(err, ErrMissingIfMatch) {
+        return c.JSON(http.StatusPreconditionRequired, map[string]string{"error": "If-Match header with the profile ETag is required"})
+    }
+    return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": ErrStaleProfile})
+}
+
 func EncryptFields(secretKey string, fields ...*string) error {
     for i, field := range fields {
         // Skip empty optional fields to avoid storing encrypted empty strings
@@ -60,7 +155,7 @@ func EncryptFields(secretKey string, fields ...*string) error {
         }
         encryptedValue, err := cipher.Encrypt(secretKey, *field)
         if err != nil {
-            return fmt.Errorf("encryption failed for %s: %w", i, err)
+            return fmt.Errorf("encryption failed for field %d: %w", i, err)
         }
         *field = encryptedValue
     }
@@ -83,7 +178,16 @@ func DecryptFields(secretKey string, fields ...*string) error {
 
 func ValidateProfile(p models.Profile) *utils.Validator{
     validate := utils.NewValidator()
-	validate.Aadhar(p.AadhaarNumber)
+	// either form identifies the holder, and a profile may keep both
+	if p.AadhaarNumber == "" && p.VID == "" {
+		validate.AddError(utils.ErrAadhaarOrVIDRequired.Key, utils.ErrAadhaarOrVIDRequired.Message)
+	}
+	if p.AadhaarNumber != "" {
+		validate.Aadhar(p.AadhaarNumber)
+	}
+	if p.VID != "" {
+		validate.VID(p.VID)
+	}
 	validate.Date(p.DateOfBirth.Format("2006-01-02"))
 	validate.Phone(p.PhoneNumber)
 	validate.NameLength(p.FullName, 3, 20)
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type historyEntry struct {
+	Version   int64         `json:"version"`
+	ProfileID int           `json:"profile_id"`
+	Change    string        `json:"change"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Changes   []fieldChange `json:"changes"`
+}
+
+type profileField struct {
+	name  string
+	value string // plaintext, used for comparison
+	shown string // what the history response may reveal
+}
+
+// profileFields flattens a decrypted profile for diffing, masking the Aadhaar
+// number, VID and phone number in what is shown. A nil profile has every field empty.
+func profileFields(p *models.Profile) []profileField {
+	if p == nil {
+		p = &models.Profile{}
+	}
+	dob := ""
+	if !p.DateOfBirth.IsZero() {
+		dob = p.DateOfBirth.Format("2006-01-02")
+	}
+	aadhaar := ""
+	if p.AadhaarNumber != "" {
+		aadhaar = utils.MaskAadhaar(p.AadhaarNumber)
+	}
+	vid := ""
+	if p.VID != "" {
+		vid = utils.MaskVID(p.VID)
+	}
+	return []profileField{
+		{"full_name", p.FullName, p.FullName},
+		{"date_of_birth", dob, dob},
+		{"aadhaar_number", p.AadhaarNumber, aadhaar},
+		{"vid", p.VID, vid},
+		{"phone_number", p.PhoneNumber, utils.MaskPhone(p.PhoneNumber)},
+		{"address", p.Address, p.Address},
+	}
+}
+
+// diffProfiles lists the fields that differ between two decrypted versions.
+// Comparing plaintext means re-encrypting an unchanged Aadhaar number with a
+// fresh nonce does not show up as a change.
+func diffProfiles(prev, next *models.Profile) []fieldChange {
+	changes := []fieldChange{}
+	before, after := profileFields(prev), profileFields(next)
+	for i := range before {
+		if before[i].value != after[i].value {
+			changes = append(changes, fieldChange{Field: before[i].name, Old: before[i].shown, New: after[i].shown})
+		}
+	}
+	return changes
+}
+
+// GetProfileHistory lists the changes to one profile on /profiles/:id/history,
+// which also covers deleted profiles, or to every profile the account has had
+// on /profile/history. Each profile is diffed against its own previous version.
+func (app *Application) GetProfileHistory(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profileID, named, ok := profileIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	}
+
+	versions, err := app.repo.Profiles.History(c.Request().Context(), userID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching profile history \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if named {
+		versions = slices.DeleteFunc(versions, func(v models.ProfileVersion) bool { return v.Profile.ID != profileID })
+		if len(versions) == 0 {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+	}
+
+	history := make([]historyEntry, 0, len(versions))
+	previous := make(map[int]*models.Profile)
+	for i := range versions {
+		v := &versions[i]
+		if err := DecryptFields(app.env[env.AES_KEY], &v.Profile.AadhaarNumber, &v.Profile.VID); err != nil {
+			app.health.SetStatus(StatusCritical)
+			app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+
+		// a delete clears every field, a restore or a new profile starts from scratch
+		var next *models.Profile
+		if v.Change != models.ProfileDeleted {
+			next = &v.Profile
+		}
+		prev := previous[v.Profile.ID]
+		if v.Change == models.ProfileCreated || v.Change == models.ProfileRestored {
+			prev = nil
+		}
+		history = append(history, historyEntry{
+			Version:   v.Version,
+			ProfileID: v.Profile.ID,
+			Change:    v.Change,
+			ChangedAt: v.ChangedAt,
+			Changes:   diffProfiles(prev, next),
+		})
+		previous[v.Profile.ID] = next
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+// GetProfileAsOf returns one of a user's profiles as it was at the time given
+// in the "at" query parameter (RFC 3339), masked as in the history. The
+// profile is named by "profile_id" and defaults to the user's current primary.
+func (app *Application) GetProfileAsOf(c echo.Context) error {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	at, err := time.Parse(time.RFC3339, c.QueryParam("at"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "at must be an RFC 3339 timestamp"})
+	}
+
+	ctx := c.Request().Context()
+	var profileID int
+	if param := c.QueryParam("profile_id"); param != "" {
+		if profileID, err = strconv.Atoi(param); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "profile_id must be a number"})
+		}
+	} else {
+		primary, err := app.repo.Profiles.GetByUserID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, models.NotFound) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "user has no primary profile, name one with profile_id"})
+			}
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error fetching primary profile \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		profileID = primary.ID
+	}
+
+	version, err := app.repo.Profiles.AsOf(ctx, userID, profileID, at)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no profile existed at that time"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching profile version \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	if err := DecryptFields(app.env[env.AES_KEY], &version.Profile.AadhaarNumber, &version.Profile.VID); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if version.Profile.AadhaarNumber != "" {
+		version.Profile.AadhaarNumber = utils.MaskAadhaar(version.Profile.AadhaarNumber)
+	}
+	if version.Profile.VID != "" {
+		version.Profile.VID = utils.MaskVID(version.Profile.VID)
+	}
+	version.Profile.PhoneNumber = utils.MaskPhone(version.Profile.PhoneNumber)
+
+	app.recordAdminAudit(c, userID, audit.ActionProfileHistoryView)
+	return c.JSON(http.StatusOK, version)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/importer"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// importBatchSize is the number of records read, checked and inserted
+// together. A failed import resumes after the last batch it saved.
+const importBatchSize = 1000
+
+var (
+	errImportCompleted = errors.New("the import has already completed")
+	errImportMismatch  = errors.New("the file does not match the records the import has already read")
+	errImportBusy      = errors.New("the import is being run by another request")
+)
+
+// importFileError is a file that cannot be read any further.
+type importFileError struct {
+	err error
+}
+
+func (e importFileError) Error() string { return e.err.Error() }
+
+func (e importFileError) Unwrap() error { return e.err }
+
+// importAccountFields and profileFields name the import column a validator key
+// stands for.
+var (
+	importAccountFields = map[string]string{
+		utils.ErrInvalidEmail.Key:   "email",
+		utils.ErrNameOutofRange.Key: "username",
+	}
+	importProfileFields = map[string]string{
+		utils.ErrNameOutofRange.Key:      "full_name",
+		utils.ErrInvalidDate.Key:         "date_of_birth",
+		utils.ErrInvalidPhone.Key:        "phone_number",
+		utils.ErrInvalidAadharNumber.Key: "aadhaar_number",
+		utils.ErrInvalidVID.Key:          "vid",
+		utils.ErrInvalidRelationship.Key: "relationship",
+	}
+)
+
+// importRunner runs import jobs for the API and the CLI. by goes into the
+// details of every audit record the import writes, to say who ran it.
+type importRunner struct {
+	repo  *repository.Repository
+	audit *audit.Logger
+	env   map[string]string
+	by    map[string]string
+}
+
+// run reads the records of the file that the job has not read yet, in
+// batches, and saves each batch with the job's progress. A resumed job must be
+// given the same file again; the records it already read are skipped after
+// checking they are unchanged. A dry run checks rows against each other only
+// from the point it was last resumed.
+func (r *importRunner) run(ctx context.Context, job *models.ImportJob, rd *importer.Reader) error {
+	if job.Status == models.ImportCompleted {
+		return errImportCompleted
+	}
+	for range job.Records {
+		if _, err := rd.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errImportMismatch
+			}
+			return importFileError{err}
+		}
+	}
+	if job.Records > 0 && rd.Checksum() != job.Checksum {
+		return errImportMismatch
+	}
+
+	planner := importer.NewPlanner()
+	for {
+		batch := models.ImportBatch{Line: job.Line}
+		var rows []models.ImportRow
+		var readErr error
+		for batch.Records < importBatchSize {
+			rec, err := rd.Next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			batch.Records++
+			batch.Line = rec.Line
+			if len(rec.Errors) > 0 {
+				batch.Errors = append(batch.Errors, rec.Errors...)
+				continue
+			}
+			row := rec.Row
+			if errs := checkImportRow(&row); len(errs) > 0 {
+				batch.Errors = append(batch.Errors, errs...)
+				continue
+			}
+			if err := indexProfile(r.env[env.BLIND_INDEX_KEY], &row.Profile); err != nil {
+				return err
+			}
+			if err := EncryptFields(r.env[env.AES_KEY], &row.Profile.AadhaarNumber, &row.Profile.VID); err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			// the records before the unreadable one are saved all the same
+			if err := r.save(ctx, job, planner, &batch, rows, rd); err != nil {
+				return err
+			}
+			return importFileError{readErr}
+		}
+		if batch.Records > 0 {
+			if err := r.save(ctx, job, planner, &batch, rows, rd); err != nil {
+				return err
+			}
+		}
+		if readErr != nil {
+			return r.repo.Imports.Complete(ctx, job)
+		}
+	}
+}
+
+// checkImportRow normalizes and validates a row the way Register and
+// CreateProfile do, returning the row's errors.
+func checkImportRow(row *models.ImportRow) []models.ImportError {
+	account := utils.NewValidator()
+	account.Check(account.Mail(row.Email), utils.ErrInvalidEmail.Key, utils.ErrInvalidEmail.Message)
+	if row.Username != "" {
+		account.NameLength(row.Username, 3, 20)
+	}
+	p := &row.Profile
+	if p.Relationship == "" {
+		p.Relationship = models.RelationshipSelf
+	}
+	normalizeAadhaar(p)
+	profile := ValidateProfile(*p)
+	profile.Relationship(p.Relationship)
+
+	errs := importErrors(row.Line, account, importAccountFields)
+	if row.PasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(row.PasswordHash)); err != nil {
+			errs = append(errs, models.ImportError{Line: row.Line, Field: "password_hash", Message: "must be a bcrypt hash"})
+		}
+	}
+	return append(errs, importErrors(row.Line, profile, importProfileFields)...)
+}
+
+// importErrors turns a validator's errors into import errors, sorted by
+// field so that a report is the same from one run to the next.
+func importErrors(line int, v *utils.Validator, fields map[string]string) []models.ImportError {
+	var errs []models.ImportError
+	for _, key := range slices.Sorted(maps.Keys(v.Errors)) {
+		field, ok := fields[key]
+		if !ok {
+			field = key
+		}
+		errs = append(errs, models.ImportError{Line: line, Field: field, Message: v.Errors[key]})
+	}
+	return errs
+}
+
+// save plans a batch against the database and inserts it together with the
+// audit records of the accounts and profiles it creates and the duplicates
+// they are flagged as.
+func (r *importRunner) save(ctx context.Context, job *models.ImportJob, planner *importer.Planner, batch *models.ImportBatch, rows []models.ImportRow, rd *importer.Reader) error {
+	existing, err := r.repo.Imports.Existing(ctx, rows)
+	if err != nil {
+		return err
+	}
+	planner.Plan(batch, rows, existing)
+	batch.Checksum = rd.Checksum()
+	slices.SortStableFunc(batch.Errors, func(a, b models.ImportError) int { return a.Line - b.Line })
+
+	// the job is only moved on once the transaction commits
+	saved := *job
+	err = r.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Imports.Insert(ctx, &saved, batch); err != nil {
+			return err
+		}
+		if saved.DryRun {
+			return nil
+		}
+		logger := r.audit.WithRepo(tx.Audit)
+		details := func(extra map[string]string) map[string]string {
+			d := maps.Clone(r.by)
+			d["import_id"] = strconv.Itoa(job.ID)
+			maps.Copy(d, extra)
+			return d
+		}
+		for _, u := range batch.Users {
+			if err := logger.Log(ctx, u.ID, audit.ActionUserImport, details(nil)); err != nil {
+				return err
+			}
+		}
+		for _, row := range batch.Rows {
+			p := row.Profile
+			profileID := map[string]string{"profile_id": strconv.Itoa(p.ID)}
+			if err := logger.Log(ctx, p.UserID, audit.ActionProfileImport, details(profileID)); err != nil {
+				return err
+			}
+			// flagged with the batch, so a resumed import does not skip them
+			pending, err := findDuplicates(ctx, tx, &p)
+			if err != nil {
+				return err
+			}
+			for range pending {
+				if err := logger.Log(ctx, p.UserID, audit.ActionDuplicateFlag, details(profileID)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, models.VersionConflict) {
+		return errImportBusy
+	}
+	if err != nil {
+		return err
+	}
+	*job = saved
+	return nil
+}
+
+func (app *Application) importRunner(c echo.Context) *importRunner {
+	adminID, _ := app.GetUserJWT(c)
+	return &importRunner{
+		repo:  app.repo,
+		audit: app.audit,
+		env:   app.env,
+		by:    map[string]string{"ip": c.RealIP(), "admin_id": strconv.Itoa(adminID)},
+	}
+}
+
+func importIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("importID"))
+	return id, err == nil && id > 0
+}
+
+// importFormat picks the format of an upload from ?format, or else from its
+// content type.
+func importFormat(c echo.Context) string {
+	if format := c.QueryParam("format"); format != "" {
+		return format
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case "text/csv":
+		return models.ImportCSV
+	case "application/x-ndjson", "application/jsonl":
+		return models.ImportNDJSON
+	}
+	return ""
+}
+
+// runImport runs the job over the request body and answers with the job as
+// it stands, which on a failure says how far the import got.
+func (app *Application) runImport(c echo.Context, job *models.ImportJob, rd *importer.Reader) error {
+	err := app.importRunner(c).run(c.Request().Context(), job, rd)
+	var fileErr importFileError
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, job)
+	case errors.As(err, &fileErr):
+		return c.JSON(http.StatusBadRequest, map[string]any{"error": fileErr.Error(), "import": job})
+	case errors.Is(err, errImportCompleted), errors.Is(err, errImportMismatch), errors.Is(err, errImportBusy):
+		return c.JSON(http.StatusConflict, map[string]any{"error": err.Error(), "import": job})
+	case errors.Is(err, models.AlreadyExists):
+		// written since the batch was checked; a resume checks it again
+		return c.JSON(http.StatusConflict, map[string]any{"error": "an account or profile in the batch was created during the import; resume it to retry", "import": job})
+	}
+	app.health.SetStatus(StatusDegraded)
+	app.logger.Errorf("error running import \n%w", err)
+	return c.JSON(http.StatusInternalServerError, map[string]any{"error": ErrInternalServer, "import": job})
+}
+
+// CreateImport starts an import of the CSV or NDJSON file in the request body
+// and runs it to the end. ?dry_run=true checks every row and reports the
+// errors without creating anything.
+func (app *Application) CreateImport(c echo.Context) error {
+	adminID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	format := importFormat(c)
+	if format != models.ImportCSV && format != models.ImportNDJSON {
+		return c.JSON(http.StatusBadRequest, map[string]string{"format": "must be csv or ndjson"})
+	}
+	dryRun, err := strconv.ParseBool(c.QueryParam("dry_run"))
+	if err != nil && c.QueryParam("dry_run") != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"dry_run": "must be true or false"})
+	}
+
+	rd, err := importer.NewReader(c.Request().Body, format)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	job := models.ImportJob{AdminID: &adminID, Format: format, DryRun: dryRun}
+	if err := app.repo.Imports.Create(c.Request().Context(), &job); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating import \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/admin/imports/%d", job.ID))
+	return app.runImport(c, &job, rd)
+}
+
+// ResumeImport carries on with an import that stopped part way, given the
+// same file again.
+func (app *Application) ResumeImport(c echo.Context) error {
+	job, err := app.loadImport(c)
+	if err != nil {
+		return app.importLoadError(c, err)
+	}
+	rd, err := importer.NewReader(c.Request().Body, job.Format)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return app.runImport(c, job, rd)
+}
+
+func (app *Application) loadImport(c echo.Context) (*models.ImportJob, error) {
+	id, ok := importIDParam(c)
+	if !ok {
+		return nil, models.NotFound
+	}
+	return app.repo.Imports.Get(c.Request().Context(), id)
+}
+
+func (app *Application) importLoadError(c echo.Context, err error) error {
+	if errors.Is(err, models.NotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "import not found"})
+	}
+	app.health.SetStatus(StatusDegraded)
+	app.logger.Errorf("error fetching import \n%w", err)
+	return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+}
+
+// GetImport returns an import's status and counts.
+func (app *Application) GetImport(c echo.Context) error {
+	job, err := app.loadImport(c)
+	if err != nil {
+		return app.importLoadError(c, err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// ImportErrorReport downloads the rows an import rejected as CSV, one line
+// per error with the line number of the row in the file.
+func (app *Application) ImportErrorReport(c echo.Context) error {
+	id, ok := importIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "import not found"})
+	}
+	errs, err := app.repo.Imports.Errors(c.Request().Context(), id)
+	if err != nil {
+		return app.importLoadError(c, err)
+	}
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="import-%d-errors.csv"`, id))
+	res.WriteHeader(http.StatusOK)
+	return writeImportErrors(res, errs)
+}
+
+func writeImportErrors(w io.Writer, errs []models.ImportError) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"line", "field", "message"})
+	for _, e := range errs {
+		cw.Write([]string{strconv.Itoa(e.Line), e.Field, e.Message})
+	}
+	cw.Flush()
+	return cw.Error()
+}
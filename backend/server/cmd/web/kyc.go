@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/kyc"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultKYCValidity = 365 * 24 * time.Hour
+	defaultKYCClaimTTL = time.Hour
+	// maxKYCQueue caps a page of the reviewer queue.
+	maxKYCQueue = 100
+)
+
+// kycError answers a request whose KYC transition failed.
+func (app *Application) kycError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, kyc.ErrTransition), errors.Is(err, kyc.ErrClaimed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, kyc.ErrNotClaimant), errors.Is(err, kyc.ErrOwnProfile):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, kyc.ErrReasonCode):
+		return c.JSON(http.StatusBadRequest, map[string]string{"reason_code": "unknown reason code"})
+	case errors.Is(err, kyc.ErrNoteMissing):
+		return c.JSON(http.StatusBadRequest, map[string]string{"note": "a note is required with reason code other"})
+	case errors.Is(err, kyc.ErrQueueEmpty):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no profiles are waiting for review"})
+	case errors.Is(err, models.NotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	case errors.Is(err, models.VersionConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "the review state changed, reload and try again"})
+	}
+	app.health.SetStatus(StatusDegraded)
+	app.logger.Errorf("error updating KYC state \n%w", err)
+	return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+}
+
+// GetKYC returns the verification state of a profile.
+func (app *Application) GetKYC(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	k, err := app.kyc.Get(c.Request().Context(), profile.ID)
+	if err != nil {
+		return app.kycError(c, err)
+	}
+	return c.JSON(http.StatusOK, ownerKYC(k))
+}
+
+// ownerKYC hides who reviewed a profile from its owner, and spells out the
+// reason for a rejection.
+func ownerKYC(k *models.KYC) map[string]any {
+	out := map[string]any{
+		"profile_id":   k.ProfileID,
+		"status":       k.Status,
+		"submitted_at": k.SubmittedAt,
+		"verified_at":  k.VerifiedAt,
+	}
+	if k.Status == models.KYCRejected {
+		out["reason_code"] = k.ReasonCode
+		out["reason"] = kyc.ReasonCodes[k.ReasonCode]
+		out["note"] = k.Note
+	}
+	return out
+}
+
+// SubmitKYC puts a profile in the review queue.
+func (app *Application) SubmitKYC(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if err := app.checkConsent(c.Request().Context(), userID, consent.PurposeKYC); err != nil {
+		return app.consentError(c, err)
+	}
+	return app.ownerKYCAction(c, userID, audit.ActionKYCSubmit, app.kyc.Submit)
+}
+
+// WithdrawKYC takes a submitted profile out of the queue before a reviewer
+// claims it.
+func (app *Application) WithdrawKYC(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	return app.ownerKYCAction(c, userID, audit.ActionKYCWithdraw, app.kyc.Withdraw)
+}
+
+func (app *Application) ownerKYCAction(c echo.Context, userID int, action string, fn func(context.Context, int) (*models.KYC, error)) error {
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	k, err := fn(c.Request().Context(), profile.ID)
+	if err != nil {
+		return app.kycError(c, err)
+	}
+	app.recordProfileAudit(c, userID, profile.ID, action)
+	return c.JSON(http.StatusOK, ownerKYC(k))
+}
+
+// reopenKYC records that an edit sent a verified profile back for review.
+func (app *Application) reopenKYC(c echo.Context, userID, profileID int, reopened bool) {
+	if reopened {
+		app.recordProfileAudit(c, userID, profileID, audit.ActionKYCReopen)
+	}
+}
+
+// KYCQueue lists the profiles waiting for review or being reviewed, longest
+// waiting first, up to ?limit.
+func (app *Application) KYCQueue(c echo.Context) error {
+	limit := maxKYCQueue
+	if param := c.QueryParam("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxKYCQueue {
+			return c.JSON(http.StatusBadRequest, map[string]string{"limit": "must be between 1 and " + strconv.Itoa(maxKYCQueue)})
+		}
+		limit = n
+	}
+	queue, err := app.repo.KYC.Queue(c.Request().Context(), limit)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing the KYC queue \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, queue)
+}
+
+// ReviewKYC returns what a reviewer needs to decide on a profile: its state,
+// the profile with the Aadhaar number and VID masked, and its eKYC
+// verifications.
+func (app *Application) ReviewKYC(c echo.Context) error {
+	profileID, err := strconv.Atoi(c.Param("profileID"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	}
+	ctx := c.Request().Context()
+	k, err := app.repo.KYC.Get(ctx, profileID)
+	if err != nil {
+		return app.kycError(c, err)
+	}
+	profile, err := app.repo.Profiles.Get(ctx, k.UserID, profileID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	if err := DecryptFields(app.env[env.AES_KEY], &profile.AadhaarNumber, &profile.VID); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if profile.AadhaarNumber != "" {
+		profile.AadhaarNumber = utils.MaskAadhaar(profile.AadhaarNumber)
+	}
+	if profile.VID != "" {
+		profile.VID = utils.MaskVID(profile.VID)
+	}
+	verifications, err := app.repo.EKYC.List(ctx, profileID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing eKYC verifications \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"kyc":     k,
+		"profile": profile,
+		"ekyc":    verifications,
+	})
+}
+
+// ClaimNextKYC claims the profile that has waited longest for review.
+func (app *Application) ClaimNextKYC(c echo.Context) error {
+	reviewerID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	k, err := app.kyc.ClaimNext(c.Request().Context(), reviewerID)
+	if err != nil {
+		return app.kycError(c, err)
+	}
+	app.recordProfileAudit(c, reviewerID, k.ProfileID, audit.ActionKYCClaim)
+	return c.JSON(http.StatusOK, k)
+}
+
+// ClaimKYC claims a profile for review, or renews the caller's claim on it.
+func (app *Application) ClaimKYC(c echo.Context) error {
+	return app.reviewKYCAction(c, audit.ActionKYCClaim, app.kyc.Claim)
+}
+
+// ReleaseKYC puts a claimed profile back in the queue.
+func (app *Application) ReleaseKYC(c echo.Context) error {
+	return app.reviewKYCAction(c, audit.ActionKYCRelease, app.kyc.Release)
+}
+
+// ApproveKYC verifies a profile the caller has claimed.
+func (app *Application) ApproveKYC(c echo.Context) error {
+	return app.reviewKYCAction(c, audit.ActionKYCApprove, app.kyc.Approve)
+}
+
+// RejectKYC turns down a profile the caller has claimed. The body names one of
+// kyc.ReasonCodes and may add a note for the owner.
+func (app *Application) RejectKYC(c echo.Context) error {
+	var req struct {
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		app.logger.Errorf("error binding json to type kyc rejection \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	return app.reviewKYCAction(c, audit.ActionKYCReject, func(ctx context.Context, profileID, reviewerID int) (*models.KYC, error) {
+		return app.kyc.Reject(ctx, profileID, reviewerID, req.ReasonCode, req.Note)
+	})
+}
+
+func (app *Application) reviewKYCAction(c echo.Context, action string, fn func(ctx context.Context, profileID, reviewerID int) (*models.KYC, error)) error {
+	reviewerID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	profileID, err := strconv.Atoi(c.Param("profileID"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	}
+	k, err := fn(c.Request().Context(), profileID, reviewerID)
+	if err != nil {
+		return app.kycError(c, err)
+	}
+	app.recordProfileAudit(c, reviewerID, profileID, action)
+	return c.JSON(http.StatusOK, k)
+}
+
+// expireKYC moves verifications past their validity to expired. It runs with
+// the purge worker.
+func (app *Application) expireKYC(ctx context.Context) {
+	n, err := app.kyc.Expire(ctx)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error expiring KYC verifications \n%w", err)
+		return
+	}
+	if n > 0 {
+		app.logger.Infof("kyc: expired %d verifications", n)
+	}
+}
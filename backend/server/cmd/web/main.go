@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/cipher"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/ekyc"
+	"github.com/Raaffs/profileManager/server/internal/kyc"
 	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/pincode"
 	"github.com/Raaffs/profileManager/server/internal/repository"
-	"github.com/Raaffs/profileManager/server/internal/store/postgres"
+	"github.com/Raaffs/profileManager/server/internal/vc"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 
@@ -24,6 +34,22 @@ type Application struct {
 	repo   *repository.Repository
 	logger echo.Logger
 	health *HealthChecker
+	audit  *audit.Logger
+	pincodes *pincode.Directory
+	// ekyc and aadhaarQR are nil when their UIDAI keys are not configured
+	ekyc      *ekyc.Verifier
+	aadhaarQR *ekyc.QRVerifier
+	kyc       *kyc.Service
+	// blobs is nil when BLOB_URL is unset, which turns attachments off
+	blobs       blob.BlobStore
+	downloads   *blob.Signer
+	downloadTTL time.Duration
+	consents    *consent.Catalogue
+	shares      *blob.Signer
+	// issuer is nil when VC_ISSUER_DOMAIN or VC_SIGNING_KEY is unset
+	issuer *vc.Issuer
+	// jobs tracks work that outlives its request, such as building exports
+	jobs sync.WaitGroup
 }
 
 func connectWithRetry(ctx context.Context, dbURL string) (*pgxpool.Pool, error) {
@@ -66,29 +92,276 @@ func loadEnv() map[string]string {
         env.CLIENT_PORT: os.Getenv(env.CLIENT_PORT),
         env.JWT_SECRET:  os.Getenv(env.JWT_SECRET),
         env.AES_KEY:     os.Getenv(env.AES_KEY),
+        env.AUDIT_SIGNING_KEY:         os.Getenv(env.AUDIT_SIGNING_KEY),
+        env.AUDIT_VERIFY_KEY:          os.Getenv(env.AUDIT_VERIFY_KEY),
+        env.AUDIT_CHECKPOINT_INTERVAL: os.Getenv(env.AUDIT_CHECKPOINT_INTERVAL),
+        env.AUTO_MIGRATE:              os.Getenv(env.AUTO_MIGRATE),
+        env.DELETED_RETENTION:         os.Getenv(env.DELETED_RETENTION),
+        env.PURGE_INTERVAL:            os.Getenv(env.PURGE_INTERVAL),
+        env.PINCODE_DATA:              os.Getenv(env.PINCODE_DATA),
+        env.BLIND_INDEX_KEY:           os.Getenv(env.BLIND_INDEX_KEY),
+        env.EKYC_CERT:                 os.Getenv(env.EKYC_CERT),
+        env.AADHAAR_QR_KEY:            os.Getenv(env.AADHAAR_QR_KEY),
+        env.KYC_VALIDITY:              os.Getenv(env.KYC_VALIDITY),
+        env.KYC_CLAIM_TTL:             os.Getenv(env.KYC_CLAIM_TTL),
+        env.BLOB_URL:                  os.Getenv(env.BLOB_URL),
+        env.S3_ACCESS_KEY:             os.Getenv(env.S3_ACCESS_KEY),
+        env.S3_SECRET_KEY:             os.Getenv(env.S3_SECRET_KEY),
+        env.DOWNLOAD_URL_KEY:          os.Getenv(env.DOWNLOAD_URL_KEY),
+        env.DOWNLOAD_URL_TTL:          os.Getenv(env.DOWNLOAD_URL_TTL),
+        env.CONSENT_NOTICES:           os.Getenv(env.CONSENT_NOTICES),
+        env.SHARE_LINK_KEY:            os.Getenv(env.SHARE_LINK_KEY),
+        env.VC_ISSUER_DOMAIN:          os.Getenv(env.VC_ISSUER_DOMAIN),
+        env.VC_SIGNING_KEY:            os.Getenv(env.VC_SIGNING_KEY),
     }
     return envMap
 }
 
+func migrateOnStart(ctx context.Context, m migrator) error {
+	applied, err := m.Up(ctx, false)
+	for _, mig := range applied {
+		log.Printf("applied migration %06d_%s", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// defaultCheckpointInterval is used when AUDIT_CHECKPOINT_INTERVAL is unset.
+const defaultCheckpointInterval = 100
+
+func newAuditLogger(repo *repository.Repository, envMap map[string]string) (*audit.Logger, error) {
+	key, err := audit.ParseSigningKey(envMap[env.AUDIT_SIGNING_KEY])
+	if err != nil {
+		return nil, err
+	}
+	interval, err := checkpointInterval(envMap)
+	if err != nil {
+		return nil, err
+	}
+	return audit.NewLogger(repo.Audit, key, interval), nil
+}
+
+// checkpointInterval reads AUDIT_CHECKPOINT_INTERVAL, which the logger signs
+// by and verify-audit expects checkpoints at.
+func checkpointInterval(envMap map[string]string) (int, error) {
+	v := envMap[env.AUDIT_CHECKPOINT_INTERVAL]
+	if v == "" {
+		return defaultCheckpointInterval, nil
+	}
+	interval, err := strconv.Atoi(v)
+	if err != nil || interval < 1 {
+		return 0, fmt.Errorf("invalid %s %q", env.AUDIT_CHECKPOINT_INTERVAL, v)
+	}
+	return interval, nil
+}
+
+// durationEnv reads a time.Duration such as "720h" from the env map, falling
+// back to def when the variable is unset.
+func durationEnv(envMap map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v := envMap[key]
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return d, nil
+}
+
+// loadPincodes opens the PIN code directory named by PINCODE_DATA, or the
+// embedded one when it is unset.
+func loadPincodes(envMap map[string]string) (*pincode.Directory, error) {
+	if path := envMap[env.PINCODE_DATA]; path != "" {
+		return pincode.Open(path)
+	}
+	return pincode.Default(), nil
+}
+
+// loadConsents opens the catalogue of consent purposes named by
+// CONSENT_NOTICES, or the embedded one when it is unset.
+func loadConsents(envMap map[string]string) (*consent.Catalogue, error) {
+	if path := envMap[env.CONSENT_NOTICES]; path != "" {
+		return consent.Open(path)
+	}
+	return consent.Default(), nil
+}
+
+// loadShareLinks makes the signer of profile share links, keyed by the base64
+// SHARE_LINK_KEY. Share links are turned off when it is unset.
+func loadShareLinks(envMap map[string]string) (*blob.Signer, error) {
+	if envMap[env.SHARE_LINK_KEY] == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(envMap[env.SHARE_LINK_KEY])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", env.SHARE_LINK_KEY, err)
+	}
+	return blob.NewSigner(key)
+}
+
+// loadIssuer makes the Verifiable Credential issuer, did:web:VC_ISSUER_DOMAIN
+// signing with the Ed25519 seed in VC_SIGNING_KEY. Credentials are turned off
+// unless both are set.
+func loadIssuer(envMap map[string]string) (*vc.Issuer, error) {
+	if envMap[env.VC_ISSUER_DOMAIN] == "" || envMap[env.VC_SIGNING_KEY] == "" {
+		return nil, nil
+	}
+	key, err := audit.ParseSigningKey(envMap[env.VC_SIGNING_KEY])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", env.VC_SIGNING_KEY, err)
+	}
+	return vc.NewIssuer(envMap[env.VC_ISSUER_DOMAIN], key)
+}
+
+// loadEKYC reads the UIDAI signing certificates named by EKYC_CERT. Offline
+// eKYC uploads are turned off when it is unset.
+func loadEKYC(envMap map[string]string) (*ekyc.Verifier, error) {
+	if path := envMap[env.EKYC_CERT]; path != "" {
+		return ekyc.Open(path)
+	}
+	return nil, nil
+}
+
+// loadAadhaarQR reads the UIDAI public key named by AADHAAR_QR_KEY. Secure QR
+// verification is turned off when it is unset.
+func loadAadhaarQR(envMap map[string]string) (*ekyc.QRVerifier, error) {
+	if path := envMap[env.AADHAAR_QR_KEY]; path != "" {
+		return ekyc.OpenQR(path)
+	}
+	return nil, nil
+}
+
+// loadBlobs opens the blob store named by BLOB_URL and the signer of its
+// download URLs, keyed by the base64 DOWNLOAD_URL_KEY. Attachments are turned
+// off when BLOB_URL is unset.
+func loadBlobs(envMap map[string]string) (blob.BlobStore, *blob.Signer, error) {
+	if envMap[env.BLOB_URL] == "" {
+		return nil, nil, nil
+	}
+	store, err := blob.Open(envMap[env.BLOB_URL], envMap[env.S3_ACCESS_KEY], envMap[env.S3_SECRET_KEY])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(envMap[env.DOWNLOAD_URL_KEY])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", env.DOWNLOAD_URL_KEY, err)
+	}
+	signer, err := blob.NewSigner(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, signer, nil
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	conn, err := connectWithRetry(ctx,loadEnv()[env.DB_URL]);if err!=nil{
+	envMap := loadEnv()
+	db, err := openDatabase(ctx, envMap[env.DB_URL]);if err!=nil{
 		log.Fatalf("Could not connect to DB: %v", err)
 	}
+	repo := db.repo
+
+	if len(os.Args) > 1 {
+		code := runCommand(ctx, db, envMap, os.Args[1:])
+		db.close()
+		os.Exit(code)
+	}
+
+	if envMap[env.AUTO_MIGRATE] != "false" {
+		if err := migrateOnStart(ctx, db.migrator); err != nil {
+			log.Fatalf("Could not migrate DB: %v", err)
+		}
+	}
+
+	auditLogger, err := newAuditLogger(repo, envMap)
+	if err != nil {
+		log.Fatalf("Could not set up audit log: %v", err)
+	}
+
+	retention, err := durationEnv(envMap, env.DELETED_RETENTION, defaultRetention)
+	if err != nil {
+		log.Fatal(err)
+	}
+	purgeInterval, err := durationEnv(envMap, env.PURGE_INTERVAL, defaultPurgeInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	kycValidity, err := durationEnv(envMap, env.KYC_VALIDITY, defaultKYCValidity)
+	if err != nil {
+		log.Fatal(err)
+	}
+	kycClaimTTL, err := durationEnv(envMap, env.KYC_CLAIM_TTL, defaultKYCClaimTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := cipher.BlindIndex(envMap[env.BLIND_INDEX_KEY], "", ""); err != nil {
+		log.Fatalf("Could not set up blind indexes: %v", err)
+	}
+
+	pincodes, err := loadPincodes(envMap)
+	if err != nil {
+		log.Fatalf("Could not load PIN code directory: %v", err)
+	}
+
+	consents, err := loadConsents(envMap)
+	if err != nil {
+		log.Fatalf("Could not load consent notices: %v", err)
+	}
+
+	ekycVerifier, err := loadEKYC(envMap)
+	if err != nil {
+		log.Fatalf("Could not load eKYC certificates: %v", err)
+	}
+	qrVerifier, err := loadAadhaarQR(envMap)
+	if err != nil {
+		log.Fatalf("Could not load Aadhaar QR key: %v", err)
+	}
+
+	blobs, downloads, err := loadBlobs(envMap)
+	if err != nil {
+		log.Fatalf("Could not set up attachments: %v", err)
+	}
+	downloadTTL, err := durationEnv(envMap, env.DOWNLOAD_URL_TTL, defaultDownloadURLTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shares, err := loadShareLinks(envMap)
+	if err != nil {
+		log.Fatalf("Could not set up share links: %v", err)
+	}
+	issuer, err := loadIssuer(envMap)
+	if err != nil {
+		log.Fatalf("Could not set up credentials: %v", err)
+	}
 
 	srv := echo.New()
 	app := &Application{
-		env:    loadEnv(),
-		repo:   store.NewPostgresRepo(conn),
+		env:    envMap,
+		repo:   repo,
 		logger: srv.Logger,
 		health: &HealthChecker{status: StatusHealthy},
+		audit:  auditLogger,
+		pincodes: pincodes,
+		ekyc:     ekycVerifier,
+		aadhaarQR: qrVerifier,
+		kyc:       kyc.NewService(repo.KYC, kycClaimTTL, kycValidity),
+		blobs:       blobs,
+		downloads:   downloads,
+		downloadTTL: downloadTTL,
+		consents:    consents,
+		shares:      shares,
+		issuer:      issuer,
 	}
 
 	app.RegisterRoutes(srv)
 	app.LoadMiddleware(srv)
 	srv.Logger=app.logger
+
+	go app.runPurgeWorker(ctx, retention, purgeInterval)
 	
 	go func() {
 		log.Println(" Server starting on ", app.env[env.API_PORT])
@@ -99,7 +372,9 @@ func main() {
 
 	<-ctx.Done()
 	log.Println("\n'Ctrl+C' received, shutting down server...")
-	conn.Close()
+	// exports being built get to finish; each is bounded by exportTimeout
+	app.jobs.Wait()
+	db.close()
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	echojwt "github.com/labstack/echo-jwt/v4"
 )
@@ -9,4 +16,59 @@ func (app *Application) Authenticate() echo.MiddlewareFunc {
         SigningKey: []byte(app.env["JWT_SECRET"]),
         TokenLookup: "header:Authorization:Bearer ",
     })
-}
\ No newline at end of file
+}
+
+// RequireActiveSession rejects tokens issued before the user's sessions were
+// revoked, which happens when the account is deleted. It must run after the
+// JWT middleware has put the token into the context.
+func (app *Application) RequireActiveSession(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        token, ok := c.Get("user").(*jwt.Token)
+        if !ok {
+            return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+        }
+        claims, ok := token.Claims.(*JwtCustomClaims)
+        if !ok {
+            return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+        }
+
+        revokedAt, err := app.repo.Sessions.RevokedAt(c.Request().Context(), claims.UserID)
+        if err != nil {
+            app.health.SetStatus(StatusDegraded)
+            app.logger.Errorf("error checking session revocation \n%w", err)
+            return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+        }
+        // iat only has second precision, so anything issued in the second of
+        // the revocation is treated as revoked too
+        if !revokedAt.IsZero() && (claims.IssuedAt == nil || !claims.IssuedAt.After(revokedAt.Truncate(time.Second))) {
+            return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+        }
+        return next(c)
+    }
+}
+
+// RequireRole only lets through users holding one of the given roles. The role
+// is read from the database so that revoking it takes effect immediately.
+func (app *Application) RequireRole(roles ...string) echo.MiddlewareFunc {
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            userID, err := app.GetUserJWT(c)
+            if err != nil {
+                return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+            }
+            user, err := app.repo.Users.GetByID(c.Request().Context(), userID)
+            if err != nil {
+                if errors.Is(err, models.NotFound) {
+                    return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+                }
+                app.health.SetStatus(StatusDegraded)
+                app.logger.Errorf("error fetching user by id \n%w", err)
+                return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+            }
+            if !slices.Contains(roles, user.Role) {
+                return c.JSON(http.StatusForbidden, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+            }
+            return next(c)
+        }
+    }
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/patch"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPatchSize caps PATCH bodies; a full profile is well under a kilobyte.
+const maxPatchSize = 64 << 10
+
+// profileDocument renders a decrypted profile as the JSON object patches are
+// applied to.
+func profileDocument(p *models.Profile) patch.Document {
+	return patch.Document{
+		models.FieldFullName:      p.FullName,
+		models.FieldDateOfBirth:   p.DateOfBirth.Format("2006-01-02"),
+		models.FieldAadhaarNumber: p.AadhaarNumber,
+		models.FieldVID:           p.VID,
+		models.FieldPhoneNumber:   p.PhoneNumber,
+		models.FieldAddress:       p.Address,
+	}
+}
+
+// changedFields lists the profile fields that differ between two decrypted
+// profiles.
+func changedFields(before, after *models.Profile) []string {
+	a, b := profileDocument(before), profileDocument(after)
+	var changed []string
+	for _, field := range models.ProfileFields {
+		if a[field] != b[field] {
+			changed = append(changed, field)
+		}
+	}
+	return changed
+}
+
+// applyProfileDocument copies the fields of a patched document that differ
+// from current into a new profile, validating only those. It returns the
+// profile, the changed fields and any validation errors.
+func applyProfileDocument(current *models.Profile, doc patch.Document) (models.Profile, []string, *utils.Validator) {
+	validate := utils.NewValidator()
+	updated := *current
+	before := profileDocument(current)
+
+	for key := range doc {
+		if !slices.Contains(models.ProfileFields, key) {
+			validate.AddError(key, "this field cannot be changed")
+		}
+	}
+
+	var changed []string
+	for _, field := range models.ProfileFields {
+		var value string
+		switch v := doc[field].(type) {
+		case nil:
+			// removed, or set to null by a merge patch
+		case string:
+			value = v
+		default:
+			validate.AddError(field, "must be a string")
+			continue
+		}
+		if field == models.FieldDateOfBirth {
+			// accept the RFC 3339 timestamps that PUT and POST take as well
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				value = t.Format("2006-01-02")
+			}
+		}
+		if value == before[field] {
+			continue
+		}
+		changed = append(changed, field)
+
+		// the Aadhaar number and VID may each be removed, but not both
+		optional := field == models.FieldAddress || field == models.FieldAadhaarNumber || field == models.FieldVID
+		if value == "" && !optional {
+			validate.AddError(field, utils.ErrFieldRequired.Message)
+			continue
+		}
+		switch field {
+		case models.FieldFullName:
+			validate.NameLength(value, 3, 20)
+			updated.FullName = value
+		case models.FieldDateOfBirth:
+			validate.Date(value)
+			updated.DateOfBirth, _ = time.Parse("2006-01-02", value)
+		case models.FieldAadhaarNumber:
+			if value != "" {
+				validate.Aadhar(value)
+			}
+			updated.AadhaarNumber = value
+		case models.FieldVID:
+			if value != "" {
+				validate.VID(value)
+			}
+			updated.VID = value
+		case models.FieldPhoneNumber:
+			validate.Phone(value)
+			updated.PhoneNumber = value
+		case models.FieldAddress:
+			updated.Address = value
+		}
+	}
+	if updated.AadhaarNumber == "" && updated.VID == "" {
+		validate.AddError(utils.ErrAadhaarOrVIDRequired.Key, utils.ErrAadhaarOrVIDRequired.Message)
+	}
+	return updated, changed, validate
+}
+
+// PatchProfile applies an RFC 7396 merge patch or an RFC 6902 JSON Patch to
+// the caller's profile. Only the fields the patch changes are validated,
+// re-encrypted and written.
+func (app *Application) PatchProfile(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	profileID, version, err := ifMatchProfile(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != patch.MergePatchType && mediaType != patch.JSONPatchType {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": fmt.Sprintf("content type must be %s or %s", patch.MergePatchType, patch.JSONPatchType),
+		})
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchSize))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+
+	ctx := c.Request().Context()
+	current, err := app.loadProfile(c, userID)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	// check up front as well as in the UPDATE: the patch is computed against
+	// the current row, which must be the one the client saw
+	if current.ID != profileID || current.Version != version {
+		return preconditionFailed(c, ErrStaleETag)
+	}
+
+	encryptedAadhaar, encryptedVID := current.AadhaarNumber, current.VID
+	if err := DecryptFields(app.env[env.AES_KEY], &current.AadhaarNumber, &current.VID); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	var doc patch.Document
+	if mediaType == patch.MergePatchType {
+		doc, err = patch.Merge(profileDocument(current), body)
+	} else {
+		doc, err = patch.Apply(profileDocument(current), body)
+	}
+	if err != nil {
+		if errors.Is(err, patch.ErrTestFailed) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	updated, changed, validate := applyProfileDocument(current, doc)
+	if !validate.Valid() {
+		return c.JSON(http.StatusBadRequest, validate.Errors)
+	}
+	if len(changed) == 0 {
+		c.Response().Header().Set(HeaderETag, profileETag(current))
+		return c.JSON(http.StatusOK, map[string]string{"message": "nothing to update"})
+	}
+
+	// re-encrypt everything, then put back the ciphertext of whichever number
+	// did not change, so its stored value and history stay the same
+	if err := app.sealProfile(&updated); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if !slices.Contains(changed, models.FieldAadhaarNumber) {
+		updated.AadhaarNumber = encryptedAadhaar
+	}
+	if !slices.Contains(changed, models.FieldVID) {
+		updated.VID = encryptedVID
+	}
+
+	var reopened bool
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		if err := tx.Profiles.Patch(ctx, &updated, changed); err != nil {
+			return err
+		}
+		reopened, err = app.fieldsEdited(ctx, tx, updated.ID, changed)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		if errors.Is(err, models.VersionConflict) {
+			return preconditionFailed(c, ErrStaleETag)
+		}
+		if errors.Is(err, models.AlreadyExists) {
+			if app.aadhaarOnAccount(ctx, userID, updated.ID, updated.AadhaarIndex) {
+				return c.JSON(http.StatusConflict, map[string]string{"error": ErrAadhaarOnAccount})
+			}
+			return c.JSON(http.StatusConflict, map[string]string{"error": "phone no. or VID already exists"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error patching profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, updated.ID, audit.ActionProfileUpdate)
+	app.reopenKYC(c, userID, updated.ID, reopened)
+	app.flagEditedDuplicates(c, userID, &updated, changed)
+	c.Response().Header().Set(HeaderETag, profileETag(&updated))
+	return c.JSON(http.StatusOK, map[string]string{"message": "profile updated successfully"})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/consent"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/photo"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPhotoSize caps photo uploads. Phone cameras write large files; what
+// matters more is photo.MaxPixels, which bounds the decoded size.
+const maxPhotoSize = 15 << 20
+
+const (
+	ErrPhotoTooLarge = "photos can be at most 15 MiB and 40 megapixels"
+	ErrPhotoType     = "only JPEG, PNG and WebP images are accepted"
+)
+
+func photoBlobKey(prefix string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", prefix, size)
+}
+
+// deletePhotoBlobs removes every size of a photo whose row is gone.
+func (app *Application) deletePhotoBlobs(ctx context.Context, p *models.Photo) {
+	for _, size := range photo.Sizes {
+		app.deleteBlob(ctx, photoBlobKey(p.BlobPrefix, size))
+	}
+}
+
+// photoURLs returns download URLs for each size of the profile's photo, or
+// nil if it has none.
+func (app *Application) photoURLs(ctx context.Context, profileID int) (map[int]string, error) {
+	if app.blobs == nil {
+		return nil, nil
+	}
+	if _, err := app.repo.Photos.Get(ctx, profileID); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	urls := make(map[int]string, len(photo.Sizes))
+	for _, size := range photo.Sizes {
+		token, _ := app.downloads.Sign(fileSubject(filePhoto, profileID, size), app.downloadTTL)
+		urls[size] = "/api/files/" + token
+	}
+	return urls, nil
+}
+
+// PutPhoto replaces the profile photo with the multipart "file", a JPEG, PNG
+// or WebP image. It is stored as square JPEG thumbnails without metadata;
+// see internal/photo.
+func (app *Application) PutPhoto(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+	if err := app.checkConsent(c.Request().Context(), userID, consent.PurposeKYC); err != nil {
+		return app.consentError(c, err)
+	}
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxPhotoSize+64<<10)
+	file, err := c.FormFile("file")
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrPhotoTooLarge})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"file": utils.ErrFieldRequired.Message})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxPhotoSize+1))
+	f.Close()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	if len(data) > maxPhotoSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrPhotoTooLarge})
+	}
+	thumbs, err := photo.Process(data)
+	switch {
+	case errors.Is(err, photo.ErrTooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": ErrPhotoTooLarge})
+	case errors.Is(err, photo.ErrNotImage):
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": ErrPhotoType})
+	case err != nil:
+		app.logger.Errorf("error processing photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	ctx := req.Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	// a new prefix per upload, so a replaced photo's sizes are never mixed
+	// with the new ones
+	suffix := make([]byte, 16)
+	dataKey, err := blob.NewDataKey()
+	if err == nil {
+		_, err = rand.Read(suffix)
+	}
+	if err != nil {
+		app.logger.Errorf("error generating photo keys \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	p := models.Photo{ProfileID: profile.ID, BlobPrefix: fmt.Sprintf("photos/%d/%s", profile.ID, hex.EncodeToString(suffix))}
+	if p.DataKey, err = app.wrapDataKey(dataKey); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	for _, size := range photo.Sizes {
+		key := photoBlobKey(p.BlobPrefix, size)
+		sealed, err := blob.SealWith(thumbs[size], dataKey, key)
+		if err == nil {
+			err = app.blobs.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed)))
+		}
+		if err != nil {
+			app.deletePhotoBlobs(ctx, &p)
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error storing photo \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+	}
+
+	var previous *models.Photo
+	err = app.repo.WithTx(ctx, func(tx *repository.Repository) error {
+		old, err := tx.Photos.Get(ctx, profile.ID)
+		if err != nil && !errors.Is(err, models.NotFound) {
+			return err
+		}
+		previous = old
+		return tx.Photos.Put(ctx, &p)
+	})
+	if err != nil {
+		app.deletePhotoBlobs(ctx, &p)
+		if errors.Is(err, models.NotFound) {
+			return app.profileLoadError(c, err)
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error saving photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if previous != nil {
+		app.deletePhotoBlobs(ctx, previous)
+	}
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionPhotoUpdate)
+	urls, err := app.photoURLs(ctx, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"photo_urls": urls, "updated_at": p.UpdatedAt})
+}
+
+// DeletePhoto removes the profile photo and all its sizes.
+func (app *Application) DeletePhoto(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.blobs == nil {
+		return app.blobsOff(c)
+	}
+
+	ctx := c.Request().Context()
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	p, err := app.repo.Photos.Get(ctx, profile.ID)
+	if err == nil {
+		err = app.repo.Photos.Delete(ctx, profile.ID)
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "photo not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error deleting photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.deletePhotoBlobs(ctx, p)
+
+	app.recordProfileAudit(c, userID, profile.ID, audit.ActionPhotoDelete)
+	return c.JSON(http.StatusOK, map[string]string{"message": "photo deleted successfully"})
+}
+
+func (app *Application) servePhoto(c echo.Context, profileID, size int) error {
+	if !slices.Contains(photo.Sizes, size) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": ErrDownloadURL})
+	}
+	p, err := app.repo.Photos.Get(c.Request().Context(), profileID)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "photo not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching photo \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	return app.serveBlob(c, photoBlobKey(p.BlobPrefix, size), p.DataKey, maxPhotoSize, "image/jpeg", "inline", fmt.Sprintf("photo-%d.jpg", size))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/cipher"
+	"github.com/Raaffs/profileManager/server/internal/dedupe"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// profileIDParam reads the :id of the /profiles/:id routes. The /profile
+// routes have no such parameter and address the primary profile instead.
+func profileIDParam(c echo.Context) (id int, named bool, ok bool) {
+	param := c.Param("id")
+	if param == "" {
+		return 0, false, true
+	}
+	id, err := strconv.Atoi(param)
+	return id, true, err == nil && id > 0
+}
+
+// loadProfile returns the profile a request addresses: the one named in the
+// path, or the account's primary profile. A malformed ID counts as not found.
+func (app *Application) loadProfile(c echo.Context, userID int) (*models.Profile, error) {
+	id, named, ok := profileIDParam(c)
+	if !ok {
+		return nil, models.NotFound
+	}
+	if !named {
+		return app.repo.Profiles.GetByUserID(c.Request().Context(), userID)
+	}
+	return app.repo.Profiles.Get(c.Request().Context(), userID, id)
+}
+
+// profileLoadError answers a request whose loadProfile failed.
+func (app *Application) profileLoadError(c echo.Context, err error) error {
+	if errors.Is(err, models.NotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	}
+	app.health.SetStatus(StatusDegraded)
+	app.logger.Errorf("error fetching profile \n%w", err)
+	return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+}
+
+// normalizeAadhaar drops the spaces people type into an Aadhaar number or VID.
+// A 16-digit value in the Aadhaar field is a VID pasted into the wrong box,
+// so it is moved over when no VID was given.
+func normalizeAadhaar(p *models.Profile) {
+	p.AadhaarNumber = strings.ReplaceAll(p.AadhaarNumber, " ", "")
+	p.VID = strings.ReplaceAll(p.VID, " ", "")
+	if len(p.AadhaarNumber) == utils.VID_LENGTH && p.VID == "" {
+		p.AadhaarNumber, p.VID = "", p.AadhaarNumber
+	}
+}
+
+// sealProfile computes the blind indexes and encrypts the Aadhaar number and
+// VID of a validated profile, leaving an absent one empty.
+func (app *Application) sealProfile(p *models.Profile) error {
+	if err := indexProfile(app.env[env.BLIND_INDEX_KEY], p); err != nil {
+		return err
+	}
+	return EncryptFields(app.env[env.AES_KEY], &p.AadhaarNumber, &p.VID)
+}
+
+// indexProfile sets the blind indexes of a profile whose VID and Aadhaar
+// number are plaintext. The VID's backs a unique index; the Aadhaar number's
+// and phone number's are for duplicate detection.
+func indexProfile(key string, p *models.Profile) error {
+	p.VIDIndex, p.AadhaarIndex, p.PhoneIndex = "", "", ""
+	var err error
+	if p.VID != "" {
+		if p.VIDIndex, err = cipher.BlindIndex(key, "vid", p.VID); err != nil {
+			return err
+		}
+	}
+	if p.AadhaarNumber != "" {
+		if p.AadhaarIndex, err = cipher.BlindIndex(key, "aadhaar", p.AadhaarNumber); err != nil {
+			return err
+		}
+	}
+	if phone := dedupe.PhoneKey(p.PhoneNumber); phone != "" {
+		if p.PhoneIndex, err = cipher.BlindIndex(key, "phone", phone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aadhaarOnAccount reports whether another of the account's profiles holds
+// the Aadhaar number behind the blind index. The database enforces this with
+// a unique index; this only tells that conflict apart from the others a write
+// reports as AlreadyExists, to give a useful message.
+func (app *Application) aadhaarOnAccount(ctx context.Context, userID, exceptID int, index string) bool {
+	if index == "" {
+		return false
+	}
+	profiles, err := app.repo.Profiles.List(ctx, userID)
+	if err != nil {
+		app.logger.Errorf("error listing the account's profiles \n%w", err)
+		return false
+	}
+	return slices.ContainsFunc(profiles, func(p models.Profile) bool {
+		return p.ID != exceptID && p.AadhaarIndex == index
+	})
+}
+
+// recordProfileAudit is recordAudit for a change to one of the account's
+// profiles, naming the profile in the details.
+func (app *Application) recordProfileAudit(c echo.Context, userID, profileID int, action string) {
+	details := map[string]string{"ip": c.RealIP(), "profile_id": strconv.Itoa(profileID)}
+	if err := app.audit.Log(c.Request().Context(), userID, action, details); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing audit record \n%w", err)
+	}
+}
+
+// ListProfiles returns every live profile the account manages, primary first.
+func (app *Application) ListProfiles(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+
+	profiles, err := app.repo.Profiles.List(c.Request().Context(), userID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing profiles \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	for i := range profiles {
+		if err := DecryptFields(app.env[env.AES_KEY], &profiles[i].AadhaarNumber, &profiles[i].VID); err != nil {
+			app.health.SetStatus(StatusCritical)
+			app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		if profiles[i].PhotoURLs, err = app.photoURLs(c.Request().Context(), profiles[i].ID); err != nil {
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error fetching photo \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+	}
+	return c.JSON(http.StatusOK, profiles)
+}
+
+// SetPrimaryProfile makes the profile in the path the account's primary one,
+// which the /profile routes then address.
+func (app *Application) SetPrimaryProfile(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	id, _, ok := profileIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+	}
+
+	if err := app.repo.Profiles.SetPrimary(c.Request().Context(), userID, id); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "profile not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error setting primary profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	app.recordProfileAudit(c, userID, id, audit.ActionProfilePrimary)
+	return c.JSON(http.StatusOK, map[string]string{"message": "primary profile updated successfully"})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/photo"
+)
+
+const (
+	defaultRetention     = 30 * 24 * time.Hour
+	defaultPurgeInterval = time.Hour
+)
+
+// runPurgeWorker permanently erases soft-deleted users and profiles, with
+// their attachments and photos, once they are older than retention, along with
+// share links that ended as long ago. It also expires stale KYC verifications
+// and deletes data exports nobody downloaded. It runs once at start-up and
+// then every interval until ctx is cancelled.
+func (app *Application) runPurgeWorker(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeDeleted(ctx, retention)
+		app.expireKYC(ctx)
+		if app.blobs != nil {
+			app.expireExports(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *Application) purgeDeleted(ctx context.Context, retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+
+	// the rows hold the only pointers to the blobs, so those go first; a
+	// failure leaves everything for the next run
+	if app.blobs != nil {
+		if err := app.purgeBlobs(ctx, cutoff); err != nil {
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error purging blobs \n%w", err)
+			return
+		}
+	}
+
+	// deleting an account soft-deletes its profiles with it, so this takes the
+	// profiles of the users purged below as well as those deleted on their own
+	profiles, err := app.repo.Profiles.Purge(ctx, cutoff)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error purging deleted profiles \n%w", err)
+		return
+	}
+	users, err := app.repo.Users.Purge(ctx, cutoff)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error purging deleted users \n%w", err)
+		return
+	}
+	// share links are kept a while after they end so their owners can see
+	// who opened them
+	shares, err := app.repo.ShareLinks.Purge(ctx, cutoff)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error purging share links \n%w", err)
+		return
+	}
+	app.logger.Infof("purge: erased %d users, %d profiles and %d share links ended before %s", users, profiles, shares, cutoff.Format(time.RFC3339))
+}
+
+// purgeBlobs deletes the attachments and photos of profiles that are about to
+// be purged.
+func (app *Application) purgeBlobs(ctx context.Context, cutoff time.Time) error {
+	var keys []string
+	attachments, err := app.repo.Attachments.Purgeable(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		keys = append(keys, a.BlobKey)
+	}
+	photos, err := app.repo.Photos.Purgeable(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	for _, p := range photos {
+		for _, size := range photo.Sizes {
+			keys = append(keys, photoBlobKey(p.BlobPrefix, size))
+		}
+	}
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
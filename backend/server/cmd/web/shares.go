@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/blob"
+	"github.com/Raaffs/profileManager/server/internal/env"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	minShareTTL     = 5 * time.Minute
+	maxShareTTL     = 30 * 24 * time.Hour
+	// maxSharePINFailures wrong PINs lock a link for good; with four digits
+	// that leaves a guesser a 1 in 2000 chance
+	maxSharePINFailures = 5
+)
+
+// HeaderSharePIN carries the PIN of a share link, so that it stays out of
+// URLs and access logs.
+const HeaderSharePIN = "X-Share-PIN"
+
+const (
+	ErrSharesOff     = "share links are not configured"
+	ErrShareLink     = "this link is invalid"
+	ErrShareExpired  = "this link has expired"
+	ErrShareRevoked  = "this link has been revoked"
+	ErrShareLocked   = "this link was locked after too many wrong PINs"
+	ErrShareGone     = "the shared profile is no longer available"
+	ErrSharePIN      = "this link needs a PIN"
+	ErrShareWrongPIN = "wrong PIN"
+)
+
+var sharePINPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+type shareRequest struct {
+	Fields []string `json:"fields"`
+	// ExpiresIn is a duration such as "72h"; empty means defaultShareTTL
+	ExpiresIn string `json:"expires_in"`
+	PIN       string `json:"pin"`
+}
+
+// shareSubject names a share link in its signed token. It has two parts, so
+// DownloadFile can never mistake it for a file.
+func shareSubject(id int) string {
+	return "share:" + strconv.Itoa(id)
+}
+
+func parseShareSubject(subject string) (int, bool) {
+	id, ok := strings.CutPrefix(subject, "share:")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(id)
+	return n, err == nil && n > 0
+}
+
+func shareIDParam(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("shareID"))
+	return id, err == nil && id > 0
+}
+
+// sharesOff answers share link requests when SHARE_LINK_KEY is unset.
+func (app *Application) sharesOff(c echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": ErrSharesOff})
+}
+
+// shareFields checks the fields asked for and puts them in the order of
+// models.ShareFields, without repeats.
+func shareFields(fields []string) ([]string, error) {
+	return pickFields(models.ShareFields, fields, "shared")
+}
+
+// pickFields checks that fields are some of allowed and returns them in the
+// order of allowed, without repeats. what completes "cannot be ..." in the
+// error.
+func pickFields(allowed, fields []string, what string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("choose at least one field")
+	}
+	for _, f := range fields {
+		if !slices.Contains(allowed, f) {
+			return nil, fmt.Errorf("%q cannot be %s", f, what)
+		}
+	}
+	var out []string
+	for _, f := range allowed {
+		if slices.Contains(fields, f) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// shareTTL parses how long a link should last.
+func shareTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultShareTTL, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl < minShareTTL || ttl > maxShareTTL {
+		return 0, fmt.Errorf("expires_in must be between %s and %s", minShareTTL, maxShareTTL)
+	}
+	return ttl, nil
+}
+
+// projectProfile is what a share link shows of a decrypted profile: the
+// chosen fields only, with the Aadhaar number, VID and phone number masked.
+// Fields the profile leaves empty are left out.
+func projectProfile(p *models.Profile, fields []string) map[string]string {
+	out := map[string]string{}
+	for _, f := range fields {
+		var v string
+		switch f {
+		case models.FieldFullName:
+			v = p.FullName
+		case models.FieldDateOfBirth:
+			v = p.DateOfBirth.Format(time.DateOnly)
+		case models.ShareYearOfBirth:
+			v = strconv.Itoa(p.DateOfBirth.Year())
+		case models.FieldAadhaarNumber:
+			if p.AadhaarNumber != "" {
+				v = utils.MaskAadhaar(p.AadhaarNumber)
+			}
+		case models.FieldVID:
+			if p.VID != "" {
+				v = utils.MaskVID(p.VID)
+			}
+		case models.FieldPhoneNumber:
+			if p.PhoneNumber != "" {
+				v = utils.MaskPhone(p.PhoneNumber)
+			}
+		}
+		if v != "" {
+			out[f] = v
+		}
+	}
+	return out
+}
+
+// showShareLink fills in what the API adds to a stored link. Only links that
+// still work get their URL, which signing again reproduces exactly.
+func (app *Application) showShareLink(l *models.ShareLink, now time.Time) {
+	l.PINRequired = l.PINHash != ""
+	if l.RevokedAt == nil && now.Before(l.ExpiresAt) && l.PINFailures < maxSharePINFailures {
+		l.URL = "/api/share/" + app.shares.SignUntil(shareSubject(l.ID), l.ExpiresAt)
+	}
+}
+
+// recordShareAudit is recordProfileAudit naming the link as well.
+func (app *Application) recordShareAudit(c echo.Context, l *models.ShareLink, action string) {
+	details := map[string]string{
+		"ip":         c.RealIP(),
+		"profile_id": strconv.Itoa(l.ProfileID),
+		"share_id":   strconv.Itoa(l.ID),
+	}
+	if err := app.audit.Log(c.Request().Context(), l.UserID, action, details); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error writing audit record \n%w", err)
+	}
+}
+
+// CreateShareLink makes a link that shows the chosen fields of a profile to
+// whoever has it, until it expires.
+func (app *Application) CreateShareLink(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.shares == nil {
+		return app.sharesOff(c)
+	}
+	var input shareRequest
+	if err := c.Bind(&input); err != nil {
+		app.logger.Errorf("error binding json to share request \n%w", err)
+		return c.JSON(http.StatusBadRequest, map[string]HttpResponseMsg{"error": ErrBadRequest})
+	}
+	fields, err := shareFields(input.Fields)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ttl, err := shareTTL(input.ExpiresIn)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if input.PIN != "" && !sharePINPattern.MatchString(input.PIN) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "the PIN must be 4 to 8 digits"})
+	}
+
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	l := models.ShareLink{
+		UserID:    userID,
+		ProfileID: profile.ID,
+		Fields:    fields,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	if input.PIN != "" {
+		if l.PINHash, err = utils.HashPassword(input.PIN); err != nil {
+			app.logger.Errorf("error hashing share PIN \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+	}
+	if err := app.repo.ShareLinks.Create(c.Request().Context(), &l); err != nil {
+		if errors.Is(err, models.NotFound) {
+			return app.profileLoadError(c, err)
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error creating share link \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordShareAudit(c, &l, audit.ActionShareCreate)
+	app.showShareLink(&l, time.Now())
+	return c.JSON(http.StatusCreated, l)
+}
+
+// ListShareLinks returns the links made for a profile, newest first, with how
+// often each was opened.
+func (app *Application) ListShareLinks(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.shares == nil {
+		return app.sharesOff(c)
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+	links, err := app.repo.ShareLinks.List(c.Request().Context(), userID, profile.ID)
+	if err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error listing share links \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	now := time.Now()
+	for i := range links {
+		app.showShareLink(&links[i], now)
+	}
+	if links == nil {
+		links = []models.ShareLink{}
+	}
+	return c.JSON(http.StatusOK, links)
+}
+
+// RevokeShareLink stops a link from working before it expires.
+func (app *Application) RevokeShareLink(c echo.Context) error {
+	userID, err := app.GetUserJWT(c)
+	if err != nil {
+		app.logger.Errorf("error getting user from jwt \n%w", err)
+		return c.JSON(http.StatusUnauthorized, map[string]HttpResponseMsg{"error": ErrUnauthorized})
+	}
+	if app.shares == nil {
+		return app.sharesOff(c)
+	}
+	id, ok := shareIDParam(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "share link not found"})
+	}
+	profile, err := app.loadProfile(c, userID)
+	if err != nil {
+		return app.profileLoadError(c, err)
+	}
+
+	ctx := c.Request().Context()
+	l, err := app.repo.ShareLinks.Get(ctx, id)
+	if err == nil && (l.UserID != userID || l.ProfileID != profile.ID) {
+		err = models.NotFound
+	}
+	if err == nil {
+		l, err = app.repo.ShareLinks.Revoke(ctx, userID, id)
+	}
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "share link not found"})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error revoking share link \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordShareAudit(c, l, audit.ActionShareRevoke)
+	app.showShareLink(l, time.Now())
+	return c.JSON(http.StatusOK, l)
+}
+
+// ViewShare shows what a share link grants. It needs no account: the signed
+// token is the credential, and the PIN too if the link has one. Every view
+// and every wrong PIN is filed in the owner's audit trail.
+func (app *Application) ViewShare(c echo.Context) error {
+	if app.shares == nil {
+		return app.sharesOff(c)
+	}
+	subject, err := app.shares.Verify(c.Param("token"))
+	if errors.Is(err, blob.ErrTokenExpired) {
+		return c.JSON(http.StatusGone, map[string]string{"error": ErrShareExpired})
+	}
+	id, ok := parseShareSubject(subject)
+	if err != nil || !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": ErrShareLink})
+	}
+
+	ctx := c.Request().Context()
+	l, err := app.repo.ShareLinks.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": ErrShareLink})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching share link \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	now := time.Now()
+	switch {
+	case l.RevokedAt != nil:
+		return c.JSON(http.StatusGone, map[string]string{"error": ErrShareRevoked})
+	case !now.Before(l.ExpiresAt):
+		return c.JSON(http.StatusGone, map[string]string{"error": ErrShareExpired})
+	case l.PINFailures >= maxSharePINFailures:
+		return c.JSON(http.StatusGone, map[string]string{"error": ErrShareLocked})
+	}
+
+	if l.PINHash != "" {
+		pin := c.Request().Header.Get(HeaderSharePIN)
+		if pin == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]any{"error": ErrSharePIN, "pin_required": true})
+		}
+		// the attempt is counted before the PIN is compared and given back if
+		// it was right, so parallel guesses cannot all pass the check above
+		failures, err := app.repo.ShareLinks.TakePINAttempt(ctx, l.ID, maxSharePINFailures)
+		if err != nil {
+			if errors.Is(err, models.NotFound) {
+				return c.JSON(http.StatusGone, map[string]string{"error": ErrShareLocked})
+			}
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error counting a share PIN attempt \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(l.PINHash), []byte(pin)); err != nil {
+			app.recordShareAudit(c, l, audit.ActionSharePINFailed)
+			if failures >= maxSharePINFailures {
+				return c.JSON(http.StatusGone, map[string]string{"error": ErrShareLocked})
+			}
+			return c.JSON(http.StatusUnauthorized, map[string]any{
+				"error":         ErrShareWrongPIN,
+				"pin_required":  true,
+				"attempts_left": maxSharePINFailures - failures,
+			})
+		}
+		if err := app.repo.ShareLinks.ReturnPINAttempt(ctx, l.ID); err != nil {
+			app.health.SetStatus(StatusDegraded)
+			app.logger.Errorf("error returning a share PIN attempt \n%w", err)
+			return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+		}
+	}
+
+	profile, err := app.repo.Profiles.Get(ctx, l.UserID, l.ProfileID)
+	if err != nil {
+		if errors.Is(err, models.NotFound) {
+			return c.JSON(http.StatusGone, map[string]string{"error": ErrShareGone})
+		}
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error fetching profile \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	if err := DecryptFields(app.env[env.AES_KEY], &profile.AadhaarNumber, &profile.VID); err != nil {
+		app.health.SetStatus(StatusCritical)
+		app.logger.Errorf("CRITICAL ERROR: cipher failure: \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+
+	if err := app.repo.ShareLinks.Accessed(ctx, l.ID, now); err != nil {
+		app.health.SetStatus(StatusDegraded)
+		app.logger.Errorf("error counting a share link access \n%w", err)
+		return c.JSON(http.StatusInternalServerError, map[string]HttpResponseMsg{"error": ErrInternalServer})
+	}
+	app.recordShareAudit(c, l, audit.ActionShareAccess)
+
+	h := c.Response().Header()
+	h.Set("Cache-Control", "private, no-store")
+	h.Set("X-Robots-Tag", "noindex")
+	return c.JSON(http.StatusOK, map[string]any{
+		"profile":    projectProfile(profile, l.Fields),
+		"expires_at": l.ExpiresAt,
+	})
+}
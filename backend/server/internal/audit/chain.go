@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+)
+
+const (
+	ActionRegister       = "user.register"
+	ActionLogin          = "user.login"
+	ActionLoginFailed    = "user.login_failed"
+	ActionProfileCreate  = "profile.create"
+	ActionProfileUpdate  = "profile.update"
+	ActionProfileDelete  = "profile.delete"
+	ActionAccountDelete  = "account.delete"
+	ActionAccountRestore = "account.restore"
+	ActionProfileRestore = "profile.restore"
+	ActionRoleChange     = "user.role_change"
+	ActionProfilePrimary = "profile.set_primary"
+	ActionAddressCreate  = "address.create"
+	ActionAddressUpdate  = "address.update"
+	ActionAddressDelete  = "address.delete"
+	ActionDocumentCreate = "document.create"
+	ActionDocumentUpdate = "document.update"
+	ActionDocumentDelete = "document.delete"
+	ActionEKYCVerify     = "ekyc.verify"
+	ActionKYCSubmit      = "kyc.submit"
+	ActionKYCWithdraw    = "kyc.withdraw"
+	ActionKYCClaim       = "kyc.claim"
+	ActionKYCRelease     = "kyc.release"
+	ActionKYCApprove     = "kyc.approve"
+	ActionKYCReject      = "kyc.reject"
+	ActionKYCReopen      = "kyc.reopen"
+
+	ActionProfileHistoryView = "profile.history_view"
+	ActionAttachmentCreate   = "attachment.create"
+	ActionAttachmentDelete   = "attachment.delete"
+	ActionPhotoUpdate        = "photo.update"
+	ActionPhotoDelete        = "photo.delete"
+	ActionDuplicateFlag      = "duplicate.flag"
+	ActionDuplicateResolve   = "duplicate.resolve"
+	ActionUserImport         = "user.import"
+	ActionProfileImport      = "profile.import"
+
+	ActionAccountExport         = "account.export"
+	ActionAccountExportDownload = "account.export_download"
+	ActionConsentGrant          = "consent.grant"
+	ActionConsentWithdraw       = "consent.withdraw"
+	ActionShareCreate           = "share.create"
+	ActionShareRevoke           = "share.revoke"
+	ActionShareAccess           = "share.access"
+	ActionSharePINFailed        = "share.pin_failed"
+	ActionCredentialIssue       = "credential.issue"
+	ActionCredentialRevoke      = "credential.revoke"
+)
+
+// GenesisHash is the PrevHash of the first record in the chain.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+var (
+	ErrInvalidSigningKey = errors.New("audit signing key must be a base64 encoded 32 byte ed25519 seed")
+	ErrInvalidVerifyKey  = errors.New("audit verification key must be a base64 encoded 32 byte ed25519 public key")
+)
+
+// Hash returns the hex SHA-256 digest that seals rec to its predecessor.
+func Hash(rec models.AuditRecord) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%d\n%s\n%s\n%s",
+		rec.Seq,
+		rec.PrevHash,
+		rec.UserID,
+		rec.Action,
+		rec.Details,
+		rec.CreatedAt.UTC().Format(time.RFC3339Nano),
+	)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal links rec to head (nil when the chain is empty) and fills in Seq,
+// PrevHash, CreatedAt and Hash. Stores call it while holding the chain lock.
+func Seal(head *models.AuditRecord, rec *models.AuditRecord) {
+	rec.Seq, rec.PrevHash = 1, GenesisHash
+	if head != nil {
+		rec.Seq, rec.PrevHash = head.Seq+1, head.Hash
+	}
+	// postgres keeps microseconds, so truncate before hashing or the
+	// stored timestamp would never reproduce the digest.
+	rec.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	rec.Hash = Hash(*rec)
+}
+
+func ParseSigningKey(seedBase64 string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(seedBase64)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidSigningKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParseVerifyKey reads the public half of the signing key, which is all that
+// Verify needs, so the chain can be checked without access to the seed.
+func ParseVerifyKey(pubBase64 string) (ed25519.PublicKey, error) {
+	pub, err := base64.StdEncoding.DecodeString(pubBase64)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrInvalidVerifyKey
+	}
+	return ed25519.PublicKey(pub), nil
+}
+
+// VerifyKey is the base64 encoded public key that checks key's checkpoints.
+func VerifyKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+func checkpointMessage(seq int64, hash string) []byte {
+	return []byte(fmt.Sprintf("audit-checkpoint:%d:%s", seq, hash))
+}
+
+// Logger appends records to the chain and signs a checkpoint every interval records.
+type Logger struct {
+	repo     repository.AuditRepository
+	key      ed25519.PrivateKey
+	interval int64
+}
+
+func NewLogger(repo repository.AuditRepository, key ed25519.PrivateKey, interval int) *Logger {
+	return &Logger{repo: repo, key: key, interval: int64(interval)}
+}
+
+// WithRepo returns a copy of the logger that appends through repo, typically
+// a transaction's AuditRepository so the record commits with the change it
+// describes.
+func (l *Logger) WithRepo(repo repository.AuditRepository) *Logger {
+	return &Logger{repo: repo, key: l.key, interval: l.interval}
+}
+
+func (l *Logger) Log(ctx context.Context, userID int, action string, details map[string]string) error {
+	// map keys are marshalled in sorted order, which keeps the hash input stable
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	rec := models.AuditRecord{
+		UserID:  userID,
+		Action:  action,
+		Details: string(raw),
+	}
+	if err := l.repo.Append(ctx, &rec); err != nil {
+		return err
+	}
+	if l.interval > 0 && rec.Seq%l.interval == 0 {
+		return l.Checkpoint(ctx, rec)
+	}
+	return nil
+}
+
+// Tombstone records that an account was erased. It deliberately carries no
+// details so that nothing personal about the user survives in the chain.
+func (l *Logger) Tombstone(ctx context.Context, userID int) error {
+	return l.Log(ctx, userID, ActionAccountDelete, map[string]string{})
+}
+
+// Checkpoint signs the given chain head and stores the signature.
+func (l *Logger) Checkpoint(ctx context.Context, head models.AuditRecord) error {
+	return l.repo.CreateCheckpoint(ctx, models.AuditCheckpoint{
+		Seq:       head.Seq,
+		Hash:      head.Hash,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(l.key, checkpointMessage(head.Seq, head.Hash))),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// Report is the outcome of walking the chain. BrokenAt is zero when the chain is intact.
+type Report struct {
+	Records     int64
+	Checkpoints int
+	BrokenAt    int64
+	Reason      string
+}
+
+func (r *Report) Intact() bool { return r.BrokenAt == 0 }
+
+func (r *Report) fail(seq int64, format string, args ...any) *Report {
+	r.BrokenAt = seq
+	r.Reason = fmt.Sprintf(format, args...)
+	return r
+}
+
+const verifyPageSize = 500
+
+// Verify walks the whole chain and stops at the first broken link. Checkpoint
+// signatures are checked against pub, and every record whose seq is a multiple
+// of interval, the one the chain was written with, must have a checkpoint, so
+// a chain rehashed after its checkpoints were deleted is caught as well. A
+// missing checkpoint is reported even when it is missing because its write
+// failed, since the records it covers are then unsigned.
+//
+// Records after the last checkpoint are protected only by the hash links: a
+// tail cut back to before the last checkpoint, with that checkpoint deleted
+// too, looks like a shorter chain. Only a signed head kept outside the
+// database can show that; a smaller interval narrows the window.
+func Verify(ctx context.Context, repo repository.AuditRepository, pub ed25519.PublicKey, interval int) (*Report, error) {
+	report := &Report{}
+
+	checkpoints, err := repo.Checkpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bySeq := make(map[int64]models.AuditCheckpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+		if err != nil || !ed25519.Verify(pub, checkpointMessage(cp.Seq, cp.Hash), sig) {
+			return report.fail(cp.Seq, "checkpoint at seq %d has an invalid signature", cp.Seq), nil
+		}
+		bySeq[cp.Seq] = cp
+	}
+	report.Checkpoints = len(checkpoints)
+
+	prev := models.AuditRecord{Hash: GenesisHash}
+	for {
+		page, err := repo.List(ctx, prev.Seq, verifyPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range page {
+			switch {
+			case rec.Seq != prev.Seq+1:
+				return report.fail(prev.Seq+1, "record %d is missing", prev.Seq+1), nil
+			case rec.PrevHash != prev.Hash:
+				return report.fail(rec.Seq, "record %d does not link to record %d", rec.Seq, prev.Seq), nil
+			case Hash(rec) != rec.Hash:
+				return report.fail(rec.Seq, "record %d was modified after it was written", rec.Seq), nil
+			}
+			cp, ok := bySeq[rec.Seq]
+			switch {
+			case ok && cp.Hash != rec.Hash:
+				return report.fail(rec.Seq, "record %d does not match its signed checkpoint", rec.Seq), nil
+			case !ok && interval > 0 && rec.Seq%int64(interval) == 0:
+				return report.fail(rec.Seq, "record %d has no signed checkpoint", rec.Seq), nil
+			}
+			prev = rec
+			report.Records++
+		}
+		if len(page) < verifyPageSize {
+			break
+		}
+	}
+
+	for seq := range bySeq {
+		if seq > prev.Seq {
+			return report.fail(prev.Seq+1, "chain ends at record %d but a checkpoint covers record %d", prev.Seq, seq), nil
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type fakeAuditRepo struct {
+	records     []models.AuditRecord
+	checkpoints []models.AuditCheckpoint
+	// failCheckpoints makes CreateCheckpoint fail
+	failCheckpoints bool
+}
+
+func (r *fakeAuditRepo) Append(ctx context.Context, rec *models.AuditRecord) error {
+	var head *models.AuditRecord
+	if len(r.records) > 0 {
+		head = &r.records[len(r.records)-1]
+	}
+	Seal(head, rec)
+	r.records = append(r.records, *rec)
+	return nil
+}
+
+func (r *fakeAuditRepo) List(ctx context.Context, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	var page []models.AuditRecord
+	for _, rec := range r.records {
+		if rec.Seq > afterSeq && len(page) < limit {
+			page = append(page, rec)
+		}
+	}
+	return page, nil
+}
+
+func (r *fakeAuditRepo) ForUser(ctx context.Context, userID int, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	var page []models.AuditRecord
+	for _, rec := range r.records {
+		if rec.UserID == userID && rec.Seq > afterSeq && len(page) < limit {
+			page = append(page, rec)
+		}
+	}
+	return page, nil
+}
+
+func (r *fakeAuditRepo) CreateCheckpoint(ctx context.Context, cp models.AuditCheckpoint) error {
+	if r.failCheckpoints {
+		return errors.New("checkpoint write failed")
+	}
+	r.checkpoints = append(r.checkpoints, cp)
+	return nil
+}
+
+func (r *fakeAuditRepo) Checkpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	return r.checkpoints, nil
+}
+
+func newChain(t *testing.T, n int) (*fakeAuditRepo, ed25519.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	repo := &fakeAuditRepo{}
+	logger := NewLogger(repo, key, 3)
+	for i := range n {
+		if err := logger.Log(context.Background(), i, ActionLogin, map[string]string{"ip": "127.0.0.1"}); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+	return repo, pub
+}
+
+func TestVerify_IntactChain(t *testing.T) {
+	repo, pub := newChain(t, 10)
+
+	report, err := Verify(context.Background(), repo, pub, 3)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !report.Intact() {
+		t.Fatalf("Verify() broken at %d: %s; want intact", report.BrokenAt, report.Reason)
+	}
+	if report.Records != 10 || report.Checkpoints != 3 {
+		t.Errorf("Verify() = %d records, %d checkpoints; want 10, 3", report.Records, report.Checkpoints)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(r *fakeAuditRepo)
+		want   int64
+	}{
+		{"edited field", func(r *fakeAuditRepo) { r.records[4].Action = ActionProfileUpdate }, 5},
+		{"edited and rehashed", func(r *fakeAuditRepo) {
+			r.records[4].UserID = 99
+			r.records[4].Hash = Hash(r.records[4])
+		}, 6},
+		{"deleted record", func(r *fakeAuditRepo) {
+			r.records = append(r.records[:4], r.records[5:]...)
+		}, 5},
+		{"truncated tail", func(r *fakeAuditRepo) { r.records = r.records[:7] }, 8},
+		{"forged checkpoint", func(r *fakeAuditRepo) { r.checkpoints[0].Hash = r.records[0].Hash }, 3},
+		{"deleted checkpoint", func(r *fakeAuditRepo) {
+			r.checkpoints = append(r.checkpoints[:1], r.checkpoints[2:]...)
+		}, 6},
+		{"rehashed without checkpoints", func(r *fakeAuditRepo) {
+			r.checkpoints = nil
+			r.records[1].UserID = 99
+			for i := 1; i < len(r.records); i++ {
+				r.records[i].PrevHash = r.records[i-1].Hash
+				r.records[i].Hash = Hash(r.records[i])
+			}
+		}, 3},
+		{"truncated with its checkpoint", func(r *fakeAuditRepo) {
+			r.records = r.records[:9]
+			r.checkpoints = r.checkpoints[:2]
+		}, 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, pub := newChain(t, 10)
+			tt.tamper(repo)
+
+			report, err := Verify(context.Background(), repo, pub, 3)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if report.BrokenAt != tt.want {
+				t.Errorf("Verify() broken at %d (%s); want %d", report.BrokenAt, report.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify_FailedCheckpointWrite(t *testing.T) {
+	ctx := context.Background()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeAuditRepo{}
+	logger := NewLogger(repo, key, 3)
+	for i := range 5 {
+		repo.failCheckpoints = i == 2
+		err := logger.Log(ctx, i, ActionLogin, nil)
+		if i == 2 && err == nil {
+			t.Errorf("Log() of record 3 = nil error; want the checkpoint failure")
+		}
+	}
+
+	report, err := Verify(ctx, repo, pub, 3)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if report.BrokenAt != 3 {
+		t.Errorf("Verify() broken at %d (%s); want 3, the record left without its checkpoint", report.BrokenAt, report.Reason)
+	}
+}
+
+func TestParseSigningKey_Invalid(t *testing.T) {
+	if _, err := ParseSigningKey("c2hvcnQ="); err == nil {
+		t.Errorf("ParseSigningKey() with short seed = nil error; want error")
+	}
+}
+
+func TestParseVerifyKey(t *testing.T) {
+	key, err := ParseSigningKey("cR/10k2BmzvkrTLgps81avNiWpPBpBkyE6If7/wHMJI=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseVerifyKey(VerifyKey(key))
+	if err != nil || !pub.Equal(key.Public()) {
+		t.Errorf("ParseVerifyKey(VerifyKey()) = %v, %v; want the signing key's public half", pub, err)
+	}
+	// the seed is the same length as a public key but must not pass for one
+	if pub, _ := ParseVerifyKey("cR/10k2BmzvkrTLgps81avNiWpPBpBkyE6If7/wHMJI="); pub.Equal(key.Public()) {
+		t.Errorf("ParseVerifyKey(seed) = the public key")
+	}
+	if _, err := ParseVerifyKey("c2hvcnQ="); err == nil {
+		t.Errorf("ParseVerifyKey() with short key = nil error; want error")
+	}
+}
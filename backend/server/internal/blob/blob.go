@@ -0,0 +1,80 @@
+// Package blob stores opaque files outside the database: on the local
+// filesystem for single-node deployments, or in an S3-compatible object store.
+// Callers encrypt what they store; see Seal.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob: not found")
+	ErrInvalidKey = errors.New("blob: invalid key")
+)
+
+// BlobStore keeps files under slash-separated keys such as
+// "attachments/12/9f86d081". Keys are chosen by the application, never by
+// users.
+type BlobStore interface {
+	// Put stores size bytes from r under key, replacing any file there.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns ErrNotFound if nothing is stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key. Deleting a missing key is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that are empty, absolute or climb out of the store
+// with "..".
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// Open returns the store a URL names:
+//
+//	file:///var/lib/profile-manager/blobs
+//	s3://bucket/prefix?endpoint=http://localhost:9000&region=us-east-1
+//
+// S3 credentials are passed separately so they stay out of logged URLs.
+// Without an endpoint the AWS endpoint of the region is used.
+func Open(rawURL, accessKey, secretKey string) (BlobStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("blob: %q names no directory", rawURL)
+		}
+		return NewFileStore(u.Path)
+	case "s3":
+		region := u.Query().Get("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := u.Query().Get("endpoint")
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		return NewS3Store(S3Config{
+			Endpoint:  endpoint,
+			Region:    region,
+			Bucket:    u.Host,
+			Prefix:    strings.Trim(u.Path, "/"),
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+		})
+	}
+	return nil, fmt.Errorf("blob: unsupported store %q", rawURL)
+}
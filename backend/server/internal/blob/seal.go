@@ -0,0 +1,77 @@
+package blob
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// DataKeySize is the size of the per-file AES-256 keys Seal generates.
+const DataKeySize = 32
+
+var ErrSealed = errors.New("blob: cannot open sealed data")
+
+// Seal encrypts a file under a fresh data key with AES-256-GCM and returns
+// the ciphertext, nonce first, and the key. The caller wraps the key with its
+// master key and stores it next to the file's metadata, so each file has its
+// own key and the master key never touches file contents. The blob key is
+// bound in as associated data: a file copied to another key will not open.
+func Seal(plaintext []byte, blobKey string) (sealed, dataKey []byte, err error) {
+	if dataKey, err = NewDataKey(); err != nil {
+		return nil, nil, err
+	}
+	sealed, err = SealWith(plaintext, dataKey, blobKey)
+	return sealed, dataKey, err
+}
+
+// NewDataKey returns a random key for SealWith.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// SealWith is Seal with a given data key, for sets of files that share one,
+// such as the sizes of one image.
+func SealWith(plaintext, dataKey []byte, blobKey string) ([]byte, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(blobKey)), nil
+}
+
+// Unseal reverses Seal.
+func Unseal(sealed, dataKey []byte, blobKey string) ([]byte, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrSealed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(blobKey))
+	if err != nil {
+		return nil, ErrSealed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != DataKeySize {
+		return nil, errors.New("blob: data key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
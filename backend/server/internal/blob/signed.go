@@ -0,0 +1,84 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadToken     = errors.New("blob: invalid download token")
+	ErrTokenExpired = errors.New("blob: download token has expired")
+)
+
+// Signer issues the tokens of short-lived download URLs. A token names what
+// it grants access to and until when, and is useless once that time passes
+// or if any byte of it changes.
+type Signer struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewSigner needs a key of at least 32 bytes.
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) < 32 {
+		return nil, errors.New("blob: signing key must be at least 32 bytes")
+	}
+	return &Signer{key: key, now: time.Now}, nil
+}
+
+// Sign returns a URL-safe token for subject, valid for ttl.
+func (s *Signer) Sign(subject string, ttl time.Duration) (token string, expires time.Time) {
+	expires = s.now().Add(ttl).Truncate(time.Second)
+	return s.SignUntil(subject, expires), expires
+}
+
+// SignUntil returns a URL-safe token for subject, valid until the second
+// expires falls in. The same subject and time always give the same token.
+func (s *Signer) SignUntil(subject string, expires time.Time) string {
+	payload := subject + "|" + strconv.FormatInt(expires.Unix(), 10)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the subject of a token it signed that has not expired.
+func (s *Signer) Verify(token string) (string, error) {
+	enc := base64.RawURLEncoding
+	encPayload, encMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrBadToken
+	}
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil {
+		return "", ErrBadToken
+	}
+	mac, err := enc.DecodeString(encMAC)
+	if err != nil || !hmac.Equal(mac, s.mac(string(payload))) {
+		return "", ErrBadToken
+	}
+	// the subject may itself contain "|"
+	i := strings.LastIndexByte(string(payload), '|')
+	if i < 0 {
+		return "", ErrBadToken
+	}
+	subject := string(payload[:i])
+	expires, err := strconv.ParseInt(string(payload[i+1:]), 10, 64)
+	if err != nil {
+		return "", ErrBadToken
+	}
+	if !s.now().Before(time.Unix(expires, 0)) {
+		return "", ErrTokenExpired
+	}
+	return subject, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte("download\x00"))
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
@@ -0,0 +1,29 @@
+package cipher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrInvalidIndexKey = errors.New("blind index key must be a base64 encoded key of at least 32 bytes")
+
+// BlindIndex returns a keyed HMAC-SHA256 of value, hex encoded. Encrypt uses a
+// fresh nonce every time, so equal plaintexts never have equal ciphertexts; a
+// blind index is deterministic and can back a unique index or an equality
+// lookup without revealing the value. kind keeps the indexes of different
+// fields apart, so the same string indexed as a PAN and as a passport number
+// cannot be matched across the two.
+func BlindIndex(secretKeyBase64, kind, value string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(secretKeyBase64)
+	if err != nil || len(key) < 32 {
+		return "", ErrInvalidIndexKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
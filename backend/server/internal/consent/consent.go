@@ -0,0 +1,205 @@
+// Package consent defines the purposes personal data is processed for and the
+// notices shown when asking for consent to each, as the DPDP Act requires.
+//
+// The catalogue is a JSON list of purposes, each with its notices in version
+// order. A purpose's current notice is its last one: publishing a changed
+// notice means appending a version, never editing one, so every consent ever
+// given can be traced to the exact text that was shown. The embedded
+// catalogue can be replaced with Open.
+package consent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+// The purposes handlers check consent for. A catalogue loaded with Open must
+// define them.
+const (
+	PurposeKYC       = "kyc"
+	PurposeMarketing = "marketing"
+)
+
+var required = []string{PurposeKYC, PurposeMarketing}
+
+//go:embed notices.json
+var embedded []byte
+
+// Notice is one version of what a user is told before consenting to a purpose.
+type Notice struct {
+	Version int `json:"version"`
+	// Data names the fields processed for the purpose.
+	Data []string `json:"data"`
+	Text string   `json:"text"`
+}
+
+// Hash identifies the notice's text, so a receipt can be checked against the
+// catalogue it was issued from.
+func (n Notice) Hash() string {
+	sum := sha256.Sum256([]byte(n.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+type Purpose struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Notices []Notice `json:"notices"`
+}
+
+// Current is the notice in force.
+func (p Purpose) Current() Notice {
+	return p.Notices[len(p.Notices)-1]
+}
+
+// Notice returns the given version of the purpose's notice.
+func (p Purpose) Notice(version int) (Notice, bool) {
+	if version < 1 || version > len(p.Notices) {
+		return Notice{}, false
+	}
+	return p.Notices[version-1], true
+}
+
+type Catalogue struct {
+	purposes []Purpose
+	byID     map[string]Purpose
+}
+
+var purposeID = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// Load reads a catalogue from JSON. Notice versions must count up from 1.
+func Load(r io.Reader) (*Catalogue, error) {
+	var purposes []Purpose
+	if err := json.NewDecoder(r).Decode(&purposes); err != nil {
+		return nil, fmt.Errorf("consent: %w", err)
+	}
+	c := &Catalogue{purposes: purposes, byID: make(map[string]Purpose)}
+	for _, p := range purposes {
+		if !purposeID.MatchString(p.ID) {
+			return nil, fmt.Errorf("consent: invalid purpose id %q", p.ID)
+		}
+		if _, ok := c.byID[p.ID]; ok {
+			return nil, fmt.Errorf("consent: purpose %q is defined twice", p.ID)
+		}
+		if p.Title == "" || len(p.Notices) == 0 {
+			return nil, fmt.Errorf("consent: purpose %q needs a title and a notice", p.ID)
+		}
+		for i, n := range p.Notices {
+			if n.Version != i+1 {
+				return nil, fmt.Errorf("consent: purpose %q: notice %d has version %d", p.ID, i+1, n.Version)
+			}
+			if n.Text == "" {
+				return nil, fmt.Errorf("consent: purpose %q: notice version %d is empty", p.ID, n.Version)
+			}
+		}
+		c.byID[p.ID] = p
+	}
+	for _, id := range required {
+		if _, ok := c.byID[id]; !ok {
+			return nil, fmt.Errorf("consent: purpose %q is not defined", id)
+		}
+	}
+	return c, nil
+}
+
+// Open loads a catalogue from a JSON file.
+func Open(path string) (*Catalogue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Default returns the embedded catalogue.
+var Default = sync.OnceValue(func() *Catalogue {
+	c, err := Load(bytes.NewReader(embedded))
+	if err != nil {
+		panic(err)
+	}
+	return c
+})
+
+// Purposes returns every purpose in catalogue order.
+func (c *Catalogue) Purposes() []Purpose {
+	return c.purposes
+}
+
+func (c *Catalogue) Purpose(id string) (Purpose, bool) {
+	p, ok := c.byID[id]
+	return p, ok
+}
+
+// Covers reports whether a consent, which must be the user's current one for
+// its purpose, still holds: it has not been withdrawn and was given to the
+// notice in force. A new notice version needs consent again.
+func (c *Catalogue) Covers(consent *models.Consent) bool {
+	p, ok := c.byID[consent.Purpose]
+	return ok && consent.WithdrawnAt == nil && consent.NoticeVersion == p.Current().Version
+}
+
+// Receipt is the record of a consent a user can download and keep. It names
+// the notice by version and hash as well as quoting it.
+type Receipt struct {
+	ReceiptID   int        `json:"receipt_id"`
+	IssuedAt    time.Time  `json:"issued_at"`
+	Principal   Principal  `json:"principal"`
+	Purpose     string     `json:"purpose"`
+	Title       string     `json:"title"`
+	Notice      Notice     `json:"notice"`
+	NoticeHash  string     `json:"notice_sha256"`
+	GrantedAt   time.Time  `json:"granted_at"`
+	WithdrawnAt *time.Time `json:"withdrawn_at,omitempty"`
+	Status      string     `json:"status"`
+}
+
+// Principal is the person the data is about, in the DPDP Act's words.
+type Principal struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// Receipt states of a consent.
+const (
+	StatusActive    = "active"
+	StatusWithdrawn = "withdrawn"
+)
+
+// Receipt makes the receipt of a consent the user gave.
+func (c *Catalogue) Receipt(user *models.User, consent *models.Consent, issued time.Time) (*Receipt, error) {
+	p, ok := c.byID[consent.Purpose]
+	if !ok {
+		return nil, fmt.Errorf("consent: purpose %q is not in the catalogue", consent.Purpose)
+	}
+	n, ok := p.Notice(consent.NoticeVersion)
+	if !ok {
+		return nil, fmt.Errorf("consent: purpose %q has no notice version %d", consent.Purpose, consent.NoticeVersion)
+	}
+	r := &Receipt{
+		ReceiptID:   consent.ID,
+		IssuedAt:    issued,
+		Principal:   Principal{UserID: user.ID, Email: user.Email},
+		Purpose:     p.ID,
+		Title:       p.Title,
+		Notice:      n,
+		NoticeHash:  n.Hash(),
+		GrantedAt:   consent.GrantedAt,
+		WithdrawnAt: consent.WithdrawnAt,
+		Status:      StatusActive,
+	}
+	if consent.WithdrawnAt != nil {
+		r.Status = StatusWithdrawn
+	}
+	return r, nil
+}
@@ -0,0 +1,71 @@
+package consent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+func TestDefault_Loads(t *testing.T) {
+	for _, id := range required {
+		if _, ok := Default().Purpose(id); !ok {
+			t.Errorf("embedded catalogue has no %q purpose", id)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	kyc := `{"id":"kyc","title":"KYC","notices":[{"version":1,"text":"t"}]}`
+	marketing := `{"id":"marketing","title":"Marketing","notices":[{"version":1,"text":"t"}]}`
+	tests := map[string]string{
+		"not JSON":         `{`,
+		"missing purpose":  `[` + kyc + `]`,
+		"duplicate":        `[` + kyc + `,` + kyc + `,` + marketing + `]`,
+		"bad id":           `[` + kyc + `,` + marketing + `,{"id":"Bad Id","title":"x","notices":[{"version":1,"text":"t"}]}]`,
+		"no notices":       `[` + kyc + `,{"id":"marketing","title":"Marketing","notices":[]}]`,
+		"skipped version":  `[` + kyc + `,{"id":"marketing","title":"Marketing","notices":[{"version":1,"text":"a"},{"version":3,"text":"b"}]}]`,
+		"empty notice":     `[` + kyc + `,{"id":"marketing","title":"Marketing","notices":[{"version":1,"text":""}]}]`,
+		"missing title":    `[` + kyc + `,{"id":"marketing","notices":[{"version":1,"text":"t"}]}]`,
+		"versions from 0":  `[` + kyc + `,{"id":"marketing","title":"Marketing","notices":[{"version":0,"text":"t"}]}]`,
+		"unordered notice": `[` + kyc + `,{"id":"marketing","title":"Marketing","notices":[{"version":2,"text":"b"},{"version":1,"text":"a"}]}]`,
+	}
+	for name, data := range tests {
+		if _, err := Load(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: Load() succeeded; want an error", name)
+		}
+	}
+}
+
+func TestCoversAndReceipt(t *testing.T) {
+	c, err := Load(strings.NewReader(`[
+		{"id":"kyc","title":"KYC","notices":[{"version":1,"text":"first"},{"version":2,"data":["aadhaar_number"],"text":"second"}]},
+		{"id":"marketing","title":"Marketing","notices":[{"version":1,"text":"t"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	old := &models.Consent{ID: 4, Purpose: PurposeKYC, NoticeVersion: 1, GrantedAt: granted}
+	current := &models.Consent{ID: 5, Purpose: PurposeKYC, NoticeVersion: 2, GrantedAt: granted}
+	withdrawn := &models.Consent{ID: 6, Purpose: PurposeKYC, NoticeVersion: 2, GrantedAt: granted, WithdrawnAt: &granted}
+	if c.Covers(old) || !c.Covers(current) || c.Covers(withdrawn) || c.Covers(&models.Consent{Purpose: "unknown", NoticeVersion: 1}) {
+		t.Error("Covers() should hold only for a live consent to the current notice")
+	}
+
+	user := &models.User{ID: 1, Email: "asha@example.com"}
+	r, err := c.Receipt(user, old, granted)
+	if err != nil {
+		t.Fatalf("Receipt() error = %v", err)
+	}
+	if r.ReceiptID != 4 || r.Notice.Text != "first" || r.NoticeHash != (Notice{Text: "first"}).Hash() || r.Status != StatusActive || r.Principal.Email != "asha@example.com" {
+		t.Errorf("Receipt() = %+v; want the notice that was shown", r)
+	}
+	if r, _ := c.Receipt(user, withdrawn, granted); r.Status != StatusWithdrawn || r.WithdrawnAt == nil {
+		t.Errorf("Receipt(withdrawn) = %+v", r)
+	}
+	if _, err := c.Receipt(user, &models.Consent{Purpose: PurposeKYC, NoticeVersion: 3}, granted); err == nil {
+		t.Error("Receipt() of an unknown notice version succeeded")
+	}
+}
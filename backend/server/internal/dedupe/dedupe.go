@@ -0,0 +1,56 @@
+// Package dedupe decides whether two profiles are likely the same person.
+// Aadhaar numbers and phone numbers are compared through their blind
+// indexes; names are compared fuzzily, and only between profiles with the
+// same date of birth, since a name alone is a poor identifier.
+package dedupe
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+// NameThreshold is the NameSimilarity at or above which two profiles born
+// on the same day are flagged. Variants like "Preethi" and "Priti" fold to
+// the same key; the threshold leaves room for a typo or a dropped initial.
+const NameThreshold = 0.92
+
+// PhoneKey is the form of a phone number that is blind-indexed: its last
+// ten digits, so "+91 98765 43210", "098765-43210" and "9876543210" index
+// alike.
+func PhoneKey(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+// Compare returns the models.DuplicateReasons that p and other have in
+// common, none if they look like different people, and the similarity of
+// their names. Both must carry their blind indexes and a plaintext name.
+func Compare(p, other *models.Profile) (reasons []string, score float64) {
+	if p.AadhaarIndex != "" && p.AadhaarIndex == other.AadhaarIndex {
+		reasons = append(reasons, models.DuplicateAadhaar)
+	}
+	if p.PhoneIndex != "" && p.PhoneIndex == other.PhoneIndex {
+		reasons = append(reasons, models.DuplicatePhone)
+	}
+	score = NameSimilarity(p.FullName, other.FullName)
+	if score >= NameThreshold && sameDay(p.DateOfBirth, other.DateOfBirth) {
+		reasons = append(reasons, models.DuplicateNameDOB)
+	}
+	return reasons, score
+}
+
+// sameDay compares dates of birth the way the DATE column stores them.
+func sameDay(a, b time.Time) bool {
+	return a.Format(time.DateOnly) == b.Format(time.DateOnly)
+}
@@ -0,0 +1,108 @@
+package dedupe
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		// the textbook examples
+		{"martha", "marhta", 0.9611},
+		{"dwayne", "duane", 0.84},
+		{"dixon", "dicksonx", 0.8133},
+		{"same", "same", 1},
+		{"abc", "xyz", 0},
+		{"", "", 1},
+		{"a", "", 0},
+	}
+	for _, tt := range tests {
+		if got := JaroWinkler(tt.a, tt.b); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("JaroWinkler(%q, %q) = %.4f; want %.4f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"राहुल शर्मा", "raahul sharmaa"},
+		{"राम", "raam"},
+		{"कमल", "kamal"},
+		{"प्रिया", "priyaa"},
+		{"संजय", "sanjay"},
+		{"ज़ोया", "zoyaa"},
+		{"Asha K", "Asha K"},
+	}
+	for _, tt := range tests {
+		if got := Transliterate(tt.in); got != tt.want {
+			t.Errorf("Transliterate(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"Smt. Preethi Reddy", "preeti redy", true},
+		{"Rahul Sharma", "राहुल शर्मा", true},
+		{"Mohammed Siddiqui", "Mohammad Siddiqui", true},
+		{"Sharma Rahul", "Rahul Sharma", true},
+		{"Bhavna Deshpande", "Bhawna Despande", true},
+		{"Rahul Sharma", "Rohit Verma", false},
+		{"Asha Kumari", "Usha Rani", false},
+		{"Rahul Sharma", "", false},
+	}
+	for _, tt := range tests {
+		got := NameSimilarity(tt.a, tt.b)
+		if (got >= NameThreshold) != tt.same {
+			t.Errorf("NameSimilarity(%q, %q) = %.3f; want same person %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestPhoneKey(t *testing.T) {
+	for _, phone := range []string{"+91 98765 43210", "098765-43210", "9876543210", "(+91) 9876543210"} {
+		if got := PhoneKey(phone); got != "9876543210" {
+			t.Errorf("PhoneKey(%q) = %q", phone, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dob := time.Date(1990, time.March, 14, 0, 0, 0, 0, time.UTC)
+	p := &models.Profile{FullName: "Preethi Reddy", DateOfBirth: dob, AadhaarIndex: "a1", PhoneIndex: "p1"}
+
+	tests := []struct {
+		name  string
+		other models.Profile
+		want  []string
+	}{
+		{"same Aadhaar", models.Profile{FullName: "Someone Else", DateOfBirth: dob.AddDate(1, 0, 0), AadhaarIndex: "a1"}, []string{models.DuplicateAadhaar}},
+		{"same phone", models.Profile{FullName: "Someone Else", DateOfBirth: dob, PhoneIndex: "p1"}, []string{models.DuplicatePhone}},
+		{"variant spelling, same birthday", models.Profile{FullName: "Priti Redy", DateOfBirth: dob}, []string{models.DuplicateNameDOB}},
+		{"same name, other birthday", models.Profile{FullName: "Preethi Reddy", DateOfBirth: dob.AddDate(0, 0, 1)}, nil},
+		{"everything", models.Profile{FullName: "preethi reddy", DateOfBirth: dob, AadhaarIndex: "a1", PhoneIndex: "p1"},
+			[]string{models.DuplicateAadhaar, models.DuplicatePhone, models.DuplicateNameDOB}},
+		// profiles from before the indexes have empty ones, which match nothing
+		{"no indexes", models.Profile{FullName: "Someone Else", DateOfBirth: dob}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := Compare(p, &tt.other); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Compare() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+	if _, score := Compare(&models.Profile{FullName: "A"}, &models.Profile{FullName: "A"}); score != 1 {
+		t.Errorf("Compare() score of equal names = %v; want 1", score)
+	}
+}
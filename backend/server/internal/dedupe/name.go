@@ -0,0 +1,131 @@
+package dedupe
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// titles are dropped from names before they are compared.
+var titles = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "miss": true, "dr": true,
+	"shri": true, "sri": true, "smt": true, "kumari": true, "km": true, "late": true,
+}
+
+// spelling folds the romanisations that differ only in how a sound is
+// written: aspirates, long vowels and the letters used interchangeably in
+// Indian names. Longer patterns come first, so "chh" wins over "ch".
+var spelling = strings.NewReplacer(
+	"chh", "c", "ch", "c", "sh", "s",
+	"bh", "b", "dh", "d", "gh", "g", "jh", "j", "kh", "k", "ph", "f", "th", "t",
+	"aa", "a", "ee", "i", "oo", "u", "ck", "k",
+	"w", "v", "z", "j", "q", "k",
+)
+
+// NormalizeName reduces a full name to a key for fuzzy comparison:
+// Devanagari is transliterated, case, punctuation and titles are dropped and
+// common spelling variants are folded, so "Smt. Preethi Reddy" and "preeti
+// redy" come out alike.
+func NormalizeName(name string) string {
+	name = strings.ToLower(Transliterate(name))
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) })
+	out := words[:0]
+	for _, w := range words {
+		if titles[w] {
+			continue
+		}
+		w = spelling.Replace(w)
+		w = squeeze(w)
+		if strings.HasSuffix(w, "y") && len(w) > 1 {
+			w = strings.TrimSuffix(w, "y") + "i"
+		}
+		out = append(out, w)
+	}
+	return strings.Join(out, " ")
+}
+
+// squeeze collapses runs of the same letter, "reddy" to "redy".
+func squeeze(s string) string {
+	var b strings.Builder
+	var last rune
+	for i, r := range s {
+		if i > 0 && r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+// NameSimilarity is the Jaro-Winkler similarity of two normalized names,
+// from 0 to 1. Names are also compared with their words sorted, so a
+// surname written first still matches.
+func NameSimilarity(a, b string) float64 {
+	a, b = NormalizeName(a), NormalizeName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	return max(JaroWinkler(a, b), JaroWinkler(sortWords(a), sortWords(b)))
+}
+
+func sortWords(s string) string {
+	words := strings.Fields(s)
+	slices.Sort(words)
+	return strings.Join(words, " ")
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity of a and b, from 0 for
+// nothing in common to 1 for equal strings. It favours strings that share a
+// prefix, which suits names: typos and variants cluster towards the end.
+func JaroWinkler(a, b string) float64 {
+	s, t := []rune(a), []rune(b)
+	if len(s) == 0 && len(t) == 0 {
+		return 1
+	}
+	if len(s) == 0 || len(t) == 0 {
+		return 0
+	}
+
+	window := max(len(s), len(t))/2 - 1
+	window = max(window, 0)
+	sMatched := make([]bool, len(s))
+	tMatched := make([]bool, len(t))
+	matches := 0
+	for i := range s {
+		lo, hi := max(0, i-window), min(len(t), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !tMatched[j] && s[i] == t[j] {
+				sMatched[i], tMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	// half the matched characters that are out of order
+	transpositions, j := 0, 0
+	for i := range s {
+		if !sMatched[i] {
+			continue
+		}
+		for !tMatched[j] {
+			j++
+		}
+		if s[i] != t[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(s)) + m/float64(len(t)) + (m-float64(transpositions/2))/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(s), len(t)) && s[prefix] == t[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,83 @@
+package dedupe
+
+import "strings"
+
+// Devanagari consonants, each carrying the inherent vowel "a" unless a vowel
+// sign or virama follows.
+var consonants = map[rune]string{
+	'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "n",
+	'च': "ch", 'छ': "chh", 'ज': "j", 'झ': "jh", 'ञ': "n",
+	'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+	'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n",
+	'प': "p", 'फ': "ph", 'ब': "b", 'भ': "bh", 'म': "m",
+	'य': "y", 'र': "r", 'ल': "l", 'ळ': "l", 'व': "v",
+	'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+	// the nukta letters, see composeNukta
+	'\u0958': "q", '\u0959': "kh", '\u095a': "g", '\u095b': "z",
+	'\u095c': "r", '\u095d': "rh", '\u095e': "f", '\u095f': "y",
+}
+
+// vowels are the independent vowel letters, which start a syllable.
+var vowels = map[rune]string{
+	'अ': "a", 'आ': "aa", 'इ': "i", 'ई': "ee", 'उ': "u", 'ऊ': "oo",
+	'ऋ': "ri", 'ए': "e", 'ऐ': "ai", 'ओ': "o", 'औ': "au",
+}
+
+// signs are the dependent vowel signs, which replace a consonant's inherent
+// vowel.
+var signs = map[rune]string{
+	'ा': "aa", 'ि': "i", 'ी': "ee", 'ु': "u", 'ू': "oo", 'ृ': "ri",
+	'े': "e", 'ै': "ai", 'ो': "o", 'ौ': "au",
+}
+
+// marks nasalise or aspirate the vowel before them, inherent or not.
+var marks = map[rune]string{'ं': "n", 'ँ': "n", 'ः': "h"}
+
+const (
+	virama = '्'
+	nukta  = '़'
+)
+
+// composeNukta turns a consonant followed by a nukta mark, the way keyboards
+// usually type it, into the precomposed letter. Any other nukta is skipped,
+// leaving the plain consonant.
+var composeNukta = strings.NewReplacer(
+	"क\u093c", "\u0958", "ख\u093c", "\u0959", "ग\u093c", "\u095a", "ज\u093c", "\u095b",
+	"ड\u093c", "\u095c", "ढ\u093c", "\u095d", "फ\u093c", "\u095e", "य\u093c", "\u095f",
+)
+
+// Transliterate writes the Devanagari in s in Latin letters the way names are
+// usually romanised, "शर्मा" as "sharmaa", and leaves everything else as it is.
+// A word-final consonant loses its inherent vowel, as it does in Hindi
+// speech: "राम" is "raam", not "raama".
+func Transliterate(s string) string {
+	var b strings.Builder
+	// a consonant was written and its inherent vowel is still owed
+	pending := false
+	for _, r := range composeNukta.Replace(s) {
+		if r == nukta {
+			continue
+		}
+		// the inherent vowel is spoken before another consonant or a mark,
+		// and dropped at the end of a word
+		if pending && (consonants[r] != "" || marks[r] != "") {
+			b.WriteString("a")
+		}
+		pending = false
+		switch {
+		case consonants[r] != "":
+			b.WriteString(consonants[r])
+			pending = true
+		case vowels[r] != "":
+			b.WriteString(vowels[r])
+		case signs[r] != "":
+			b.WriteString(signs[r])
+		case marks[r] != "":
+			b.WriteString(marks[r])
+		case r == virama:
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,305 @@
+// Package ekyc reads UIDAI offline Aadhaar eKYC files and Secure QR codes.
+//
+// A resident downloads the file from UIDAI as a ZIP archive protected by a
+// share code of their choosing. Inside is one XML document, signed by UIDAI
+// with an enveloped XML signature, carrying the demographic details on the
+// Aadhaar card. The reference ID starts with the last four digits of the
+// Aadhaar number, followed by the time the file was generated; the mobile
+// number and email address are only present as salted hashes.
+//
+// The Secure QR code on Aadhaar letters carries the same details in a
+// compact signed binary form; see QRVerifier.
+package ekyc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/yeka/zip"
+)
+
+var (
+	ErrNoCertificates = errors.New("ekyc: no certificates found")
+	ErrArchive        = errors.New("ekyc: not an offline eKYC archive")
+	ErrShareCode      = errors.New("ekyc: wrong share code")
+	ErrSignature      = errors.New("ekyc: signature does not verify")
+	ErrMalformed      = errors.New("ekyc: malformed eKYC document")
+)
+
+// MaxDocumentSize caps the unpacked XML. Real files are tens of kilobytes,
+// most of it the photo.
+const MaxDocumentSize = 1 << 20
+
+// Address is the proof of address section of the document.
+type Address struct {
+	CareOf      string `json:"care_of"`
+	House       string `json:"house"`
+	Street      string `json:"street"`
+	Landmark    string `json:"landmark"`
+	Locality    string `json:"locality"`
+	VTC         string `json:"vtc"`
+	PostOffice  string `json:"post_office"`
+	SubDistrict string `json:"sub_district"`
+	District    string `json:"district"`
+	State       string `json:"state"`
+	Country     string `json:"country"`
+	PinCode     string `json:"pin_code"`
+}
+
+// String joins the parts of the address the way it is printed on the card,
+// leaving out the care-of line and empty parts.
+func (a Address) String() string {
+	var parts []string
+	for _, p := range []string{a.House, a.Street, a.Landmark, a.Locality, a.VTC, a.PostOffice, a.SubDistrict, a.District, a.State} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	s := strings.Join(parts, ", ")
+	if a.PinCode != "" {
+		s += " - " + a.PinCode
+	}
+	return s
+}
+
+// Record is what a verified document says about its holder. The photo is
+// never read.
+type Record struct {
+	ReferenceID string
+	// Last4 are the last four digits of the Aadhaar number.
+	Last4       string
+	GeneratedAt time.Time
+	Name        string
+	DateOfBirth time.Time
+	Gender      string
+	Address     Address
+	// MobileHash and EmailHash are empty when no mobile number or email
+	// address is linked to the Aadhaar number.
+	MobileHash string
+	EmailHash  string
+	// Digest is the SHA-256 of the XML as it was in the archive, or of the
+	// signed data of a QR code.
+	Digest string
+}
+
+// ReferenceHash is the SHA-256 of the reference ID, hex encoded. It identifies
+// the file without keeping the digits of the Aadhaar number it starts with.
+func (r *Record) ReferenceHash() string {
+	sum := sha256.Sum256([]byte(r.ReferenceID))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchMobile reports whether mobile is the number hashed into the document.
+// UIDAI hashes the mobile number followed by the share code with SHA-256, as
+// many times as the last digit of the Aadhaar number, and at least once.
+// Secure QR codes hash the number alone; pass an empty share code for those.
+func (r *Record) MatchMobile(mobile, shareCode string) bool {
+	return r.MobileHash != "" && strings.EqualFold(r.MobileHash, saltedHash(mobile+shareCode, r.Last4))
+}
+
+// MatchEmail is MatchMobile for the email address.
+func (r *Record) MatchEmail(email, shareCode string) bool {
+	return r.EmailHash != "" && strings.EqualFold(r.EmailHash, saltedHash(email+shareCode, r.Last4))
+}
+
+func saltedHash(value, last4 string) string {
+	rounds := int(last4[len(last4)-1] - '0')
+	rounds = max(rounds, 1)
+	for range rounds {
+		sum := sha256.Sum256([]byte(value))
+		value = hex.EncodeToString(sum[:])
+	}
+	return value
+}
+
+// Verifier checks documents against the UIDAI signing certificates.
+type Verifier struct {
+	certs []*x509.Certificate
+}
+
+func NewVerifier(certs []*x509.Certificate) *Verifier {
+	return &Verifier{certs: certs}
+}
+
+// LoadCertificates parses every CERTIFICATE block of a PEM file.
+func LoadCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCertificates
+	}
+	return certs, nil
+}
+
+// Open builds a Verifier from a PEM file of certificates.
+func Open(file string) (*Verifier, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := LoadCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return NewVerifier(certs), nil
+}
+
+// ReadArchive unpacks the XML document from an offline eKYC archive with the
+// share code and verifies it.
+func (v *Verifier) ReadArchive(archive []byte, shareCode string) (*Record, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, ErrArchive
+	}
+	for _, f := range zr.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".xml") {
+			continue
+		}
+		if f.IsEncrypted() {
+			f.SetPassword(shareCode)
+		}
+		doc, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		return v.Verify(doc)
+	}
+	return nil, ErrArchive
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		if f.IsEncrypted() {
+			return nil, ErrShareCode
+		}
+		return nil, ErrArchive
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxDocumentSize+1))
+	if err != nil {
+		// a wrong password fails authentication, or with the older
+		// ZipCrypto scheme garbles the stream until the checksum fails
+		if f.IsEncrypted() {
+			return nil, ErrShareCode
+		}
+		return nil, ErrArchive
+	}
+	if len(data) > MaxDocumentSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrMalformed, MaxDocumentSize)
+	}
+	return data, nil
+}
+
+// Verify checks the signature of an eKYC XML document and reads it. Only the
+// signed element is read, never the document as received, so nothing can be
+// smuggled in next to the signature. The signing certificate must have been
+// valid when the document was generated rather than now: residents keep
+// their files, and UIDAI rotates its certificates.
+func (v *Verifier) Verify(doc []byte) (*Record, error) {
+	tree := etree.NewDocument()
+	if err := tree.ReadFromBytes(doc); err != nil || tree.Root() == nil {
+		return nil, ErrMalformed
+	}
+	rec := &Record{ReferenceID: tree.Root().SelectAttrValue("referenceId", "")}
+	if err := rec.parseReference(); err != nil {
+		return nil, err
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: v.certs})
+	ctx.Clock = dsig.NewFakeClockAt(rec.GeneratedAt)
+	signed, err := ctx.Validate(tree.Root())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+
+	rec.ReferenceID = signed.SelectAttrValue("referenceId", "")
+	if err := rec.parseReference(); err != nil {
+		return nil, err
+	}
+	if err := rec.parseData(signed); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(doc)
+	rec.Digest = hex.EncodeToString(sum[:])
+	return rec, nil
+}
+
+// parseReference splits a reference ID such as 678920190305123456789 into
+// the last four Aadhaar digits and a timestamp in IST.
+func (r *Record) parseReference() error {
+	if len(r.ReferenceID) < 4+14 || strings.Trim(r.ReferenceID, "0123456789") != "" {
+		return fmt.Errorf("%w: invalid reference ID", ErrMalformed)
+	}
+	generated, err := time.ParseInLocation("20060102150405", r.ReferenceID[4:18], ist)
+	if err != nil {
+		return fmt.Errorf("%w: invalid reference ID", ErrMalformed)
+	}
+	r.Last4, r.GeneratedAt = r.ReferenceID[:4], generated
+	return nil
+}
+
+var ist = time.FixedZone("IST", 5*60*60+30*60)
+
+func (r *Record) parseData(root *etree.Element) error {
+	poi := root.FindElement("./UidData/Poi")
+	poa := root.FindElement("./UidData/Poa")
+	if poi == nil || poa == nil {
+		return fmt.Errorf("%w: missing Poi or Poa", ErrMalformed)
+	}
+	attr := func(el *etree.Element, key string) string {
+		return strings.TrimSpace(el.SelectAttrValue(key, ""))
+	}
+
+	r.Name = attr(poi, "name")
+	r.Gender = attr(poi, "gender")
+	r.MobileHash = attr(poi, "m")
+	r.EmailHash = attr(poi, "e")
+	dob, err := time.Parse("02-01-2006", attr(poi, "dob"))
+	if err != nil || r.Name == "" {
+		return fmt.Errorf("%w: missing name or date of birth", ErrMalformed)
+	}
+	r.DateOfBirth = dob
+
+	r.Address = Address{
+		CareOf:      attr(poa, "careof"),
+		House:       attr(poa, "house"),
+		Street:      attr(poa, "street"),
+		Landmark:    attr(poa, "landmark"),
+		Locality:    attr(poa, "loc"),
+		VTC:         attr(poa, "vtc"),
+		PostOffice:  attr(poa, "po"),
+		SubDistrict: attr(poa, "subdist"),
+		District:    attr(poa, "dist"),
+		State:       attr(poa, "state"),
+		Country:     attr(poa, "country"),
+		PinCode:     attr(poa, "pc"),
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package ekyc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/yeka/zip"
+)
+
+// referenceID is for an Aadhaar number ending in 0124, generated on 5 March 2019.
+const referenceID = "012420190305123456789"
+
+const unsigned = `<OfflinePaperlessKyc referenceId="` + referenceID + `">` +
+	`<UidData>` +
+	`<Poi dob="14-03-1990" e="" gender="F" m="MOBILEHASH" name="Asha Rao"/>` +
+	`<Poa careof="" country="India" dist="Bengaluru" house="12" landmark="" loc="MG Road" pc="560001" po="" state="Karnataka" street="" subdist="" vtc="Bengaluru"/>` +
+	`<Pht>cGhvdG8=</Pht>` +
+	`</UidData>` +
+	`</OfflinePaperlessKyc>`
+
+// newSigner returns a self-signed certificate valid around the reference
+// time, and a function that signs documents with it.
+func newSigner(t *testing.T) (*x509.Certificate, func(doc string) []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test UIDAI signer"},
+		NotBefore:    time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	sign := func(doc string) []byte {
+		tree := etree.NewDocument()
+		if err := tree.ReadFromString(doc); err != nil {
+			t.Fatal(err)
+		}
+		ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}))
+		signed, err := ctx.SignEnveloped(tree.Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.SetRoot(signed)
+		out, err := tree.WriteToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	return cert, sign
+}
+
+func archive(t *testing.T, doc []byte, shareCode string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Encrypt("offlineaadhaar20190305123456789.xml", shareCode, zip.AES256Encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(doc)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	cert, sign := newSigner(t)
+	v := NewVerifier([]*x509.Certificate{cert})
+	mobileHash := saltedHash("9876543210"+"1234", "0124")
+	doc := sign(strings.Replace(unsigned, "MOBILEHASH", mobileHash, 1))
+
+	rec, err := v.ReadArchive(archive(t, doc, "1234"), "1234")
+	if err != nil {
+		t.Fatalf("ReadArchive() error = %v", err)
+	}
+	if rec.Name != "Asha Rao" || !rec.DateOfBirth.Equal(time.Date(1990, 3, 14, 0, 0, 0, 0, time.UTC)) || rec.Last4 != "0124" {
+		t.Errorf("ReadArchive() = %+v", rec)
+	}
+	if got, want := rec.Address.String(), "12, MG Road, Bengaluru, Bengaluru, Karnataka - 560001"; got != want {
+		t.Errorf("Address = %q; want %q", got, want)
+	}
+	if !rec.MatchMobile("9876543210", "1234") || rec.MatchMobile("9876543211", "1234") || rec.MatchEmail("", "1234") {
+		t.Error("MatchMobile/MatchEmail do not follow the hash in the document")
+	}
+
+	if _, err := v.ReadArchive(archive(t, doc, "1234"), "4321"); !errors.Is(err, ErrShareCode) {
+		t.Errorf("ReadArchive(wrong share code) error = %v; want %v", err, ErrShareCode)
+	}
+	if _, err := v.ReadArchive([]byte("not a zip"), "1234"); !errors.Is(err, ErrArchive) {
+		t.Errorf("ReadArchive(not a zip) error = %v; want %v", err, ErrArchive)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	cert, sign := newSigner(t)
+	other, _ := newSigner(t)
+	doc := sign(unsigned)
+
+	tampered := bytes.Replace(doc, []byte("Asha Rao"), []byte("Ravi Rao"), 1)
+	if _, err := NewVerifier([]*x509.Certificate{cert}).Verify(tampered); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify(tampered) error = %v; want %v", err, ErrSignature)
+	}
+	if _, err := NewVerifier([]*x509.Certificate{other}).Verify(doc); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify(untrusted signer) error = %v; want %v", err, ErrSignature)
+	}
+	// the certificate had expired by 2021
+	late := sign(strings.Replace(unsigned, "20190305", "20210305", 1))
+	if _, err := NewVerifier([]*x509.Certificate{cert}).Verify(late); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify(generated after the certificate expired) error = %v; want %v", err, ErrSignature)
+	}
+}
+
+func TestLoadCertificates(t *testing.T) {
+	cert, _ := newSigner(t)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if certs, err := LoadCertificates(data); err != nil || len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Errorf("LoadCertificates() = %v, %v", certs, err)
+	}
+	if _, err := LoadCertificates([]byte("nothing here")); !errors.Is(err, ErrNoCertificates) {
+		t.Errorf("LoadCertificates(empty) error = %v; want %v", err, ErrNoCertificates)
+	}
+}
@@ -0,0 +1,201 @@
+package ekyc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrNoPublicKey = errors.New("ekyc: no RSA public key found")
+
+// MaxQRPayload caps the decimal payload of a Secure QR code. Real codes are
+// around four thousand digits.
+const MaxQRPayload = 16 << 10
+
+// qrDelimiter separates the text fields of a Secure QR code.
+const qrDelimiter = 255
+
+// The text fields of a Secure QR code, in order. Version 2 and later codes
+// start with a "V2" style version field before these. Anything after vtc,
+// such as the photo, is not read.
+const (
+	qrEmailMobile = iota
+	qrReferenceID
+	qrName
+	qrDateOfBirth
+	qrGender
+	qrCareOf
+	qrDistrict
+	qrLandmark
+	qrHouse
+	qrLocality
+	qrPinCode
+	qrPostOffice
+	qrState
+	qrStreet
+	qrSubDistrict
+	qrVTC
+	qrFields
+)
+
+// QRVerifier decodes the Secure QR code printed on Aadhaar letters and
+// e-Aadhaar PDFs and checks its signature with UIDAI's public key.
+type QRVerifier struct {
+	key *rsa.PublicKey
+}
+
+func NewQRVerifier(key *rsa.PublicKey) *QRVerifier {
+	return &QRVerifier{key: key}
+}
+
+// LoadPublicKey reads the first RSA public key of a PEM file, given either as
+// a PUBLIC KEY block or inside a CERTIFICATE.
+func LoadPublicKey(data []byte) (*rsa.PublicKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, ErrNoPublicKey
+		}
+		var key any
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	}
+}
+
+// OpenQR builds a QRVerifier from a PEM file holding UIDAI's public key.
+func OpenQR(file string) (*QRVerifier, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := LoadPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return NewQRVerifier(key), nil
+}
+
+// Decode reads the payload of a Secure QR code: a decimal integer whose
+// big-endian bytes are a gzip stream. Decompressed, it is a run of
+// 255-delimited text fields, the photo, the hashes of the email address and
+// mobile number that are present, and an RSA-SHA256 signature over all of
+// that, in the last key-size bytes.
+func (v *QRVerifier) Decode(payload string) (*Record, error) {
+	payload = strings.TrimSpace(payload)
+	if len(payload) > MaxQRPayload {
+		return nil, fmt.Errorf("%w: QR payload is too long", ErrMalformed)
+	}
+	n, ok := new(big.Int).SetString(payload, 10)
+	if !ok || n.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: QR payload is not a decimal number", ErrMalformed)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(n.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: QR payload is not compressed data", ErrMalformed)
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, MaxDocumentSize+1))
+	if err != nil || len(data) > MaxDocumentSize {
+		return nil, fmt.Errorf("%w: QR payload does not decompress", ErrMalformed)
+	}
+
+	sigLen := v.key.Size()
+	if len(data) <= sigLen {
+		return nil, fmt.Errorf("%w: QR data is shorter than its signature", ErrMalformed)
+	}
+	signed, sig := data[:len(data)-sigLen], data[len(data)-sigLen:]
+	digest := sha256.Sum256(signed)
+	if err := rsa.VerifyPKCS1v15(v.key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+
+	fields := bytes.SplitN(signed, []byte{qrDelimiter}, qrFields+2)
+	if len(fields) > 0 && bytes.HasPrefix(fields[0], []byte("V")) {
+		fields = fields[1:]
+	}
+	if len(fields) <= qrFields {
+		return nil, fmt.Errorf("%w: QR data has too few fields", ErrMalformed)
+	}
+	field := func(i int) string { return strings.TrimSpace(string(fields[i])) }
+
+	rec := &Record{
+		ReferenceID: field(qrReferenceID),
+		Name:        field(qrName),
+		Gender:      field(qrGender),
+		Address: Address{
+			CareOf:      field(qrCareOf),
+			House:       field(qrHouse),
+			Street:      field(qrStreet),
+			Landmark:    field(qrLandmark),
+			Locality:    field(qrLocality),
+			VTC:         field(qrVTC),
+			PostOffice:  field(qrPostOffice),
+			SubDistrict: field(qrSubDistrict),
+			District:    field(qrDistrict),
+			State:       field(qrState),
+			PinCode:     field(qrPinCode),
+		},
+		Digest: hex.EncodeToString(digest[:]),
+	}
+	if err := rec.parseReference(); err != nil {
+		return nil, err
+	}
+	dob := field(qrDateOfBirth)
+	if rec.DateOfBirth, err = time.Parse("02-01-2006", strings.ReplaceAll(dob, "/", "-")); err != nil || rec.Name == "" {
+		return nil, fmt.Errorf("%w: missing name or date of birth", ErrMalformed)
+	}
+
+	// the indicator says which hashes sit just before the signature: 1 for
+	// the email's, 2 for the mobile's, 3 for both, email first
+	hashes := signed
+	indicator := field(qrEmailMobile)
+	if indicator == "2" || indicator == "3" {
+		if rec.MobileHash, hashes, err = qrHash(hashes); err != nil {
+			return nil, err
+		}
+	}
+	if indicator == "1" || indicator == "3" {
+		if rec.EmailHash, _, err = qrHash(hashes); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// qrHash takes the SHA-256 hash at the end of data, hex encoded, and returns
+// what is left.
+func qrHash(data []byte) (string, []byte, error) {
+	if len(data) < sha256.Size {
+		return "", nil, fmt.Errorf("%w: QR data is missing a hash", ErrMalformed)
+	}
+	cut := len(data) - sha256.Size
+	return hex.EncodeToString(data[cut:]), data[:cut], nil
+}
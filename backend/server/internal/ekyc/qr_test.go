@@ -0,0 +1,76 @@
+package ekyc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// qrPayload builds a version 2 Secure QR payload with a mobile hash, signed
+// with key.
+func qrPayload(t *testing.T, key *rsa.PrivateKey, name string) string {
+	t.Helper()
+	fields := []string{
+		"V2", "2", referenceID, name, "14-03-1990", "F", "",
+		"Bengaluru", "", "12", "MG Road", "560001", "", "Karnataka", "", "", "Bengaluru",
+	}
+	var data bytes.Buffer
+	data.WriteString(strings.Join(fields, "\xff"))
+	data.WriteString("\xffjp2-photo-bytes")
+	mobile, _ := hex.DecodeString(saltedHash("9876543210", "0124"))
+	data.Write(mobile)
+
+	digest := sha256.Sum256(data.Bytes())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Write(sig)
+
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(data.Bytes())
+	zw.Close()
+	return new(big.Int).SetBytes(zipped.Bytes()).String()
+}
+
+func TestQRDecode(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewQRVerifier(&key.PublicKey)
+
+	rec, err := v.Decode(qrPayload(t, key, "Asha Rao"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if rec.Name != "Asha Rao" || rec.Gender != "F" || rec.Last4 != "0124" || rec.Address.PinCode != "560001" {
+		t.Errorf("Decode() = %+v", rec)
+	}
+	if !rec.DateOfBirth.Equal(time.Date(1990, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DateOfBirth = %v", rec.DateOfBirth)
+	}
+	if !rec.MatchMobile("9876543210", "") || rec.EmailHash != "" {
+		t.Errorf("Decode() read mobile hash %q, email hash %q", rec.MobileHash, rec.EmailHash)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := v.Decode(qrPayload(t, other, "Asha Rao")); !errors.Is(err, ErrSignature) {
+		t.Errorf("Decode(signed by another key) error = %v; want %v", err, ErrSignature)
+	}
+	for _, payload := range []string{"", "12ab", "123456789"} {
+		if _, err := v.Decode(payload); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Decode(%q) error = %v; want %v", payload, err, ErrMalformed)
+		}
+	}
+}
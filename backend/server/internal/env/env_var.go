@@ -5,4 +5,25 @@ var (
 	CLIENT_PORT="CLIENT_PORT"
 	JWT_SECRET="JWT_SECRET"
 	AES_KEY="AES_KEY"
+	AUDIT_SIGNING_KEY="AUDIT_SIGNING_KEY"
+	AUDIT_VERIFY_KEY="AUDIT_VERIFY_KEY"
+	AUDIT_CHECKPOINT_INTERVAL="AUDIT_CHECKPOINT_INTERVAL"
+	AUTO_MIGRATE="AUTO_MIGRATE"
+	DELETED_RETENTION="DELETED_RETENTION"
+	PURGE_INTERVAL="PURGE_INTERVAL"
+	PINCODE_DATA="PINCODE_DATA"
+	BLIND_INDEX_KEY="BLIND_INDEX_KEY"
+	EKYC_CERT="EKYC_CERT"
+	AADHAAR_QR_KEY="AADHAAR_QR_KEY"
+	KYC_VALIDITY="KYC_VALIDITY"
+	KYC_CLAIM_TTL="KYC_CLAIM_TTL"
+	BLOB_URL="BLOB_URL"
+	S3_ACCESS_KEY="S3_ACCESS_KEY"
+	S3_SECRET_KEY="S3_SECRET_KEY"
+	DOWNLOAD_URL_KEY="DOWNLOAD_URL_KEY"
+	DOWNLOAD_URL_TTL="DOWNLOAD_URL_TTL"
+	CONSENT_NOTICES="CONSENT_NOTICES"
+	SHARE_LINK_KEY="SHARE_LINK_KEY"
+	VC_ISSUER_DOMAIN="VC_ISSUER_DOMAIN"
+	VC_SIGNING_KEY="VC_SIGNING_KEY"
 )
\ No newline at end of file
@@ -0,0 +1,202 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+func readAll(t *testing.T, r *Reader) []Record {
+	t.Helper()
+	var out []Record
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		out = append(out, rec)
+	}
+}
+
+func TestReader_CSV(t *testing.T) {
+	file := "Email,Full_Name,date_of_birth,relationship\n" +
+		"asha@example.com,Asha Rao,1990-03-14,\n" +
+		"asha@example.com,\"Ravi\nRao\",2015-06-01,child\n" +
+		"bad@example.com,Bad Date,14/03/1990,\n" +
+		"short@example.com,Too Few\n"
+	r, err := NewReader(strings.NewReader(file), models.ImportCSV)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	recs := readAll(t, r)
+	if len(recs) != 4 {
+		t.Fatalf("read %d records; want 4", len(recs))
+	}
+	if got := recs[0].Row; got.Email != "asha@example.com" || got.Profile.FullName != "Asha Rao" || got.Profile.DateOfBirth.Format("2006-01-02") != "1990-03-14" || len(recs[0].Errors) != 0 {
+		t.Errorf("record 1 = %+v", recs[0])
+	}
+	// a quoted field may span lines; the record is numbered by its first
+	if recs[1].Line != 3 || recs[1].Row.Profile.Relationship != "child" || recs[2].Line != 5 {
+		t.Errorf("lines = %d, %d; want 3, 5", recs[1].Line, recs[2].Line)
+	}
+	if len(recs[2].Errors) != 1 || recs[2].Errors[0].Field != "date_of_birth" {
+		t.Errorf("record 3 errors = %+v; want date_of_birth", recs[2].Errors)
+	}
+	if len(recs[3].Errors) != 1 || recs[3].Errors[0].Line != 6 {
+		t.Errorf("record 4 errors = %+v; want a field count error on line 6", recs[3].Errors)
+	}
+}
+
+func TestReader_CSVHeader(t *testing.T) {
+	for file, want := range map[string]string{
+		"":                                       "empty",
+		"email,full_name\n":                      `missing column "date_of_birth"`,
+		"email,full_name,date_of_birth,salary\n": `unknown column "salary"`,
+		"email,email,full_name,date_of_birth\n":  "twice",
+	} {
+		if _, err := NewReader(strings.NewReader(file), models.ImportCSV); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("NewReader(%q) error = %v; want %q", file, err, want)
+		}
+	}
+}
+
+func TestReader_NDJSON(t *testing.T) {
+	file := `{"email":"asha@example.com","full_name":"Asha Rao","date_of_birth":"1990-03-14T00:00:00Z"}` + "\n\n" +
+		`{"email":"x@example.com","salary":"1"}` + "\n" +
+		`not json` + "\n"
+	r, err := NewReader(strings.NewReader(file), models.ImportNDJSON)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	recs := readAll(t, r)
+	if len(recs) != 3 {
+		t.Fatalf("read %d records; want 3 (blank lines are skipped)", len(recs))
+	}
+	if recs[0].Row.Profile.DateOfBirth.Format("2006-01-02") != "1990-03-14" || len(recs[0].Errors) != 0 {
+		t.Errorf("record 1 = %+v", recs[0])
+	}
+	if recs[1].Line != 3 || len(recs[1].Errors) != 1 || !strings.Contains(recs[1].Errors[0].Message, "salary") {
+		t.Errorf("record 2 = %+v; want an unknown key error on line 3", recs[1])
+	}
+	if recs[2].Line != 4 || len(recs[2].Errors) != 1 {
+		t.Errorf("record 3 = %+v; want an error on line 4", recs[2])
+	}
+}
+
+func TestReader_Checksum(t *testing.T) {
+	sum := func(file string, n int) string {
+		r, err := NewReader(strings.NewReader(file), models.ImportNDJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range n {
+			if _, err := r.Next(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return r.Checksum()
+	}
+	a := "{\"email\":\"a\"}\n{\"email\":\"b\"}\n"
+	b := "{\"email\":\"a\"}\n{\"email\":\"c\"}\n"
+	if sum(a, 1) != sum(b, 1) {
+		t.Error("files with the same first record have different checksums after it")
+	}
+	if sum(a, 2) == sum(b, 2) {
+		t.Error("different records have the same checksum")
+	}
+}
+
+func importRow(line int, email, username, relationship string, n int) models.ImportRow {
+	return models.ImportRow{
+		Line:     line,
+		Email:    email,
+		Username: username,
+		Profile: models.Profile{
+			FullName:      fmt.Sprintf("Person %d", n),
+			AadhaarNumber: "sealed",
+			AadhaarIndex:  fmt.Sprintf("aadhaar-%d", n),
+			PhoneNumber:   fmt.Sprintf("98765%05d", n),
+			Relationship:  relationship,
+		},
+	}
+}
+
+func emptyExisting() *models.ImportExisting {
+	return &models.ImportExisting{
+		Accounts:   map[string]int{},
+		Usernames:  map[string]bool{},
+		VIDs:       map[string]bool{},
+		SelfPhones: map[string]bool{},
+		Self:       map[int]bool{},
+		Primary:    map[int]bool{},
+		Aadhaar:    map[int][]string{},
+	}
+}
+
+func fields(errs []models.ImportError) string {
+	var out []string
+	for _, e := range errs {
+		out = append(out, fmt.Sprintf("%d:%s", e.Line, e.Field))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestPlanner(t *testing.T) {
+	p := NewPlanner()
+	existing := emptyExisting()
+	existing.Accounts["ravi@example.com"] = 7
+	existing.Self[7], existing.Primary[7] = true, true
+	existing.Aadhaar[7] = []string{"aadhaar-9"}
+	existing.Usernames["taken"] = true
+
+	rows := []models.ImportRow{
+		importRow(2, "asha@example.com", "asha", models.RelationshipSelf, 1),
+		importRow(3, "asha@example.com", "", models.RelationshipChild, 2),
+		importRow(4, "asha@example.com", "", models.RelationshipSelf, 3),       // second self
+		importRow(5, "new@example.com", "", models.RelationshipSelf, 4),        // no username
+		importRow(6, "other@example.com", "taken", models.RelationshipSelf, 5), // username in the database
+		importRow(7, "dup@example.com", "asha", models.RelationshipSelf, 6),    // username in the file
+		importRow(8, "ravi@example.com", "", models.RelationshipChild, 9),      // Aadhaar already on the account
+		importRow(9, "ravi@example.com", "", models.RelationshipChild, 10),
+		importRow(10, "kiran@example.com", "kiran", models.RelationshipSelf, 1), // phone of another self profile
+	}
+	var batch models.ImportBatch
+	p.Plan(&batch, rows, existing)
+
+	if got := fields(batch.Errors); got != "4:relationship 5:username 6:username 7:username 8:aadhaar_number 10:phone_number" {
+		t.Errorf("errors = %s", got)
+	}
+	if len(batch.Users) != 1 || batch.Users[0].Email != "asha@example.com" || batch.Users[0].Role != models.RoleUser {
+		t.Fatalf("users = %+v; want asha's account", batch.Users)
+	}
+	if len(batch.Rows) != 3 {
+		t.Fatalf("rows = %+v; want 3", batch.Rows)
+	}
+	asha, child, ravi := batch.Rows[0].Profile, batch.Rows[1].Profile, batch.Rows[2].Profile
+	if asha.UserID != 0 || !asha.IsPrimary || child.IsPrimary || asha.AadhaarForm != models.AadhaarFormAadhaar {
+		t.Errorf("asha's profiles = %+v, %+v; want the first as primary on the new account", asha, child)
+	}
+	if ravi.UserID != 7 || ravi.IsPrimary {
+		t.Errorf("ravi's profile = %+v; want account 7, not primary", ravi)
+	}
+
+	// a later batch remembers the accounts and keys of this one
+	var next models.ImportBatch
+	p.Plan(&next, []models.ImportRow{
+		importRow(11, "asha@example.com", "", models.RelationshipSpouse, 12),
+		importRow(12, "kiran@example.com", "kiran", models.RelationshipSelf, 1),
+	}, emptyExisting())
+	if got := fields(next.Errors); got != "12:phone_number" {
+		t.Errorf("next errors = %s", got)
+	}
+	if len(next.Users) != 0 || len(next.Rows) != 1 || next.Rows[0].Profile.IsPrimary {
+		t.Errorf("next batch = %+v; want one more profile on asha's account", next)
+	}
+}
@@ -0,0 +1,131 @@
+// Package importer reads bulk import files of accounts and profiles and
+// decides which of their rows can be inserted. Validating and encrypting a
+// row is left to the caller, and storing a batch to the repository.
+package importer
+
+import (
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+// account is what the planner knows of an account a row goes on.
+type account struct {
+	id      int
+	self    bool
+	primary bool
+	aadhaar map[string]bool
+}
+
+// Planner decides which rows of an import can be inserted without breaking
+// the constraints the API enforces one profile at a time. It remembers the
+// accounts and keys of the rows it accepted in earlier batches, so that rows
+// are checked against each other across the whole file as well as against
+// the database; in a dry run nothing else would catch two rows that collide.
+type Planner struct {
+	accounts   map[string]*account
+	usernames  map[string]string
+	vids       map[string]bool
+	selfPhones map[string]bool
+}
+
+func NewPlanner() *Planner {
+	return &Planner{
+		accounts:   map[string]*account{},
+		usernames:  map[string]string{},
+		vids:       map[string]bool{},
+		selfPhones: map[string]bool{},
+	}
+}
+
+// Plan adds rows, validated and sealed, to batch as accounts and profiles to
+// create or as errors. existing is what the database holds for the keys of
+// the rows, see repository.ImportRepository.Existing.
+func (p *Planner) Plan(batch *models.ImportBatch, rows []models.ImportRow, existing *models.ImportExisting) {
+	for _, row := range rows {
+		acct := p.account(row.Email, existing)
+		field, message := p.conflict(row, acct, existing)
+		if field != "" {
+			batch.Errors = append(batch.Errors, models.ImportError{Line: row.Line, Field: field, Message: message})
+			continue
+		}
+
+		if acct == nil {
+			acct = &account{aadhaar: map[string]bool{}}
+			p.accounts[row.Email] = acct
+			p.usernames[row.Username] = row.Email
+			batch.Users = append(batch.Users, models.User{
+				Email:        row.Email,
+				Username:     row.Username,
+				PasswordHash: row.PasswordHash,
+				Role:         models.RoleUser,
+			})
+		}
+		prof := &row.Profile
+		prof.UserID = acct.id
+		prof.IsPrimary = !acct.primary
+		prof.AadhaarForm = models.AadhaarFormOf(prof.AadhaarNumber, prof.VID)
+		acct.primary = true
+		if prof.Relationship == models.RelationshipSelf {
+			acct.self = true
+			p.selfPhones[prof.PhoneNumber] = true
+		}
+		if prof.VIDIndex != "" {
+			p.vids[prof.VIDIndex] = true
+		}
+		if prof.AadhaarIndex != "" {
+			acct.aadhaar[prof.AadhaarIndex] = true
+		}
+		batch.Rows = append(batch.Rows, row)
+	}
+}
+
+// account returns what is known of the account with the email, from the
+// database and from earlier rows, or nil for an account the row would have
+// to create.
+func (p *Planner) account(email string, existing *models.ImportExisting) *account {
+	acct := p.accounts[email]
+	id, ok := existing.Accounts[email]
+	if !ok {
+		return acct
+	}
+	if acct == nil {
+		acct = &account{aadhaar: map[string]bool{}}
+		p.accounts[email] = acct
+	}
+	// the database is ahead of the planner once earlier batches are saved
+	acct.id = id
+	acct.self = acct.self || existing.Self[id]
+	acct.primary = acct.primary || existing.Primary[id]
+	for _, index := range existing.Aadhaar[id] {
+		acct.aadhaar[index] = true
+	}
+	return acct
+}
+
+// conflict returns the field and message of the first constraint the row
+// would break, or an empty field.
+func (p *Planner) conflict(row models.ImportRow, acct *account, existing *models.ImportExisting) (string, string) {
+	prof := row.Profile
+	if acct == nil {
+		if row.Username == "" {
+			return "username", "required on the first row of a new account"
+		}
+		if existing.Usernames[row.Username] || p.usernames[row.Username] != "" {
+			return "username", "username already exists"
+		}
+	}
+	if prof.VIDIndex != "" && (existing.VIDs[prof.VIDIndex] || p.vids[prof.VIDIndex]) {
+		return "vid", "VID already exists"
+	}
+	if prof.Relationship == models.RelationshipSelf {
+		if acct != nil && acct.self {
+			return "relationship", "the account already has a self profile"
+		}
+		if existing.SelfPhones[prof.PhoneNumber] || p.selfPhones[prof.PhoneNumber] {
+			return "phone_number", "phone no. already exists on another self profile"
+		}
+	}
+	if prof.AadhaarIndex != "" && acct != nil && acct.aadhaar[prof.AadhaarIndex] {
+		return "aadhaar_number", "another profile on this account already has this aadhaar number"
+	}
+	return "", ""
+}
@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+// Columns are the CSV header names and NDJSON keys of an import file. Only
+// email, full_name and date_of_birth are required; username is required on
+// the first row of an account the import creates.
+var Columns = []string{
+	"email",
+	"username",
+	"password_hash",
+	"full_name",
+	"date_of_birth",
+	"aadhaar_number",
+	"vid",
+	"phone_number",
+	"address",
+	"relationship",
+}
+
+var requiredColumns = []string{"email", "full_name", "date_of_birth"}
+
+// maxLine bounds an NDJSON line, and so the memory a single record can take.
+const maxLine = 64 << 10
+
+// Record is one record of an import file. A record that cannot be read as a
+// row has Errors instead.
+type Record struct {
+	Line   int
+	Row    models.ImportRow
+	Errors []models.ImportError
+}
+
+// Reader streams the records of an import file. It keeps a running checksum
+// of the records it has read so that a resumed import can check it was given
+// the same file.
+type Reader struct {
+	next func() (Record, error)
+	sum  [sha256.Size]byte
+}
+
+// NewReader reads CSV with a header line, or NDJSON with one object per
+// line. It fails on a CSV header with unknown or missing columns.
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	rd := &Reader{}
+	switch format {
+	case models.ImportCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("the file is empty")
+			}
+			return nil, err
+		}
+		index, err := headerIndex(header)
+		if err != nil {
+			return nil, err
+		}
+		rd.link(strings.Join(header, "\x1f"))
+		rd.next = func() (Record, error) { return rd.nextCSV(cr, index) }
+	case models.ImportNDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 4096), maxLine)
+		line := 0
+		rd.next = func() (Record, error) { return rd.nextNDJSON(sc, &line) }
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	return rd, nil
+}
+
+// Next returns the next record, or io.EOF after the last one. Any other error
+// means the rest of the file cannot be read.
+func (r *Reader) Next() (Record, error) {
+	return r.next()
+}
+
+// Checksum is the checksum of the records read so far.
+func (r *Reader) Checksum() string {
+	return hex.EncodeToString(r.sum[:])
+}
+
+// link chains a record into the checksum.
+func (r *Reader) link(raw string) {
+	h := sha256.New()
+	h.Write(r.sum[:])
+	h.Write([]byte(raw))
+	h.Sum(r.sum[:0])
+}
+
+func headerIndex(header []string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !isColumn(name) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		index[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return index, nil
+}
+
+func isColumn(name string) bool {
+	return slices.Contains(Columns, name)
+}
+
+func (r *Reader) nextCSV(cr *csv.Reader, index map[string]int) (Record, error) {
+	fields, err := cr.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// a stray quote spoils one record; the reader carries on after it
+			r.link("error:" + strconv.Itoa(parseErr.StartLine))
+			return Record{Line: parseErr.StartLine, Errors: []models.ImportError{
+				{Line: parseErr.StartLine, Field: "line", Message: "malformed CSV: " + parseErr.Err.Error()},
+			}}, nil
+		}
+		return Record{}, err
+	}
+	r.link(strings.Join(fields, "\x1f"))
+	line, _ := cr.FieldPos(0)
+	values := map[string]string{}
+	for name, i := range index {
+		if i < len(fields) {
+			values[name] = fields[i]
+		}
+	}
+	rec := Record{Line: line}
+	if len(fields) != len(index) {
+		rec.Errors = append(rec.Errors, models.ImportError{
+			Line: line, Field: "line", Message: fmt.Sprintf("has %d fields; the header has %d", len(fields), len(index)),
+		})
+		return rec, nil
+	}
+	rec.Row, rec.Errors = row(line, values)
+	return rec, nil
+}
+
+func (r *Reader) nextNDJSON(sc *bufio.Scanner, line *int) (Record, error) {
+	for sc.Scan() {
+		*line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		r.link(string(raw))
+		rec := Record{Line: *line}
+		values := map[string]string{}
+		if err := json.Unmarshal(raw, &values); err != nil {
+			rec.Errors = []models.ImportError{{Line: *line, Field: "line", Message: "must be a JSON object of strings"}}
+			return rec, nil
+		}
+		for name := range values {
+			if !isColumn(name) {
+				rec.Errors = []models.ImportError{{Line: *line, Field: "line", Message: fmt.Sprintf("unknown key %q", name)}}
+				return rec, nil
+			}
+		}
+		rec.Row, rec.Errors = row(*line, values)
+		return rec, nil
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return Record{}, fmt.Errorf("line %d is longer than %d bytes", *line+1, maxLine)
+		}
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// row builds the row of a record. Everything but the date of birth is kept
+// as written; the caller validates it.
+func row(line int, values map[string]string) (models.ImportRow, []models.ImportError) {
+	get := func(name string) string { return strings.TrimSpace(values[name]) }
+	r := models.ImportRow{
+		Line:         line,
+		Email:        get("email"),
+		Username:     get("username"),
+		PasswordHash: get("password_hash"),
+		Profile: models.Profile{
+			FullName:      get("full_name"),
+			AadhaarNumber: get("aadhaar_number"),
+			VID:           get("vid"),
+			PhoneNumber:   get("phone_number"),
+			Address:       get("address"),
+			Relationship:  get("relationship"),
+		},
+	}
+	dob, err := parseDate(get("date_of_birth"))
+	if err != nil {
+		return r, []models.ImportError{{Line: line, Field: "date_of_birth", Message: "must be a date in the form YYYY-MM-DD"}}
+	}
+	r.Profile.DateOfBirth = dob
+	return r, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
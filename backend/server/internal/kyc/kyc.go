@@ -0,0 +1,293 @@
+// Package kyc is the verification workflow of profiles. A profile starts in
+// draft; its owner submits it for review, a support user claims it from the
+// queue and approves or rejects it, and a verified profile goes back to
+// submitted when a verified field is edited, or expires after a while.
+//
+// The transitions are enforced here rather than in the stores, which only
+// save what the Service decides under optimistic locking.
+package kyc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+)
+
+var (
+	ErrTransition  = errors.New("kyc: transition not allowed")
+	ErrClaimed     = errors.New("kyc: claimed by another reviewer")
+	ErrNotClaimant = errors.New("kyc: not claimed by this reviewer")
+	ErrOwnProfile  = errors.New("kyc: reviewers cannot review their own profiles")
+	ErrQueueEmpty  = errors.New("kyc: nothing to review")
+	ErrReasonCode  = errors.New("kyc: unknown reason code")
+	ErrNoteMissing = errors.New("kyc: a note is required with reason code other")
+)
+
+// transitions lists the states each state may move to.
+var transitions = map[string][]string{
+	models.KYCDraft:       {models.KYCSubmitted},
+	models.KYCSubmitted:   {models.KYCDraft, models.KYCUnderReview},
+	models.KYCUnderReview: {models.KYCSubmitted, models.KYCVerified, models.KYCRejected},
+	models.KYCVerified:    {models.KYCSubmitted, models.KYCExpired},
+	models.KYCRejected:    {models.KYCSubmitted},
+	models.KYCExpired:     {models.KYCSubmitted},
+}
+
+// CanTransition reports whether a profile may move from one state to another.
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// ReasonOther is the reason code for rejections that fit no other; it
+// requires a note.
+const ReasonOther = "other"
+
+// ReasonCodes are the reasons a reviewer may give for a rejection, with the
+// text shown to the profile owner.
+var ReasonCodes = map[string]string{
+	"document_mismatch":    "the details do not match the documents provided",
+	"name_mismatch":        "the name does not match the identity documents",
+	"dob_mismatch":         "the date of birth does not match the identity documents",
+	"address_unverifiable": "the address could not be verified",
+	"illegible_document":   "a document could not be read",
+	"expired_document":     "a document has expired",
+	"suspected_fraud":      "the details could not be accepted",
+	ReasonOther:            "see the reviewer's note",
+}
+
+// VerifiedFields are the profile fields a review vouches for, with the
+// structured addresses and identity documents. Editing one of them on a
+// verified profile, or one under review, sends it back for review; the phone
+// number is verified separately.
+var VerifiedFields = []string{
+	models.FieldFullName,
+	models.FieldDateOfBirth,
+	models.FieldAadhaarNumber,
+	models.FieldVID,
+	models.FieldAddress,
+	models.FieldDocuments,
+}
+
+type Service struct {
+	repo repository.KYCRepository
+	// claimTTL is how long a claim holds before another reviewer may take
+	// the profile over.
+	claimTTL time.Duration
+	// validity is how long a verification lasts before it expires.
+	validity time.Duration
+	now      func() time.Time
+}
+
+func NewService(repo repository.KYCRepository, claimTTL, validity time.Duration) *Service {
+	return &Service{repo: repo, claimTTL: claimTTL, validity: validity, now: time.Now}
+}
+
+// In returns the service bound to a transaction's repository.
+func (s *Service) In(tx *repository.Repository) *Service {
+	bound := *s
+	bound.repo = tx.KYC
+	return &bound
+}
+
+// Get returns the state of a profile, draft if it has never been submitted.
+func (s *Service) Get(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := s.repo.Get(ctx, profileID)
+	if errors.Is(err, models.NotFound) {
+		return &models.KYC{ProfileID: profileID, Status: models.KYCDraft}, nil
+	}
+	return k, err
+}
+
+func (s *Service) move(ctx context.Context, k *models.KYC, to string) error {
+	if !CanTransition(k.Status, to) {
+		return fmt.Errorf("%w: %s to %s", ErrTransition, k.Status, to)
+	}
+	k.Status = to
+	if to != models.KYCUnderReview {
+		k.ReviewerID, k.ClaimedAt = nil, nil
+	}
+	return s.repo.Save(ctx, k)
+}
+
+// Submit puts a profile in the review queue.
+func (s *Service) Submit(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := s.Get(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if k.Status == models.KYCVerified {
+		// re-submitting an unchanged verified profile would only lose the
+		// verification
+		return nil, fmt.Errorf("%w: %s to %s", ErrTransition, k.Status, models.KYCSubmitted)
+	}
+	return k, s.submit(ctx, k)
+}
+
+func (s *Service) submit(ctx context.Context, k *models.KYC) error {
+	now := s.now()
+	prev := k.SubmittedAt
+	k.SubmittedAt = &now
+	if err := s.move(ctx, k, models.KYCSubmitted); err != nil {
+		k.SubmittedAt = prev
+		return err
+	}
+	return nil
+}
+
+// Withdraw takes a submitted profile back to draft before a reviewer claims it.
+func (s *Service) Withdraw(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := s.Get(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+	return k, s.move(ctx, k, models.KYCDraft)
+}
+
+// claimable reports whether k is waiting for a reviewer, or its claim has
+// lapsed or lost its reviewer.
+func (s *Service) claimable(k *models.KYC) bool {
+	switch k.Status {
+	case models.KYCSubmitted:
+		return true
+	case models.KYCUnderReview:
+		return k.ReviewerID == nil || k.ClaimedAt == nil || s.now().Sub(*k.ClaimedAt) > s.claimTTL
+	}
+	return false
+}
+
+// Claim assigns a submitted profile to reviewerID. Claiming a profile the
+// reviewer already holds renews the claim; a claim held by someone else can
+// only be taken over once it has lapsed.
+func (s *Service) Claim(ctx context.Context, profileID, reviewerID int) (*models.KYC, error) {
+	k, err := s.Get(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+	return k, s.claim(ctx, k, reviewerID)
+}
+
+func (s *Service) claim(ctx context.Context, k *models.KYC, reviewerID int) error {
+	if k.UserID == reviewerID {
+		return ErrOwnProfile
+	}
+	held := k.Status == models.KYCUnderReview && k.ReviewerID != nil && *k.ReviewerID == reviewerID
+	if k.Status == models.KYCUnderReview && !held && !s.claimable(k) {
+		return ErrClaimed
+	}
+	if k.Status != models.KYCUnderReview && !CanTransition(k.Status, models.KYCUnderReview) {
+		return fmt.Errorf("%w: %s to %s", ErrTransition, k.Status, models.KYCUnderReview)
+	}
+	now := s.now()
+	k.Status, k.ReviewerID, k.ClaimedAt = models.KYCUnderReview, &reviewerID, &now
+	return s.repo.Save(ctx, k)
+}
+
+// queueScan is how many queued profiles ClaimNext looks at.
+const queueScan = 50
+
+// ClaimNext claims the profile that has waited longest and is free for
+// reviewerID, skipping the reviewer's own profiles.
+func (s *Service) ClaimNext(ctx context.Context, reviewerID int) (*models.KYC, error) {
+	queue, err := s.repo.Queue(ctx, queueScan)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range queue {
+		if k.UserID == reviewerID || !s.claimable(&k) {
+			continue
+		}
+		err := s.claim(ctx, &k, reviewerID)
+		if errors.Is(err, models.VersionConflict) {
+			// another reviewer got there first
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &k, nil
+	}
+	return nil, ErrQueueEmpty
+}
+
+// held loads a profile that reviewerID must have claimed.
+func (s *Service) held(ctx context.Context, profileID, reviewerID int) (*models.KYC, error) {
+	k, err := s.Get(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if k.Status != models.KYCUnderReview || k.ReviewerID == nil || *k.ReviewerID != reviewerID {
+		return nil, ErrNotClaimant
+	}
+	return k, nil
+}
+
+// Release puts a claimed profile back in the queue.
+func (s *Service) Release(ctx context.Context, profileID, reviewerID int) (*models.KYC, error) {
+	k, err := s.held(ctx, profileID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	return k, s.move(ctx, k, models.KYCSubmitted)
+}
+
+// Approve verifies a profile the reviewer has claimed.
+func (s *Service) Approve(ctx context.Context, profileID, reviewerID int) (*models.KYC, error) {
+	k, err := s.held(ctx, profileID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	k.VerifiedAt, k.ReasonCode, k.Note = &now, "", ""
+	return k, s.move(ctx, k, models.KYCVerified)
+}
+
+// Reject turns down a profile the reviewer has claimed, for one of
+// ReasonCodes.
+func (s *Service) Reject(ctx context.Context, profileID, reviewerID int, reasonCode, note string) (*models.KYC, error) {
+	if _, ok := ReasonCodes[reasonCode]; !ok {
+		return nil, ErrReasonCode
+	}
+	if reasonCode == ReasonOther && note == "" {
+		return nil, ErrNoteMissing
+	}
+	k, err := s.held(ctx, profileID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	k.ReasonCode, k.Note, k.VerifiedAt = reasonCode, note, nil
+	return k, s.move(ctx, k, models.KYCRejected)
+}
+
+// FieldsEdited sends a verified profile, or one under review, back to
+// submitted if any of the changed fields is one of VerifiedFields, dropping
+// the claim so the reviewer cannot approve data they have not seen. It
+// reports whether it did.
+func (s *Service) FieldsEdited(ctx context.Context, profileID int, changed []string) (bool, error) {
+	if !slices.ContainsFunc(changed, func(f string) bool { return slices.Contains(VerifiedFields, f) }) {
+		return false, nil
+	}
+	k, err := s.Get(ctx, profileID)
+	if err != nil || (k.Status != models.KYCVerified && k.Status != models.KYCUnderReview) {
+		return false, err
+	}
+	k.VerifiedAt = nil
+	if err := s.submit(ctx, k); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ValidUntil returns when the verification of a verified profile expires.
+func (s *Service) ValidUntil(k *models.KYC) time.Time {
+	return k.VerifiedAt.Add(s.validity)
+}
+
+// Expire moves verifications older than the validity period to expired.
+func (s *Service) Expire(ctx context.Context) (int64, error) {
+	return s.repo.Expire(ctx, s.now().Add(-s.validity))
+}
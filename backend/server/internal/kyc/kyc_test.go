@@ -0,0 +1,163 @@
+package kyc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/store/memory"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.KYCDraft, models.KYCSubmitted, true},
+		{models.KYCDraft, models.KYCVerified, false},
+		{models.KYCSubmitted, models.KYCVerified, false},
+		{models.KYCUnderReview, models.KYCVerified, true},
+		{models.KYCUnderReview, models.KYCRejected, true},
+		{models.KYCRejected, models.KYCVerified, false},
+		{models.KYCVerified, models.KYCSubmitted, true},
+		{models.KYCExpired, models.KYCUnderReview, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v; want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// setup returns a service on a memory store with an owner's profile and two
+// reviewers, and a clock the test can move.
+func setup(t *testing.T) (s *Service, profileID, owner, alice, bob int, clock *time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	repo := memory.NewRepo()
+	var ids []int
+	for _, name := range []string{"owner", "alice", "bob"} {
+		u := &models.User{Email: name + "@example.com", Username: name, PasswordHash: "hash"}
+		if err := repo.Users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+	}
+	p := &models.Profile{UserID: ids[0], FullName: "Asha Rao", AadhaarNumber: "a", PhoneNumber: "9876543210", Relationship: models.RelationshipSelf}
+	if err := repo.Profiles.Create(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s = NewService(repo.KYC, time.Hour, 24*time.Hour)
+	s.now = func() time.Time { return now }
+	return s, p.ID, ids[0], ids[1], ids[2], &now
+}
+
+func TestService_Review(t *testing.T) {
+	ctx := context.Background()
+	s, id, owner, alice, bob, clock := setup(t)
+
+	if _, err := s.Claim(ctx, id, alice); !errors.Is(err, ErrTransition) {
+		t.Errorf("Claim(draft) error = %v; want %v", err, ErrTransition)
+	}
+	if _, err := s.Submit(ctx, id); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := s.Claim(ctx, id, owner); !errors.Is(err, ErrOwnProfile) {
+		t.Errorf("Claim(own profile) error = %v; want %v", err, ErrOwnProfile)
+	}
+	if k, err := s.ClaimNext(ctx, alice); err != nil || k.ProfileID != id || *k.ReviewerID != alice {
+		t.Fatalf("ClaimNext() = %+v, %v", k, err)
+	}
+	if _, err := s.ClaimNext(ctx, bob); !errors.Is(err, ErrQueueEmpty) {
+		t.Errorf("ClaimNext(all claimed) error = %v; want %v", err, ErrQueueEmpty)
+	}
+	if _, err := s.Claim(ctx, id, bob); !errors.Is(err, ErrClaimed) {
+		t.Errorf("Claim(held by alice) error = %v; want %v", err, ErrClaimed)
+	}
+	if _, err := s.Approve(ctx, id, bob); !errors.Is(err, ErrNotClaimant) {
+		t.Errorf("Approve(not the claimant) error = %v; want %v", err, ErrNotClaimant)
+	}
+
+	// the claim lapses, and bob takes over
+	*clock = clock.Add(2 * time.Hour)
+	if _, err := s.Claim(ctx, id, bob); err != nil {
+		t.Fatalf("Claim(lapsed) error = %v", err)
+	}
+	if _, err := s.Reject(ctx, id, bob, "no_reason", ""); !errors.Is(err, ErrReasonCode) {
+		t.Errorf("Reject(unknown reason) error = %v; want %v", err, ErrReasonCode)
+	}
+	if _, err := s.Reject(ctx, id, bob, ReasonOther, ""); !errors.Is(err, ErrNoteMissing) {
+		t.Errorf("Reject(other without a note) error = %v; want %v", err, ErrNoteMissing)
+	}
+	if k, err := s.Reject(ctx, id, bob, "name_mismatch", ""); err != nil || k.Status != models.KYCRejected || k.ReviewerID != nil {
+		t.Fatalf("Reject() = %+v, %v", k, err)
+	}
+
+	if _, err := s.Submit(ctx, id); err != nil {
+		t.Fatalf("Submit(rejected) error = %v", err)
+	}
+	if _, err := s.Claim(ctx, id, alice); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if k, err := s.Approve(ctx, id, alice); err != nil || k.Status != models.KYCVerified || k.ReasonCode != "" {
+		t.Fatalf("Approve() = %+v, %v", k, err)
+	}
+	if _, err := s.Submit(ctx, id); !errors.Is(err, ErrTransition) {
+		t.Errorf("Submit(verified) error = %v; want %v", err, ErrTransition)
+	}
+}
+
+func TestService_FieldsEditedAndExpire(t *testing.T) {
+	ctx := context.Background()
+	s, id, _, alice, _, clock := setup(t)
+	if _, err := s.Submit(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Claim(ctx, id, alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Approve(ctx, id, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	if reopened, err := s.FieldsEdited(ctx, id, []string{models.FieldPhoneNumber}); err != nil || reopened {
+		t.Errorf("FieldsEdited(phone number) = %v, %v; want false", reopened, err)
+	}
+	if reopened, err := s.FieldsEdited(ctx, id, []string{models.FieldAddress}); err != nil || !reopened {
+		t.Errorf("FieldsEdited(address) = %v, %v; want true", reopened, err)
+	}
+	if k, _ := s.Get(ctx, id); k.Status != models.KYCSubmitted || k.VerifiedAt != nil {
+		t.Errorf("after editing a verified field: %+v; want submitted", k)
+	}
+
+	// an edit under review drops the claim
+	if _, err := s.Claim(ctx, id, alice); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, err := s.FieldsEdited(ctx, id, []string{models.FieldDocuments}); err != nil || !reopened {
+		t.Errorf("FieldsEdited(documents) under review = %v, %v; want true", reopened, err)
+	}
+	if k, _ := s.Get(ctx, id); k.Status != models.KYCSubmitted || k.ReviewerID != nil {
+		t.Errorf("after editing a profile under review: %+v; want submitted and unclaimed", k)
+	}
+	if reopened, err := s.FieldsEdited(ctx, id, []string{models.FieldFullName}); err != nil || reopened {
+		t.Errorf("FieldsEdited(full name) when submitted = %v, %v; want false", reopened, err)
+	}
+
+	if _, err := s.Claim(ctx, id, alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Approve(ctx, id, alice); err != nil {
+		t.Fatal(err)
+	}
+	*clock = clock.Add(25 * time.Hour)
+	if n, err := s.Expire(ctx); err != nil || n != 1 {
+		t.Errorf("Expire() = %d, %v; want 1", n, err)
+	}
+	if k, _ := s.Get(ctx, id); k.Status != models.KYCExpired {
+		t.Errorf("after Expire(): %+v; want expired", k)
+	}
+}
@@ -8,15 +8,24 @@ import (
 var(
     NotFound = errors.New("record not found")
     AlreadyExists = errors.New("record already exists")
+    VersionConflict = errors.New("record was modified since it was read")
+)
+
+const (
+    RoleUser    = "user"
+    RoleSupport = "support"
+    RoleAdmin   = "admin"
 )
 
 type User struct {
-    ID           int       `json:"id"`
-    Email        string    `json:"email"`
-    Username     string    `json:"username"`
-    PasswordHash string    `json:"-"`
-    CreatedAt    time.Time `json:"created_at"`
-    UpdatedAt    time.Time `json:"updated_at"`
+    ID           int        `json:"id"`
+    Email        string     `json:"email"`
+    Username     string     `json:"username"`
+    PasswordHash string     `json:"-"`
+    Role         string     `json:"role"`
+    CreatedAt    time.Time  `json:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at"`
+    DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 }
 
 type Profile struct {
@@ -24,9 +33,455 @@ type Profile struct {
     UserID        int       `json:"user_id"`
     FullName      string    `json:"full_name"`
     DateOfBirth   time.Time `json:"date_of_birth"`
+    // AadhaarNumber and VID are both optional but a profile has at least
+    // one. AadhaarForm records which of them the user gave.
     AadhaarNumber string    `json:"aadhaar_number"`
+    VID           string    `json:"vid"`
+    VIDIndex      string    `json:"-"`
+    // AadhaarIndex and PhoneIndex are blind indexes for duplicate detection,
+    // see internal/dedupe. Rows written before they existed have them empty
+    // until the next write or backfill-indexes.
+    AadhaarIndex  string    `json:"-"`
+    PhoneIndex    string    `json:"-"`
+    AadhaarForm   string    `json:"aadhaar_form"`
     PhoneNumber   string    `json:"phone_number"`
+    // Address is the free-text address from before structured addresses.
+    // It is still stored for older clients; new code should use Address rows.
     Address       string    `json:"address"`     
+    Relationship  string    `json:"relationship"`
+    IsPrimary     bool      `json:"is_primary"`
+    Version       int       `json:"version"`
     CreatedAt     time.Time `json:"created_at"`
     UpdatedAt     time.Time `json:"updated_at"`
-}
\ No newline at end of file
+    DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+    // PhotoURLs are short-lived download URLs of the profile photo, keyed by
+    // size in pixels. The API fills them in; they are not stored.
+    PhotoURLs     map[int]string `json:"photo_urls,omitempty"`
+}
+
+// Relationship of a profile to the account holder. An account has at most one
+// self profile; the rest are family members and dependents it manages.
+const (
+    RelationshipSelf   = "self"
+    RelationshipChild  = "child"
+    RelationshipParent = "parent"
+    RelationshipSpouse = "spouse"
+    RelationshipWard   = "ward"
+)
+
+var Relationships = []string{RelationshipSelf, RelationshipChild, RelationshipParent, RelationshipSpouse, RelationshipWard}
+
+// How a profile identifies its holder to UIDAI: by the 12-digit Aadhaar
+// number, by a 16-digit Virtual ID that stands in for it, or by both.
+const (
+    AadhaarFormAadhaar = "aadhaar"
+    AadhaarFormVID     = "vid"
+    AadhaarFormBoth    = "both"
+)
+
+// AadhaarFormOf returns the form for a profile holding the given numbers.
+func AadhaarFormOf(aadhaar, vid string) string {
+    switch {
+    case aadhaar != "" && vid != "":
+        return AadhaarFormBoth
+    case vid != "":
+        return AadhaarFormVID
+    }
+    return AadhaarFormAadhaar
+}
+
+// Profile fields that clients may change, named after their JSON keys, which
+// are also the column names.
+const (
+    FieldFullName      = "full_name"
+    FieldDateOfBirth   = "date_of_birth"
+    FieldAadhaarNumber = "aadhaar_number"
+    FieldVID           = "vid"
+    FieldPhoneNumber   = "phone_number"
+    FieldAddress       = "address"
+)
+
+var ProfileFields = []string{FieldFullName, FieldDateOfBirth, FieldAadhaarNumber, FieldVID, FieldPhoneNumber, FieldAddress}
+
+// FieldDocuments stands for the identity documents of a profile when telling
+// the KYC service what an edit changed. It is not a profile field.
+const FieldDocuments = "documents"
+
+const (
+    ProfileCreated  = "create"
+    ProfileUpdated  = "update"
+    ProfileDeleted  = "delete"
+    ProfileRestored = "restore"
+)
+
+const (
+    AddressPermanent = "permanent"
+    AddressCurrent   = "current"
+    AddressOffice    = "office"
+)
+
+var AddressTypes = []string{AddressPermanent, AddressCurrent, AddressOffice}
+
+// Address is one postal address of a profile, at most one of each type.
+// Addresses copied from the old free-text column have only Line1 and an
+// empty PinCode until they are backfilled or edited.
+type Address struct {
+    ID        int       `json:"id"`
+    ProfileID int       `json:"profile_id"`
+    Type      string    `json:"type"`
+    Line1     string    `json:"line1"`
+    Line2     string    `json:"line2"`
+    Locality  string    `json:"locality"`
+    District  string    `json:"district"`
+    State     string    `json:"state"`
+    PinCode   string    `json:"pin_code"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProfileVersion is a snapshot of a profile taken in the same transaction as
+// the change it records. Sensitive fields stay encrypted exactly as stored.
+type ProfileVersion struct {
+    Version   int64     `json:"version"`
+    Change    string    `json:"change"`
+    ChangedAt time.Time `json:"changed_at"`
+    Profile   Profile   `json:"profile"`
+}
+
+// AuditRecord is one link in the tamper-evident audit chain. Hash covers every
+// other field plus PrevHash, so editing or removing a record breaks the chain.
+type AuditRecord struct {
+    Seq       int64     `json:"seq"`
+    UserID    int       `json:"user_id"`
+    Action    string    `json:"action"`
+    Details   string    `json:"details"`
+    CreatedAt time.Time `json:"created_at"`
+    PrevHash  string    `json:"prev_hash"`
+    Hash      string    `json:"hash"`
+}
+
+// AuditCheckpoint is a server-signed statement that the chain head at Seq had Hash.
+type AuditCheckpoint struct {
+    Seq       int64     `json:"seq"`
+    Hash      string    `json:"hash"`
+    Signature string    `json:"signature"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+    DocumentPAN            = "pan"
+    DocumentPassport       = "passport"
+    DocumentVoterID        = "voter_id"
+    DocumentDrivingLicence = "driving_licence"
+)
+
+var DocumentTypes = []string{DocumentPAN, DocumentPassport, DocumentVoterID, DocumentDrivingLicence}
+
+// IdentityDocument is an identity document of a profile other than Aadhaar,
+// at most one of each type. Number is stored encrypted; NumberIndex is its
+// blind index, which keeps a document number registered to one profile only.
+type IdentityDocument struct {
+    ID          int        `json:"id"`
+    ProfileID   int        `json:"profile_id"`
+    Type        string     `json:"type"`
+    Number      string     `json:"number"`
+    NumberIndex string     `json:"-"`
+    ExpiresOn   *time.Time `json:"expires_on,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Where an EKYCVerification came from: an offline eKYC XML archive or the
+// Secure QR code printed on Aadhaar letters.
+const (
+    EKYCSourceXML = "offline_xml"
+    EKYCSourceQR  = "secure_qr"
+)
+
+// EKYCVerification records a UIDAI-signed document checked against a
+// profile. The document is never stored, only hashes that identify it and
+// the outcome of each comparison. Verified means the name, date of birth and
+// Aadhaar number all matched.
+type EKYCVerification struct {
+    ID               int       `json:"id"`
+    ProfileID        int       `json:"profile_id"`
+    Source           string    `json:"source"`
+    ReferenceHash    string    `json:"reference_hash"`
+    DocumentHash     string    `json:"document_hash"`
+    MobileHash       string    `json:"-"`
+    EmailHash        string    `json:"-"`
+    GeneratedAt      time.Time `json:"generated_at"`
+    NameMatch        bool      `json:"name_match"`
+    DateOfBirthMatch bool      `json:"date_of_birth_match"`
+    AddressMatch     bool      `json:"address_match"`
+    AadhaarMatch     bool      `json:"aadhaar_match"`
+    MobileMatch      bool      `json:"mobile_match"`
+    Verified         bool      `json:"verified"`
+    CreatedAt        time.Time `json:"created_at"`
+}
+
+// The KYC states of a profile. A profile starts in draft; internal/kyc holds
+// the transitions between them.
+const (
+    KYCDraft       = "draft"
+    KYCSubmitted   = "submitted"
+    KYCUnderReview = "under_review"
+    KYCVerified    = "verified"
+    KYCRejected    = "rejected"
+    KYCExpired     = "expired"
+)
+
+// KYC is the review state of a profile. ReviewerID and ClaimedAt are set
+// while a support user has the profile claimed; ReasonCode and Note explain
+// the last rejection.
+type KYC struct {
+    ProfileID   int        `json:"profile_id"`
+    UserID      int        `json:"user_id"`
+    Status      string     `json:"status"`
+    ReviewerID  *int       `json:"reviewer_id,omitempty"`
+    ClaimedAt   *time.Time `json:"claimed_at,omitempty"`
+    ReasonCode  string     `json:"reason_code,omitempty"`
+    Note        string     `json:"note,omitempty"`
+    SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+    VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+    Version     int        `json:"version"`
+    UpdatedAt   time.Time  `json:"updated_at,omitzero"`
+}
+
+// What an Attachment is evidence of.
+const (
+    AttachmentAddressProof = "address_proof"
+    AttachmentIDScan       = "id_scan"
+    AttachmentOther        = "other"
+)
+
+var AttachmentKinds = []string{AttachmentAddressProof, AttachmentIDScan, AttachmentOther}
+
+// Attachment is a file uploaded to a profile, such as a scan of an identity
+// document. The file itself lives in a blob store under BlobKey, encrypted
+// with its own data key; DataKey is that key, encrypted with the master key.
+// SHA256 is the hash of the plaintext, hex encoded.
+type Attachment struct {
+    ID          int       `json:"id"`
+    ProfileID   int       `json:"profile_id"`
+    Kind        string    `json:"kind"`
+    FileName    string    `json:"file_name"`
+    ContentType string    `json:"content_type"`
+    Size        int64     `json:"size"`
+    SHA256      string    `json:"sha256"`
+    BlobKey     string    `json:"-"`
+    DataKey     string    `json:"-"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Photo is the photo of a profile. Its sizes are stored in the blob store at
+// BlobPrefix/<size>.jpg, each encrypted with DataKey, which is encrypted with
+// the master key. Every upload gets a new prefix.
+type Photo struct {
+    ProfileID  int       `json:"profile_id"`
+    BlobPrefix string    `json:"-"`
+    DataKey    string    `json:"-"`
+    UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Why a pair of profiles was flagged as a likely duplicate.
+const (
+    DuplicateAadhaar = "aadhaar"
+    DuplicatePhone   = "phone"
+    DuplicateNameDOB = "name_dob"
+)
+
+// The review states of a Duplicate.
+const (
+    DuplicatePending  = "pending"
+    DuplicateSame     = "duplicate"
+    DuplicateDistinct = "distinct"
+)
+
+// Duplicate is a pair of live profiles on different accounts that look like
+// the same person, waiting for or settled by an admin. ProfileID is the lower
+// of the two IDs, so a pair is stored once whichever profile was written.
+type Duplicate struct {
+    ID         int        `json:"id"`
+    ProfileID  int        `json:"profile_id"`
+    MatchID    int        `json:"match_id"`
+    Reasons    []string   `json:"reasons"`
+    Score      float64    `json:"score"`
+    Status     string     `json:"status"`
+    ReviewerID *int       `json:"reviewer_id,omitempty"`
+    Note       string     `json:"note,omitempty"`
+    CreatedAt  time.Time  `json:"created_at"`
+    ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// File formats of a bulk import.
+const (
+    ImportCSV    = "csv"
+    ImportNDJSON = "ndjson"
+)
+
+// The states of an ImportJob.
+const (
+    ImportRunning   = "running"
+    ImportCompleted = "completed"
+)
+
+// ImportJob is a bulk import of accounts and profiles. Its progress is saved
+// with every batch, so an import cut off half way resumes after the last
+// saved record when the same file is sent again. A dry run saves progress and
+// errors but no accounts or profiles; Users and Profiles then count what
+// would have been created.
+type ImportJob struct {
+    ID          int        `json:"id"`
+    // AdminID is nil for imports run from the command line.
+    AdminID     *int       `json:"admin_id"`
+    Format      string     `json:"format"`
+    DryRun      bool       `json:"dry_run"`
+    Status      string     `json:"status"`
+    // Records counts the records read so far, valid or not, and Line is the
+    // line the last of them ended on.
+    Records     int        `json:"records"`
+    Line        int        `json:"line"`
+    // Checksum covers the records read so far, to tell a resumed file from
+    // a different one.
+    Checksum    string     `json:"-"`
+    Users       int        `json:"users"`
+    Profiles    int        `json:"profiles"`
+    Failed      int        `json:"failed"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+    CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ImportRow is a valid record of an import file: a profile and the account,
+// by email, it goes on. Username and PasswordHash are only used when the
+// account is created by the import.
+type ImportRow struct {
+    Line         int
+    Email        string
+    Username     string
+    PasswordHash string
+    Profile      Profile
+}
+
+// ImportError is a line of an import's error report. Messages never repeat
+// the values that were rejected.
+type ImportError struct {
+    Line    int    `json:"line"`
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// ImportBatch is what one batch of records adds to an import job.
+type ImportBatch struct {
+    Records  int
+    Line     int
+    Checksum string
+    // Users are the accounts to create; the store fills in their IDs.
+    Users    []User
+    // Rows are the profiles to create, with UserID, IsPrimary and
+    // AadhaarForm decided. A row with UserID 0 goes on the account in Users
+    // with its Email; the store fills in the profile's ID.
+    Rows     []ImportRow
+    Errors   []ImportError
+}
+
+// ImportExisting is what the database already holds that the rows of a batch
+// could collide with, narrowed to the keys of those rows.
+type ImportExisting struct {
+    // Accounts maps the emails of live accounts to their IDs.
+    Accounts   map[string]int
+    Usernames  map[string]bool
+    // VIDs are the VID blind indexes of live profiles, and SelfPhones the
+    // phone numbers of live self profiles.
+    VIDs       map[string]bool
+    SelfPhones map[string]bool
+    // Self and Primary hold the accounts that have a live self or primary
+    // profile, and Aadhaar the Aadhaar indexes of each account's profiles.
+    Self       map[int]bool
+    Primary    map[int]bool
+    Aadhaar    map[int][]string
+}
+
+// The states of an Export. A pending export becomes ready or failed; a ready
+// one becomes downloaded or expired.
+const (
+    ExportPending    = "pending"
+    ExportReady      = "ready"
+    ExportFailed     = "failed"
+    ExportDownloaded = "downloaded"
+    ExportExpired    = "expired"
+)
+
+// Export is a copy of everything held about an account, asked for by its
+// owner. The archive is built in the background and sealed in the blob store
+// under BlobKey with its own data key, like an attachment. It can be
+// downloaded once, before ExpiresAt.
+type Export struct {
+    ID           int        `json:"id"`
+    UserID       int        `json:"-"`
+    Status       string     `json:"status"`
+    BlobKey      string     `json:"-"`
+    DataKey      string     `json:"-"`
+    Size         int64      `json:"size,omitempty"`
+    CreatedAt    time.Time  `json:"created_at"`
+    CompletedAt  *time.Time `json:"completed_at,omitempty"`
+    ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+    DownloadedAt *time.Time `json:"downloaded_at,omitempty"`
+}
+
+// Consent is a user's consent to their data being processed for a purpose,
+// given to one version of the purpose's notice. Consenting again ends the
+// previous consent, so at most one per purpose has no WithdrawnAt.
+type Consent struct {
+    ID            int        `json:"id"`
+    UserID        int        `json:"-"`
+    Purpose       string     `json:"purpose"`
+    NoticeVersion int        `json:"notice_version"`
+    GrantedAt     time.Time  `json:"granted_at"`
+    WithdrawnAt   *time.Time `json:"withdrawn_at,omitempty"`
+}
+
+// ShareYearOfBirth shares only the year of a profile's date of birth.
+const ShareYearOfBirth = "year_of_birth"
+
+// ShareFields are what a share link can show, in the order they are shown.
+// The Aadhaar number, VID and phone number are always masked.
+var ShareFields = []string{FieldFullName, FieldDateOfBirth, ShareYearOfBirth, FieldAadhaarNumber, FieldVID, FieldPhoneNumber}
+
+// ShareLink lets anyone holding its URL see the chosen Fields of a profile
+// until ExpiresAt, unless it is revoked first. A link with a PINHash also
+// needs the PIN, and stops working after too many wrong ones.
+type ShareLink struct {
+    ID             int        `json:"id"`
+    UserID         int        `json:"-"`
+    ProfileID      int        `json:"profile_id"`
+    Fields         []string   `json:"fields"`
+    PINHash        string     `json:"-"`
+    PINFailures    int        `json:"pin_failures"`
+    Accesses       int        `json:"accesses"`
+    LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    ExpiresAt      time.Time  `json:"expires_at"`
+    RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+    // PINRequired and URL are filled in by the API; they are not stored.
+    PINRequired    bool       `json:"pin_required"`
+    URL            string     `json:"url,omitempty"`
+}
+
+// Credential records a Verifiable Credential issued for a profile, so that
+// it can be listed and revoked. The signed credential holds personal data and
+// is not stored; the row keeps only what the revocation status list needs.
+// ProfileID and UserID are 0 once the profile or account is purged, and the
+// credential then counts as revoked.
+type Credential struct {
+    ID        int        `json:"id"`
+    UserID    int        `json:"-"`
+    ProfileID int        `json:"profile_id"`
+    Fields    []string   `json:"fields"`
+    IssuedAt  time.Time  `json:"issued_at"`
+    ExpiresAt time.Time  `json:"expires_at"`
+    RevokedAt *time.Time `json:"revoked_at,omitempty"`
+    // JWT is the signed credential, returned once when it is issued.
+    JWT       string     `json:"jwt,omitempty"`
+}
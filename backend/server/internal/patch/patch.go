@@ -0,0 +1,151 @@
+// Package patch applies RFC 7396 JSON Merge Patch and RFC 6902 JSON Patch
+// documents to flat JSON objects such as a profile.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch document")
+	ErrTestFailed   = errors.New("patch test operation failed")
+)
+
+// Document is a decoded JSON object.
+type Document map[string]any
+
+func (d Document) clone() Document {
+	out := make(Document, len(d))
+	for k, v := range d {
+		out[k] = v
+	}
+	return out
+}
+
+// Merge applies an RFC 7396 merge patch. Members set to null are removed and
+// nested objects are merged recursively. The input document is not modified.
+func Merge(doc Document, patch []byte) (Document, error) {
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	obj, ok := p.(map[string]any)
+	if !ok {
+		// replacing the whole document with a non-object is valid RFC 7396 but
+		// never a valid profile
+		return nil, fmt.Errorf("%w: merge patch must be a JSON object", ErrInvalidPatch)
+	}
+	return mergeObject(doc, obj), nil
+}
+
+func mergeObject(target map[string]any, patch map[string]any) Document {
+	out := Document(target).clone()
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		if sub, ok := v.(map[string]any); ok {
+			existing, _ := out[k].(map[string]any)
+			out[k] = map[string]any(mergeObject(existing, sub))
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies an RFC 6902 JSON Patch. Operations run in order and the patch
+// is atomic: if any operation fails the input document is returned untouched
+// along with the error. Only top-level members can be addressed.
+func Apply(doc Document, patch []byte) (Document, error) {
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	out := doc.clone()
+	for i, op := range ops {
+		if err := out.apply(op); err != nil {
+			return doc, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return out, nil
+}
+
+func (d Document) apply(op operation) error {
+	key, err := memberName(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		current, exists := d[key]
+		switch op.Op {
+		case "add":
+			d[key] = value
+		case "replace":
+			if !exists {
+				return fmt.Errorf("%w: %s does not exist", ErrInvalidPatch, op.Path)
+			}
+			d[key] = value
+		case "test":
+			if !exists || !reflect.DeepEqual(current, value) {
+				return ErrTestFailed
+			}
+		}
+	case "remove":
+		if _, exists := d[key]; !exists {
+			return fmt.Errorf("%w: %s does not exist", ErrInvalidPatch, op.Path)
+		}
+		delete(d, key)
+	case "move", "copy":
+		from, err := memberName(op.From)
+		if err != nil {
+			return err
+		}
+		value, exists := d[from]
+		if !exists {
+			return fmt.Errorf("%w: %s does not exist", ErrInvalidPatch, op.From)
+		}
+		if op.Op == "move" {
+			delete(d, from)
+		}
+		d[key] = value
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+	return nil
+}
+
+// memberName decodes a JSON Pointer that names a single top-level member.
+func memberName(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 {
+		return "", fmt.Errorf("%w: path %q must name a top-level field", ErrInvalidPatch, pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
@@ -0,0 +1,99 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func profileDoc() Document {
+	return Document{
+		"full_name":    "Asha Rao",
+		"phone_number": "9876543210",
+		"address":      "12 MG Road",
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  Document
+	}{
+		{"replace one field", `{"address":"4 Park St"}`, Document{"full_name": "Asha Rao", "phone_number": "9876543210", "address": "4 Park St"}},
+		{"null removes", `{"address":null}`, Document{"full_name": "Asha Rao", "phone_number": "9876543210"}},
+		{"empty patch", `{}`, profileDoc()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge(profileDoc(), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge_NonObject_Error(t *testing.T) {
+	if _, err := Merge(profileDoc(), []byte(`["address"]`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Merge() error = %v; want ErrInvalidPatch", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	patch := `[
+		{"op":"test","path":"/full_name","value":"Asha Rao"},
+		{"op":"replace","path":"/address","value":"4 Park St"},
+		{"op":"copy","from":"/address","path":"/office"},
+		{"op":"move","from":"/office","path":"/branch"},
+		{"op":"remove","path":"/branch"}
+	]`
+	got, err := Apply(profileDoc(), []byte(patch))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := Document{"full_name": "Asha Rao", "phone_number": "9876543210", "address": "4 Park St"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v; want %v", got, want)
+	}
+}
+
+func TestApply_IsAtomic(t *testing.T) {
+	doc := profileDoc()
+	patch := `[
+		{"op":"replace","path":"/address","value":"4 Park St"},
+		{"op":"test","path":"/full_name","value":"Someone Else"}
+	]`
+	got, err := Apply(doc, []byte(patch))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("Apply() error = %v; want ErrTestFailed", err)
+	}
+	if got["address"] != "12 MG Road" || doc["address"] != "12 MG Road" {
+		t.Errorf("Apply() changed the document after a failed test: %v", got)
+	}
+}
+
+func TestApply_InvalidOperations(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"nested path", `[{"op":"add","path":"/address/line1","value":"x"}]`},
+		{"whole document", `[{"op":"replace","path":"","value":{}}]`},
+		{"replace missing", `[{"op":"replace","path":"/nickname","value":"x"}]`},
+		{"remove missing", `[{"op":"remove","path":"/nickname"}]`},
+		{"missing value", `[{"op":"add","path":"/address"}]`},
+		{"unknown op", `[{"op":"upsert","path":"/address","value":"x"}]`},
+		{"not an array", `{"op":"add"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Apply(profileDoc(), []byte(tt.patch)); !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("Apply() error = %v; want ErrInvalidPatch", err)
+			}
+		})
+	}
+}
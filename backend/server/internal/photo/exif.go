@@ -0,0 +1,118 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Orientation returns the EXIF orientation, 1 to 8, of a JPEG, PNG or WebP
+// image, or 1 if it has none. Cameras store photos the way the sensor was
+// held and record how to turn them upright here.
+func Orientation(data []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		tiff = jpegEXIF(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		tiff = pngEXIF(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		tiff = webpEXIF(data)
+	}
+	if o := tiffOrientation(tiff); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegEXIF walks the segments before the image data for an APP1 segment
+// holding EXIF.
+func jpegEXIF(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xda || marker == 0xd9 { // start of scan, end of image
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+n]
+		if marker == 0xe1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// pngEXIF looks for the eXIf chunk.
+func pngEXIF(data []byte) []byte {
+	for i := 8; i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n < 0 || i+12+n > len(data) {
+			return nil
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf":
+			return data[i+8 : i+8+n]
+		case "IDAT", "IEND":
+			return nil
+		}
+		i += 12 + n
+	}
+	return nil
+}
+
+// webpEXIF looks for the EXIF chunk of an extended WebP file. Some encoders
+// keep the JPEG-style header in front of the TIFF data.
+func webpEXIF(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			return nil
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			return bytes.TrimPrefix(data[i+8:i+8+n], exifHeader)
+		}
+		i += 8 + n + n%2
+	}
+	return nil
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of EXIF's TIFF
+// structure, or returns 0.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for e := range count {
+		entry := ifd + 2 + 12*e
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// a SHORT, stored in the first two bytes of the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
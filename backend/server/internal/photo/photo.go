@@ -0,0 +1,121 @@
+// Package photo turns an uploaded profile photo into the square JPEG
+// thumbnails the API serves. Only pixels survive: the output is re-encoded
+// from scratch, so EXIF, GPS coordinates and any other metadata in the upload
+// are dropped, after the EXIF orientation has been applied.
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the edge lengths, in pixels, of the thumbnails Process makes.
+var Sizes = []int{64, 256, 512}
+
+const (
+	// MaxPixels bounds the decoded size of an upload. A small file can
+	// declare a huge image, so this is checked against the header before
+	// any pixels are decoded.
+	MaxPixels = 40_000_000
+	// quality of the JPEG thumbnails
+	quality = 85
+)
+
+var (
+	ErrNotImage = errors.New("photo: not a JPEG, PNG or WebP image")
+	ErrTooLarge = errors.New("photo: image dimensions are too large")
+)
+
+// formats are the decoders allowed for uploads, by the names the image
+// package registers them under.
+var formats = map[string]bool{"jpeg": true, "png": true, "webp": true}
+
+// Process decodes a JPEG, PNG or WebP image, rotates it upright, crops the
+// largest centred square and returns a JPEG of each of Sizes, keyed by size.
+func Process(data []byte) (map[int][]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !formats[format] {
+		return nil, ErrNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrNotImage
+	}
+	if cfg.Width > MaxPixels/cfg.Height {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+
+	// The centred square of an image is the centred square of any rotation
+	// or flip of it, so crop and scale first and orient only the result.
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+	largest := Sizes[len(Sizes)-1]
+	square := scale(src, crop, largest)
+	square = orient(square, Orientation(data))
+
+	out := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		img := square
+		if size != largest {
+			img = scale(square, square.Bounds(), size)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		out[size] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// scale draws the r part of src into a size x size image. Transparent pixels
+// end up white, since JPEG has no alpha.
+func scale(src image.Image, r image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, r, draw.Over, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation to a square image.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	n := img.Bounds().Dx()
+	dst := image.NewRGBA(img.Bounds())
+	for y := range n {
+		for x := range n {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = n-1-x, y
+			case 3: // upside down
+				sx, sy = n-1-x, n-1-y
+			case 4: // upside down and mirrored
+				sx, sy = x, n-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs turning 90° clockwise
+				sx, sy = y, n-1-x
+			case 7: // transversed
+				sx, sy = n-1-y, n-1-x
+			case 8: // needs turning 90° counter-clockwise
+				sx, sy = n-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,146 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves is a square image, red on top and blue below.
+func halves(n int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, n, n))
+	for y := range n {
+		for x := range n {
+			c := color.RGBA{R: 255, A: 255}
+			if y >= n/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withEXIF puts an APP1 segment with the given orientation and a GPS pointer
+// right after a JPEG's SOI marker.
+func withEXIF(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00*")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	// Orientation, SHORT, 1 value
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	// GPSInfo, LONG, pointing at an IFD this test does not bother to write
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8825, 4})
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 26})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	out = append(out, payload...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess_Sizes(t *testing.T) {
+	// a wide PNG with transparency comes out square, opaque and as JPEG
+	img := image.NewNRGBA(image.Rect(0, 0, 900, 300))
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	out, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	for _, size := range Sizes {
+		got, err := jpeg.Decode(bytes.NewReader(out[size]))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if b := got.Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Errorf("size %d is %v", size, b)
+		}
+		if r, g, b, _ := got.At(size/2, size/2).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+			t.Errorf("size %d: transparent pixel = %d,%d,%d; want white", size, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+func TestProcess_OrientsAndStripsEXIF(t *testing.T) {
+	upload := withEXIF(t, encodeJPEG(t, halves(600)), 6)
+	if got := Orientation(upload); got != 6 {
+		t.Fatalf("Orientation() = %d; want 6", got)
+	}
+
+	out, err := Process(upload)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	thumb := out[512]
+	if bytes.Contains(thumb, []byte("Exif")) {
+		t.Error("thumbnail still has EXIF")
+	}
+	if got := Orientation(thumb); got != 1 {
+		t.Errorf("Orientation(thumbnail) = %d; want 1", got)
+	}
+	img, _ := jpeg.Decode(bytes.NewReader(thumb))
+	// turned clockwise, the red top is now on the right
+	if r, _, b, _ := img.At(500, 256).RGBA(); r < b {
+		t.Errorf("right edge is not red: r=%d b=%d", r>>8, b>>8)
+	}
+	if r, _, b, _ := img.At(10, 256).RGBA(); b < r {
+		t.Errorf("left edge is not blue: r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+func TestProcess_Rejects(t *testing.T) {
+	// an 8-bit grey PNG header claiming 100000 x 100000 pixels
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 100000)
+	binary.BigEndian.PutUint32(ihdr[4:], 100000)
+	ihdr[8] = 8
+	var bomb bytes.Buffer
+	bomb.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&bomb, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	bomb.Write(chunk)
+	binary.Write(&bomb, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"decompression bomb", bomb.Bytes(), ErrTooLarge},
+		{"text", []byte("<svg xmlns='http://www.w3.org/2000/svg'/>"), ErrNotImage},
+		{"truncated JPEG", encodeJPEG(t, halves(64))[:100], ErrNotImage},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrNotImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Process() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package pincode checks Indian postal index numbers against an offline
+// directory and tells which district and state they belong to.
+//
+// The directory is a CSV of pin,district,state rows. A pin column shorter
+// than six digits is a prefix: the first two digits of a PIN name a postal
+// circle and the first three a sorting district, so prefixes are enough to
+// place most PINs in their state. Full six-digit rows add the district. A
+// prefix may map to more than one state where a sorting district crosses a
+// state line. The embedded directory covers every circle plus the head post
+// offices of major cities; a complete India Post export in the same format can
+// be loaded instead with Open.
+package pincode
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//go:embed pincodes.csv
+var embedded []byte
+
+// Place is where a PIN or PIN prefix is delivered. District is empty when the
+// directory only knows the prefix.
+type Place struct {
+	District string
+	State    string
+}
+
+type Directory struct {
+	places map[string][]Place
+}
+
+var pinFormat = regexp.MustCompile(`^[1-9][0-9]{5}$`)
+
+// Valid reports whether pin is six digits not starting with zero.
+func Valid(pin string) bool {
+	return pinFormat.MatchString(pin)
+}
+
+// Load reads a directory from CSV with a pin,district,state header.
+func Load(r io.Reader) (*Directory, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != "pin,district,state" {
+		return nil, errors.New("pincode: missing pin,district,state header")
+	}
+	d := &Directory{places: make(map[string][]Place)}
+	for i, row := range rows[1:] {
+		pin, district, state := strings.TrimSpace(row[0]), strings.TrimSpace(row[1]), strings.TrimSpace(row[2])
+		if len(pin) == 0 || len(pin) > 6 || strings.Trim(pin, "0123456789") != "" || state == "" {
+			return nil, fmt.Errorf("pincode: line %d: invalid row %q", i+2, strings.Join(row, ","))
+		}
+		d.places[pin] = append(d.places[pin], Place{District: district, State: state})
+	}
+	return d, nil
+}
+
+// Open loads a directory from a CSV file.
+func Open(path string) (*Directory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Default returns the embedded directory.
+var Default = sync.OnceValue(func() *Directory {
+	d, err := Load(bytes.NewReader(embedded))
+	if err != nil {
+		panic(err)
+	}
+	return d
+})
+
+// Lookup returns the places matching the longest known prefix of pin, or
+// false if pin is malformed or no prefix of it is known. More than one place
+// means the PIN alone does not settle the state.
+func (d *Directory) Lookup(pin string) ([]Place, bool) {
+	if !Valid(pin) {
+		return nil, false
+	}
+	for n := len(pin); n > 0; n-- {
+		if places, ok := d.places[pin[:n]]; ok {
+			return places, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve checks that pin belongs to state and returns the matching place.
+// An empty state is filled in when the PIN settles it.
+func (d *Directory) Resolve(pin, state string) (Place, error) {
+	places, ok := d.Lookup(pin)
+	if !ok {
+		return Place{}, ErrUnknownPIN
+	}
+	if state == "" {
+		if len(places) > 1 {
+			return Place{}, ErrAmbiguousState
+		}
+		return places[0], nil
+	}
+	for _, p := range places {
+		if strings.EqualFold(p.State, state) {
+			return p, nil
+		}
+	}
+	return Place{}, ErrStateMismatch
+}
+
+var (
+	ErrUnknownPIN     = errors.New("unknown PIN code")
+	ErrAmbiguousState = errors.New("PIN code is shared by more than one state, state is required")
+	ErrStateMismatch  = errors.New("PIN code does not belong to this state")
+)
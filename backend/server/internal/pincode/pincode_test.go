@@ -0,0 +1,54 @@
+package pincode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefault_Loads(t *testing.T) {
+	if len(Default().places) == 0 {
+		t.Fatal("embedded directory is empty")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	d := Default()
+	tests := []struct {
+		pin, state string
+		want       Place
+		wantErr    error
+	}{
+		{"560001", "", Place{"Bengaluru Urban", "Karnataka"}, nil},
+		{"560095", "", Place{"", "Karnataka"}, nil},
+		{"560095", "karnataka", Place{"", "Karnataka"}, nil},
+		{"834001", "", Place{"Ranchi", "Jharkhand"}, nil},
+		{"823001", "", Place{"", "Bihar"}, nil},
+		{"160062", "", Place{}, ErrAmbiguousState},
+		{"160062", "Punjab", Place{"", "Punjab"}, nil},
+		{"560001", "Kerala", Place{}, ErrStateMismatch},
+		{"912345", "", Place{}, ErrUnknownPIN},
+		{"056001", "", Place{}, ErrUnknownPIN},
+		{"56001", "", Place{}, ErrUnknownPIN},
+	}
+	for _, tt := range tests {
+		got, err := d.Resolve(tt.pin, tt.state)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Resolve(%q, %q) = %+v, %v; want %+v, %v", tt.pin, tt.state, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RejectsBadRows(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"code,district,state\n11,,Delhi\n",
+		"pin,district,state\n1100011,,Delhi\n",
+		"pin,district,state\n11a,,Delhi\n",
+		"pin,district,state\n11,New Delhi,\n",
+	} {
+		if _, err := Load(strings.NewReader(data)); err == nil {
+			t.Errorf("Load(%q) = nil error; want error", data)
+		}
+	}
+}
@@ -2,22 +2,356 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"github.com/Raaffs/profileManager/server/internal/models"
 )
 
 type Repository struct {
-	Users    UserRepository
-	Profiles ProfileRepository
+	Users       UserRepository
+	Profiles    ProfileRepository
+	Addresses   AddressRepository
+	Documents   DocumentRepository
+	EKYC        EKYCRepository
+	KYC         KYCRepository
+	Attachments AttachmentRepository
+	Photos      PhotoRepository
+	Duplicates  DuplicateRepository
+	Imports     ImportRepository
+	Exports     ExportRepository
+	Consents    ConsentRepository
+	ShareLinks  ShareLinkRepository
+	Credentials CredentialRepository
+	Audit       AuditRepository
+	Sessions    SessionRepository
+	Tx          Transactor
+}
+
+// Transactor is implemented by each store to give Repository.WithTx its
+// transactions.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(tx *Repository) error) error
+}
+
+// WithTx runs fn against a Repository bound to a new transaction. The
+// transaction commits if fn returns nil and rolls back if it returns an error
+// or panics. Calling WithTx on tx nests a savepoint, which rolls back on its
+// own without aborting the outer transaction. fn must use only tx: the outer
+// repository may block until the transaction ends, as it does in the memory
+// and sqlite stores, so fn deadlocks if it waits on a call to it.
+func (r *Repository) WithTx(ctx context.Context, fn func(tx *Repository) error) error {
+	return r.Tx.WithTx(ctx, fn)
 }
 
 type UserRepository interface {
 	GetByID(ctx context.Context, id int) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	Create(ctx context.Context, user *models.User) error
+	SetRole(ctx context.Context, email string, role string) error
+	// Delete soft-deletes the user and their profiles. Every other method
+	// except Restore and Purge treats soft-deleted rows as missing.
+	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) error
+	// Purge hard-deletes users soft-deleted before the cutoff and returns how many.
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
 
+// ProfileRepository stores the profiles an account manages: its own and those
+// of family members and dependents. Every method is scoped to the owning user,
+// so a profile ID from another account behaves as if it did not exist.
 type ProfileRepository interface {
+	// GetByUserID returns the user's primary profile.
 	GetByUserID(ctx context.Context, userID int) (*models.Profile, error)
-	Create(ctx context.Context, profile models.Profile) error
-	Update(ctx context.Context, profile models.Profile) error
-}
\ No newline at end of file
+	Get(ctx context.Context, userID, id int) (*models.Profile, error)
+	// List returns the user's live profiles, primary first, then by ID.
+	List(ctx context.Context, userID int) ([]models.Profile, error)
+	// Create inserts the profile and fills in ID, Version and IsPrimary. The
+	// first live profile of an account becomes its primary.
+	Create(ctx context.Context, profile *models.Profile) error
+	// Update requires profile.Version to match the stored row and returns
+	// models.VersionConflict otherwise. On success profile.Version is bumped.
+	Update(ctx context.Context, profile *models.Profile) error
+	// Patch is Update restricted to the given models.ProfileFields.
+	Patch(ctx context.Context, profile *models.Profile, fields []string) error
+	// SetPrimary makes the profile the user's primary one.
+	SetPrimary(ctx context.Context, userID, id int) error
+	// Delete soft-deletes one profile. Deleting the primary promotes the
+	// account's self profile, or failing that its oldest remaining one.
+	Delete(ctx context.Context, userID, id int) error
+	// Restore brings back one of the user's deleted profiles. It becomes
+	// primary only if the account has no primary left.
+	Restore(ctx context.Context, userID, id int) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// History returns every recorded version of the user's profiles, oldest first.
+	History(ctx context.Context, userID int) ([]models.ProfileVersion, error)
+	// AsOf returns one of the user's profiles as it stood at the given time.
+	AsOf(ctx context.Context, userID, id int, at time.Time) (*models.ProfileVersion, error)
+}
+
+// AddressRepository stores the structured addresses of profiles. Callers check
+// that the profile belongs to the user before calling it.
+type AddressRepository interface {
+	// List returns the profile's addresses in id order.
+	List(ctx context.Context, profileID int) ([]models.Address, error)
+	// Create returns models.AlreadyExists if the profile already has an
+	// address of that type and models.NotFound if the profile does not exist.
+	Create(ctx context.Context, address *models.Address) error
+	// Update rewrites the address with address.ID on address.ProfileID.
+	Update(ctx context.Context, address *models.Address) error
+	Delete(ctx context.Context, profileID, id int) error
+	// Unchecked returns up to limit addresses with no PIN code and an ID above
+	// afterID, in id order. These are copies of old free-text addresses.
+	Unchecked(ctx context.Context, afterID, limit int) ([]models.Address, error)
+}
+
+// DocumentRepository stores the identity documents of profiles. Numbers are
+// encrypted by the caller, who also computes NumberIndex and checks that the
+// profile belongs to the user.
+type DocumentRepository interface {
+	// List returns the profile's documents in id order.
+	List(ctx context.Context, profileID int) ([]models.IdentityDocument, error)
+	Get(ctx context.Context, profileID, id int) (*models.IdentityDocument, error)
+	// Create returns models.AlreadyExists if the profile already has a
+	// document of that type or any profile has one of the same type and
+	// NumberIndex, and models.NotFound if the profile does not exist.
+	Create(ctx context.Context, doc *models.IdentityDocument) error
+	// Update rewrites the number and expiry of the document with doc.ID on
+	// doc.ProfileID. The type of a document cannot change.
+	Update(ctx context.Context, doc *models.IdentityDocument) error
+	Delete(ctx context.Context, profileID, id int) error
+}
+
+// EKYCRepository records offline eKYC verifications of profiles. Callers check
+// that the profile belongs to the user.
+type EKYCRepository interface {
+	// Create returns models.NotFound if the profile does not exist.
+	Create(ctx context.Context, v *models.EKYCVerification) error
+	// List returns the profile's verifications, newest first.
+	List(ctx context.Context, profileID int) ([]models.EKYCVerification, error)
+}
+
+// KYCRepository stores the KYC state of profiles. It only stores what
+// internal/kyc decides; a profile with no row is in draft.
+type KYCRepository interface {
+	// Get returns models.NotFound if the profile has no row or is deleted.
+	Get(ctx context.Context, profileID int) (*models.KYC, error)
+	// GetForUpdate is Get that also locks the row until the transaction
+	// ends, for a decision that must not race a change of state.
+	GetForUpdate(ctx context.Context, profileID int) (*models.KYC, error)
+	// Save writes k if its Version is still the stored one, 0 meaning no row
+	// yet, and bumps it. It returns models.VersionConflict if another write
+	// got there first and models.NotFound if the profile does not exist.
+	Save(ctx context.Context, k *models.KYC) error
+	// Queue returns up to limit live profiles that are submitted or under
+	// review, longest waiting first.
+	Queue(ctx context.Context, limit int) ([]models.KYC, error)
+	// Expire moves profiles verified before the cutoff to expired and returns
+	// how many there were.
+	Expire(ctx context.Context, verifiedBefore time.Time) (int64, error)
+}
+
+// AttachmentRepository stores the metadata of files uploaded to profiles; the
+// files themselves are in a blob.BlobStore. Callers check that the profile
+// belongs to the user.
+type AttachmentRepository interface {
+	// List returns the profile's attachments in id order.
+	List(ctx context.Context, profileID int) ([]models.Attachment, error)
+	// Get returns models.NotFound if the attachment is not on the profile or
+	// the profile is deleted.
+	Get(ctx context.Context, profileID, id int) (*models.Attachment, error)
+	// Create fills in ID and CreatedAt. It returns models.NotFound if the
+	// profile does not exist.
+	Create(ctx context.Context, a *models.Attachment) error
+	Delete(ctx context.Context, profileID, id int) error
+	// Purgeable returns the attachments of profiles soft-deleted before the
+	// cutoff, which ProfileRepository.Purge and UserRepository.Purge will
+	// erase, so their blobs can be deleted first.
+	Purgeable(ctx context.Context, before time.Time) ([]models.Attachment, error)
+}
+
+// PhotoRepository stores where the photo of each profile is; the images are
+// in a blob.BlobStore. Callers check that the profile belongs to the user.
+type PhotoRepository interface {
+	// Get returns models.NotFound if the profile has no photo or is deleted.
+	Get(ctx context.Context, profileID int) (*models.Photo, error)
+	// Put sets the profile's photo, replacing any other, and fills in
+	// UpdatedAt. It returns models.NotFound if the profile does not exist.
+	Put(ctx context.Context, p *models.Photo) error
+	Delete(ctx context.Context, profileID int) error
+	// Purgeable returns the photos of profiles soft-deleted before the
+	// cutoff; see AttachmentRepository.Purgeable.
+	Purgeable(ctx context.Context, before time.Time) ([]models.Photo, error)
+}
+
+// DuplicateRepository finds profiles that may be the same person and keeps
+// the admin review queue of likely duplicates; internal/dedupe decides which
+// candidates are likely.
+type DuplicateRepository interface {
+	// Candidates returns up to limit live profiles of other accounts than
+	// p's that share its Aadhaar index, its phone index or its date of birth,
+	// index matches first.
+	Candidates(ctx context.Context, p *models.Profile, limit int) ([]models.Profile, error)
+	// Flag records a pending pair, ProfileID below MatchID, or refreshes the
+	// Reasons and Score of one still pending. A pair an admin has resolved
+	// stays resolved. Either way d is filled in from the stored row. It
+	// returns models.NotFound if either profile does not exist.
+	Flag(ctx context.Context, d *models.Duplicate) error
+	// Get returns models.NotFound if there is no such pair.
+	Get(ctx context.Context, id int) (*models.Duplicate, error)
+	// Pair returns the live profiles of a pair, lower ID first, leaving out
+	// one that is deleted.
+	Pair(ctx context.Context, d *models.Duplicate) ([]models.Profile, error)
+	// Queue returns up to limit pending pairs whose profiles are both live,
+	// oldest first.
+	Queue(ctx context.Context, limit int) ([]models.Duplicate, error)
+	// Resolve settles a pending pair with d's Status, ReviewerID and Note and
+	// fills in ResolvedAt. It returns models.NotFound if there is no such
+	// pair and models.VersionConflict if it was already resolved.
+	Resolve(ctx context.Context, d *models.Duplicate) error
+	// Unindexed returns up to limit live profiles with ID above afterID that
+	// lack an Aadhaar or phone index, in ID order.
+	Unindexed(ctx context.Context, afterID, limit int) ([]models.Profile, error)
+	// SetIndexes stores a profile's Aadhaar and phone indexes. They are
+	// derived from the profile, so its version and history are untouched.
+	SetIndexes(ctx context.Context, p *models.Profile) error
+}
+
+// ImportRepository keeps bulk import jobs and stores their batches;
+// internal/importer decides what a batch holds.
+type ImportRepository interface {
+	// Create records a new running job and fills in ID, Status and the
+	// timestamps.
+	Create(ctx context.Context, job *models.ImportJob) error
+	// Get returns models.NotFound if there is no such job.
+	Get(ctx context.Context, id int) (*models.ImportJob, error)
+	// Existing looks up the accounts and profiles the rows could collide
+	// with: accounts by email and username, profiles by VID index and self
+	// phone number, and the self, primary and Aadhaar indexes of the
+	// accounts found.
+	Existing(ctx context.Context, rows []models.ImportRow) (*models.ImportExisting, error)
+	// Insert saves a batch in one transaction: the accounts and profiles,
+	// with a profile_versions snapshot of each, unless the job is a dry run,
+	// then the errors and the job's progress. job must still be at the
+	// Records stored, or nothing is saved and it returns
+	// models.VersionConflict; it returns models.AlreadyExists if a row
+	// collides with a write made since Existing. On success job is updated.
+	Insert(ctx context.Context, job *models.ImportJob, batch *models.ImportBatch) error
+	// Complete marks the job completed.
+	Complete(ctx context.Context, job *models.ImportJob) error
+	// Errors returns the job's errors in line order.
+	Errors(ctx context.Context, id int) ([]models.ImportError, error)
+}
+
+// ExportRepository tracks the data exports users ask for. Get and Download
+// are scoped to the owning user and treat a deleted account's exports as
+// missing.
+type ExportRepository interface {
+	// Create fills in ID, Status and CreatedAt. It returns
+	// models.AlreadyExists if the user has an export pending and
+	// models.NotFound if there is no such user.
+	Create(ctx context.Context, e *models.Export) error
+	Get(ctx context.Context, userID, id int) (*models.Export, error)
+	// Finish records how a pending export ended: ready with its BlobKey,
+	// DataKey, Size and ExpiresAt, or failed. It returns models.NotFound if the
+	// export is not pending.
+	Finish(ctx context.Context, e *models.Export) error
+	// Download marks a ready export downloaded and returns it, so that it can
+	// be downloaded only once. It returns models.NotFound if the export is not
+	// ready or has expired by now.
+	Download(ctx context.Context, userID, id int, now time.Time) (*models.Export, error)
+	// Expire marks expired the ready exports that expired by now or whose
+	// account was deleted, and returns them so their archives can be deleted.
+	Expire(ctx context.Context, now time.Time) ([]models.Export, error)
+	// Abandon fails the exports still pending that were created before the
+	// cutoff, which a restart cut off, and returns how many.
+	Abandon(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ConsentRepository keeps every consent a user gives, including the ones
+// that ended, so each can be traced to the notice that was shown.
+type ConsentRepository interface {
+	// Grant records a consent and ends the user's current consent to the same
+	// purpose, if any. It fills in ID and GrantedAt. It returns
+	// models.NotFound if there is no such user and models.AlreadyExists if a
+	// concurrent Grant to the same purpose got there first.
+	Grant(ctx context.Context, c *models.Consent) error
+	// Withdraw ends the user's current consent to purpose and returns it. It
+	// returns models.NotFound if there is none.
+	Withdraw(ctx context.Context, userID int, purpose string) (*models.Consent, error)
+	// Current returns the user's consent to purpose that has not been
+	// withdrawn, or models.NotFound.
+	Current(ctx context.Context, userID int, purpose string) (*models.Consent, error)
+	Get(ctx context.Context, userID, id int) (*models.Consent, error)
+	// List returns every consent the user gave, oldest first.
+	List(ctx context.Context, userID int) ([]models.Consent, error)
+}
+
+// ShareLinkRepository stores the links users hand out to show parts of a
+// profile to people without an account. Get is not scoped to a user: whoever
+// calls it has checked the link's signature.
+type ShareLinkRepository interface {
+	// Create fills in ID and CreatedAt. It returns models.NotFound if the
+	// profile does not exist.
+	Create(ctx context.Context, l *models.ShareLink) error
+	Get(ctx context.Context, id int) (*models.ShareLink, error)
+	// List returns the links of one of the user's profiles, newest first.
+	List(ctx context.Context, userID, profileID int) ([]models.ShareLink, error)
+	// Revoke ends one of the user's links and returns it. It returns
+	// models.NotFound if there is no such link or it is already revoked.
+	Revoke(ctx context.Context, userID, id int) (*models.ShareLink, error)
+	// Accessed counts an access to the link made at the given time.
+	Accessed(ctx context.Context, id int, at time.Time) error
+	// TakePINAttempt counts a PIN attempt before the PIN is checked, so that
+	// parallel guesses cannot all slip under the limit, and returns how many
+	// have been counted. It returns models.NotFound if the link does not
+	// exist or already has max attempts counted.
+	TakePINAttempt(ctx context.Context, id, max int) (int, error)
+	// ReturnPINAttempt uncounts an attempt whose PIN was right.
+	ReturnPINAttempt(ctx context.Context, id int) error
+	// Purge deletes the links that expired or were revoked before the cutoff.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// CredentialRepository records the Verifiable Credentials issued for
+// profiles. Rows outlive their profiles, so a credential's revocation bit
+// never goes back to unset; Get is not scoped to a user, for verifiers.
+type CredentialRepository interface {
+	// Create fills in ID and IssuedAt. It returns models.NotFound if the
+	// profile does not exist.
+	Create(ctx context.Context, c *models.Credential) error
+	Get(ctx context.Context, id int) (*models.Credential, error)
+	// List returns the credentials issued for one of the user's profiles,
+	// newest first.
+	List(ctx context.Context, userID, profileID int) ([]models.Credential, error)
+	// Revoke revokes one of the user's credentials and returns it. It returns
+	// models.NotFound if there is no such credential or it is already revoked.
+	Revoke(ctx context.Context, userID, id int) (*models.Credential, error)
+	// RevokeProfile revokes every credential issued for the profile that is
+	// not revoked yet, and returns how many.
+	RevokeProfile(ctx context.Context, profileID int) (int64, error)
+	// RevokeUser is RevokeProfile for every profile of the user.
+	RevokeUser(ctx context.Context, userID int) (int64, error)
+	// Revoked returns, in order, the IDs from first to last inclusive of the
+	// credentials that are revoked or whose profile was purged.
+	Revoked(ctx context.Context, first, last int) ([]int, error)
+}
+
+type AuditRepository interface {
+	// Append links rec to the current chain head and stores it. Implementations
+	// must serialise appends so two records can never share a predecessor.
+	Append(ctx context.Context, rec *models.AuditRecord) error
+	// List returns up to limit records with Seq greater than afterSeq, in chain order.
+	List(ctx context.Context, afterSeq int64, limit int) ([]models.AuditRecord, error)
+	// ForUser is List narrowed to the records filed under userID.
+	ForUser(ctx context.Context, userID int, afterSeq int64, limit int) ([]models.AuditRecord, error)
+	CreateCheckpoint(ctx context.Context, cp models.AuditCheckpoint) error
+	Checkpoints(ctx context.Context) ([]models.AuditCheckpoint, error)
+}
+
+type SessionRepository interface {
+	// RevokeAll invalidates every token issued to the user up to now.
+	RevokeAll(ctx context.Context, userID int) error
+	// RevokedAt returns when the user's sessions were last revoked, or the zero
+	// time if they never were.
+	RevokedAt(ctx context.Context, userID int) (time.Time, error)
+}
@@ -0,0 +1,2065 @@
+// Package repotest is the conformance suite for repository implementations.
+// Every store runs it from its own tests, so constraint and error semantics
+// cannot drift between backends:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) *repository.Repository { return NewRepo() })
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+)
+
+// NewRepo returns an empty repository. It is called once per subtest.
+type NewRepo func(t *testing.T) *repository.Repository
+
+// Run runs the whole suite. Subtests run sequentially, so implementations
+// backed by a shared database may reset it in NewRepo.
+func Run(t *testing.T, newRepo NewRepo) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo *repository.Repository)
+	}{
+		{"Users/CreateAndGet", testUserCreateAndGet},
+		{"Users/Unique", testUserUnique},
+		{"Users/NotFound", testUserNotFound},
+		{"Users/SetRole", testUserSetRole},
+		{"Users/DeleteCascades", testUserDeleteCascades},
+		{"Users/DeleteFreesEmail", testUserDeleteFreesEmail},
+		{"Users/RestoreConflict", testUserRestoreConflict},
+		{"Users/Purge", testUserPurge},
+		{"Profiles/CreateAndGet", testProfileCreateAndGet},
+		{"Profiles/CreateUnknownUser", testProfileCreateUnknownUser},
+		{"Profiles/Unique", testProfileUnique},
+		{"Profiles/UpdateVersioning", testProfileUpdateVersioning},
+		{"Profiles/PatchFields", testProfilePatchFields},
+		{"Profiles/PatchUnique", testProfilePatchUnique},
+		{"Profiles/Dependents", testProfileDependents},
+		{"Profiles/AadhaarPerAccount", testProfileAadhaarPerAccount},
+		{"Profiles/PrimaryHandover", testProfilePrimaryHandover},
+		{"Profiles/VID", testProfileVID},
+		{"Profiles/DeleteAndRestore", testProfileDeleteAndRestore},
+		{"Profiles/HistoryAndAsOf", testProfileHistoryAndAsOf},
+		{"Profiles/Purge", testProfilePurge},
+		{"Addresses/CRUD", testAddressCRUD},
+		{"Addresses/Unchecked", testAddressUnchecked},
+		{"Addresses/PurgedWithProfile", testAddressPurgedWithProfile},
+		{"Documents/CRUD", testDocumentCRUD},
+		{"Documents/UniqueNumber", testDocumentUniqueNumber},
+		{"EKYC/CreateList", testEKYCCreateList},
+		{"KYC/SaveVersioning", testKYCSaveVersioning},
+		{"KYC/QueueAndExpire", testKYCQueueAndExpire},
+		{"Attachments/CRUD", testAttachmentCRUD},
+		{"Attachments/Purgeable", testAttachmentPurgeable},
+		{"Photos/PutGetDelete", testPhotoPutGetDelete},
+		{"Duplicates/Candidates", testDuplicateCandidates},
+		{"Duplicates/FlagAndResolve", testDuplicateFlagAndResolve},
+		{"Duplicates/Indexes", testDuplicateIndexes},
+		{"Imports/Insert", testImportInsert},
+		{"Imports/DryRun", testImportDryRun},
+		{"Exports/Lifecycle", testExportLifecycle},
+		{"Exports/ExpireAndAbandon", testExportExpireAndAbandon},
+		{"Consents/GrantAndWithdraw", testConsentGrantAndWithdraw},
+		{"ShareLinks/Lifecycle", testShareLinkLifecycle},
+		{"Credentials/Lifecycle", testCredentialLifecycle},
+		{"Audit/Chain", testAuditChain},
+		{"Audit/Checkpoints", testAuditCheckpoints},
+		{"Sessions/Revoke", testSessionRevoke},
+		{"Tx/Commit", testTxCommit},
+		{"Tx/Rollback", testTxRollback},
+		{"Tx/Panic", testTxPanic},
+		{"Tx/NestedRollback", testTxNestedRollback},
+		{"Tx/OuterRepository", testTxOuterRepository},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+var dob = time.Date(1990, time.March, 14, 0, 0, 0, 0, time.UTC)
+
+func newUser(t *testing.T, repo *repository.Repository, name string) *models.User {
+	t.Helper()
+	u := &models.User{Email: name + "@example.com", Username: name, PasswordHash: "hash"}
+	if err := repo.Users.Create(context.Background(), u); err != nil {
+		t.Fatalf("Users.Create(%s) error = %v", name, err)
+	}
+	if u.ID == 0 {
+		t.Fatalf("Users.Create(%s) did not set ID", name)
+	}
+	return u
+}
+
+// profileFor builds a profile whose unique columns are derived from n.
+func profileFor(userID, n int) *models.Profile {
+	return &models.Profile{
+		UserID:        userID,
+		FullName:      fmt.Sprintf("Person %d", n),
+		DateOfBirth:   dob,
+		AadhaarNumber: fmt.Sprintf("aadhaar-%d", n),
+		PhoneNumber:   fmt.Sprintf("98765%05d", n),
+		Address:       "12 MG Road",
+		Relationship:  models.RelationshipSelf,
+	}
+}
+
+func newProfile(t *testing.T, repo *repository.Repository, userID, n int) *models.Profile {
+	t.Helper()
+	p := profileFor(userID, n)
+	if err := repo.Profiles.Create(context.Background(), p); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+	return p
+}
+
+func wantErr(t *testing.T, call string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s error = %v; want %v", call, err, want)
+	}
+}
+
+func testUserCreateAndGet(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+
+	byID, err := repo.Users.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if byID.Email != u.Email || byID.Username != u.Username || byID.PasswordHash != u.PasswordHash {
+		t.Errorf("GetByID() = %+v; want %+v", byID, u)
+	}
+	if byID.Role != models.RoleUser {
+		t.Errorf("GetByID().Role = %q; want %q", byID.Role, models.RoleUser)
+	}
+
+	byEmail, err := repo.Users.GetByEmail(ctx, u.Email)
+	if err != nil {
+		t.Fatalf("GetByEmail() error = %v", err)
+	}
+	if byEmail.ID != u.ID {
+		t.Errorf("GetByEmail().ID = %d; want %d", byEmail.ID, u.ID)
+	}
+
+	other := newUser(t, repo, "ravi")
+	if other.ID == u.ID {
+		t.Errorf("second user got the same ID %d", u.ID)
+	}
+}
+
+func testUserUnique(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	newUser(t, repo, "asha")
+
+	sameEmail := &models.User{Email: "asha@example.com", Username: "other", PasswordHash: "hash"}
+	wantErr(t, "Create(same email)", repo.Users.Create(ctx, sameEmail), models.AlreadyExists)
+
+	sameName := &models.User{Email: "other@example.com", Username: "asha", PasswordHash: "hash"}
+	wantErr(t, "Create(same username)", repo.Users.Create(ctx, sameName), models.AlreadyExists)
+}
+
+func testUserNotFound(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	_, err := repo.Users.GetByID(ctx, 4242)
+	wantErr(t, "GetByID(unknown)", err, models.NotFound)
+	_, err = repo.Users.GetByEmail(ctx, "nobody@example.com")
+	wantErr(t, "GetByEmail(unknown)", err, models.NotFound)
+	wantErr(t, "Delete(unknown)", repo.Users.Delete(ctx, 4242), models.NotFound)
+	wantErr(t, "Restore(unknown)", repo.Users.Restore(ctx, 4242), models.NotFound)
+}
+
+func testUserSetRole(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+
+	if err := repo.Users.SetRole(ctx, u.Email, models.RoleAdmin); err != nil {
+		t.Fatalf("SetRole() error = %v", err)
+	}
+	got, err := repo.Users.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.Role != models.RoleAdmin {
+		t.Errorf("Role = %q; want %q", got.Role, models.RoleAdmin)
+	}
+
+	wantErr(t, "SetRole(unknown email)", repo.Users.SetRole(ctx, "nobody@example.com", models.RoleAdmin), models.NotFound)
+	if err := repo.Users.SetRole(ctx, u.Email, "root"); err == nil {
+		t.Errorf("SetRole(invalid role) = nil; want error")
+	}
+}
+
+func testUserDeleteCascades(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	newProfile(t, repo, u.ID, 1)
+
+	if err := repo.Users.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err := repo.Users.GetByID(ctx, u.ID)
+	wantErr(t, "GetByID(deleted)", err, models.NotFound)
+	_, err = repo.Profiles.GetByUserID(ctx, u.ID)
+	wantErr(t, "Profiles.GetByUserID(deleted user)", err, models.NotFound)
+	wantErr(t, "Delete(deleted)", repo.Users.Delete(ctx, u.ID), models.NotFound)
+
+	if err := repo.Users.Restore(ctx, u.ID); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := repo.Profiles.GetByUserID(ctx, u.ID); err != nil {
+		t.Errorf("Profiles.GetByUserID(restored user) error = %v", err)
+	}
+	wantErr(t, "Restore(live)", repo.Users.Restore(ctx, u.ID), models.NotFound)
+}
+
+func testUserDeleteFreesEmail(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	old := newUser(t, repo, "asha")
+	newProfile(t, repo, old.ID, 1)
+	if err := repo.Users.Delete(ctx, old.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	u := newUser(t, repo, "asha")
+	if u.ID == old.ID {
+		t.Errorf("re-registered user reused ID %d", old.ID)
+	}
+	// the deleted profile's phone and Aadhaar are free again as well
+	newProfile(t, repo, u.ID, 1)
+}
+
+func testUserRestoreConflict(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	old := newUser(t, repo, "asha")
+	newProfile(t, repo, old.ID, 1)
+	if err := repo.Users.Delete(ctx, old.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	other := newUser(t, repo, "ravi")
+	newProfile(t, repo, other.ID, 1)
+
+	// the user row is free but their profile's phone is taken: nothing changes
+	wantErr(t, "Restore(profile conflict)", repo.Users.Restore(ctx, old.ID), models.AlreadyExists)
+	_, err := repo.Users.GetByID(ctx, old.ID)
+	wantErr(t, "GetByID(after failed restore)", err, models.NotFound)
+
+	newUser(t, repo, "asha")
+	wantErr(t, "Restore(email taken)", repo.Users.Restore(ctx, old.ID), models.AlreadyExists)
+}
+
+func testUserPurge(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	gone := newUser(t, repo, "asha")
+	newProfile(t, repo, gone.ID, 1)
+	kept := newUser(t, repo, "ravi")
+	newProfile(t, repo, kept.ID, 2)
+	if err := repo.Users.Delete(ctx, gone.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	n, err := repo.Users.Purge(ctx, time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("Purge(before delete) = %d, %v; want 0, nil", n, err)
+	}
+	n, err = repo.Users.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge() = %d, %v; want 1, nil", n, err)
+	}
+	wantErr(t, "Restore(purged)", repo.Users.Restore(ctx, gone.ID), models.NotFound)
+
+	history, err := repo.Profiles.History(ctx, gone.ID)
+	if err != nil || len(history) != 0 {
+		t.Errorf("History(purged) = %d versions, %v; want none", len(history), err)
+	}
+	if _, err := repo.Profiles.GetByUserID(ctx, kept.ID); err != nil {
+		t.Errorf("GetByUserID(kept) error = %v", err)
+	}
+}
+
+func testProfileCreateAndGet(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	if p.ID == 0 || p.Version != 1 || !p.IsPrimary {
+		t.Fatalf("Create() set ID %d, Version %d, IsPrimary %t; want non-zero ID, Version 1, primary", p.ID, p.Version, p.IsPrimary)
+	}
+
+	got, err := repo.Profiles.GetByUserID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	if got.ID != p.ID || got.Version != 1 || got.UserID != u.ID ||
+		got.FullName != p.FullName || !got.DateOfBirth.Equal(dob) ||
+		got.AadhaarNumber != p.AadhaarNumber || got.PhoneNumber != p.PhoneNumber || got.Address != p.Address ||
+		got.Relationship != models.RelationshipSelf || !got.IsPrimary {
+		t.Errorf("GetByUserID() = %+v; want %+v", got, p)
+	}
+	if byID, err := repo.Profiles.Get(ctx, u.ID, p.ID); err != nil || byID.ID != p.ID {
+		t.Errorf("Get() = %+v, %v; want profile %d", byID, err, p.ID)
+	}
+
+	_, err = repo.Profiles.GetByUserID(ctx, 4242)
+	wantErr(t, "GetByUserID(unknown)", err, models.NotFound)
+}
+
+func testProfileCreateUnknownUser(t *testing.T, repo *repository.Repository) {
+	wantErr(t, "Create(unknown user)", repo.Profiles.Create(context.Background(), profileFor(4242, 1)), models.NotFound)
+}
+
+func testProfileUnique(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	a := newUser(t, repo, "asha")
+	b := newUser(t, repo, "ravi")
+	newProfile(t, repo, a.ID, 1)
+
+	samePhone := profileFor(b.ID, 2)
+	samePhone.PhoneNumber = profileFor(a.ID, 1).PhoneNumber
+	wantErr(t, "Create(same phone)", repo.Profiles.Create(ctx, samePhone), models.AlreadyExists)
+
+	sameAadhaar := profileFor(b.ID, 2)
+	sameAadhaar.AadhaarNumber = profileFor(a.ID, 1).AadhaarNumber
+	wantErr(t, "Create(same aadhaar)", repo.Profiles.Create(ctx, sameAadhaar), models.AlreadyExists)
+}
+
+func testProfileUpdateVersioning(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	stale := *p
+	p.Address = "4 Park St"
+	if err := repo.Profiles.Update(ctx, p); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if p.Version != 2 {
+		t.Errorf("Update() left Version = %d; want 2", p.Version)
+	}
+	stale.Address = "lost update"
+	wantErr(t, "Update(stale)", repo.Profiles.Update(ctx, &stale), models.VersionConflict)
+
+	got, err := repo.Profiles.GetByUserID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	if got.Address != "4 Park St" || got.Version != 2 {
+		t.Errorf("GetByUserID() = %q at version %d; want %q at version 2", got.Address, got.Version, "4 Park St")
+	}
+
+	missing := profileFor(newUser(t, repo, "ravi").ID, 2)
+	wantErr(t, "Update(no profile)", repo.Profiles.Update(ctx, missing), models.NotFound)
+}
+
+func testProfilePatchFields(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	change := *p
+	change.FullName = "Asha Rao"
+	change.Address = "not written"
+	if err := repo.Profiles.Patch(ctx, &change, []string{models.FieldFullName}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	got, err := repo.Profiles.GetByUserID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	if got.FullName != "Asha Rao" || got.Address != p.Address {
+		t.Errorf("Patch(full_name) stored name %q, address %q; want %q, %q", got.FullName, got.Address, "Asha Rao", p.Address)
+	}
+
+	if err := repo.Profiles.Patch(ctx, &change, []string{"id"}); err == nil {
+		t.Errorf("Patch(unknown field) = nil; want error")
+	}
+}
+
+func testProfilePatchUnique(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	a := newUser(t, repo, "asha")
+	newProfile(t, repo, a.ID, 1)
+	b := newUser(t, repo, "ravi")
+	p := newProfile(t, repo, b.ID, 2)
+
+	p.PhoneNumber = profileFor(a.ID, 1).PhoneNumber
+	wantErr(t, "Patch(same phone)", repo.Profiles.Patch(ctx, p, []string{models.FieldPhoneNumber}), models.AlreadyExists)
+}
+
+func testProfileDependents(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	self := newProfile(t, repo, u.ID, 1)
+
+	// a child may share the account holder's phone, but has its own Aadhaar
+	child := profileFor(u.ID, 2)
+	child.Relationship = models.RelationshipChild
+	child.PhoneNumber = self.PhoneNumber
+	if err := repo.Profiles.Create(ctx, child); err != nil {
+		t.Fatalf("Create(child) error = %v", err)
+	}
+	if child.IsPrimary {
+		t.Errorf("Create(child) made a second primary profile")
+	}
+	wantErr(t, "Create(second self)", repo.Profiles.Create(ctx, profileFor(u.ID, 3)), models.AlreadyExists)
+
+	sameAadhaar := profileFor(u.ID, 4)
+	sameAadhaar.Relationship = models.RelationshipParent
+	sameAadhaar.AadhaarNumber = child.AadhaarNumber
+	wantErr(t, "Create(parent with the child's aadhaar)", repo.Profiles.Create(ctx, sameAadhaar), models.AlreadyExists)
+
+	invalid := profileFor(u.ID, 5)
+	invalid.Relationship = "cousin"
+	if err := repo.Profiles.Create(ctx, invalid); err == nil {
+		t.Errorf("Create(invalid relationship) = nil; want error")
+	}
+
+	list, err := repo.Profiles.List(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].ID != self.ID || list[1].ID != child.ID {
+		t.Fatalf("List() = %+v; want self then child", list)
+	}
+
+	other := newUser(t, repo, "ravi")
+	_, err = repo.Profiles.Get(ctx, other.ID, child.ID)
+	wantErr(t, "Get(another user's profile)", err, models.NotFound)
+	wantErr(t, "Delete(another user's profile)", repo.Profiles.Delete(ctx, other.ID, child.ID), models.NotFound)
+	wantErr(t, "SetPrimary(another user's profile)", repo.Profiles.SetPrimary(ctx, other.ID, child.ID), models.NotFound)
+	if list, err := repo.Profiles.List(ctx, other.ID); err != nil || len(list) != 0 {
+		t.Errorf("List(no profiles) = %+v, %v; want empty", list, err)
+	}
+}
+
+func testProfileAadhaarPerAccount(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	self := profileFor(u.ID, 1)
+	self.AadhaarIndex = "aadhaar-index-1"
+	if err := repo.Profiles.Create(ctx, self); err != nil {
+		t.Fatalf("Create(self) error = %v", err)
+	}
+
+	// the ciphertext differs, the blind index does not
+	child := profileFor(u.ID, 2)
+	child.Relationship, child.AadhaarIndex = models.RelationshipChild, self.AadhaarIndex
+	wantErr(t, "Create(same aadhaar index)", repo.Profiles.Create(ctx, child), models.AlreadyExists)
+	child.AadhaarIndex = "aadhaar-index-2"
+	if err := repo.Profiles.Create(ctx, child); err != nil {
+		t.Fatalf("Create(child) error = %v", err)
+	}
+	child.AadhaarIndex = self.AadhaarIndex
+	wantErr(t, "Patch(same aadhaar index)", repo.Profiles.Patch(ctx, child, []string{models.FieldAadhaarNumber}), models.AlreadyExists)
+
+	// another account may hold the number; that is for duplicate review
+	other := profileFor(newUser(t, repo, "ravi").ID, 3)
+	other.AadhaarIndex = self.AadhaarIndex
+	if err := repo.Profiles.Create(ctx, other); err != nil {
+		t.Errorf("Create(another account) error = %v", err)
+	}
+
+	// a deleted profile frees the number, and cannot take it back
+	if err := repo.Profiles.Delete(ctx, u.ID, self.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	reused := profileFor(u.ID, 4)
+	reused.Relationship, reused.AadhaarIndex = models.RelationshipParent, self.AadhaarIndex
+	if err := repo.Profiles.Create(ctx, reused); err != nil {
+		t.Fatalf("Create(freed aadhaar index) error = %v", err)
+	}
+	wantErr(t, "Restore(aadhaar index taken)", repo.Profiles.Restore(ctx, u.ID, self.ID), models.AlreadyExists)
+}
+
+func testProfilePrimaryHandover(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	self := newProfile(t, repo, u.ID, 1)
+	ward := profileFor(u.ID, 2)
+	ward.Relationship = models.RelationshipWard
+	if err := repo.Profiles.Create(ctx, ward); err != nil {
+		t.Fatalf("Create(ward) error = %v", err)
+	}
+
+	if err := repo.Profiles.SetPrimary(ctx, u.ID, ward.ID); err != nil {
+		t.Fatalf("SetPrimary() error = %v", err)
+	}
+	got, err := repo.Profiles.GetByUserID(ctx, u.ID)
+	if err != nil || got.ID != ward.ID {
+		t.Fatalf("GetByUserID() after SetPrimary = %+v, %v; want the ward", got, err)
+	}
+	if list, _ := repo.Profiles.List(ctx, u.ID); len(list) != 2 || list[0].ID != ward.ID || list[1].IsPrimary {
+		t.Errorf("List() after SetPrimary = %+v; want only the ward primary, first", list)
+	}
+
+	if err := repo.Profiles.Delete(ctx, u.ID, ward.ID); err != nil {
+		t.Fatalf("Delete(primary) error = %v", err)
+	}
+	got, err = repo.Profiles.GetByUserID(ctx, u.ID)
+	if err != nil || got.ID != self.ID {
+		t.Fatalf("GetByUserID() after deleting the primary = %+v, %v; want the self profile", got, err)
+	}
+
+	// the restored ward does not take the flag back
+	if err := repo.Profiles.Restore(ctx, u.ID, ward.ID); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	restored, err := repo.Profiles.Get(ctx, u.ID, ward.ID)
+	if err != nil || restored.IsPrimary {
+		t.Errorf("Get(restored ward) = %+v, %v; want a live, non-primary profile", restored, err)
+	}
+}
+
+func testProfileVID(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+
+	p := profileFor(u.ID, 1)
+	p.AadhaarNumber, p.VID, p.VIDIndex = "", "vid-1", "vid-index-1"
+	if err := repo.Profiles.Create(ctx, p); err != nil {
+		t.Fatalf("Create(VID only) error = %v", err)
+	}
+	got, err := repo.Profiles.Get(ctx, u.ID, p.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.VID != "vid-1" || got.VIDIndex != "vid-index-1" || got.AadhaarNumber != "" || got.AadhaarForm != models.AadhaarFormVID {
+		t.Errorf("Get() = %+v; want the VID-only profile", got)
+	}
+
+	// an empty Aadhaar number is not a value, so VID-only profiles do not collide
+	other := profileFor(newUser(t, repo, "ravi").ID, 2)
+	other.AadhaarNumber, other.VID, other.VIDIndex = "", "vid-2", "vid-index-2"
+	if err := repo.Profiles.Create(ctx, other); err != nil {
+		t.Fatalf("Create(second VID only) error = %v", err)
+	}
+	dup := profileFor(newUser(t, repo, "meera").ID, 3)
+	dup.VID, dup.VIDIndex = "vid-1 again", "vid-index-1"
+	wantErr(t, "Create(same VID index)", repo.Profiles.Create(ctx, dup), models.AlreadyExists)
+
+	neither := profileFor(dup.UserID, 4)
+	neither.AadhaarNumber = ""
+	if err := repo.Profiles.Create(ctx, neither); err == nil {
+		t.Errorf("Create(no aadhaar and no VID) = nil; want error")
+	}
+
+	p.AadhaarNumber = "aadhaar-1"
+	if err := repo.Profiles.Patch(ctx, p, []string{models.FieldAadhaarNumber}); err != nil {
+		t.Fatalf("Patch(add aadhaar) error = %v", err)
+	}
+	if p.AadhaarForm != models.AadhaarFormBoth {
+		t.Errorf("Patch(add aadhaar) AadhaarForm = %q; want %q", p.AadhaarForm, models.AadhaarFormBoth)
+	}
+	p.VID, p.VIDIndex = "", ""
+	if err := repo.Profiles.Patch(ctx, p, []string{models.FieldVID}); err != nil {
+		t.Fatalf("Patch(drop VID) error = %v", err)
+	}
+	got, _ = repo.Profiles.Get(ctx, u.ID, p.ID)
+	if got.VID != "" || got.VIDIndex != "" || got.AadhaarForm != models.AadhaarFormAadhaar {
+		t.Errorf("Get() after dropping the VID = %+v", got)
+	}
+	// the freed index can be taken by someone else
+	dup.AadhaarNumber = "aadhaar-5"
+	if err := repo.Profiles.Create(ctx, dup); err != nil {
+		t.Errorf("Create(released VID index) error = %v", err)
+	}
+
+	history, err := repo.Profiles.History(ctx, u.ID)
+	if err != nil || len(history) != 3 || history[0].Profile.VID != "vid-1" || history[2].Profile.VID != "" {
+		t.Errorf("History() = %+v, %v; want the VID in each snapshot", history, err)
+	}
+}
+
+func testProfileDeleteAndRestore(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	wantErr(t, "Restore(live)", repo.Profiles.Restore(ctx, u.ID, p.ID), models.NotFound)
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err := repo.Profiles.GetByUserID(ctx, u.ID)
+	wantErr(t, "GetByUserID(deleted)", err, models.NotFound)
+	wantErr(t, "Delete(deleted)", repo.Profiles.Delete(ctx, u.ID, p.ID), models.NotFound)
+
+	if err := repo.Profiles.Restore(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, err := repo.Profiles.GetByUserID(ctx, u.ID); err != nil || !got.IsPrimary {
+		t.Errorf("GetByUserID(restored) = %+v, %v; want the restored profile as primary", got, err)
+	}
+
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	// a new self profile takes the slot the deleted one would come back to
+	q := newProfile(t, repo, u.ID, 2)
+	wantErr(t, "Restore(replaced)", repo.Profiles.Restore(ctx, u.ID, p.ID), models.AlreadyExists)
+
+	// any deleted profile can come back, not only the latest
+	if err := repo.Profiles.Delete(ctx, u.ID, q.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Profiles.Restore(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Restore(older) error = %v", err)
+	}
+	if got, err := repo.Profiles.GetByUserID(ctx, u.ID); err != nil || got.ID != p.ID {
+		t.Errorf("GetByUserID() = %+v, %v; want the older profile", got, err)
+	}
+	_, err = repo.Profiles.Get(ctx, u.ID, q.ID)
+	wantErr(t, "Get(still deleted)", err, models.NotFound)
+
+	nobody := newUser(t, repo, "ravi")
+	wantErr(t, "Restore(another user's profile)", repo.Profiles.Restore(ctx, nobody.ID, q.ID), models.NotFound)
+	wantErr(t, "Restore(unknown)", repo.Profiles.Restore(ctx, u.ID, q.ID+100), models.NotFound)
+}
+
+func testProfileHistoryAndAsOf(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	before := time.Now().Add(-time.Hour)
+	p := newProfile(t, repo, u.ID, 1)
+	p.Address = "4 Park St"
+	if err := repo.Profiles.Update(ctx, p); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Profiles.Restore(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	history, err := repo.Profiles.History(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	want := []string{models.ProfileCreated, models.ProfileUpdated, models.ProfileDeleted, models.ProfileRestored}
+	if len(history) != len(want) {
+		t.Fatalf("History() returned %d versions; want %d", len(history), len(want))
+	}
+	for i, v := range history {
+		if v.Change != want[i] {
+			t.Errorf("History()[%d].Change = %q; want %q", i, v.Change, want[i])
+		}
+		if v.Profile.ID != p.ID || v.Profile.UserID != u.ID {
+			t.Errorf("History()[%d] belongs to profile %d of user %d", i, v.Profile.ID, v.Profile.UserID)
+		}
+		if i > 0 && v.Version <= history[i-1].Version {
+			t.Errorf("History() versions out of order: %d after %d", v.Version, history[i-1].Version)
+		}
+	}
+	if history[0].Profile.Address != "12 MG Road" || history[1].Profile.Address != "4 Park St" {
+		t.Errorf("History() addresses = %q, %q; want the old then the new", history[0].Profile.Address, history[1].Profile.Address)
+	}
+
+	_, err = repo.Profiles.AsOf(ctx, u.ID, p.ID, before)
+	wantErr(t, "AsOf(before creation)", err, models.NotFound)
+	at, err := repo.Profiles.AsOf(ctx, u.ID, p.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("AsOf(now) error = %v", err)
+	}
+	if at.Change != models.ProfileRestored || at.Profile.Address != "4 Park St" {
+		t.Errorf("AsOf(now) = %s %q; want restore %q", at.Change, at.Profile.Address, "4 Park St")
+	}
+	_, err = repo.Profiles.AsOf(ctx, u.ID, p.ID, history[2].ChangedAt)
+	if history[2].ChangedAt.Before(history[3].ChangedAt) {
+		wantErr(t, "AsOf(while deleted)", err, models.NotFound)
+	}
+}
+
+func testProfilePurge(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	live := newUser(t, repo, "ravi")
+	newProfile(t, repo, live.ID, 2)
+
+	n, err := repo.Profiles.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge() = %d, %v; want 1, nil", n, err)
+	}
+	wantErr(t, "Restore(purged)", repo.Profiles.Restore(ctx, u.ID, p.ID), models.NotFound)
+	history, err := repo.Profiles.History(ctx, u.ID)
+	if err != nil || len(history) != 0 {
+		t.Errorf("History(purged) = %d versions, %v; want none", len(history), err)
+	}
+	if _, err := repo.Users.GetByID(ctx, u.ID); err != nil {
+		t.Errorf("Users.GetByID() after profile purge error = %v", err)
+	}
+}
+
+func addressFor(profileID int, typ string) *models.Address {
+	return &models.Address{
+		ProfileID: profileID,
+		Type:      typ,
+		Line1:     "12 MG Road",
+		Locality:  "Shivajinagar",
+		District:  "Bengaluru Urban",
+		State:     "Karnataka",
+		PinCode:   "560001",
+	}
+}
+
+func testAddressCRUD(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	home := addressFor(p.ID, models.AddressPermanent)
+	if err := repo.Addresses.Create(ctx, home); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if home.ID == 0 || home.CreatedAt.IsZero() {
+		t.Fatalf("Create() left ID %d, CreatedAt %v", home.ID, home.CreatedAt)
+	}
+	wantErr(t, "Create(second permanent)", repo.Addresses.Create(ctx, addressFor(p.ID, models.AddressPermanent)), models.AlreadyExists)
+	wantErr(t, "Create(unknown profile)", repo.Addresses.Create(ctx, addressFor(4242, models.AddressOffice)), models.NotFound)
+	if err := repo.Addresses.Create(ctx, addressFor(p.ID, "holiday")); err == nil {
+		t.Errorf("Create(invalid type) = nil; want error")
+	}
+
+	office := addressFor(p.ID, models.AddressOffice)
+	if err := repo.Addresses.Create(ctx, office); err != nil {
+		t.Fatalf("Create(office) error = %v", err)
+	}
+	office.Line1 = "1 Residency Road"
+	if err := repo.Addresses.Update(ctx, office); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	office.Type = models.AddressPermanent
+	wantErr(t, "Update(to a type already used)", repo.Addresses.Update(ctx, office), models.AlreadyExists)
+	office.Type = models.AddressOffice
+
+	other := newProfile(t, repo, newUser(t, repo, "ravi").ID, 2)
+	moved := *office
+	moved.ProfileID = other.ID
+	wantErr(t, "Update(another profile's address)", repo.Addresses.Update(ctx, &moved), models.NotFound)
+	wantErr(t, "Delete(another profile's address)", repo.Addresses.Delete(ctx, other.ID, office.ID), models.NotFound)
+
+	list, err := repo.Addresses.List(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].ID != home.ID || list[1].Line1 != "1 Residency Road" || list[1].PinCode != "560001" {
+		t.Errorf("List() = %+v; want home, then the updated office", list)
+	}
+
+	if err := repo.Addresses.Delete(ctx, p.ID, home.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	wantErr(t, "Delete(deleted)", repo.Addresses.Delete(ctx, p.ID, home.ID), models.NotFound)
+	if list, _ := repo.Addresses.List(ctx, p.ID); len(list) != 1 {
+		t.Errorf("List() after Delete = %d addresses; want 1", len(list))
+	}
+}
+
+func testAddressUnchecked(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	var unchecked []int
+	for i := range 3 {
+		p := newProfile(t, repo, newUser(t, repo, fmt.Sprintf("user%d", i)).ID, i+1)
+		a := &models.Address{ProfileID: p.ID, Type: models.AddressPermanent, Line1: "12 MG Road, Bengaluru 560001"}
+		if err := repo.Addresses.Create(ctx, a); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		unchecked = append(unchecked, a.ID)
+	}
+	checked := addressFor(newProfile(t, repo, u.ID, 9).ID, models.AddressCurrent)
+	if err := repo.Addresses.Create(ctx, checked); err != nil {
+		t.Fatalf("Create(checked) error = %v", err)
+	}
+
+	page, err := repo.Addresses.Unchecked(ctx, 0, 2)
+	if err != nil || len(page) != 2 || page[0].ID != unchecked[0] || page[1].ID != unchecked[1] {
+		t.Fatalf("Unchecked(0, 2) = %+v, %v; want the first two", page, err)
+	}
+	page, err = repo.Addresses.Unchecked(ctx, page[1].ID, 2)
+	if err != nil || len(page) != 1 || page[0].ID != unchecked[2] {
+		t.Fatalf("Unchecked(after, 2) = %+v, %v; want the last one", page, err)
+	}
+
+	page[0].PinCode, page[0].State = "560001", "Karnataka"
+	if err := repo.Addresses.Update(ctx, &page[0]); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if page, _ := repo.Addresses.Unchecked(ctx, 0, 10); len(page) != 2 {
+		t.Errorf("Unchecked() after backfilling one = %d; want 2", len(page))
+	}
+}
+
+func testAddressPurgedWithProfile(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	if err := repo.Addresses.Create(ctx, addressFor(p.ID, models.AddressPermanent)); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	// soft deletion keeps the addresses for a restore
+	if list, _ := repo.Addresses.List(ctx, p.ID); len(list) != 1 {
+		t.Fatalf("List() after soft delete = %d addresses; want 1", len(list))
+	}
+	if _, err := repo.Profiles.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Profiles.Purge() error = %v", err)
+	}
+	if list, err := repo.Addresses.List(ctx, p.ID); err != nil || len(list) != 0 {
+		t.Errorf("List() after purge = %d addresses, %v; want none", len(list), err)
+	}
+}
+
+func documentFor(profileID int, typ, index string) *models.IdentityDocument {
+	return &models.IdentityDocument{ProfileID: profileID, Type: typ, Number: "ciphertext-" + index, NumberIndex: index}
+}
+
+func testDocumentCRUD(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	expires := time.Date(2031, 5, 17, 0, 0, 0, 0, time.UTC)
+	passport := documentFor(p.ID, models.DocumentPassport, "idx-passport")
+	passport.ExpiresOn = &expires
+	if err := repo.Documents.Create(ctx, passport); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if passport.ID == 0 || passport.CreatedAt.IsZero() {
+		t.Fatalf("Create() left ID %d, CreatedAt %v", passport.ID, passport.CreatedAt)
+	}
+	wantErr(t, "Create(second passport)", repo.Documents.Create(ctx, documentFor(p.ID, models.DocumentPassport, "idx-other")), models.AlreadyExists)
+	wantErr(t, "Create(unknown profile)", repo.Documents.Create(ctx, documentFor(4242, models.DocumentPAN, "idx-pan")), models.NotFound)
+	if err := repo.Documents.Create(ctx, documentFor(p.ID, "ration_card", "idx-ration")); err == nil {
+		t.Errorf("Create(invalid type) = nil; want error")
+	}
+
+	got, err := repo.Documents.Get(ctx, p.ID, passport.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Number != "ciphertext-idx-passport" || got.NumberIndex != "idx-passport" || got.ExpiresOn == nil || !got.ExpiresOn.Equal(expires) {
+		t.Errorf("Get() = %+v; want the stored passport expiring %v", got, expires)
+	}
+
+	other := newProfile(t, repo, newUser(t, repo, "ravi").ID, 2)
+	_, err = repo.Documents.Get(ctx, other.ID, passport.ID)
+	wantErr(t, "Get(another profile's document)", err, models.NotFound)
+
+	renewed := &models.IdentityDocument{ID: passport.ID, ProfileID: p.ID, Number: "ciphertext-new", NumberIndex: "idx-new"}
+	if err := repo.Documents.Update(ctx, renewed); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if renewed.Type != models.DocumentPassport || renewed.CreatedAt.IsZero() {
+		t.Errorf("Update() filled Type %q, CreatedAt %v; want the stored ones", renewed.Type, renewed.CreatedAt)
+	}
+	if got, _ := repo.Documents.Get(ctx, p.ID, passport.ID); got.NumberIndex != "idx-new" || got.ExpiresOn != nil {
+		t.Errorf("Get() after Update = %+v; want the new number and no expiry", got)
+	}
+	renewed.ProfileID = other.ID
+	wantErr(t, "Update(another profile's document)", repo.Documents.Update(ctx, renewed), models.NotFound)
+	wantErr(t, "Delete(another profile's document)", repo.Documents.Delete(ctx, other.ID, passport.ID), models.NotFound)
+
+	if err := repo.Documents.Create(ctx, documentFor(p.ID, models.DocumentPAN, "idx-pan")); err != nil {
+		t.Fatalf("Create(pan) error = %v", err)
+	}
+	if list, err := repo.Documents.List(ctx, p.ID); err != nil || len(list) != 2 || list[0].ID != passport.ID {
+		t.Errorf("List() = %+v, %v; want the passport, then the PAN", list, err)
+	}
+	if err := repo.Documents.Delete(ctx, p.ID, passport.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	wantErr(t, "Delete(deleted)", repo.Documents.Delete(ctx, p.ID, passport.ID), models.NotFound)
+
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if _, err := repo.Profiles.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Profiles.Purge() error = %v", err)
+	}
+	if list, err := repo.Documents.List(ctx, p.ID); err != nil || len(list) != 0 {
+		t.Errorf("List() after purge = %d documents, %v; want none", len(list), err)
+	}
+}
+
+func testDocumentUniqueNumber(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	a := newProfile(t, repo, newUser(t, repo, "asha").ID, 1)
+	b := newProfile(t, repo, newUser(t, repo, "ravi").ID, 2)
+
+	if err := repo.Documents.Create(ctx, documentFor(a.ID, models.DocumentPAN, "idx-1")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	wantErr(t, "Create(same PAN on another profile)", repo.Documents.Create(ctx, documentFor(b.ID, models.DocumentPAN, "idx-1")), models.AlreadyExists)
+	// indexes are per type, so an equal index under another type is unrelated
+	if err := repo.Documents.Create(ctx, documentFor(b.ID, models.DocumentVoterID, "idx-1")); err != nil {
+		t.Errorf("Create(same index, other type) error = %v", err)
+	}
+
+	pan := documentFor(b.ID, models.DocumentPAN, "idx-2")
+	if err := repo.Documents.Create(ctx, pan); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	pan.NumberIndex = "idx-1"
+	wantErr(t, "Update(to a PAN held elsewhere)", repo.Documents.Update(ctx, pan), models.AlreadyExists)
+
+	// deleting a profile frees its numbers, and restoring it cannot take them
+	// back while another profile holds them
+	if err := repo.Profiles.Delete(ctx, a.UserID, a.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if err := repo.Documents.Update(ctx, pan); err != nil {
+		t.Errorf("Update(to a deleted profile's PAN) error = %v", err)
+	}
+	wantErr(t, "Profiles.Restore(PAN taken)", repo.Profiles.Restore(ctx, a.UserID, a.ID), models.AlreadyExists)
+	if err := repo.Documents.Delete(ctx, b.ID, pan.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Profiles.Restore(ctx, a.UserID, a.ID); err != nil {
+		t.Fatalf("Profiles.Restore() error = %v", err)
+	}
+	wantErr(t, "Create(restored profile's PAN)", repo.Documents.Create(ctx, documentFor(b.ID, models.DocumentPAN, "idx-1")), models.AlreadyExists)
+
+	// and the same with the whole account
+	if err := repo.Users.Delete(ctx, a.UserID); err != nil {
+		t.Fatalf("Users.Delete() error = %v", err)
+	}
+	if err := repo.Documents.Create(ctx, documentFor(b.ID, models.DocumentPAN, "idx-1")); err != nil {
+		t.Errorf("Create(a deleted account's PAN) error = %v", err)
+	}
+	wantErr(t, "Users.Restore(PAN taken)", repo.Users.Restore(ctx, a.UserID), models.AlreadyExists)
+}
+
+func testDuplicateCandidates(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	asha, ravi, meena := newUser(t, repo, "asha"), newUser(t, repo, "ravi"), newUser(t, repo, "meena")
+
+	p := profileFor(asha.ID, 1)
+	p.AadhaarIndex, p.PhoneIndex = "aadhaar-index-1", "phone-index-1"
+	if err := repo.Profiles.Create(ctx, p); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+	// the same account's other profiles are never candidates
+	child := profileFor(asha.ID, 2)
+	child.Relationship, child.PhoneIndex = models.RelationshipChild, "phone-index-1"
+	if err := repo.Profiles.Create(ctx, child); err != nil {
+		t.Fatalf("Profiles.Create(child) error = %v", err)
+	}
+
+	byDOB := newProfile(t, repo, ravi.ID, 3)
+	byPhone := profileFor(meena.ID, 4)
+	byPhone.DateOfBirth, byPhone.PhoneIndex = dob.AddDate(1, 0, 0), "phone-index-1"
+	if err := repo.Profiles.Create(ctx, byPhone); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+	byAadhaar := profileFor(ravi.ID, 5)
+	byAadhaar.Relationship = models.RelationshipSpouse
+	byAadhaar.DateOfBirth, byAadhaar.AadhaarIndex = dob.AddDate(2, 0, 0), "aadhaar-index-1"
+	if err := repo.Profiles.Create(ctx, byAadhaar); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+	unrelated := profileFor(meena.ID, 6)
+	unrelated.Relationship, unrelated.DateOfBirth = models.RelationshipParent, dob.AddDate(-30, 0, 0)
+	if err := repo.Profiles.Create(ctx, unrelated); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+
+	got, err := repo.Duplicates.Candidates(ctx, p, 10)
+	if err != nil {
+		t.Fatalf("Candidates() error = %v", err)
+	}
+	var ids []int
+	for _, c := range got {
+		ids = append(ids, c.ID)
+	}
+	// index matches first
+	if fmt.Sprint(ids) != fmt.Sprint([]int{byAadhaar.ID, byPhone.ID, byDOB.ID}) {
+		t.Errorf("Candidates() = %v; want %v", ids, []int{byAadhaar.ID, byPhone.ID, byDOB.ID})
+	}
+	if got[0].AadhaarIndex != "aadhaar-index-1" || got[1].PhoneIndex != "phone-index-1" {
+		t.Errorf("Candidates() did not return the blind indexes: %+v", got[:2])
+	}
+	if got, _ := repo.Duplicates.Candidates(ctx, p, 1); len(got) != 1 || got[0].ID != byAadhaar.ID {
+		t.Errorf("Candidates(limit 1) = %+v; want only the Aadhaar match", got)
+	}
+
+	if err := repo.Profiles.Delete(ctx, ravi.ID, byAadhaar.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if got, _ := repo.Duplicates.Candidates(ctx, p, 10); len(got) != 2 {
+		t.Errorf("Candidates() after delete = %d profiles; want 2", len(got))
+	}
+}
+
+func testDuplicateFlagAndResolve(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	asha, ravi, admin := newUser(t, repo, "asha"), newUser(t, repo, "ravi"), newUser(t, repo, "admin")
+	a := newProfile(t, repo, asha.ID, 1)
+	b := newProfile(t, repo, ravi.ID, 2)
+
+	wantErr(t, "Flag(unknown profile)", repo.Duplicates.Flag(ctx, &models.Duplicate{
+		ProfileID: a.ID, MatchID: b.ID + 100, Reasons: []string{models.DuplicatePhone},
+	}), models.NotFound)
+
+	d := &models.Duplicate{ProfileID: a.ID, MatchID: b.ID, Reasons: []string{models.DuplicateNameDOB}, Score: 0.93}
+	if err := repo.Duplicates.Flag(ctx, d); err != nil {
+		t.Fatalf("Flag() error = %v", err)
+	}
+	if d.ID == 0 || d.Status != models.DuplicatePending || d.CreatedAt.IsZero() {
+		t.Fatalf("Flag() = %+v; want a pending pair", d)
+	}
+	// flagging the pair again refreshes it
+	again := &models.Duplicate{ProfileID: a.ID, MatchID: b.ID, Reasons: []string{models.DuplicateAadhaar, models.DuplicateNameDOB}, Score: 0.97}
+	if err := repo.Duplicates.Flag(ctx, again); err != nil || again.ID != d.ID {
+		t.Fatalf("Flag(again) = %+v, %v; want the same pair", again, err)
+	}
+	got, err := repo.Duplicates.Get(ctx, d.ID)
+	if err != nil || fmt.Sprint(got.Reasons) != "[aadhaar name_dob]" || got.Score != 0.97 {
+		t.Fatalf("Get() = %+v, %v; want the refreshed reasons", got, err)
+	}
+	_, err = repo.Duplicates.Get(ctx, d.ID+100)
+	wantErr(t, "Get(unknown)", err, models.NotFound)
+
+	if queue, err := repo.Duplicates.Queue(ctx, 10); err != nil || len(queue) != 1 || queue[0].ID != d.ID {
+		t.Fatalf("Queue() = %+v, %v; want the pair", queue, err)
+	}
+	if pair, err := repo.Duplicates.Pair(ctx, d); err != nil || len(pair) != 2 || pair[0].ID != a.ID || pair[1].ID != b.ID {
+		t.Fatalf("Pair() = %+v, %v; want both profiles", pair, err)
+	}
+	// a deleted profile takes its pairs out of the queue until it is restored
+	if err := repo.Profiles.Delete(ctx, ravi.ID, b.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if queue, _ := repo.Duplicates.Queue(ctx, 10); len(queue) != 0 {
+		t.Errorf("Queue() with a deleted profile = %+v; want none", queue)
+	}
+	if pair, _ := repo.Duplicates.Pair(ctx, d); len(pair) != 1 || pair[0].ID != a.ID {
+		t.Errorf("Pair() with a deleted profile = %+v; want only the live one", pair)
+	}
+	if err := repo.Profiles.Restore(ctx, ravi.ID, b.ID); err != nil {
+		t.Fatalf("Profiles.Restore() error = %v", err)
+	}
+
+	resolve := &models.Duplicate{ID: d.ID, Status: models.DuplicateDistinct, ReviewerID: &admin.ID, Note: "twins"}
+	if err := repo.Duplicates.Resolve(ctx, resolve); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resolve.ResolvedAt == nil || resolve.ProfileID != a.ID || resolve.Note != "twins" {
+		t.Errorf("Resolve() = %+v; want the resolved pair", resolve)
+	}
+	wantErr(t, "Resolve(again)", repo.Duplicates.Resolve(ctx, &models.Duplicate{ID: d.ID, Status: models.DuplicateSame}), models.VersionConflict)
+	wantErr(t, "Resolve(unknown)", repo.Duplicates.Resolve(ctx, &models.Duplicate{ID: d.ID + 100, Status: models.DuplicateSame}), models.NotFound)
+	if queue, _ := repo.Duplicates.Queue(ctx, 10); len(queue) != 0 {
+		t.Errorf("Queue() after Resolve = %+v; want none", queue)
+	}
+
+	// a resolved pair stays resolved when it is flagged again
+	third := &models.Duplicate{ProfileID: a.ID, MatchID: b.ID, Reasons: []string{models.DuplicatePhone}, Score: 0.5}
+	if err := repo.Duplicates.Flag(ctx, third); err != nil {
+		t.Fatalf("Flag(resolved) error = %v", err)
+	}
+	if third.ID != d.ID || third.Status != models.DuplicateDistinct || fmt.Sprint(third.Reasons) != "[aadhaar name_dob]" {
+		t.Errorf("Flag(resolved) = %+v; want the resolved pair unchanged", third)
+	}
+
+	// purging a profile removes its pairs
+	if err := repo.Profiles.Delete(ctx, asha.ID, a.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if _, err := repo.Profiles.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Profiles.Purge() error = %v", err)
+	}
+	_, err = repo.Duplicates.Get(ctx, d.ID)
+	wantErr(t, "Get(purged)", err, models.NotFound)
+}
+
+func testDuplicateIndexes(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	indexed := profileFor(u.ID, 2)
+	indexed.Relationship = models.RelationshipChild
+	indexed.AadhaarIndex, indexed.PhoneIndex = "aadhaar-index-2", "phone-index-2"
+	if err := repo.Profiles.Create(ctx, indexed); err != nil {
+		t.Fatalf("Profiles.Create() error = %v", err)
+	}
+
+	list, err := repo.Duplicates.Unindexed(ctx, 0, 10)
+	if err != nil || len(list) != 1 || list[0].ID != p.ID {
+		t.Fatalf("Unindexed() = %+v, %v; want the profile without indexes", list, err)
+	}
+	if list, _ := repo.Duplicates.Unindexed(ctx, p.ID, 10); len(list) != 0 {
+		t.Errorf("Unindexed(after) = %+v; want none", list)
+	}
+
+	p.AadhaarIndex, p.PhoneIndex = "aadhaar-index-1", "phone-index-1"
+	if err := repo.Duplicates.SetIndexes(ctx, p); err != nil {
+		t.Fatalf("SetIndexes() error = %v", err)
+	}
+	got, err := repo.Profiles.Get(ctx, u.ID, p.ID)
+	if err != nil || got.AadhaarIndex != "aadhaar-index-1" || got.PhoneIndex != "phone-index-1" || got.Version != 1 {
+		t.Fatalf("Get() = %+v, %v; want the indexes at version 1", got, err)
+	}
+	if list, _ := repo.Duplicates.Unindexed(ctx, 0, 10); len(list) != 0 {
+		t.Errorf("Unindexed() after SetIndexes = %+v; want none", list)
+	}
+	wantErr(t, "SetIndexes(unknown)", repo.Duplicates.SetIndexes(ctx, &models.Profile{ID: p.ID + 100}), models.NotFound)
+
+	// the indexes move with their field
+	got.PhoneNumber, got.PhoneIndex = "9999900001", "phone-index-new"
+	got.AadhaarIndex = "not written"
+	if err := repo.Profiles.Patch(ctx, got, []string{models.FieldPhoneNumber}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	got, _ = repo.Profiles.Get(ctx, u.ID, p.ID)
+	if got.PhoneIndex != "phone-index-new" || got.AadhaarIndex != "aadhaar-index-1" {
+		t.Errorf("after Patch: phone index %q, aadhaar index %q", got.PhoneIndex, got.AadhaarIndex)
+	}
+}
+
+// importBatch is a batch that creates the account "ravi" with a self and a
+// child profile, and reports one error.
+func importBatch(records int) *models.ImportBatch {
+	self := profileFor(0, 11)
+	self.VIDIndex, self.AadhaarIndex, self.IsPrimary = "vid-index-11", "aadhaar-index-11", true
+	child := profileFor(0, 12)
+	child.Relationship = models.RelationshipChild
+	self.AadhaarForm, child.AadhaarForm = models.AadhaarFormAadhaar, models.AadhaarFormAadhaar
+	return &models.ImportBatch{
+		Records:  records,
+		Line:     records + 1,
+		Checksum: fmt.Sprintf("sum-%d", records),
+		Users:    []models.User{{Email: "ravi@example.com", Username: "ravi", Role: models.RoleUser}},
+		Rows: []models.ImportRow{
+			{Line: 2, Email: "ravi@example.com", Username: "ravi", Profile: *self},
+			{Line: 4, Email: "ravi@example.com", Username: "ravi", Profile: *child},
+		},
+		Errors: []models.ImportError{{Line: 3, Field: "vid", Message: "invalid VID"}},
+	}
+}
+
+func testImportInsert(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	admin := newUser(t, repo, "asha")
+	job := &models.ImportJob{AdminID: &admin.ID, Format: models.ImportCSV}
+	if err := repo.Imports.Create(ctx, job); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if job.ID == 0 || job.Status != models.ImportRunning || job.Records != 0 {
+		t.Fatalf("Create() = %+v; want a running job with an ID", job)
+	}
+	unknown := 9999
+	wantErr(t, "Create(unknown admin)", repo.Imports.Create(ctx, &models.ImportJob{AdminID: &unknown, Format: models.ImportCSV}), models.NotFound)
+
+	batch := importBatch(3)
+	stale := *job
+	if err := repo.Imports.Insert(ctx, job, batch); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if job.Records != 3 || job.Line != 4 || job.Checksum != "sum-3" || job.Users != 1 || job.Profiles != 2 || job.Failed != 1 {
+		t.Errorf("Insert() job = %+v; want 3 records, 1 user, 2 profiles, 1 failed", job)
+	}
+	ravi := batch.Users[0].ID
+	if ravi == 0 || batch.Rows[1].Profile.UserID != ravi || batch.Rows[1].Profile.ID == 0 {
+		t.Fatalf("Insert() did not fill in IDs: %+v", batch)
+	}
+	profiles, err := repo.Profiles.List(ctx, ravi)
+	if err != nil || len(profiles) != 2 || !profiles[0].IsPrimary || profiles[0].Relationship != models.RelationshipSelf {
+		t.Fatalf("List() = %+v, %v; want the self profile as primary and the child", profiles, err)
+	}
+	if history, _ := repo.Profiles.History(ctx, ravi); len(history) != 2 {
+		t.Errorf("History() = %d versions; want one per imported profile", len(history))
+	}
+
+	existing, err := repo.Imports.Existing(ctx, batch.Rows)
+	if err != nil {
+		t.Fatalf("Existing() error = %v", err)
+	}
+	want := fmt.Sprint(map[string]int{"ravi@example.com": ravi})
+	if fmt.Sprint(existing.Accounts) != want || !existing.Usernames["ravi"] || !existing.VIDs["vid-index-11"] ||
+		!existing.SelfPhones[profileFor(0, 11).PhoneNumber] || existing.SelfPhones[profileFor(0, 12).PhoneNumber] ||
+		!existing.Self[ravi] || !existing.Primary[ravi] || fmt.Sprint(existing.Aadhaar[ravi]) != "[aadhaar-index-11]" {
+		t.Errorf("Existing() = %+v", existing)
+	}
+
+	// the same batch again: from a stale job it is refused, and from the
+	// current one the account collides
+	wantErr(t, "Insert(stale)", repo.Imports.Insert(ctx, &stale, importBatch(3)), models.VersionConflict)
+	wantErr(t, "Insert(collision)", repo.Imports.Insert(ctx, job, importBatch(3)), models.AlreadyExists)
+	if got, _ := repo.Imports.Get(ctx, job.ID); got.Records != 3 || got.Failed != 1 {
+		t.Errorf("Get() after a failed Insert = %+v; want nothing saved", got)
+	}
+
+	if err := repo.Imports.Insert(ctx, job, &models.ImportBatch{Records: 1, Line: 5, Errors: []models.ImportError{{Line: 5, Field: "email", Message: "invalid"}}}); err != nil {
+		t.Fatalf("Insert(errors only) error = %v", err)
+	}
+	errs, err := repo.Imports.Errors(ctx, job.ID)
+	if err != nil || len(errs) != 2 || errs[0].Line != 3 || errs[1].Field != "email" {
+		t.Errorf("Errors() = %+v, %v; want lines 3 and 5", errs, err)
+	}
+	if err := repo.Imports.Complete(ctx, job); err != nil || job.Status != models.ImportCompleted || job.CompletedAt == nil {
+		t.Fatalf("Complete() = %+v, %v", job, err)
+	}
+	wantErr(t, "Insert(completed)", repo.Imports.Insert(ctx, job, &models.ImportBatch{Records: 1}), models.VersionConflict)
+	_, err = repo.Imports.Get(ctx, job.ID+1)
+	wantErr(t, "Get(unknown)", err, models.NotFound)
+	_, err = repo.Imports.Errors(ctx, job.ID+1)
+	wantErr(t, "Errors(unknown)", err, models.NotFound)
+}
+
+func testImportDryRun(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	job := &models.ImportJob{Format: models.ImportNDJSON, DryRun: true}
+	if err := repo.Imports.Create(ctx, job); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if job.AdminID != nil || !job.DryRun {
+		t.Fatalf("Create() = %+v; want a dry run without an admin", job)
+	}
+	if err := repo.Imports.Insert(ctx, job, importBatch(3)); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if job.Users != 1 || job.Profiles != 2 || job.Failed != 1 {
+		t.Errorf("Insert() job = %+v; want what would have been created", job)
+	}
+	if _, err := repo.Users.GetByEmail(ctx, "ravi@example.com"); !errors.Is(err, models.NotFound) {
+		t.Errorf("GetByEmail() after a dry run error = %v; want NotFound", err)
+	}
+	if errs, _ := repo.Imports.Errors(ctx, job.ID); len(errs) != 1 {
+		t.Errorf("Errors() = %+v; want the dry run's error", errs)
+	}
+}
+
+// readyExport creates an export for the user and finishes it, ready until expires.
+func readyExport(t *testing.T, repo *repository.Repository, userID int, expires time.Time) *models.Export {
+	t.Helper()
+	ctx := context.Background()
+	e := &models.Export{UserID: userID}
+	if err := repo.Exports.Create(ctx, e); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	e.Status = models.ExportReady
+	e.BlobKey = fmt.Sprintf("exports/%d/%d", userID, e.ID)
+	e.DataKey = "wrapped"
+	e.Size = 42
+	e.ExpiresAt = &expires
+	if err := repo.Exports.Finish(ctx, e); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	return e
+}
+
+func testExportLifecycle(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	e := &models.Export{UserID: u.ID}
+	if err := repo.Exports.Create(ctx, e); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if e.ID == 0 || e.Status != models.ExportPending || e.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %+v; want a pending export", e)
+	}
+	err := repo.Exports.Create(ctx, &models.Export{UserID: u.ID})
+	wantErr(t, "Create(second pending)", err, models.AlreadyExists)
+	err = repo.Exports.Create(ctx, &models.Export{UserID: u.ID + 100})
+	wantErr(t, "Create(unknown user)", err, models.NotFound)
+
+	_, err = repo.Exports.Download(ctx, u.ID, e.ID, time.Now())
+	wantErr(t, "Download(pending)", err, models.NotFound)
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	e.Status, e.BlobKey, e.DataKey, e.Size, e.ExpiresAt = models.ExportReady, "exports/1/a", "wrapped", 42, &expires
+	if err := repo.Exports.Finish(ctx, e); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if e.Status != models.ExportReady || e.CompletedAt == nil || !e.ExpiresAt.Equal(expires) {
+		t.Fatalf("Finish() = %+v; want a ready export", e)
+	}
+	err = repo.Exports.Finish(ctx, e)
+	wantErr(t, "Finish(ready)", err, models.NotFound)
+
+	other := newUser(t, repo, "ravi")
+	_, err = repo.Exports.Get(ctx, other.ID, e.ID)
+	wantErr(t, "Get(another user's)", err, models.NotFound)
+	_, err = repo.Exports.Download(ctx, other.ID, e.ID, time.Now())
+	wantErr(t, "Download(another user's)", err, models.NotFound)
+	_, err = repo.Exports.Download(ctx, u.ID, e.ID, expires.Add(time.Second))
+	wantErr(t, "Download(expired)", err, models.NotFound)
+
+	got, err := repo.Exports.Download(ctx, u.ID, e.ID, time.Now())
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if got.Status != models.ExportDownloaded || got.DownloadedAt == nil || got.BlobKey != "exports/1/a" || got.DataKey != "wrapped" {
+		t.Errorf("Download() = %+v; want the downloaded export with its blob", got)
+	}
+	_, err = repo.Exports.Download(ctx, u.ID, e.ID, time.Now())
+	wantErr(t, "Download(twice)", err, models.NotFound)
+
+	// a second export can start once the first is done
+	if err := repo.Exports.Create(ctx, &models.Export{UserID: u.ID}); err != nil {
+		t.Errorf("Create() after the first finished error = %v", err)
+	}
+	if err := repo.Users.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Users.Delete() error = %v", err)
+	}
+	_, err = repo.Exports.Get(ctx, u.ID, e.ID)
+	wantErr(t, "Get(deleted user)", err, models.NotFound)
+}
+
+func testExportExpireAndAbandon(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	now := time.Now()
+	asha := newUser(t, repo, "asha")
+	ravi := newUser(t, repo, "ravi")
+	meena := newUser(t, repo, "meena")
+	stale := readyExport(t, repo, asha.ID, now.Add(-time.Minute))
+	fresh := readyExport(t, repo, ravi.ID, now.Add(time.Hour))
+	orphan := readyExport(t, repo, meena.ID, now.Add(time.Hour))
+	if err := repo.Users.Delete(ctx, meena.ID); err != nil {
+		t.Fatalf("Users.Delete() error = %v", err)
+	}
+	pending := &models.Export{UserID: ravi.ID}
+	if err := repo.Exports.Create(ctx, pending); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	expired, err := repo.Exports.Expire(ctx, now)
+	if err != nil {
+		t.Fatalf("Expire() error = %v", err)
+	}
+	keys := map[string]bool{}
+	for _, e := range expired {
+		keys[e.BlobKey] = true
+	}
+	if len(expired) != 2 || !keys[stale.BlobKey] || !keys[orphan.BlobKey] {
+		t.Errorf("Expire() = %+v; want the expired export and the deleted user's", expired)
+	}
+	if again, _ := repo.Exports.Expire(ctx, now); len(again) != 0 {
+		t.Errorf("Expire() twice = %+v; want none", again)
+	}
+	if got, err := repo.Exports.Get(ctx, asha.ID, stale.ID); err != nil || got.Status != models.ExportExpired {
+		t.Errorf("Get(expired) = %+v, %v; want status expired", got, err)
+	}
+	if got, err := repo.Exports.Get(ctx, ravi.ID, fresh.ID); err != nil || got.Status != models.ExportReady {
+		t.Errorf("Get(fresh) = %+v, %v; want status ready", got, err)
+	}
+
+	if n, err := repo.Exports.Abandon(ctx, now.Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Abandon(before it started) = %d, %v; want 0", n, err)
+	}
+	if n, err := repo.Exports.Abandon(ctx, now.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Abandon() = %d, %v; want 1", n, err)
+	}
+	if got, err := repo.Exports.Get(ctx, ravi.ID, pending.ID); err != nil || got.Status != models.ExportFailed || got.CompletedAt == nil {
+		t.Errorf("Get(abandoned) = %+v, %v; want status failed", got, err)
+	}
+}
+
+func testConsentGrantAndWithdraw(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	_, err := repo.Consents.Current(ctx, u.ID, "kyc")
+	wantErr(t, "Current(never given)", err, models.NotFound)
+	_, err = repo.Consents.Withdraw(ctx, u.ID, "kyc")
+	wantErr(t, "Withdraw(never given)", err, models.NotFound)
+	err = repo.Consents.Grant(ctx, &models.Consent{UserID: u.ID + 100, Purpose: "kyc", NoticeVersion: 1})
+	wantErr(t, "Grant(unknown user)", err, models.NotFound)
+
+	first := &models.Consent{UserID: u.ID, Purpose: "kyc", NoticeVersion: 1}
+	if err := repo.Consents.Grant(ctx, first); err != nil {
+		t.Fatalf("Grant() error = %v", err)
+	}
+	if first.ID == 0 || first.GrantedAt.IsZero() || first.WithdrawnAt != nil {
+		t.Fatalf("Grant() = %+v; want a current consent", first)
+	}
+	marketing := &models.Consent{UserID: u.ID, Purpose: "marketing", NoticeVersion: 1}
+	if err := repo.Consents.Grant(ctx, marketing); err != nil {
+		t.Fatalf("Grant(marketing) error = %v", err)
+	}
+
+	// consenting to a new notice ends the old consent
+	second := &models.Consent{UserID: u.ID, Purpose: "kyc", NoticeVersion: 2}
+	if err := repo.Consents.Grant(ctx, second); err != nil {
+		t.Fatalf("Grant(version 2) error = %v", err)
+	}
+	got, err := repo.Consents.Current(ctx, u.ID, "kyc")
+	if err != nil || got.ID != second.ID || got.NoticeVersion != 2 {
+		t.Errorf("Current() = %+v, %v; want the version 2 consent", got, err)
+	}
+	ended, err := repo.Consents.Get(ctx, u.ID, first.ID)
+	if err != nil || ended.WithdrawnAt == nil || ended.WithdrawnAt.Before(ended.GrantedAt) {
+		t.Errorf("Get(first) = %+v, %v; want it ended", ended, err)
+	}
+	other := newUser(t, repo, "ravi")
+	_, err = repo.Consents.Get(ctx, other.ID, first.ID)
+	wantErr(t, "Get(another user's)", err, models.NotFound)
+
+	withdrawn, err := repo.Consents.Withdraw(ctx, u.ID, "kyc")
+	if err != nil || withdrawn.ID != second.ID || withdrawn.WithdrawnAt == nil {
+		t.Fatalf("Withdraw() = %+v, %v; want the version 2 consent withdrawn", withdrawn, err)
+	}
+	_, err = repo.Consents.Current(ctx, u.ID, "kyc")
+	wantErr(t, "Current(withdrawn)", err, models.NotFound)
+	if got, err := repo.Consents.Current(ctx, u.ID, "marketing"); err != nil || got.ID != marketing.ID {
+		t.Errorf("Current(marketing) = %+v, %v; want it untouched", got, err)
+	}
+
+	list, err := repo.Consents.List(ctx, u.ID)
+	if err != nil || len(list) != 3 || list[0].ID != first.ID || list[1].ID != marketing.ID || list[2].ID != second.ID {
+		t.Errorf("List() = %+v, %v; want all three, oldest first", list, err)
+	}
+	if list, _ := repo.Consents.List(ctx, other.ID); len(list) != 0 {
+		t.Errorf("List(another user) = %+v; want none", list)
+	}
+}
+
+func testShareLinkLifecycle(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	err := repo.ShareLinks.Create(ctx, &models.ShareLink{UserID: u.ID, ProfileID: p.ID + 100, Fields: []string{models.FieldFullName}, ExpiresAt: expires})
+	wantErr(t, "Create(unknown profile)", err, models.NotFound)
+	_, err = repo.ShareLinks.Get(ctx, 1000)
+	wantErr(t, "Get(unknown)", err, models.NotFound)
+
+	l := &models.ShareLink{UserID: u.ID, ProfileID: p.ID, Fields: []string{models.FieldFullName, models.FieldAadhaarNumber}, PINHash: "pin", ExpiresAt: expires}
+	if err := repo.ShareLinks.Create(ctx, l); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if l.ID == 0 || l.CreatedAt.IsZero() || !l.ExpiresAt.Equal(expires) || len(l.Fields) != 2 || l.PINHash != "pin" {
+		t.Fatalf("Create() = %+v", l)
+	}
+	open := &models.ShareLink{UserID: u.ID, ProfileID: p.ID, Fields: []string{models.ShareYearOfBirth}, ExpiresAt: expires}
+	if err := repo.ShareLinks.Create(ctx, open); err != nil {
+		t.Fatalf("Create(without a PIN) error = %v", err)
+	}
+
+	at := time.Now().UTC().Truncate(time.Second)
+	for range 2 {
+		if err := repo.ShareLinks.Accessed(ctx, l.ID, at); err != nil {
+			t.Fatalf("Accessed() error = %v", err)
+		}
+	}
+	for want := 1; want <= 3; want++ {
+		if n, err := repo.ShareLinks.TakePINAttempt(ctx, l.ID, 3); err != nil || n != want {
+			t.Errorf("TakePINAttempt() = %d, %v; want %d", n, err, want)
+		}
+	}
+	_, err = repo.ShareLinks.TakePINAttempt(ctx, l.ID, 3)
+	wantErr(t, "TakePINAttempt(past the limit)", err, models.NotFound)
+	for range 2 {
+		if err := repo.ShareLinks.ReturnPINAttempt(ctx, l.ID); err != nil {
+			t.Fatalf("ReturnPINAttempt() error = %v", err)
+		}
+	}
+	got, err := repo.ShareLinks.Get(ctx, l.ID)
+	if err != nil || got.Accesses != 2 || got.LastAccessedAt == nil || !got.LastAccessedAt.Equal(at) || got.PINFailures != 1 {
+		t.Errorf("Get() = %+v, %v; want two accesses and a PIN failure", got, err)
+	}
+
+	list, err := repo.ShareLinks.List(ctx, u.ID, p.ID)
+	if err != nil || len(list) != 2 || list[0].ID != open.ID || list[1].ID != l.ID {
+		t.Errorf("List() = %+v, %v; want both, newest first", list, err)
+	}
+	other := newUser(t, repo, "ravi")
+	if list, _ := repo.ShareLinks.List(ctx, other.ID, p.ID); len(list) != 0 {
+		t.Errorf("List(another user) = %+v; want none", list)
+	}
+	_, err = repo.ShareLinks.Revoke(ctx, other.ID, l.ID)
+	wantErr(t, "Revoke(another user's)", err, models.NotFound)
+	revoked, err := repo.ShareLinks.Revoke(ctx, u.ID, l.ID)
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("Revoke() = %+v, %v; want it revoked", revoked, err)
+	}
+	_, err = repo.ShareLinks.Revoke(ctx, u.ID, l.ID)
+	wantErr(t, "Revoke(twice)", err, models.NotFound)
+
+	if n, err := repo.ShareLinks.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Purge(an hour ago) = %d, %v; want 0", n, err)
+	}
+	if n, err := repo.ShareLinks.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("Purge() = %d, %v; want the revoked link", n, err)
+	}
+	if _, err := repo.ShareLinks.Get(ctx, open.ID); err != nil {
+		t.Errorf("Get(live link) after Purge() error = %v", err)
+	}
+	if n, err := repo.ShareLinks.Purge(ctx, expires.Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("Purge(after expiry) = %d, %v; want 1", n, err)
+	}
+}
+
+func testCredentialLifecycle(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	child := profileFor(u.ID, 2)
+	child.Relationship = models.RelationshipChild
+	if err := repo.Profiles.Create(ctx, child); err != nil {
+		t.Fatalf("Profiles.Create(child) error = %v", err)
+	}
+	expires := time.Now().AddDate(1, 0, 0).UTC().Truncate(time.Second)
+
+	err := repo.Credentials.Create(ctx, &models.Credential{UserID: u.ID, ProfileID: p.ID + 100, Fields: []string{models.FieldFullName}, ExpiresAt: expires})
+	wantErr(t, "Create(unknown profile)", err, models.NotFound)
+	_, err = repo.Credentials.Get(ctx, 1000)
+	wantErr(t, "Get(unknown)", err, models.NotFound)
+
+	c := &models.Credential{UserID: u.ID, ProfileID: p.ID, Fields: []string{models.FieldFullName, models.ShareYearOfBirth}, ExpiresAt: expires}
+	if err := repo.Credentials.Create(ctx, c); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if c.ID == 0 || c.IssuedAt.IsZero() || !c.ExpiresAt.Equal(expires) || len(c.Fields) != 2 || c.RevokedAt != nil {
+		t.Fatalf("Create() = %+v", c)
+	}
+	second := &models.Credential{UserID: u.ID, ProfileID: p.ID, Fields: []string{models.FieldFullName}, ExpiresAt: expires}
+	forChild := &models.Credential{UserID: u.ID, ProfileID: child.ID, Fields: []string{models.FieldFullName}, ExpiresAt: expires}
+	for _, cred := range []*models.Credential{second, forChild} {
+		if err := repo.Credentials.Create(ctx, cred); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	list, err := repo.Credentials.List(ctx, u.ID, p.ID)
+	if err != nil || len(list) != 2 || list[0].ID != second.ID || list[1].ID != c.ID {
+		t.Errorf("List() = %+v, %v; want both of the profile's, newest first", list, err)
+	}
+	other := newUser(t, repo, "ravi")
+	if list, _ := repo.Credentials.List(ctx, other.ID, p.ID); len(list) != 0 {
+		t.Errorf("List(another user) = %+v; want none", list)
+	}
+	_, err = repo.Credentials.Revoke(ctx, other.ID, c.ID)
+	wantErr(t, "Revoke(another user's)", err, models.NotFound)
+	revoked, err := repo.Credentials.Revoke(ctx, u.ID, c.ID)
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("Revoke() = %+v, %v; want it revoked", revoked, err)
+	}
+	_, err = repo.Credentials.Revoke(ctx, u.ID, c.ID)
+	wantErr(t, "Revoke(twice)", err, models.NotFound)
+
+	if n, err := repo.Credentials.RevokeProfile(ctx, p.ID); err != nil || n != 1 {
+		t.Errorf("RevokeProfile() = %d, %v; want the one still valid", n, err)
+	}
+	if ids, err := repo.Credentials.Revoked(ctx, 1, forChild.ID); err != nil || !slices.Equal(ids, []int{c.ID, second.ID}) {
+		t.Errorf("Revoked() = %v, %v; want %v", ids, err, []int{c.ID, second.ID})
+	}
+	if ids, _ := repo.Credentials.Revoked(ctx, second.ID+1, forChild.ID+10); len(ids) != 0 {
+		t.Errorf("Revoked(past them) = %v; want none", ids)
+	}
+
+	// a purged account leaves its credentials behind, revoked
+	if err := repo.Users.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Users.Delete() error = %v", err)
+	}
+	if _, err := repo.Users.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Users.Purge() error = %v", err)
+	}
+	got, err := repo.Credentials.Get(ctx, forChild.ID)
+	if err != nil || got.UserID != 0 || got.ProfileID != 0 || got.RevokedAt != nil {
+		t.Errorf("Get() after the purge = %+v, %v; want it kept without its references", got, err)
+	}
+	if ids, _ := repo.Credentials.Revoked(ctx, 1, forChild.ID); len(ids) != 3 {
+		t.Errorf("Revoked() after the purge = %v; want all three", ids)
+	}
+}
+
+func testAuditChain(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	for i := range 3 {
+		rec := &models.AuditRecord{UserID: i + 1, Action: "test", Details: "{}"}
+		if err := repo.Audit.Append(ctx, rec); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if rec.Seq != int64(i+1) || rec.Hash == "" {
+			t.Fatalf("Append() sealed seq %d hash %q; want seq %d", rec.Seq, rec.Hash, i+1)
+		}
+	}
+
+	records, err := repo.Audit.List(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("List() returned %d records; want 3", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].PrevHash != records[i-1].Hash {
+			t.Errorf("record %d does not link to record %d", records[i].Seq, records[i-1].Seq)
+		}
+	}
+
+	page, err := repo.Audit.List(ctx, 1, 1)
+	if err != nil || len(page) != 1 || page[0].Seq != 2 {
+		t.Errorf("List(1, 1) = %v, %v; want record 2", page, err)
+	}
+	mine, err := repo.Audit.ForUser(ctx, 2, 0, 10)
+	if err != nil || len(mine) != 1 || mine[0].Seq != 2 {
+		t.Errorf("ForUser(2) = %v, %v; want record 2", mine, err)
+	}
+	if mine, _ := repo.Audit.ForUser(ctx, 2, 2, 10); len(mine) != 0 {
+		t.Errorf("ForUser(2) after seq 2 = %v; want none", mine)
+	}
+}
+
+func testAuditCheckpoints(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	created := time.Now().UTC().Truncate(time.Second)
+	for _, seq := range []int64{2, 1} {
+		cp := models.AuditCheckpoint{Seq: seq, Hash: fmt.Sprintf("%064d", seq), Signature: "sig", CreatedAt: created}
+		if err := repo.Audit.CreateCheckpoint(ctx, cp); err != nil {
+			t.Fatalf("CreateCheckpoint() error = %v", err)
+		}
+	}
+	got, err := repo.Audit.Checkpoints(ctx)
+	if err != nil {
+		t.Fatalf("Checkpoints() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Seq != 1 || got[1].Seq != 2 || !got[0].CreatedAt.Equal(created) {
+		t.Errorf("Checkpoints() = %+v; want seq 1 and 2 in order", got)
+	}
+}
+
+func testSessionRevoke(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	at, err := repo.Sessions.RevokedAt(ctx, 1)
+	if err != nil || !at.IsZero() {
+		t.Fatalf("RevokedAt(never revoked) = %v, %v; want zero time", at, err)
+	}
+	if err := repo.Sessions.RevokeAll(ctx, 1); err != nil {
+		t.Fatalf("RevokeAll() error = %v", err)
+	}
+	at, err = repo.Sessions.RevokedAt(ctx, 1)
+	if err != nil || at.IsZero() {
+		t.Errorf("RevokedAt(revoked) = %v, %v; want a time", at, err)
+	}
+}
+
+var errAbort = errors.New("abort")
+
+func testTxCommit(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	var u *models.User
+	err := repo.WithTx(ctx, func(tx *repository.Repository) error {
+		u = newUser(t, tx, "asha")
+		newProfile(t, tx, u.ID, 1)
+		return tx.Audit.Append(ctx, &models.AuditRecord{UserID: u.ID, Action: "test", Details: "{}"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	if _, err := repo.Profiles.GetByUserID(ctx, u.ID); err != nil {
+		t.Errorf("GetByUserID() after commit error = %v", err)
+	}
+	if records, err := repo.Audit.List(ctx, 0, 10); err != nil || len(records) != 1 {
+		t.Errorf("Audit.List() after commit = %d records, %v; want 1", len(records), err)
+	}
+}
+
+func testTxRollback(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	err := repo.WithTx(ctx, func(tx *repository.Repository) error {
+		u := newUser(t, tx, "asha")
+		if _, err := tx.Users.GetByID(ctx, u.ID); err != nil {
+			t.Errorf("GetByID() inside the transaction error = %v", err)
+		}
+		return errAbort
+	})
+	wantErr(t, "WithTx()", err, errAbort)
+
+	_, err = repo.Users.GetByEmail(ctx, "asha@example.com")
+	wantErr(t, "GetByEmail() after rollback", err, models.NotFound)
+	// the email is free again
+	newUser(t, repo, "asha")
+}
+
+func testTxPanic(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx() swallowed the panic")
+			}
+		}()
+		repo.WithTx(ctx, func(tx *repository.Repository) error {
+			newUser(t, tx, "asha")
+			panic("boom")
+		})
+	}()
+
+	_, err := repo.Users.GetByEmail(ctx, "asha@example.com")
+	wantErr(t, "GetByEmail() after panic", err, models.NotFound)
+}
+
+func testTxNestedRollback(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	err := repo.WithTx(ctx, func(tx *repository.Repository) error {
+		newUser(t, tx, "asha")
+
+		err := tx.WithTx(ctx, func(inner *repository.Repository) error {
+			newUser(t, inner, "ravi")
+			return errAbort
+		})
+		wantErr(t, "nested WithTx()", err, errAbort)
+
+		// a failed statement in a savepoint leaves the outer transaction usable
+		err = tx.WithTx(ctx, func(inner *repository.Repository) error {
+			return inner.Users.Create(ctx, &models.User{Email: "asha@example.com", Username: "dup", PasswordHash: "hash"})
+		})
+		wantErr(t, "nested Create(duplicate)", err, models.AlreadyExists)
+
+		return tx.WithTx(ctx, func(inner *repository.Repository) error {
+			newUser(t, inner, "meera")
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+
+	for name, want := range map[string]error{"asha": nil, "ravi": models.NotFound, "meera": nil} {
+		_, err := repo.Users.GetByEmail(ctx, name+"@example.com")
+		if !errors.Is(err, want) {
+			t.Errorf("GetByEmail(%s) error = %v; want %v", name, err, want)
+		}
+	}
+}
+
+func testEKYCCreateList(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	generated := time.Date(2019, 3, 5, 12, 34, 56, 0, time.UTC)
+	first := &models.EKYCVerification{ProfileID: p.ID, Source: models.EKYCSourceXML, ReferenceHash: "ref-1", DocumentHash: "doc-1", GeneratedAt: generated, NameMatch: true}
+	if err := repo.EKYC.Create(ctx, first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if first.ID == 0 || first.CreatedAt.IsZero() {
+		t.Fatalf("Create() left ID %d, CreatedAt %v", first.ID, first.CreatedAt)
+	}
+	second := &models.EKYCVerification{ProfileID: p.ID, Source: models.EKYCSourceQR, ReferenceHash: "ref-2", DocumentHash: "doc-2", MobileHash: "m", GeneratedAt: generated, Verified: true}
+	if err := repo.EKYC.Create(ctx, second); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	wantErr(t, "Create(unknown profile)", repo.EKYC.Create(ctx, &models.EKYCVerification{ProfileID: 4242, Source: models.EKYCSourceXML, GeneratedAt: generated}), models.NotFound)
+	if err := repo.EKYC.Create(ctx, &models.EKYCVerification{ProfileID: p.ID, Source: "photocopy", GeneratedAt: generated}); err == nil {
+		t.Errorf("Create(invalid source) = nil; want error")
+	}
+
+	list, err := repo.EKYC.List(ctx, p.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("List() = %+v, %v; want two verifications", list, err)
+	}
+	if list[0].ID != second.ID || list[0].Source != models.EKYCSourceQR || !list[0].Verified || list[0].MobileHash != "m" || !list[1].NameMatch || !list[1].GeneratedAt.Equal(generated) {
+		t.Errorf("List() = %+v; want the second verification, then the first", list)
+	}
+
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	if _, err := repo.Profiles.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Profiles.Purge() error = %v", err)
+	}
+	if list, err := repo.EKYC.List(ctx, p.ID); err != nil || len(list) != 0 {
+		t.Errorf("List() after purge = %d verifications, %v; want none", len(list), err)
+	}
+}
+
+func testKYCSaveVersioning(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	reviewer := newUser(t, repo, "ravi")
+	p := newProfile(t, repo, u.ID, 1)
+
+	_, err := repo.KYC.Get(ctx, p.ID)
+	wantErr(t, "Get(no row)", err, models.NotFound)
+	submitted := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	k := &models.KYC{ProfileID: p.ID, Status: models.KYCSubmitted, SubmittedAt: &submitted}
+	if err := repo.KYC.Save(ctx, k); err != nil {
+		t.Fatalf("Save(new) error = %v", err)
+	}
+	if k.Version != 1 || k.UpdatedAt.IsZero() {
+		t.Fatalf("Save(new) left Version %d, UpdatedAt %v", k.Version, k.UpdatedAt)
+	}
+	wantErr(t, "Save(second insert)", repo.KYC.Save(ctx, &models.KYC{ProfileID: p.ID, Status: models.KYCSubmitted}), models.VersionConflict)
+	wantErr(t, "Save(unknown profile)", repo.KYC.Save(ctx, &models.KYC{ProfileID: 4242, Status: models.KYCSubmitted}), models.NotFound)
+	if err := repo.KYC.Save(ctx, &models.KYC{ProfileID: p.ID, Status: "approved", Version: 1}); err == nil {
+		t.Errorf("Save(invalid status) = nil; want error")
+	}
+
+	claimed := submitted.Add(time.Hour)
+	k.Status, k.ReviewerID, k.ClaimedAt = models.KYCUnderReview, &reviewer.ID, &claimed
+	if err := repo.KYC.Save(ctx, k); err != nil {
+		t.Fatalf("Save(claim) error = %v", err)
+	}
+	stale := *k
+	stale.Version = 1
+	wantErr(t, "Save(stale version)", repo.KYC.Save(ctx, &stale), models.VersionConflict)
+
+	got, err := repo.KYC.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.UserID != u.ID || got.Status != models.KYCUnderReview || got.Version != 2 ||
+		got.ReviewerID == nil || *got.ReviewerID != reviewer.ID || !got.ClaimedAt.Equal(claimed) ||
+		!got.SubmittedAt.Equal(submitted) || got.VerifiedAt != nil {
+		t.Errorf("Get() = %+v", got)
+	}
+	err = repo.WithTx(ctx, func(tx *repository.Repository) error {
+		locked, err := tx.KYC.GetForUpdate(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		if locked.Status != got.Status || locked.Version != got.Version {
+			t.Errorf("GetForUpdate() = %+v; want %+v", locked, got)
+		}
+		_, err = tx.KYC.GetForUpdate(ctx, 4242)
+		wantErr(t, "GetForUpdate(unknown profile)", err, models.NotFound)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx(GetForUpdate) error = %v", err)
+	}
+
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	_, err = repo.KYC.Get(ctx, p.ID)
+	wantErr(t, "Get(deleted profile)", err, models.NotFound)
+}
+
+func testKYCQueueAndExpire(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	n := 0
+	save := func(status string, at time.Time) *models.Profile {
+		t.Helper()
+		n++
+		p := newProfile(t, repo, newUser(t, repo, fmt.Sprintf("user%d", n)).ID, n)
+		k := &models.KYC{ProfileID: p.ID, Status: status, SubmittedAt: &at}
+		if status == models.KYCVerified {
+			k.VerifiedAt = &at
+		}
+		if err := repo.KYC.Save(ctx, k); err != nil {
+			t.Fatalf("Save(%s) error = %v", status, err)
+		}
+		return p
+	}
+	later := save(models.KYCSubmitted, base.Add(2*time.Hour))
+	earlier := save(models.KYCUnderReview, base.Add(time.Hour))
+	save(models.KYCRejected, base)
+	oldVerified := save(models.KYCVerified, base)
+	newVerified := save(models.KYCVerified, base.Add(48*time.Hour))
+
+	queue, err := repo.KYC.Queue(ctx, 10)
+	if err != nil || len(queue) != 2 {
+		t.Fatalf("Queue() = %+v, %v; want two profiles", queue, err)
+	}
+	if queue[0].ProfileID != earlier.ID || queue[1].ProfileID != later.ID || queue[0].UserID != earlier.UserID {
+		t.Errorf("Queue() = %+v; want the earlier submission first", queue)
+	}
+	if queue, err := repo.KYC.Queue(ctx, 1); err != nil || len(queue) != 1 {
+		t.Errorf("Queue(1) = %d profiles, %v; want one", len(queue), err)
+	}
+
+	expired, err := repo.KYC.Expire(ctx, base.Add(24*time.Hour))
+	if err != nil || expired != 1 {
+		t.Fatalf("Expire() = %d, %v; want 1", expired, err)
+	}
+	if got, err := repo.KYC.Get(ctx, oldVerified.ID); err != nil || got.Status != models.KYCExpired || got.Version != 2 {
+		t.Errorf("Get(old verification) = %+v, %v; want expired", got, err)
+	}
+	if got, err := repo.KYC.Get(ctx, newVerified.ID); err != nil || got.Status != models.KYCVerified {
+		t.Errorf("Get(recent verification) = %+v, %v; want verified", got, err)
+	}
+}
+
+func attachmentFor(profileID int, key string) *models.Attachment {
+	return &models.Attachment{
+		ProfileID:   profileID,
+		Kind:        models.AttachmentAddressProof,
+		FileName:    "bill.pdf",
+		ContentType: "application/pdf",
+		Size:        1024,
+		SHA256:      fmt.Sprintf("%064x", 171),
+		BlobKey:     "attachments/" + key,
+		DataKey:     "wrapped-" + key,
+	}
+}
+
+func testAttachmentCRUD(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	a := attachmentFor(p.ID, "a")
+	if err := repo.Attachments.Create(ctx, a); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if a.ID == 0 || a.CreatedAt.IsZero() {
+		t.Fatalf("Create() did not fill in ID and CreatedAt: %+v", a)
+	}
+	if err := repo.Attachments.Create(ctx, attachmentFor(p.ID, "b")); err != nil {
+		t.Fatalf("Create(second) error = %v", err)
+	}
+	wantErr(t, "Create(unknown profile)", repo.Attachments.Create(ctx, attachmentFor(p.ID+100, "c")), models.NotFound)
+
+	got, err := repo.Attachments.Get(ctx, p.ID, a.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.BlobKey != a.BlobKey || got.DataKey != a.DataKey || got.Size != a.Size || got.SHA256 != a.SHA256 {
+		t.Errorf("Get() = %+v; want %+v", got, a)
+	}
+	other := newProfile(t, repo, newUser(t, repo, "ravi").ID, 2)
+	_, err = repo.Attachments.Get(ctx, other.ID, a.ID)
+	wantErr(t, "Get(other profile)", err, models.NotFound)
+
+	list, err := repo.Attachments.List(ctx, p.ID)
+	if err != nil || len(list) != 2 || list[0].ID != a.ID {
+		t.Fatalf("List() = %+v, %v; want both, oldest first", list, err)
+	}
+
+	wantErr(t, "Delete(other profile)", repo.Attachments.Delete(ctx, other.ID, a.ID), models.NotFound)
+	if err := repo.Attachments.Delete(ctx, p.ID, a.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err = repo.Attachments.Get(ctx, p.ID, a.ID)
+	wantErr(t, "Get(deleted)", err, models.NotFound)
+	wantErr(t, "Delete(deleted)", repo.Attachments.Delete(ctx, p.ID, a.ID), models.NotFound)
+}
+
+func testAttachmentPurgeable(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+	a := attachmentFor(p.ID, "a")
+	if err := repo.Attachments.Create(ctx, a); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	live := newProfile(t, repo, newUser(t, repo, "ravi").ID, 2)
+	if err := repo.Attachments.Create(ctx, attachmentFor(live.ID, "b")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	cutoff := time.Now().Add(time.Hour)
+	if list, err := repo.Attachments.Purgeable(ctx, cutoff); err != nil || len(list) != 0 {
+		t.Fatalf("Purgeable() with nothing deleted = %d, %v; want none", len(list), err)
+	}
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	_, err := repo.Attachments.Get(ctx, p.ID, a.ID)
+	wantErr(t, "Get(deleted profile)", err, models.NotFound)
+
+	if list, err := repo.Attachments.Purgeable(ctx, time.Now().Add(-time.Hour)); err != nil || len(list) != 0 {
+		t.Errorf("Purgeable(before the deletion) = %d, %v; want none", len(list), err)
+	}
+	list, err := repo.Attachments.Purgeable(ctx, cutoff)
+	if err != nil || len(list) != 1 || list[0].BlobKey != a.BlobKey {
+		t.Fatalf("Purgeable() = %+v, %v; want the deleted profile's attachment", list, err)
+	}
+	if _, err := repo.Profiles.Purge(ctx, cutoff); err != nil {
+		t.Fatalf("Profiles.Purge() error = %v", err)
+	}
+	if list, err := repo.Attachments.List(ctx, p.ID); err != nil || len(list) != 0 {
+		t.Errorf("List() after purge = %d, %v; want none", len(list), err)
+	}
+}
+
+func testPhotoPutGetDelete(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, repo, "asha")
+	p := newProfile(t, repo, u.ID, 1)
+
+	_, err := repo.Photos.Get(ctx, p.ID)
+	wantErr(t, "Get(no photo)", err, models.NotFound)
+	wantErr(t, "Put(unknown profile)", repo.Photos.Put(ctx, &models.Photo{ProfileID: p.ID + 100, BlobPrefix: "photos/x", DataKey: "k"}), models.NotFound)
+
+	first := &models.Photo{ProfileID: p.ID, BlobPrefix: "photos/1/a", DataKey: "key-a"}
+	if err := repo.Photos.Put(ctx, first); err != nil || first.UpdatedAt.IsZero() {
+		t.Fatalf("Put() = %v, UpdatedAt %v", err, first.UpdatedAt)
+	}
+	// a second upload replaces the first
+	if err := repo.Photos.Put(ctx, &models.Photo{ProfileID: p.ID, BlobPrefix: "photos/1/b", DataKey: "key-b"}); err != nil {
+		t.Fatalf("Put(replacement) error = %v", err)
+	}
+	got, err := repo.Photos.Get(ctx, p.ID)
+	if err != nil || got.BlobPrefix != "photos/1/b" || got.DataKey != "key-b" {
+		t.Fatalf("Get() = %+v, %v; want the replacement", got, err)
+	}
+
+	if err := repo.Profiles.Delete(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Delete() error = %v", err)
+	}
+	_, err = repo.Photos.Get(ctx, p.ID)
+	wantErr(t, "Get(deleted profile)", err, models.NotFound)
+	cutoff := time.Now().Add(time.Hour)
+	if list, err := repo.Photos.Purgeable(ctx, cutoff); err != nil || len(list) != 1 || list[0].BlobPrefix != "photos/1/b" {
+		t.Errorf("Purgeable() = %+v, %v; want the deleted profile's photo", list, err)
+	}
+	if err := repo.Profiles.Restore(ctx, u.ID, p.ID); err != nil {
+		t.Fatalf("Profiles.Restore() error = %v", err)
+	}
+
+	if err := repo.Photos.Delete(ctx, p.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	wantErr(t, "Delete(again)", repo.Photos.Delete(ctx, p.ID), models.NotFound)
+	if list, err := repo.Photos.Purgeable(ctx, cutoff); err != nil || len(list) != 0 {
+		t.Errorf("Purgeable() after Delete = %+v, %v; want none", list, err)
+	}
+}
+
+// testTxOuterRepository checks that a call on the outer repository started
+// inside a transaction, which may have to wait for the transaction to end,
+// goes through once it has, and never sees the transaction half done.
+func testTxOuterRepository(t *testing.T, repo *repository.Repository) {
+	ctx := context.Background()
+	done := make(chan error, 1)
+	err := repo.WithTx(ctx, func(tx *repository.Repository) error {
+		u := newUser(t, tx, "asha")
+		newProfile(t, tx, u.ID, 1)
+		go func() {
+			u, err := repo.Users.GetByEmail(ctx, "asha@example.com")
+			if err == nil {
+				// the account was committed, so its profile was too
+				if _, err := repo.Profiles.GetByUserID(ctx, u.ID); err != nil {
+					done <- fmt.Errorf("profile of a committed account: %w", err)
+					return
+				}
+			}
+			done <- err
+		}()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		// NotFound if it ran before the commit
+		if err != nil && !errors.Is(err, models.NotFound) {
+			t.Errorf("outer repository error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("a call on the outer repository did not return after the transaction committed")
+	}
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AddressRepo struct {
+	db *db
+}
+
+// addressConflict reports whether another address of the same profile has
+// a's type, the UNIQUE (profile_id, type) constraint in postgres.
+func (d *db) addressConflict(a models.Address) bool {
+	for _, other := range d.addresses {
+		if other.ID != a.ID && other.ProfileID == a.ProfileID && other.Type == a.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedAddresses returns the addresses matching the predicate in id order.
+func (d *db) sortedAddresses(match func(a models.Address) bool) []models.Address {
+	out := []models.Address{}
+	for _, a := range d.addresses {
+		if match(a) {
+			out = append(out, a)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Address) int { return a.ID - b.ID })
+	return out
+}
+
+func checkAddressType(t string) error {
+	if !slices.Contains(models.AddressTypes, t) {
+		// the CHECK constraint on addresses.type
+		return fmt.Errorf("invalid address type %q", t)
+	}
+	return nil
+}
+
+func (r *AddressRepo) List(ctx context.Context, profileID int) ([]models.Address, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return r.db.sortedAddresses(func(a models.Address) bool { return a.ProfileID == profileID }), nil
+}
+
+func (r *AddressRepo) Create(ctx context.Context, address *models.Address) error {
+	if err := checkAddressType(address.Type); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	a := *address
+	a.ID = 0
+	if r.db.addressConflict(a) {
+		return models.AlreadyExists
+	}
+	// the foreign key only needs the row, soft-deleted profiles included
+	if _, ok := r.db.profiles[a.ProfileID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastAddressID++
+	a.ID = r.db.lastAddressID
+	a.CreatedAt = now()
+	a.UpdatedAt = a.CreatedAt
+	r.db.addresses[a.ID] = a
+
+	address.ID, address.CreatedAt, address.UpdatedAt = a.ID, a.CreatedAt, a.UpdatedAt
+	return nil
+}
+
+func (r *AddressRepo) Update(ctx context.Context, address *models.Address) error {
+	if err := checkAddressType(address.Type); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	current, ok := r.db.addresses[address.ID]
+	if !ok || current.ProfileID != address.ProfileID {
+		return models.NotFound
+	}
+	if r.db.addressConflict(*address) {
+		return models.AlreadyExists
+	}
+	a := *address
+	a.CreatedAt = current.CreatedAt
+	a.UpdatedAt = now()
+	r.db.addresses[a.ID] = a
+
+	address.CreatedAt, address.UpdatedAt = a.CreatedAt, a.UpdatedAt
+	return nil
+}
+
+func (r *AddressRepo) Delete(ctx context.Context, profileID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	a, ok := r.db.addresses[id]
+	if !ok || a.ProfileID != profileID {
+		return models.NotFound
+	}
+	delete(r.db.addresses, id)
+	return nil
+}
+
+func (r *AddressRepo) Unchecked(ctx context.Context, afterID, limit int) ([]models.Address, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := r.db.sortedAddresses(func(a models.Address) bool { return a.PinCode == "" && a.ID > afterID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
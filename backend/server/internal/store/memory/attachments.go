@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AttachmentRepo struct {
+	db *db
+}
+
+func sortAttachments(out []models.Attachment) {
+	slices.SortFunc(out, func(a, b models.Attachment) int { return a.ID - b.ID })
+}
+
+func (r *AttachmentRepo) List(ctx context.Context, profileID int) ([]models.Attachment, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.Attachment{}
+	for _, a := range r.db.attachments {
+		if a.ProfileID == profileID {
+			out = append(out, a)
+		}
+	}
+	sortAttachments(out)
+	return out, nil
+}
+
+func (r *AttachmentRepo) Get(ctx context.Context, profileID, id int) (*models.Attachment, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	a, ok := r.db.attachments[id]
+	if !ok || a.ProfileID != profileID {
+		return nil, models.NotFound
+	}
+	if p, ok := r.db.profiles[profileID]; !ok || p.DeletedAt != nil {
+		return nil, models.NotFound
+	}
+	return &a, nil
+}
+
+func (r *AttachmentRepo) Create(ctx context.Context, a *models.Attachment) error {
+	if !slices.Contains(models.AttachmentKinds, a.Kind) {
+		// the CHECK constraint on attachments.kind
+		return fmt.Errorf("invalid attachment kind %q", a.Kind)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.profiles[a.ProfileID]; !ok {
+		return models.NotFound
+	}
+	for _, other := range r.db.attachments {
+		if other.BlobKey == a.BlobKey {
+			// the UNIQUE constraint on attachments.blob_key
+			return fmt.Errorf("duplicate attachment blob key %q", a.BlobKey)
+		}
+	}
+	r.db.lastAttachmentID++
+	stored := *a
+	stored.ID = r.db.lastAttachmentID
+	stored.CreatedAt = now()
+	r.db.attachments[stored.ID] = stored
+
+	a.ID, a.CreatedAt = stored.ID, stored.CreatedAt
+	return nil
+}
+
+func (r *AttachmentRepo) Delete(ctx context.Context, profileID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	a, ok := r.db.attachments[id]
+	if !ok || a.ProfileID != profileID {
+		return models.NotFound
+	}
+	delete(r.db.attachments, id)
+	return nil
+}
+
+func (r *AttachmentRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Attachment, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.Attachment{}
+	for _, a := range r.db.attachments {
+		if p := r.db.profiles[a.ProfileID]; p.DeletedAt != nil && p.DeletedAt.Before(before) {
+			out = append(out, a)
+		}
+	}
+	sortAttachments(out)
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AuditRepo struct {
+	db *db
+}
+
+func (r *AuditRepo) Append(ctx context.Context, rec *models.AuditRecord) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var head *models.AuditRecord
+	if n := len(r.db.audit); n > 0 {
+		head = &r.db.audit[n-1]
+	}
+	audit.Seal(head, rec)
+	r.db.audit = append(r.db.audit, *rec)
+	return nil
+}
+
+func (r *AuditRepo) List(ctx context.Context, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var records []models.AuditRecord
+	for _, rec := range r.db.audit {
+		if len(records) == limit {
+			break
+		}
+		if rec.Seq > afterSeq {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (r *AuditRepo) ForUser(ctx context.Context, userID int, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var records []models.AuditRecord
+	for _, rec := range r.db.audit {
+		if len(records) == limit {
+			break
+		}
+		if rec.Seq > afterSeq && rec.UserID == userID {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (r *AuditRepo) CreateCheckpoint(ctx context.Context, cp models.AuditCheckpoint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, existing := range r.db.checkpoints {
+		if existing.Seq == cp.Seq {
+			// a primary key violation, which postgres does not map either
+			return fmt.Errorf("checkpoint for seq %d already exists", cp.Seq)
+		}
+	}
+	r.db.checkpoints = append(r.db.checkpoints, cp)
+	return nil
+}
+
+func (r *AuditRepo) Checkpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	checkpoints := slices.Clone(r.db.checkpoints)
+	slices.SortFunc(checkpoints, func(a, b models.AuditCheckpoint) int { return cmp.Compare(a.Seq, b.Seq) })
+	return checkpoints, nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ConsentRepo struct {
+	db *db
+}
+
+// currentConsent returns the ID of the user's current consent to purpose, or 0.
+func (d *db) currentConsent(userID int, purpose string) int {
+	for id, c := range d.consents {
+		if c.UserID == userID && c.Purpose == purpose && c.WithdrawnAt == nil {
+			return id
+		}
+	}
+	return 0
+}
+
+func (r *ConsentRepo) Grant(ctx context.Context, c *models.Consent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.users[c.UserID]; !ok {
+		return models.NotFound
+	}
+	at := now()
+	if id := r.db.currentConsent(c.UserID, c.Purpose); id != 0 {
+		ended := r.db.consents[id]
+		ended.WithdrawnAt = &at
+		r.db.consents[id] = ended
+	}
+	r.db.lastConsentID++
+	stored := models.Consent{
+		ID:            r.db.lastConsentID,
+		UserID:        c.UserID,
+		Purpose:       c.Purpose,
+		NoticeVersion: c.NoticeVersion,
+		GrantedAt:     at,
+	}
+	r.db.consents[stored.ID] = stored
+	*c = stored
+	return nil
+}
+
+func (r *ConsentRepo) Withdraw(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	id := r.db.currentConsent(userID, purpose)
+	if id == 0 {
+		return nil, models.NotFound
+	}
+	c := r.db.consents[id]
+	at := now()
+	c.WithdrawnAt = &at
+	r.db.consents[id] = c
+	return &c, nil
+}
+
+func (r *ConsentRepo) Current(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	id := r.db.currentConsent(userID, purpose)
+	if id == 0 {
+		return nil, models.NotFound
+	}
+	c := r.db.consents[id]
+	return &c, nil
+}
+
+func (r *ConsentRepo) Get(ctx context.Context, userID, id int) (*models.Consent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	c, ok := r.db.consents[id]
+	if !ok || c.UserID != userID {
+		return nil, models.NotFound
+	}
+	return &c, nil
+}
+
+func (r *ConsentRepo) List(ctx context.Context, userID int) ([]models.Consent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var consents []models.Consent
+	for id := 1; id <= r.db.lastConsentID; id++ {
+		if c, ok := r.db.consents[id]; ok && c.UserID == userID {
+			consents = append(consents, c)
+		}
+	}
+	return consents, nil
+}
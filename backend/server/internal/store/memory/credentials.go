@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type CredentialRepo struct {
+	db *db
+}
+
+func (r *CredentialRepo) Create(ctx context.Context, c *models.Credential) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.users[c.UserID]; !ok {
+		return models.NotFound
+	}
+	if _, ok := r.db.profiles[c.ProfileID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastCredentialID++
+	stored := models.Credential{
+		ID:        r.db.lastCredentialID,
+		UserID:    c.UserID,
+		ProfileID: c.ProfileID,
+		Fields:    slices.Clone(c.Fields),
+		IssuedAt:  now(),
+		ExpiresAt: c.ExpiresAt.UTC().Truncate(time.Microsecond),
+	}
+	r.db.credentials[stored.ID] = stored
+	*c = stored
+	return nil
+}
+
+func (r *CredentialRepo) Get(ctx context.Context, id int) (*models.Credential, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	c, ok := r.db.credentials[id]
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &c, nil
+}
+
+func (r *CredentialRepo) List(ctx context.Context, userID, profileID int) ([]models.Credential, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var credentials []models.Credential
+	for id := r.db.lastCredentialID; id > 0; id-- {
+		if c, ok := r.db.credentials[id]; ok && c.UserID == userID && c.ProfileID == profileID {
+			credentials = append(credentials, c)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *CredentialRepo) Revoke(ctx context.Context, userID, id int) (*models.Credential, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	c, ok := r.db.credentials[id]
+	if !ok || c.UserID != userID || c.RevokedAt != nil {
+		return nil, models.NotFound
+	}
+	at := now()
+	c.RevokedAt = &at
+	r.db.credentials[id] = c
+	return &c, nil
+}
+
+func (r *CredentialRepo) RevokeProfile(ctx context.Context, profileID int) (int64, error) {
+	return r.revokeWhere(func(c models.Credential) bool { return c.ProfileID == profileID })
+}
+
+func (r *CredentialRepo) RevokeUser(ctx context.Context, userID int) (int64, error) {
+	return r.revokeWhere(func(c models.Credential) bool { return c.UserID == userID })
+}
+
+func (r *CredentialRepo) revokeWhere(match func(models.Credential) bool) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	at := now()
+	var n int64
+	for id, c := range r.db.credentials {
+		if c.RevokedAt == nil && match(c) {
+			c.RevokedAt = &at
+			r.db.credentials[id] = c
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *CredentialRepo) Revoked(ctx context.Context, first, last int) ([]int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var ids []int
+	for id := first; id <= last && id <= r.db.lastCredentialID; id++ {
+		if c, ok := r.db.credentials[id]; ok && (c.RevokedAt != nil || c.ProfileID == 0) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type DocumentRepo struct {
+	db *db
+}
+
+// documentConflict reports whether another document breaks UNIQUE
+// (profile_id, type), or holds the number of doc on a live profile as
+// identity_documents_number_index_live_key forbids. doc is taken to be live.
+func (d *db) documentConflict(doc models.IdentityDocument) bool {
+	for _, other := range d.documents {
+		if other.ID == doc.ID || other.Type != doc.Type {
+			continue
+		}
+		if other.ProfileID == doc.ProfileID {
+			return true
+		}
+		if other.NumberIndex == doc.NumberIndex && d.profiles[other.ProfileID].DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// profileDocumentsConflict reports whether restoring a deleted profile would
+// bring back a document number that a live profile has taken since.
+func (d *db) profileDocumentsConflict(profileID int) bool {
+	for _, doc := range d.documents {
+		if doc.ProfileID == profileID && d.documentConflict(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DocumentRepo) List(ctx context.Context, profileID int) ([]models.IdentityDocument, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.IdentityDocument{}
+	for _, doc := range r.db.documents {
+		if doc.ProfileID == profileID {
+			out = append(out, doc)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.IdentityDocument) int { return a.ID - b.ID })
+	return out, nil
+}
+
+func (r *DocumentRepo) Get(ctx context.Context, profileID, id int) (*models.IdentityDocument, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	doc, ok := r.db.documents[id]
+	if !ok || doc.ProfileID != profileID {
+		return nil, models.NotFound
+	}
+	return &doc, nil
+}
+
+func (r *DocumentRepo) Create(ctx context.Context, doc *models.IdentityDocument) error {
+	if !slices.Contains(models.DocumentTypes, doc.Type) {
+		// the CHECK constraint on identity_documents.type
+		return fmt.Errorf("invalid document type %q", doc.Type)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	d := *doc
+	d.ID = 0
+	if r.db.documentConflict(d) {
+		return models.AlreadyExists
+	}
+	if _, ok := r.db.profiles[d.ProfileID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastDocumentID++
+	d.ID = r.db.lastDocumentID
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	r.db.documents[d.ID] = d
+
+	doc.ID, doc.CreatedAt, doc.UpdatedAt = d.ID, d.CreatedAt, d.UpdatedAt
+	return nil
+}
+
+func (r *DocumentRepo) Update(ctx context.Context, doc *models.IdentityDocument) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	current, ok := r.db.documents[doc.ID]
+	if !ok || current.ProfileID != doc.ProfileID {
+		return models.NotFound
+	}
+	d := current
+	d.Number, d.NumberIndex, d.ExpiresOn = doc.Number, doc.NumberIndex, doc.ExpiresOn
+	if r.db.documentConflict(d) {
+		return models.AlreadyExists
+	}
+	d.UpdatedAt = now()
+	r.db.documents[d.ID] = d
+
+	doc.Type, doc.CreatedAt, doc.UpdatedAt = d.Type, d.CreatedAt, d.UpdatedAt
+	return nil
+}
+
+func (r *DocumentRepo) Delete(ctx context.Context, profileID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	doc, ok := r.db.documents[id]
+	if !ok || doc.ProfileID != profileID {
+		return models.NotFound
+	}
+	delete(r.db.documents, id)
+	return nil
+}
@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type DuplicateRepo struct {
+	db *db
+}
+
+func (r *DuplicateRepo) Candidates(ctx context.Context, p *models.Profile, limit int) ([]models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	rank := func(c models.Profile) int {
+		switch {
+		case p.AadhaarIndex != "" && c.AadhaarIndex == p.AadhaarIndex:
+			return 0
+		case p.PhoneIndex != "" && c.PhoneIndex == p.PhoneIndex:
+			return 1
+		case c.DateOfBirth.Format(time.DateOnly) == p.DateOfBirth.Format(time.DateOnly):
+			return 2
+		}
+		return -1
+	}
+	out := []models.Profile{}
+	for _, c := range r.db.profiles {
+		if c.DeletedAt == nil && c.UserID != p.UserID && rank(c) >= 0 {
+			out = append(out, c)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Profile) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return a.ID - b.ID
+	})
+	return out[:min(limit, len(out))], nil
+}
+
+func (r *DuplicateRepo) Flag(ctx context.Context, d *models.Duplicate) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if d.ProfileID >= d.MatchID {
+		// the profile_duplicates_order CHECK constraint
+		return errors.New("duplicate pair is not in ID order")
+	}
+	if _, ok := r.db.profiles[d.ProfileID]; !ok {
+		return models.NotFound
+	}
+	if _, ok := r.db.profiles[d.MatchID]; !ok {
+		return models.NotFound
+	}
+	for id, stored := range r.db.duplicates {
+		if stored.ProfileID != d.ProfileID || stored.MatchID != d.MatchID {
+			continue
+		}
+		if stored.Status == models.DuplicatePending {
+			stored.Reasons, stored.Score = slices.Clone(d.Reasons), d.Score
+			r.db.duplicates[id] = stored
+		}
+		*d = stored
+		return nil
+	}
+
+	r.db.lastDuplicateID++
+	stored := models.Duplicate{
+		ID:        r.db.lastDuplicateID,
+		ProfileID: d.ProfileID,
+		MatchID:   d.MatchID,
+		Reasons:   slices.Clone(d.Reasons),
+		Score:     d.Score,
+		Status:    models.DuplicatePending,
+		CreatedAt: now(),
+	}
+	r.db.duplicates[stored.ID] = stored
+	*d = stored
+	return nil
+}
+
+func (r *DuplicateRepo) Get(ctx context.Context, id int) (*models.Duplicate, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	d, ok := r.db.duplicates[id]
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &d, nil
+}
+
+func (r *DuplicateRepo) Pair(ctx context.Context, d *models.Duplicate) ([]models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.Profile{}
+	for _, id := range []int{d.ProfileID, d.MatchID} {
+		if p, ok := r.db.profiles[id]; ok && p.DeletedAt == nil {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (r *DuplicateRepo) Queue(ctx context.Context, limit int) ([]models.Duplicate, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	live := func(id int) bool {
+		p, ok := r.db.profiles[id]
+		return ok && p.DeletedAt == nil
+	}
+	out := []models.Duplicate{}
+	for _, d := range r.db.duplicates {
+		if d.Status == models.DuplicatePending && live(d.ProfileID) && live(d.MatchID) {
+			out = append(out, d)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Duplicate) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return out[:min(limit, len(out))], nil
+}
+
+func (r *DuplicateRepo) Resolve(ctx context.Context, d *models.Duplicate) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.duplicates[d.ID]
+	if !ok {
+		return models.NotFound
+	}
+	if stored.Status != models.DuplicatePending {
+		return models.VersionConflict
+	}
+	if !slices.Contains([]string{models.DuplicatePending, models.DuplicateSame, models.DuplicateDistinct}, d.Status) {
+		// the CHECK constraint on profile_duplicates.status
+		return errors.New("invalid duplicate status " + d.Status)
+	}
+	resolved := now()
+	stored.Status, stored.ReviewerID, stored.Note = d.Status, d.ReviewerID, d.Note
+	stored.ResolvedAt = &resolved
+	r.db.duplicates[d.ID] = stored
+	*d = stored
+	return nil
+}
+
+func (r *DuplicateRepo) Unindexed(ctx context.Context, afterID, limit int) ([]models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.Profile{}
+	for _, p := range r.db.profiles {
+		if p.DeletedAt == nil && p.ID > afterID && ((p.AadhaarNumber != "" && p.AadhaarIndex == "") || p.PhoneIndex == "") {
+			out = append(out, p)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Profile) int { return a.ID - b.ID })
+	return out[:min(limit, len(out))], nil
+}
+
+func (r *DuplicateRepo) SetIndexes(ctx context.Context, p *models.Profile) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.profiles[p.ID]
+	if !ok {
+		return models.NotFound
+	}
+	stored.AadhaarIndex, stored.PhoneIndex = p.AadhaarIndex, p.PhoneIndex
+	r.db.profiles[p.ID] = stored
+	return nil
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type EKYCRepo struct {
+	db *db
+}
+
+func (r *EKYCRepo) Create(ctx context.Context, v *models.EKYCVerification) error {
+	if v.Source != models.EKYCSourceXML && v.Source != models.EKYCSourceQR {
+		// the CHECK constraint on ekyc_verifications.source
+		return fmt.Errorf("invalid eKYC source %q", v.Source)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.profiles[v.ProfileID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastEKYCID++
+	e := *v
+	e.ID = r.db.lastEKYCID
+	e.GeneratedAt = e.GeneratedAt.UTC().Truncate(time.Microsecond)
+	e.CreatedAt = now()
+	r.db.ekyc = append(r.db.ekyc, e)
+
+	v.ID, v.CreatedAt = e.ID, e.CreatedAt
+	return nil
+}
+
+func (r *EKYCRepo) List(ctx context.Context, profileID int) ([]models.EKYCVerification, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.EKYCVerification{}
+	for _, v := range slices.Backward(r.db.ekyc) {
+		if v.ProfileID == profileID {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ExportRepo struct {
+	db *db
+}
+
+func (r *ExportRepo) Create(ctx context.Context, e *models.Export) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.users[e.UserID]; !ok {
+		return models.NotFound
+	}
+	for _, existing := range r.db.exports {
+		// exports_pending_idx
+		if existing.UserID == e.UserID && existing.Status == models.ExportPending {
+			return models.AlreadyExists
+		}
+	}
+	r.db.lastExportID++
+	stored := models.Export{
+		ID:        r.db.lastExportID,
+		UserID:    e.UserID,
+		Status:    models.ExportPending,
+		CreatedAt: now(),
+	}
+	r.db.exports[stored.ID] = stored
+	*e = stored
+	return nil
+}
+
+// liveExport returns the user's export if the user is not deleted.
+func (d *db) liveExport(userID, id int) (models.Export, bool) {
+	e, ok := d.exports[id]
+	if !ok || e.UserID != userID || d.users[userID].DeletedAt != nil {
+		return models.Export{}, false
+	}
+	return e, true
+}
+
+func (r *ExportRepo) Get(ctx context.Context, userID, id int) (*models.Export, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	e, ok := r.db.liveExport(userID, id)
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &e, nil
+}
+
+func (r *ExportRepo) Finish(ctx context.Context, e *models.Export) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.exports[e.ID]
+	if !ok || stored.Status != models.ExportPending {
+		return models.NotFound
+	}
+	completed := now()
+	stored.Status = e.Status
+	stored.BlobKey = e.BlobKey
+	stored.DataKey = e.DataKey
+	stored.Size = e.Size
+	stored.ExpiresAt = e.ExpiresAt
+	stored.CompletedAt = &completed
+	r.db.exports[e.ID] = stored
+	*e = stored
+	return nil
+}
+
+func (r *ExportRepo) Download(ctx context.Context, userID, id int, at time.Time) (*models.Export, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	e, ok := r.db.liveExport(userID, id)
+	if !ok || e.Status != models.ExportReady || !e.ExpiresAt.After(at) {
+		return nil, models.NotFound
+	}
+	downloaded := now()
+	e.Status = models.ExportDownloaded
+	e.DownloadedAt = &downloaded
+	r.db.exports[id] = e
+	return &e, nil
+}
+
+func (r *ExportRepo) Expire(ctx context.Context, at time.Time) ([]models.Export, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var expired []models.Export
+	for id, e := range r.db.exports {
+		if e.Status != models.ExportReady {
+			continue
+		}
+		if e.ExpiresAt.After(at) && r.db.users[e.UserID].DeletedAt == nil {
+			continue
+		}
+		e.Status = models.ExportExpired
+		r.db.exports[id] = e
+		expired = append(expired, e)
+	}
+	return expired, nil
+}
+
+func (r *ExportRepo) Abandon(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var n int64
+	for id, e := range r.db.exports {
+		if e.Status == models.ExportPending && e.CreatedAt.Before(before) {
+			completed := now()
+			e.Status = models.ExportFailed
+			e.CompletedAt = &completed
+			r.db.exports[id] = e
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ImportRepo struct {
+	db *db
+}
+
+func (r *ImportRepo) Create(ctx context.Context, job *models.ImportJob) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if job.Format != models.ImportCSV && job.Format != models.ImportNDJSON {
+		// the CHECK constraint on import_jobs.format
+		return errors.New("invalid import format " + job.Format)
+	}
+	if job.AdminID != nil {
+		if _, ok := r.db.users[*job.AdminID]; !ok {
+			return models.NotFound
+		}
+	}
+	created := now()
+	r.db.lastImportID++
+	stored := models.ImportJob{
+		ID:        r.db.lastImportID,
+		AdminID:   job.AdminID,
+		Format:    job.Format,
+		DryRun:    job.DryRun,
+		Status:    models.ImportRunning,
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+	r.db.imports[stored.ID] = stored
+	*job = stored
+	return nil
+}
+
+func (r *ImportRepo) Get(ctx context.Context, id int) (*models.ImportJob, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	job, ok := r.db.imports[id]
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &job, nil
+}
+
+func (r *ImportRepo) Existing(ctx context.Context, rows []models.ImportRow) (*models.ImportExisting, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	emails, usernames, vids, phones := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, row := range rows {
+		emails[row.Email] = true
+		usernames[row.Username] = true
+		vids[row.Profile.VIDIndex] = true
+		phones[row.Profile.PhoneNumber] = true
+	}
+	e := &models.ImportExisting{
+		Accounts:   map[string]int{},
+		Usernames:  map[string]bool{},
+		VIDs:       map[string]bool{},
+		SelfPhones: map[string]bool{},
+		Self:       map[int]bool{},
+		Primary:    map[int]bool{},
+		Aadhaar:    map[int][]string{},
+	}
+	for _, u := range r.db.users {
+		if u.DeletedAt != nil {
+			continue
+		}
+		if emails[u.Email] {
+			e.Accounts[u.Email] = u.ID
+		}
+		if usernames[u.Username] {
+			e.Usernames[u.Username] = true
+		}
+	}
+	accounts := map[int]bool{}
+	for _, id := range e.Accounts {
+		accounts[id] = true
+	}
+	for _, p := range r.db.profiles {
+		if p.DeletedAt != nil {
+			continue
+		}
+		self := p.Relationship == models.RelationshipSelf
+		if p.VIDIndex != "" && vids[p.VIDIndex] {
+			e.VIDs[p.VIDIndex] = true
+		}
+		if self && phones[p.PhoneNumber] {
+			e.SelfPhones[p.PhoneNumber] = true
+		}
+		if !accounts[p.UserID] {
+			continue
+		}
+		e.Self[p.UserID] = e.Self[p.UserID] || self
+		e.Primary[p.UserID] = e.Primary[p.UserID] || p.IsPrimary
+		if p.AadhaarIndex != "" {
+			e.Aadhaar[p.UserID] = append(e.Aadhaar[p.UserID], p.AadhaarIndex)
+		}
+	}
+	return e, nil
+}
+
+// Insert works on a copy of the tables, like Transactor.WithTx, so a batch
+// that collides halfway leaves nothing behind.
+func (r *ImportRepo) Insert(ctx context.Context, job *models.ImportJob, batch *models.ImportBatch) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	tx := r.db.clone()
+	err := tx.insertImport(job, batch)
+	r.db.commit(tx, err == nil)
+	return err
+}
+
+func (tx *db) insertImport(job *models.ImportJob, batch *models.ImportBatch) error {
+	stored, ok := tx.imports[job.ID]
+	if !ok {
+		return models.NotFound
+	}
+	if stored.Records != job.Records || stored.Status != models.ImportRunning {
+		return models.VersionConflict
+	}
+
+	created := now()
+	if !stored.DryRun {
+		accounts := map[string]int{}
+		for i := range batch.Users {
+			u := batch.Users[i]
+			u.CreatedAt, u.UpdatedAt = created, created
+			if tx.userConflict(u) {
+				return models.AlreadyExists
+			}
+			tx.lastUserID++
+			u.ID = tx.lastUserID
+			tx.users[u.ID] = u
+			batch.Users[i].ID = u.ID
+			accounts[u.Email] = u.ID
+		}
+		for i := range batch.Rows {
+			p := batch.Rows[i].Profile
+			if p.UserID == 0 {
+				p.UserID = accounts[batch.Rows[i].Email]
+			}
+			if !slices.Contains(models.Relationships, p.Relationship) {
+				// the CHECK constraints on profiles.relationship
+				return errors.New("invalid relationship " + p.Relationship)
+			}
+			if !slices.Contains([]string{models.AadhaarFormAadhaar, models.AadhaarFormVID, models.AadhaarFormBoth}, p.AadhaarForm) {
+				// and aadhaar_form
+				return errors.New("invalid aadhaar form " + p.AadhaarForm)
+			}
+			if err := checkAadhaarOrVID(p); err != nil {
+				return err
+			}
+			if tx.profileConflict(p) {
+				return models.AlreadyExists
+			}
+			if _, ok := tx.users[p.UserID]; !ok {
+				return models.NotFound
+			}
+			tx.lastProfileID++
+			p.ID, p.Version, p.CreatedAt, p.UpdatedAt = tx.lastProfileID, 1, created, created
+			tx.profiles[p.ID] = p
+			tx.recordVersion(models.ProfileCreated, p, created)
+			batch.Rows[i].Profile = p
+		}
+	}
+	tx.importErrors[job.ID] = append(slices.Clone(tx.importErrors[job.ID]), batch.Errors...)
+
+	stored.Records += batch.Records
+	stored.Line = batch.Line
+	stored.Checksum = batch.Checksum
+	stored.Users += len(batch.Users)
+	stored.Profiles += len(batch.Rows)
+	stored.Failed += len(batch.Errors)
+	stored.UpdatedAt = created
+	tx.imports[job.ID] = stored
+	*job = stored
+	return nil
+}
+
+func (r *ImportRepo) Complete(ctx context.Context, job *models.ImportJob) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.imports[job.ID]
+	if !ok {
+		return models.NotFound
+	}
+	completed := now()
+	stored.Status, stored.UpdatedAt, stored.CompletedAt = models.ImportCompleted, completed, &completed
+	r.db.imports[job.ID] = stored
+	*job = stored
+	return nil
+}
+
+func (r *ImportRepo) Errors(ctx context.Context, id int) ([]models.ImportError, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	if _, ok := r.db.imports[id]; !ok {
+		return nil, models.NotFound
+	}
+	out := slices.Clone(r.db.importErrors[id])
+	slices.SortStableFunc(out, func(a, b models.ImportError) int { return a.Line - b.Line })
+	if out == nil {
+		out = []models.ImportError{}
+	}
+	return out, nil
+}
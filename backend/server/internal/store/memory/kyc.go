@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type KYCRepo struct {
+	db *db
+}
+
+var kycStatuses = []string{
+	models.KYCDraft,
+	models.KYCSubmitted,
+	models.KYCUnderReview,
+	models.KYCVerified,
+	models.KYCRejected,
+	models.KYCExpired,
+}
+
+// withUser fills in UserID from the profile, the way the SQL stores join
+// profiles. It reports false if the profile is gone or deleted.
+func (d *db) withUser(k models.KYC) (models.KYC, bool) {
+	p, ok := d.profiles[k.ProfileID]
+	if !ok || p.DeletedAt != nil {
+		return k, false
+	}
+	k.UserID = p.UserID
+	return k, true
+}
+
+func (r *KYCRepo) Get(ctx context.Context, profileID int) (*models.KYC, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	k, ok := r.db.kyc[profileID]
+	if !ok {
+		return nil, models.NotFound
+	}
+	if k, ok = r.db.withUser(k); !ok {
+		return nil, models.NotFound
+	}
+	return &k, nil
+}
+
+// GetForUpdate is Get: a transaction holds the write lock throughout.
+func (r *KYCRepo) GetForUpdate(ctx context.Context, profileID int) (*models.KYC, error) {
+	return r.Get(ctx, profileID)
+}
+
+func (r *KYCRepo) Save(ctx context.Context, k *models.KYC) error {
+	if !slices.Contains(kycStatuses, k.Status) {
+		// the CHECK constraint on profile_kyc.status
+		return fmt.Errorf("invalid KYC status %q", k.Status)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.profiles[k.ProfileID]; !ok {
+		return models.NotFound
+	}
+	if k.ReviewerID != nil {
+		if _, ok := r.db.users[*k.ReviewerID]; !ok {
+			return models.NotFound
+		}
+	}
+	stored, ok := r.db.kyc[k.ProfileID]
+	if (!ok && k.Version != 0) || (ok && stored.Version != k.Version) {
+		return models.VersionConflict
+	}
+
+	row := *k
+	row.ClaimedAt = truncate(row.ClaimedAt)
+	row.SubmittedAt = truncate(row.SubmittedAt)
+	row.VerifiedAt = truncate(row.VerifiedAt)
+	row.Version++
+	row.UpdatedAt = now()
+	r.db.kyc[k.ProfileID] = row
+
+	k.Version, k.UpdatedAt = row.Version, row.UpdatedAt
+	return nil
+}
+
+func truncate(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC().Truncate(time.Microsecond)
+	return &u
+}
+
+func (r *KYCRepo) Queue(ctx context.Context, limit int) ([]models.KYC, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.KYC{}
+	for _, k := range r.db.kyc {
+		if k.Status != models.KYCSubmitted && k.Status != models.KYCUnderReview {
+			continue
+		}
+		if k, ok := r.db.withUser(k); ok {
+			out = append(out, k)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.KYC) int {
+		// postgres sorts NULLs last
+		switch {
+		case a.SubmittedAt == nil && b.SubmittedAt != nil:
+			return 1
+		case a.SubmittedAt != nil && b.SubmittedAt == nil:
+			return -1
+		case a.SubmittedAt != nil:
+			if c := a.SubmittedAt.Compare(*b.SubmittedAt); c != 0 {
+				return c
+			}
+		}
+		return a.ProfileID - b.ProfileID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *KYCRepo) Expire(ctx context.Context, verifiedBefore time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var n int64
+	for id, k := range r.db.kyc {
+		if k.Status != models.KYCVerified || k.VerifiedAt == nil || !k.VerifiedAt.Before(verifiedBefore) {
+			continue
+		}
+		k.Status = models.KYCExpired
+		k.Version++
+		k.UpdatedAt = now()
+		r.db.kyc[id] = k
+		n++
+	}
+	return n, nil
+}
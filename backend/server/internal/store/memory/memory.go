@@ -0,0 +1,205 @@
+// Package memory is an in-process implementation of the repository
+// interfaces for tests and local demos. It mirrors the postgres store's
+// constraints and error mapping, so code that passes against it behaves the
+// same against a real database. Nothing is persisted.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+)
+
+// db holds every table. All repositories built by NewRepo share one db and
+// one lock, the way the postgres repositories share one pool.
+type db struct {
+	mu sync.RWMutex
+
+	users       map[int]models.User
+	profiles    map[int]models.Profile
+	versions    []models.ProfileVersion
+	addresses   map[int]models.Address
+	documents   map[int]models.IdentityDocument
+	ekyc        []models.EKYCVerification
+	kyc         map[int]models.KYC
+	attachments map[int]models.Attachment
+	photos      map[int]models.Photo
+	duplicates  map[int]models.Duplicate
+	imports     map[int]models.ImportJob
+	// importErrors are kept in insertion order, which is line order
+	importErrors map[int][]models.ImportError
+	exports      map[int]models.Export
+	consents     map[int]models.Consent
+	shareLinks   map[int]models.ShareLink
+	credentials  map[int]models.Credential
+	audit        []models.AuditRecord
+	checkpoints  []models.AuditCheckpoint
+	revoked      map[int]time.Time
+
+	lastUserID       int
+	lastProfileID    int
+	lastVersionID    int64
+	lastAddressID    int
+	lastDocumentID   int
+	lastEKYCID       int
+	lastAttachmentID int
+	lastDuplicateID  int
+	lastImportID     int
+	lastExportID     int
+	lastConsentID    int
+	lastShareLinkID  int
+	lastCredentialID int
+}
+
+func NewRepo() *repository.Repository {
+	d := &db{
+		users:        make(map[int]models.User),
+		profiles:     make(map[int]models.Profile),
+		addresses:    make(map[int]models.Address),
+		documents:    make(map[int]models.IdentityDocument),
+		kyc:          make(map[int]models.KYC),
+		attachments:  make(map[int]models.Attachment),
+		photos:       make(map[int]models.Photo),
+		duplicates:   make(map[int]models.Duplicate),
+		imports:      make(map[int]models.ImportJob),
+		importErrors: make(map[int][]models.ImportError),
+		exports:      make(map[int]models.Export),
+		consents:     make(map[int]models.Consent),
+		shareLinks:   make(map[int]models.ShareLink),
+		credentials:  make(map[int]models.Credential),
+		revoked:      make(map[int]time.Time),
+	}
+	return d.repo()
+}
+
+func (d *db) repo() *repository.Repository {
+	return &repository.Repository{
+		Users:       &UserRepo{db: d},
+		Profiles:    &ProfileRepo{db: d},
+		Addresses:   &AddressRepo{db: d},
+		Documents:   &DocumentRepo{db: d},
+		EKYC:        &EKYCRepo{db: d},
+		KYC:         &KYCRepo{db: d},
+		Attachments: &AttachmentRepo{db: d},
+		Photos:      &PhotoRepo{db: d},
+		Duplicates:  &DuplicateRepo{db: d},
+		Imports:     &ImportRepo{db: d},
+		Exports:     &ExportRepo{db: d},
+		Consents:    &ConsentRepo{db: d},
+		ShareLinks:  &ShareLinkRepo{db: d},
+		Credentials: &CredentialRepo{db: d},
+		Audit:       &AuditRepo{db: d},
+		Sessions:    &SessionRepo{db: d},
+		Tx:          &Transactor{db: d},
+	}
+}
+
+// clone copies every table. Rows are stored by value, so copying the maps
+// and slices is enough to isolate the copy.
+func (d *db) clone() *db {
+	return &db{
+		users:            maps.Clone(d.users),
+		profiles:         maps.Clone(d.profiles),
+		versions:         slices.Clone(d.versions),
+		addresses:        maps.Clone(d.addresses),
+		documents:        maps.Clone(d.documents),
+		ekyc:             slices.Clone(d.ekyc),
+		kyc:              maps.Clone(d.kyc),
+		attachments:      maps.Clone(d.attachments),
+		photos:           maps.Clone(d.photos),
+		duplicates:       maps.Clone(d.duplicates),
+		imports:          maps.Clone(d.imports),
+		importErrors:     maps.Clone(d.importErrors),
+		exports:          maps.Clone(d.exports),
+		consents:         maps.Clone(d.consents),
+		shareLinks:       maps.Clone(d.shareLinks),
+		credentials:      maps.Clone(d.credentials),
+		audit:            slices.Clone(d.audit),
+		checkpoints:      slices.Clone(d.checkpoints),
+		revoked:          maps.Clone(d.revoked),
+		lastUserID:       d.lastUserID,
+		lastProfileID:    d.lastProfileID,
+		lastVersionID:    d.lastVersionID,
+		lastAddressID:    d.lastAddressID,
+		lastDocumentID:   d.lastDocumentID,
+		lastEKYCID:       d.lastEKYCID,
+		lastAttachmentID: d.lastAttachmentID,
+		lastDuplicateID:  d.lastDuplicateID,
+		lastImportID:     d.lastImportID,
+		lastExportID:     d.lastExportID,
+		lastConsentID:    d.lastConsentID,
+		lastShareLinkID:  d.lastShareLinkID,
+		lastCredentialID: d.lastCredentialID,
+	}
+}
+
+// Transactor runs a transaction on a private copy of the tables while holding
+// the write lock, and swaps the copy in on commit. Holding the lock makes
+// transactions serializable; nesting works because each level copies the one
+// above it. It also means that any call on the outer repository waits for the
+// transaction to end, so fn deadlocks if it waits on one.
+type Transactor struct {
+	db *db
+}
+
+func (t *Transactor) WithTx(ctx context.Context, fn func(tx *repository.Repository) error) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	tx := t.db.clone()
+	err := fn(tx.repo())
+	t.db.commit(tx, err == nil)
+	return err
+}
+
+// commit copies the ID counters of tx back, since ids are never handed out
+// twice, like postgres sequences, which do not roll back either. If ok it
+// swaps in the tables of tx as well.
+func (d *db) commit(tx *db, ok bool) {
+	d.lastUserID = tx.lastUserID
+	d.lastProfileID = tx.lastProfileID
+	d.lastVersionID = tx.lastVersionID
+	d.lastAddressID = tx.lastAddressID
+	d.lastDocumentID = tx.lastDocumentID
+	d.lastEKYCID = tx.lastEKYCID
+	d.lastAttachmentID = tx.lastAttachmentID
+	d.lastDuplicateID = tx.lastDuplicateID
+	d.lastImportID = tx.lastImportID
+	d.lastExportID = tx.lastExportID
+	d.lastConsentID = tx.lastConsentID
+	d.lastShareLinkID = tx.lastShareLinkID
+	d.lastCredentialID = tx.lastCredentialID
+	if !ok {
+		return
+	}
+
+	d.users = tx.users
+	d.profiles = tx.profiles
+	d.versions = tx.versions
+	d.addresses = tx.addresses
+	d.documents = tx.documents
+	d.ekyc = tx.ekyc
+	d.kyc = tx.kyc
+	d.attachments = tx.attachments
+	d.photos = tx.photos
+	d.duplicates = tx.duplicates
+	d.imports = tx.imports
+	d.importErrors = tx.importErrors
+	d.exports = tx.exports
+	d.consents = tx.consents
+	d.shareLinks = tx.shareLinks
+	d.credentials = tx.credentials
+	d.audit = tx.audit
+	d.checkpoints = tx.checkpoints
+	d.revoked = tx.revoked
+}
+
+// now matches the precision of a postgres TIMESTAMPTZ.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repository.Repository { return NewRepo() })
+}
+
+func TestWithTx_OuterRepositoryWaits(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	done := make(chan struct{})
+	err := repo.WithTx(ctx, func(tx *repository.Repository) error {
+		go func() {
+			repo.Users.GetByEmail(ctx, "asha@example.com")
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Error("a call on the outer repository ran inside the transaction")
+		case <-time.After(50 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	<-done
+}
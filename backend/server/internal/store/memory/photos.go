@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type PhotoRepo struct {
+	db *db
+}
+
+func (r *PhotoRepo) Get(ctx context.Context, profileID int) (*models.Photo, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	p, ok := r.db.photos[profileID]
+	if !ok {
+		return nil, models.NotFound
+	}
+	if profile, ok := r.db.profiles[profileID]; !ok || profile.DeletedAt != nil {
+		return nil, models.NotFound
+	}
+	return &p, nil
+}
+
+func (r *PhotoRepo) Put(ctx context.Context, p *models.Photo) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.profiles[p.ProfileID]; !ok {
+		return models.NotFound
+	}
+	stored := *p
+	stored.UpdatedAt = now()
+	r.db.photos[p.ProfileID] = stored
+	p.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *PhotoRepo) Delete(ctx context.Context, profileID int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.photos[profileID]; !ok {
+		return models.NotFound
+	}
+	delete(r.db.photos, profileID)
+	return nil
+}
+
+func (r *PhotoRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Photo, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	out := []models.Photo{}
+	for _, p := range r.db.photos {
+		if profile := r.db.profiles[p.ProfileID]; profile.DeletedAt != nil && profile.DeletedAt.Before(before) {
+			out = append(out, p)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Photo) int { return a.ProfileID - b.ProfileID })
+	return out, nil
+}
@@ -0,0 +1,408 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ProfileRepo struct {
+	db *db
+}
+
+// profilesOf returns every profile row of the user, live or not, in id order.
+// Callers hold the lock.
+func (d *db) profilesOf(userID int) []models.Profile {
+	var out []models.Profile
+	for _, p := range d.profiles {
+		if p.UserID == userID {
+			out = append(out, p)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Profile) int { return a.ID - b.ID })
+	return out
+}
+
+// liveProfiles returns the user's live profiles, primary first, then by id.
+// Callers hold the lock.
+func (d *db) liveProfiles(userID int) []models.Profile {
+	out := []models.Profile{}
+	for _, p := range d.profilesOf(userID) {
+		if p.DeletedAt == nil {
+			out = append(out, p)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b models.Profile) int {
+		switch {
+		case a.IsPrimary == b.IsPrimary:
+			return 0
+		case a.IsPrimary:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return out
+}
+
+func (d *db) liveProfile(userID, id int) (models.Profile, bool) {
+	p, ok := d.profiles[id]
+	if !ok || p.UserID != userID || p.DeletedAt != nil {
+		return models.Profile{}, false
+	}
+	return p, true
+}
+
+func (d *db) primaryProfile(userID int) (models.Profile, bool) {
+	live := d.liveProfiles(userID)
+	if len(live) == 0 || !live[0].IsPrimary {
+		return models.Profile{}, false
+	}
+	return live[0], true
+}
+
+// profileConflict reports whether a live profile other than p collides with
+// it on one of the partial unique indexes in postgres: the Aadhaar number and
+// VID index when set, the phone number among self profiles, and one self and
+// one primary per account.
+func (d *db) profileConflict(p models.Profile) bool {
+	self := p.Relationship == models.RelationshipSelf
+	for _, other := range d.profiles {
+		if other.ID == p.ID || other.DeletedAt != nil {
+			continue
+		}
+		otherSelf := other.Relationship == models.RelationshipSelf
+		if (p.AadhaarNumber != "" && other.AadhaarNumber == p.AadhaarNumber) ||
+			(p.VIDIndex != "" && other.VIDIndex == p.VIDIndex) ||
+			(self && otherSelf && other.PhoneNumber == p.PhoneNumber) {
+			return true
+		}
+		if other.UserID == p.UserID && ((self && otherSelf) || (p.IsPrimary && other.IsPrimary) ||
+			(p.AadhaarIndex != "" && other.AadhaarIndex == p.AadhaarIndex)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAadhaarOrVID is the profiles_aadhaar_or_vid CHECK constraint.
+func checkAadhaarOrVID(p models.Profile) error {
+	if p.AadhaarNumber == "" && p.VID == "" {
+		return errors.New("profile has neither an aadhaar number nor a VID")
+	}
+	return nil
+}
+
+// recordVersion appends a snapshot of p to the history, keeping the same
+// columns as profile_versions.
+func (d *db) recordVersion(change string, p models.Profile, at time.Time) {
+	d.lastVersionID++
+	d.versions = append(d.versions, models.ProfileVersion{
+		Version:   d.lastVersionID,
+		Change:    change,
+		ChangedAt: at,
+		Profile: models.Profile{
+			ID:            p.ID,
+			UserID:        p.UserID,
+			FullName:      p.FullName,
+			DateOfBirth:   p.DateOfBirth,
+			AadhaarNumber: p.AadhaarNumber,
+			VID:           p.VID,
+			PhoneNumber:   p.PhoneNumber,
+			Address:       p.Address,
+		},
+	})
+}
+
+// deleteProfile removes a profile row and, like ON DELETE CASCADE, its
+// history, addresses, identity documents, eKYC verifications, KYC state,
+// attachments, photo and duplicate pairs.
+func (d *db) deleteProfile(id int) {
+	delete(d.profiles, id)
+	maps.DeleteFunc(d.addresses, func(_ int, a models.Address) bool { return a.ProfileID == id })
+	maps.DeleteFunc(d.documents, func(_ int, doc models.IdentityDocument) bool { return doc.ProfileID == id })
+	d.ekyc = slices.DeleteFunc(d.ekyc, func(v models.EKYCVerification) bool { return v.ProfileID == id })
+	delete(d.kyc, id)
+	maps.DeleteFunc(d.attachments, func(_ int, a models.Attachment) bool { return a.ProfileID == id })
+	delete(d.photos, id)
+	maps.DeleteFunc(d.shareLinks, func(_ int, l models.ShareLink) bool { return l.ProfileID == id })
+	// credentials.profile_id is ON DELETE SET NULL
+	for cid, c := range d.credentials {
+		if c.ProfileID == id {
+			c.ProfileID = 0
+			d.credentials[cid] = c
+		}
+	}
+	maps.DeleteFunc(d.duplicates, func(_ int, dup models.Duplicate) bool {
+		return dup.ProfileID == id || dup.MatchID == id
+	})
+	d.versions = slices.DeleteFunc(d.versions, func(v models.ProfileVersion) bool {
+		return v.Profile.ID == id
+	})
+}
+
+func (r *ProfileRepo) GetByUserID(ctx context.Context, userID int) (*models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	p, ok := r.db.primaryProfile(userID)
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &p, nil
+}
+
+func (r *ProfileRepo) Get(ctx context.Context, userID, id int) (*models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	p, ok := r.db.liveProfile(userID, id)
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &p, nil
+}
+
+func (r *ProfileRepo) List(ctx context.Context, userID int) ([]models.Profile, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return r.db.liveProfiles(userID), nil
+}
+
+// Create inserts the profile and fills in its ID and Version.
+func (r *ProfileRepo) Create(ctx context.Context, profile *models.Profile) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if !slices.Contains(models.Relationships, profile.Relationship) {
+		// the CHECK constraint on profiles.relationship
+		return fmt.Errorf("invalid relationship %q", profile.Relationship)
+	}
+	if err := checkAadhaarOrVID(*profile); err != nil {
+		return err
+	}
+
+	_, hasPrimary := r.db.primaryProfile(profile.UserID)
+	created := now()
+	p := models.Profile{
+		UserID:        profile.UserID,
+		FullName:      profile.FullName,
+		DateOfBirth:   profile.DateOfBirth,
+		AadhaarNumber: profile.AadhaarNumber,
+		VID:           profile.VID,
+		VIDIndex:      profile.VIDIndex,
+		AadhaarIndex:  profile.AadhaarIndex,
+		PhoneIndex:    profile.PhoneIndex,
+		AadhaarForm:   models.AadhaarFormOf(profile.AadhaarNumber, profile.VID),
+		PhoneNumber:   profile.PhoneNumber,
+		Address:       profile.Address,
+		Relationship:  profile.Relationship,
+		IsPrimary:     !hasPrimary,
+		Version:       1,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	if r.db.profileConflict(p) {
+		return models.AlreadyExists
+	}
+	// the foreign key only needs the row, soft-deleted users included
+	if _, ok := r.db.users[p.UserID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastProfileID++
+	p.ID = r.db.lastProfileID
+	r.db.profiles[p.ID] = p
+	r.db.recordVersion(models.ProfileCreated, p, created)
+
+	profile.ID = p.ID
+	profile.Version = p.Version
+	profile.IsPrimary = p.IsPrimary
+	profile.AadhaarForm = p.AadhaarForm
+	return nil
+}
+
+func (r *ProfileRepo) Update(ctx context.Context, profile *models.Profile) error {
+	return r.Patch(ctx, profile, models.ProfileFields)
+}
+
+// Patch writes only the named fields, and only if the stored row is still at
+// profile.Version. See the postgres implementation for the error contract.
+func (r *ProfileRepo) Patch(ctx context.Context, profile *models.Profile, fields []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	current, ok := r.db.liveProfile(profile.UserID, profile.ID)
+	if !ok {
+		return models.NotFound
+	}
+	if current.Version != profile.Version {
+		return models.VersionConflict
+	}
+
+	updated := current
+	for _, field := range fields {
+		switch field {
+		case models.FieldFullName:
+			updated.FullName = profile.FullName
+		case models.FieldDateOfBirth:
+			updated.DateOfBirth = profile.DateOfBirth
+		case models.FieldAadhaarNumber:
+			updated.AadhaarNumber, updated.AadhaarIndex = profile.AadhaarNumber, profile.AadhaarIndex
+		case models.FieldVID:
+			updated.VID, updated.VIDIndex = profile.VID, profile.VIDIndex
+		case models.FieldPhoneNumber:
+			updated.PhoneNumber, updated.PhoneIndex = profile.PhoneNumber, profile.PhoneIndex
+		case models.FieldAddress:
+			updated.Address = profile.Address
+		default:
+			return fmt.Errorf("unknown profile field %q", field)
+		}
+	}
+	if err := checkAadhaarOrVID(updated); err != nil {
+		return err
+	}
+	updated.AadhaarForm = models.AadhaarFormOf(updated.AadhaarNumber, updated.VID)
+	if r.db.profileConflict(updated) {
+		return models.AlreadyExists
+	}
+	updated.Version++
+	updated.UpdatedAt = now()
+	r.db.profiles[updated.ID] = updated
+	r.db.recordVersion(models.ProfileUpdated, updated, updated.UpdatedAt)
+
+	profile.Version = updated.Version
+	profile.AadhaarForm = updated.AadhaarForm
+	return nil
+}
+
+// SetPrimary moves the primary flag to the given profile.
+func (r *ProfileRepo) SetPrimary(ctx context.Context, userID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	p, ok := r.db.liveProfile(userID, id)
+	if !ok {
+		return models.NotFound
+	}
+	if old, ok := r.db.primaryProfile(userID); ok {
+		old.IsPrimary = false
+		r.db.profiles[old.ID] = old
+	}
+	p.IsPrimary = true
+	r.db.profiles[p.ID] = p
+	return nil
+}
+
+// Delete soft-deletes one of the user's profiles, handing the primary flag on
+// to the self profile or else the oldest remaining one.
+func (r *ProfileRepo) Delete(ctx context.Context, userID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	p, ok := r.db.liveProfile(userID, id)
+	if !ok {
+		return models.NotFound
+	}
+	wasPrimary := p.IsPrimary
+	deletedAt := now()
+	p.DeletedAt = &deletedAt
+	p.IsPrimary = false
+	r.db.profiles[p.ID] = p
+	r.db.recordVersion(models.ProfileDeleted, p, deletedAt)
+
+	if !wasPrimary {
+		return nil
+	}
+	var heir *models.Profile
+	for _, other := range r.db.liveProfiles(userID) {
+		if heir == nil || (other.Relationship == models.RelationshipSelf && heir.Relationship != models.RelationshipSelf) {
+			heir = &other
+		}
+	}
+	if heir != nil {
+		heir.IsPrimary = true
+		r.db.profiles[heir.ID] = *heir
+	}
+	return nil
+}
+
+// Restore brings back one of the user's deleted profiles, provided the user is
+// live and the profile does not collide with a live one.
+func (r *ProfileRepo) Restore(ctx context.Context, userID, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if u, ok := r.db.users[userID]; !ok || u.DeletedAt != nil {
+		return models.NotFound
+	}
+	p, ok := r.db.profiles[id]
+	if !ok || p.UserID != userID || p.DeletedAt == nil {
+		return models.NotFound
+	}
+	_, hasPrimary := r.db.primaryProfile(userID)
+	p.DeletedAt = nil
+	p.IsPrimary = !hasPrimary
+	if r.db.profileConflict(p) || r.db.profileDocumentsConflict(id) {
+		return models.AlreadyExists
+	}
+	r.db.profiles[id] = p
+	r.db.recordVersion(models.ProfileRestored, p, now())
+	return nil
+}
+
+func (r *ProfileRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var n int64
+	for id, p := range r.db.profiles {
+		if p.DeletedAt != nil && p.DeletedAt.Before(before) {
+			r.db.deleteProfile(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *ProfileRepo) History(ctx context.Context, userID int) ([]models.ProfileVersion, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var versions []models.ProfileVersion
+	for _, v := range r.db.versions {
+		if v.Profile.UserID == userID {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// AsOf returns one of the user's profiles as it stood at the given time. A
+// profile that was deleted at that point counts as not found.
+func (r *ProfileRepo) AsOf(ctx context.Context, userID, id int, at time.Time) (*models.ProfileVersion, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var found *models.ProfileVersion
+	for i := range r.db.versions {
+		v := &r.db.versions[i]
+		if v.Profile.UserID != userID || v.Profile.ID != id || v.ChangedAt.After(at) {
+			continue
+		}
+		// ORDER BY changed_at DESC, id DESC
+		if found == nil || !v.ChangedAt.Before(found.ChangedAt) {
+			found = v
+		}
+	}
+	if found == nil || found.Change == models.ProfileDeleted {
+		return nil, models.NotFound
+	}
+	v := *found
+	return &v, nil
+}
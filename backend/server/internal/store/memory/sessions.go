@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type SessionRepo struct {
+	db *db
+}
+
+func (r *SessionRepo) RevokeAll(ctx context.Context, userID int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.revoked[userID] = now()
+	return nil
+}
+
+func (r *SessionRepo) RevokedAt(ctx context.Context, userID int) (time.Time, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return r.db.revoked[userID], nil
+}
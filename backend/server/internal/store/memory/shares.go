@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ShareLinkRepo struct {
+	db *db
+}
+
+func (r *ShareLinkRepo) Create(ctx context.Context, l *models.ShareLink) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.users[l.UserID]; !ok {
+		return models.NotFound
+	}
+	if _, ok := r.db.profiles[l.ProfileID]; !ok {
+		return models.NotFound
+	}
+	r.db.lastShareLinkID++
+	stored := models.ShareLink{
+		ID:        r.db.lastShareLinkID,
+		UserID:    l.UserID,
+		ProfileID: l.ProfileID,
+		Fields:    slices.Clone(l.Fields),
+		PINHash:   l.PINHash,
+		CreatedAt: now(),
+		ExpiresAt: l.ExpiresAt.UTC().Truncate(time.Microsecond),
+	}
+	r.db.shareLinks[stored.ID] = stored
+	*l = stored
+	return nil
+}
+
+func (r *ShareLinkRepo) Get(ctx context.Context, id int) (*models.ShareLink, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	l, ok := r.db.shareLinks[id]
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &l, nil
+}
+
+func (r *ShareLinkRepo) List(ctx context.Context, userID, profileID int) ([]models.ShareLink, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var links []models.ShareLink
+	for id := r.db.lastShareLinkID; id > 0; id-- {
+		if l, ok := r.db.shareLinks[id]; ok && l.UserID == userID && l.ProfileID == profileID {
+			links = append(links, l)
+		}
+	}
+	return links, nil
+}
+
+func (r *ShareLinkRepo) Revoke(ctx context.Context, userID, id int) (*models.ShareLink, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	l, ok := r.db.shareLinks[id]
+	if !ok || l.UserID != userID || l.RevokedAt != nil {
+		return nil, models.NotFound
+	}
+	at := now()
+	l.RevokedAt = &at
+	r.db.shareLinks[id] = l
+	return &l, nil
+}
+
+func (r *ShareLinkRepo) Accessed(ctx context.Context, id int, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	l, ok := r.db.shareLinks[id]
+	if !ok {
+		return nil
+	}
+	at = at.UTC().Truncate(time.Microsecond)
+	l.Accesses++
+	l.LastAccessedAt = &at
+	r.db.shareLinks[id] = l
+	return nil
+}
+
+func (r *ShareLinkRepo) TakePINAttempt(ctx context.Context, id, max int) (int, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	l, ok := r.db.shareLinks[id]
+	if !ok || l.PINFailures >= max {
+		return 0, models.NotFound
+	}
+	l.PINFailures++
+	r.db.shareLinks[id] = l
+	return l.PINFailures, nil
+}
+
+func (r *ShareLinkRepo) ReturnPINAttempt(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	l, ok := r.db.shareLinks[id]
+	if !ok || l.PINFailures == 0 {
+		return nil
+	}
+	l.PINFailures--
+	r.db.shareLinks[id] = l
+	return nil
+}
+
+func (r *ShareLinkRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var n int64
+	for id, l := range r.db.shareLinks {
+		if l.ExpiresAt.Before(before) || (l.RevokedAt != nil && l.RevokedAt.Before(before)) {
+			delete(r.db.shareLinks, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type UserRepo struct {
+	db *db
+}
+
+// liveUser returns the live user matching the predicate. Callers hold the lock.
+func (d *db) liveUser(match func(u models.User) bool) (models.User, bool) {
+	for _, u := range d.users {
+		if u.DeletedAt == nil && match(u) {
+			return u, true
+		}
+	}
+	return models.User{}, false
+}
+
+// userConflict reports whether a live user other than u already holds u's
+// email or username, the columns with partial unique indexes in postgres.
+func (d *db) userConflict(u models.User) bool {
+	_, taken := d.liveUser(func(other models.User) bool {
+		return other.ID != u.ID && (other.Email == u.Email || other.Username == u.Username)
+	})
+	return taken
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	u, ok := r.db.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, models.NotFound
+	}
+	return &u, nil
+}
+
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	u, ok := r.db.liveUser(func(u models.User) bool { return u.Email == email })
+	if !ok {
+		return nil, models.NotFound
+	}
+	return &u, nil
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *models.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	created := now()
+	u := models.User{
+		Email:        user.Email,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         models.RoleUser,
+		CreatedAt:    created,
+		UpdatedAt:    created,
+	}
+	if r.db.userConflict(u) {
+		return models.AlreadyExists
+	}
+	r.db.lastUserID++
+	u.ID = r.db.lastUserID
+	r.db.users[u.ID] = u
+	user.ID = u.ID
+	return nil
+}
+
+func (r *UserRepo) SetRole(ctx context.Context, email string, role string) error {
+	switch role {
+	case models.RoleUser, models.RoleSupport, models.RoleAdmin:
+	default:
+		// the CHECK constraint on users.role
+		return fmt.Errorf("invalid role %q", role)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	u, ok := r.db.liveUser(func(u models.User) bool { return u.Email == email })
+	if !ok {
+		return models.NotFound
+	}
+	u.Role = role
+	u.UpdatedAt = now()
+	r.db.users[u.ID] = u
+	return nil
+}
+
+// Delete soft-deletes the user together with their live profiles, stamping
+// both with the same deleted_at.
+func (r *UserRepo) Delete(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	u, ok := r.db.users[id]
+	if !ok || u.DeletedAt != nil {
+		return models.NotFound
+	}
+	deletedAt := now()
+	u.DeletedAt = &deletedAt
+	r.db.users[id] = u
+
+	for _, p := range r.db.profilesOf(id) {
+		if p.DeletedAt == nil {
+			p.DeletedAt = &deletedAt
+			r.db.profiles[p.ID] = p
+			r.db.recordVersion(models.ProfileDeleted, p, deletedAt)
+		}
+	}
+	return nil
+}
+
+// Restore undoes Delete. Like the postgres transaction it changes nothing if
+// any restored row would collide with a live one.
+func (r *UserRepo) Restore(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	u, ok := r.db.users[id]
+	if !ok || u.DeletedAt == nil {
+		return models.NotFound
+	}
+	if r.db.userConflict(u) {
+		return models.AlreadyExists
+	}
+	var restored []models.Profile
+	for _, p := range r.db.profilesOf(id) {
+		if p.DeletedAt != nil && p.DeletedAt.Equal(*u.DeletedAt) {
+			if r.db.profileConflict(p) || r.db.profileDocumentsConflict(p.ID) {
+				return models.AlreadyExists
+			}
+			restored = append(restored, p)
+		}
+	}
+
+	at := now()
+	u.DeletedAt = nil
+	r.db.users[id] = u
+	for _, p := range restored {
+		p.DeletedAt = nil
+		r.db.profiles[p.ID] = p
+		r.db.recordVersion(models.ProfileRestored, p, at)
+	}
+	return nil
+}
+
+// Purge permanently erases users soft-deleted before the cutoff, cascading to
+// their profiles and history as the foreign keys do in postgres.
+func (r *UserRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var n int64
+	for id, u := range r.db.users {
+		if u.DeletedAt == nil || !u.DeletedAt.Before(before) {
+			continue
+		}
+		for _, p := range r.db.profilesOf(id) {
+			r.db.deleteProfile(p.ID)
+		}
+		r.db.versions = slices.DeleteFunc(r.db.versions, func(v models.ProfileVersion) bool {
+			return v.Profile.UserID == id
+		})
+		// profile_kyc.reviewer_id is ON DELETE SET NULL
+		for pid, k := range r.db.kyc {
+			if k.ReviewerID != nil && *k.ReviewerID == id {
+				k.ReviewerID = nil
+				r.db.kyc[pid] = k
+			}
+		}
+		// and so is profile_duplicates.reviewer_id
+		for did, d := range r.db.duplicates {
+			if d.ReviewerID != nil && *d.ReviewerID == id {
+				d.ReviewerID = nil
+				r.db.duplicates[did] = d
+			}
+		}
+		// and import_jobs.admin_id
+		for jid, j := range r.db.imports {
+			if j.AdminID != nil && *j.AdminID == id {
+				j.AdminID = nil
+				r.db.imports[jid] = j
+			}
+		}
+		// exports.user_id and consents.user_id are ON DELETE CASCADE
+		for eid, e := range r.db.exports {
+			if e.UserID == id {
+				delete(r.db.exports, eid)
+			}
+		}
+		for cid, c := range r.db.consents {
+			if c.UserID == id {
+				delete(r.db.consents, cid)
+			}
+		}
+		// credentials.user_id is ON DELETE SET NULL
+		for cid, c := range r.db.credentials {
+			if c.UserID == id {
+				c.UserID = 0
+				r.db.credentials[cid] = c
+			}
+		}
+		delete(r.db.users, id)
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresAddressRepo struct {
+	DB DBTX
+}
+
+const addressColumns = `id,profile_id,type,line1,line2,locality,district,state,pin_code,created_at,updated_at`
+
+func scanAddress(row pgx.Row) (*models.Address, error) {
+	var a models.Address
+	if err := row.Scan(
+		&a.ID,
+		&a.ProfileID,
+		&a.Type,
+		&a.Line1,
+		&a.Line2,
+		&a.Locality,
+		&a.District,
+		&a.State,
+		&a.PinCode,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *PostgresAddressRepo) queryAddresses(ctx context.Context, query string, args ...any) ([]models.Address, error) {
+	rows, err := r.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	return addresses, rows.Err()
+}
+
+func (r *PostgresAddressRepo) List(ctx context.Context, profileID int) ([]models.Address, error) {
+	return r.queryAddresses(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE profile_id=$1
+		ORDER BY id
+	`, profileID)
+}
+
+func (r *PostgresAddressRepo) Create(ctx context.Context, address *models.Address) error {
+	query:=`
+		INSERT INTO addresses (profile_id,type,line1,line2,locality,district,state,pin_code)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		RETURNING id,created_at,updated_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		address.ProfileID,
+		address.Type,
+		address.Line1,
+		address.Line2,
+		address.Locality,
+		address.District,
+		address.State,
+		address.PinCode,
+	).Scan(&address.ID, &address.CreatedAt, &address.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresAddressRepo) Update(ctx context.Context, address *models.Address) error {
+	query:=`
+		UPDATE addresses
+		SET type=$3,line1=$4,line2=$5,locality=$6,district=$7,state=$8,pin_code=$9,updated_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND profile_id=$2
+		RETURNING created_at,updated_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		address.ID,
+		address.ProfileID,
+		address.Type,
+		address.Line1,
+		address.Line2,
+		address.Locality,
+		address.District,
+		address.State,
+		address.PinCode,
+	).Scan(&address.CreatedAt, &address.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresAddressRepo) Delete(ctx context.Context, profileID, id int) error {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM addresses WHERE id=$1 AND profile_id=$2`, id, profileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
+
+func (r *PostgresAddressRepo) Unchecked(ctx context.Context, afterID, limit int) ([]models.Address, error) {
+	return r.queryAddresses(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE pin_code='' AND id>$1
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+}
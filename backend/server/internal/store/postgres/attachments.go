@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresAttachmentRepo struct {
+	DB DBTX
+}
+
+const attachmentColumns = `a.id,a.profile_id,a.kind,a.file_name,a.content_type,a.size,a.sha256,a.blob_key,a.data_key,a.created_at`
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	var a models.Attachment
+	if err := row.Scan(
+		&a.ID,
+		&a.ProfileID,
+		&a.Kind,
+		&a.FileName,
+		&a.ContentType,
+		&a.Size,
+		&a.SHA256,
+		&a.BlobKey,
+		&a.DataKey,
+		&a.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *PostgresAttachmentRepo) list(ctx context.Context, query string, args ...any) ([]models.Attachment, error) {
+	rows, err := r.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresAttachmentRepo) List(ctx context.Context, profileID int) ([]models.Attachment, error) {
+	return r.list(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.profile_id=$1
+		ORDER BY a.id
+	`, profileID)
+}
+
+func (r *PostgresAttachmentRepo) Get(ctx context.Context, profileID, id int) (*models.Attachment, error) {
+	a, err := scanAttachment(r.DB.QueryRow(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		JOIN profiles p ON p.id=a.profile_id
+		WHERE a.id=$1 AND a.profile_id=$2 AND p.deleted_at IS NULL
+	`, id, profileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return a, err
+}
+
+func (r *PostgresAttachmentRepo) Create(ctx context.Context, a *models.Attachment) error {
+	query:=`
+		INSERT INTO attachments (profile_id,kind,file_name,content_type,size,sha256,blob_key,data_key)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		RETURNING id,created_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		a.ProfileID,
+		a.Kind,
+		a.FileName,
+		a.ContentType,
+		a.Size,
+		a.SHA256,
+		a.BlobKey,
+		a.DataKey,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresAttachmentRepo) Delete(ctx context.Context, profileID, id int) error {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM attachments WHERE id=$1 AND profile_id=$2`, id, profileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
+
+func (r *PostgresAttachmentRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Attachment, error) {
+	return r.list(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		JOIN profiles p ON p.id=a.profile_id
+		WHERE p.deleted_at<$1
+		ORDER BY a.id
+	`, before)
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// auditChainLock is the advisory lock key that serialises appends to audit_log.
+const auditChainLock = 7_261_001
+
+type PostgresAuditRepo struct {
+	DB DBTX
+}
+
+func (r *PostgresAuditRepo) Append(ctx context.Context, rec *models.AuditRecord) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock); err != nil {
+		return err
+	}
+
+	var head *models.AuditRecord
+	var last models.AuditRecord
+	err = tx.QueryRow(ctx, `
+		SELECT seq, hash
+		FROM audit_log
+		ORDER BY seq DESC
+		LIMIT 1
+	`).Scan(&last.Seq, &last.Hash)
+	switch {
+	case err == nil:
+		head = &last
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+
+	audit.Seal(head, rec)
+	query := `
+		INSERT INTO audit_log (seq,user_id,action,details,created_at,prev_hash,hash)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+	`
+	if _, err := tx.Exec(
+		ctx,
+		query,
+		rec.Seq,
+		rec.UserID,
+		rec.Action,
+		rec.Details,
+		rec.CreatedAt,
+		rec.PrevHash,
+		rec.Hash,
+	); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PostgresAuditRepo) List(ctx context.Context, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	query := `
+		SELECT seq,user_id,action,details,created_at,prev_hash,hash
+		FROM audit_log
+		WHERE seq>$1
+		ORDER BY seq
+		LIMIT $2
+	`
+	rows, err := r.DB.Query(ctx, query, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+	for rows.Next() {
+		var rec models.AuditRecord
+		if err := rows.Scan(
+			&rec.Seq,
+			&rec.UserID,
+			&rec.Action,
+			&rec.Details,
+			&rec.CreatedAt,
+			&rec.PrevHash,
+			&rec.Hash,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (r *PostgresAuditRepo) ForUser(ctx context.Context, userID int, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	query := `
+		SELECT seq,user_id,action,details,created_at,prev_hash,hash
+		FROM audit_log
+		WHERE user_id=$1 AND seq>$2
+		ORDER BY seq
+		LIMIT $3
+	`
+	rows, err := r.DB.Query(ctx, query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+	for rows.Next() {
+		var rec models.AuditRecord
+		if err := rows.Scan(
+			&rec.Seq,
+			&rec.UserID,
+			&rec.Action,
+			&rec.Details,
+			&rec.CreatedAt,
+			&rec.PrevHash,
+			&rec.Hash,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (r *PostgresAuditRepo) CreateCheckpoint(ctx context.Context, cp models.AuditCheckpoint) error {
+	query := `
+		INSERT INTO audit_checkpoints (seq,hash,signature,created_at)
+		VALUES ($1,$2,$3,$4)
+	`
+	_, err := r.DB.Exec(ctx, query, cp.Seq, cp.Hash, cp.Signature, cp.CreatedAt)
+	return err
+}
+
+func (r *PostgresAuditRepo) Checkpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT seq,hash,signature,created_at
+		FROM audit_checkpoints
+		ORDER BY seq
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditCheckpoint
+	for rows.Next() {
+		var cp models.AuditCheckpoint
+		if err := rows.Scan(&cp.Seq, &cp.Hash, &cp.Signature, &cp.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresConsentRepo struct {
+	DB DBTX
+}
+
+const consentColumns = `id,user_id,purpose,notice_version,granted_at,withdrawn_at`
+
+func scanConsent(row pgx.Row) (*models.Consent, error) {
+	var c models.Consent
+	if err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Purpose,
+		&c.NoticeVersion,
+		&c.GrantedAt,
+		&c.WithdrawnAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *PostgresConsentRepo) Grant(ctx context.Context, c *models.Consent) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE consents SET withdrawn_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND purpose=$2 AND withdrawn_at IS NULL
+	`, c.UserID, c.Purpose); err != nil {
+		return err
+	}
+	stored, err := scanConsent(tx.QueryRow(ctx, `
+		INSERT INTO consents (user_id,purpose,notice_version)
+		VALUES ($1,$2,$3)
+		RETURNING `+consentColumns,
+		c.UserID, c.Purpose, c.NoticeVersion,
+	))
+	switch {
+	case isUniqueViolation(err):
+		return models.AlreadyExists
+	case isForeignKeyViolation(err):
+		return models.NotFound
+	case err != nil:
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	*c = *stored
+	return nil
+}
+
+func (r *PostgresConsentRepo) Withdraw(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRow(ctx, `
+		UPDATE consents SET withdrawn_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND purpose=$2 AND withdrawn_at IS NULL
+		RETURNING `+consentColumns,
+		userID, purpose,
+	))
+}
+
+func (r *PostgresConsentRepo) Current(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRow(ctx, `
+		SELECT `+consentColumns+` FROM consents
+		WHERE user_id=$1 AND purpose=$2 AND withdrawn_at IS NULL
+	`, userID, purpose))
+}
+
+func (r *PostgresConsentRepo) Get(ctx context.Context, userID, id int) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRow(ctx, `
+		SELECT `+consentColumns+` FROM consents WHERE id=$1 AND user_id=$2
+	`, id, userID))
+}
+
+func (r *PostgresConsentRepo) List(ctx context.Context, userID int) ([]models.Consent, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+consentColumns+` FROM consents WHERE user_id=$1 ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []models.Consent
+	for rows.Next() {
+		c, err := scanConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, *c)
+	}
+	return consents, rows.Err()
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresCredentialRepo struct {
+	DB DBTX
+}
+
+// the references are cleared when a profile or account is purged
+const credentialColumns = `id,COALESCE(user_id,0),COALESCE(profile_id,0),fields,issued_at,expires_at,revoked_at`
+
+func scanCredential(row pgx.Row) (*models.Credential, error) {
+	var c models.Credential
+	var fields string
+	if err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ProfileID,
+		&fields,
+		&c.IssuedAt,
+		&c.ExpiresAt,
+		&c.RevokedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	c.Fields = strings.Split(fields, ",")
+	return &c, nil
+}
+
+func (r *PostgresCredentialRepo) Create(ctx context.Context, c *models.Credential) error {
+	stored, err := scanCredential(r.DB.QueryRow(ctx, `
+		INSERT INTO credentials (user_id,profile_id,fields,expires_at)
+		VALUES ($1,$2,$3,$4)
+		RETURNING `+credentialColumns,
+		c.UserID, c.ProfileID, strings.Join(c.Fields, ","), c.ExpiresAt,
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*c = *stored
+	return nil
+}
+
+func (r *PostgresCredentialRepo) Get(ctx context.Context, id int) (*models.Credential, error) {
+	return scanCredential(r.DB.QueryRow(ctx, `
+		SELECT `+credentialColumns+` FROM credentials WHERE id=$1
+	`, id))
+}
+
+func (r *PostgresCredentialRepo) List(ctx context.Context, userID, profileID int) ([]models.Credential, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+credentialColumns+` FROM credentials
+		WHERE user_id=$1 AND profile_id=$2
+		ORDER BY id DESC
+	`, userID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []models.Credential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *c)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *PostgresCredentialRepo) Revoke(ctx context.Context, userID, id int) (*models.Credential, error) {
+	return scanCredential(r.DB.QueryRow(ctx, `
+		UPDATE credentials SET revoked_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+		RETURNING `+credentialColumns,
+		id, userID,
+	))
+}
+
+func (r *PostgresCredentialRepo) RevokeProfile(ctx context.Context, profileID int) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE credentials SET revoked_at=CURRENT_TIMESTAMP WHERE profile_id=$1 AND revoked_at IS NULL
+	`, profileID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PostgresCredentialRepo) RevokeUser(ctx context.Context, userID int) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE credentials SET revoked_at=CURRENT_TIMESTAMP WHERE user_id=$1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PostgresCredentialRepo) Revoked(ctx context.Context, first, last int) ([]int, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id FROM credentials
+		WHERE id BETWEEN $1 AND $2 AND (revoked_at IS NOT NULL OR profile_id IS NULL)
+		ORDER BY id
+	`, first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
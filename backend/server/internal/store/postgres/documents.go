@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresDocumentRepo struct {
+	DB DBTX
+}
+
+const documentColumns = `id,profile_id,type,number,number_index,expires_on,created_at,updated_at`
+
+func scanDocument(row pgx.Row) (*models.IdentityDocument, error) {
+	var d models.IdentityDocument
+	if err := row.Scan(
+		&d.ID,
+		&d.ProfileID,
+		&d.Type,
+		&d.Number,
+		&d.NumberIndex,
+		&d.ExpiresOn,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *PostgresDocumentRepo) List(ctx context.Context, profileID int) ([]models.IdentityDocument, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+documentColumns+`
+		FROM identity_documents
+		WHERE profile_id=$1
+		ORDER BY id
+	`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.IdentityDocument{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *d)
+	}
+	return docs, rows.Err()
+}
+
+func (r *PostgresDocumentRepo) Get(ctx context.Context, profileID, id int) (*models.IdentityDocument, error) {
+	d, err := scanDocument(r.DB.QueryRow(ctx, `
+		SELECT `+documentColumns+`
+		FROM identity_documents
+		WHERE id=$1 AND profile_id=$2
+	`, id, profileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return d, err
+}
+
+func (r *PostgresDocumentRepo) Create(ctx context.Context, doc *models.IdentityDocument) error {
+	query:=`
+		INSERT INTO identity_documents (profile_id,type,number,number_index,expires_on)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id,created_at,updated_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		doc.ProfileID,
+		doc.Type,
+		doc.Number,
+		doc.NumberIndex,
+		doc.ExpiresOn,
+	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresDocumentRepo) Update(ctx context.Context, doc *models.IdentityDocument) error {
+	query:=`
+		UPDATE identity_documents
+		SET number=$3,number_index=$4,expires_on=$5,updated_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND profile_id=$2
+		RETURNING type,created_at,updated_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		doc.ID,
+		doc.ProfileID,
+		doc.Number,
+		doc.NumberIndex,
+		doc.ExpiresOn,
+	).Scan(&doc.Type, &doc.CreatedAt, &doc.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresDocumentRepo) Delete(ctx context.Context, profileID, id int) error {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM identity_documents WHERE id=$1 AND profile_id=$2`, id, profileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
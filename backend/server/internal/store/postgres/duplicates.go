@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresDuplicateRepo struct {
+	DB DBTX
+}
+
+const duplicateColumns = `d.id,d.profile_id,d.match_id,d.reasons,d.score,d.status,d.reviewer_id,d.note,d.created_at,d.resolved_at`
+
+func scanDuplicate(row pgx.Row) (*models.Duplicate, error) {
+	var d models.Duplicate
+	var reasons string
+	if err := row.Scan(
+		&d.ID,
+		&d.ProfileID,
+		&d.MatchID,
+		&reasons,
+		&d.Score,
+		&d.Status,
+		&d.ReviewerID,
+		&d.Note,
+		&d.CreatedAt,
+		&d.ResolvedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Reasons = strings.Split(reasons, ",")
+	return &d, nil
+}
+
+func (r *PostgresDuplicateRepo) Candidates(ctx context.Context, p *models.Profile, limit int) ([]models.Profile, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND user_id<>$1 AND (
+			($2<>'' AND aadhaar_index=$2) OR ($3<>'' AND phone_index=$3) OR date_of_birth=$4
+		)
+		ORDER BY ($2<>'' AND aadhaar_index=$2) DESC, ($3<>'' AND phone_index=$3) DESC, id
+		LIMIT $5
+	`, p.UserID, p.AadhaarIndex, p.PhoneIndex, p.DateOfBirth, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Profile{}
+	for rows.Next() {
+		c, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresDuplicateRepo) Flag(ctx context.Context, d *models.Duplicate) error {
+	query := `
+		INSERT INTO profile_duplicates AS d (profile_id,match_id,reasons,score)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (profile_id,match_id) DO UPDATE
+			SET reasons=EXCLUDED.reasons,score=EXCLUDED.score
+			WHERE d.status='pending'
+		RETURNING ` + duplicateColumns
+	stored, err := scanDuplicate(r.DB.QueryRow(ctx, query, d.ProfileID, d.MatchID, strings.Join(d.Reasons, ","), d.Score))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// the pair was resolved, and the WHERE kept it as it was
+		stored, err = getDuplicate(ctx, r.DB, `d.profile_id=$1 AND d.match_id=$2`, d.ProfileID, d.MatchID)
+	}
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*d = *stored
+	return nil
+}
+
+func getDuplicate(ctx context.Context, db DBTX, where string, args ...any) (*models.Duplicate, error) {
+	d, err := scanDuplicate(db.QueryRow(ctx, `
+		SELECT `+duplicateColumns+`
+		FROM profile_duplicates d
+		WHERE `+where, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return d, err
+}
+
+func (r *PostgresDuplicateRepo) Get(ctx context.Context, id int) (*models.Duplicate, error) {
+	return getDuplicate(ctx, r.DB, `d.id=$1`, id)
+}
+
+func (r *PostgresDuplicateRepo) Pair(ctx context.Context, d *models.Duplicate) ([]models.Profile, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND id IN ($1,$2)
+		ORDER BY id
+	`, d.ProfileID, d.MatchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresDuplicateRepo) Queue(ctx context.Context, limit int) ([]models.Duplicate, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+duplicateColumns+`
+		FROM profile_duplicates d
+		JOIN profiles p ON p.id=d.profile_id
+		JOIN profiles m ON m.id=d.match_id
+		WHERE d.status='pending' AND p.deleted_at IS NULL AND m.deleted_at IS NULL
+		ORDER BY d.created_at,d.id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Duplicate{}
+	for rows.Next() {
+		d, err := scanDuplicate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresDuplicateRepo) Resolve(ctx context.Context, d *models.Duplicate) error {
+	query := `
+		UPDATE profile_duplicates d
+		SET status=$2,reviewer_id=$3,note=$4,resolved_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND status='pending'
+		RETURNING ` + duplicateColumns
+	stored, err := scanDuplicate(r.DB.QueryRow(ctx, query, d.ID, d.Status, d.ReviewerID, d.Note))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.Get(ctx, d.ID); err != nil {
+			return err
+		}
+		return models.VersionConflict
+	}
+	if err != nil {
+		return err
+	}
+	*d = *stored
+	return nil
+}
+
+func (r *PostgresDuplicateRepo) Unindexed(ctx context.Context, afterID, limit int) ([]models.Profile, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND id>$1 AND ((aadhaar_number<>'' AND aadhaar_index='') OR phone_index='')
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresDuplicateRepo) SetIndexes(ctx context.Context, p *models.Profile) error {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE profiles SET aadhaar_index=$2,phone_index=$3 WHERE id=$1
+	`, p.ID, p.AadhaarIndex, p.PhoneIndex)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
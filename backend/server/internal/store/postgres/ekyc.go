@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type PostgresEKYCRepo struct {
+	DB DBTX
+}
+
+func (r *PostgresEKYCRepo) Create(ctx context.Context, v *models.EKYCVerification) error {
+	query:=`
+		INSERT INTO ekyc_verifications (
+			profile_id,source,reference_hash,document_hash,mobile_hash,email_hash,generated_at,
+			name_match,date_of_birth_match,address_match,aadhaar_match,mobile_match,verified
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+		RETURNING id,created_at
+	`
+	err := r.DB.QueryRow(
+		ctx,
+		query,
+		v.ProfileID,
+		v.Source,
+		v.ReferenceHash,
+		v.DocumentHash,
+		v.MobileHash,
+		v.EmailHash,
+		v.GeneratedAt,
+		v.NameMatch,
+		v.DateOfBirthMatch,
+		v.AddressMatch,
+		v.AadhaarMatch,
+		v.MobileMatch,
+		v.Verified,
+	).Scan(&v.ID, &v.CreatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresEKYCRepo) List(ctx context.Context, profileID int) ([]models.EKYCVerification, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id,profile_id,source,reference_hash,document_hash,mobile_hash,email_hash,generated_at,
+			name_match,date_of_birth_match,address_match,aadhaar_match,mobile_match,verified,created_at
+		FROM ekyc_verifications
+		WHERE profile_id=$1
+		ORDER BY id DESC
+	`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.EKYCVerification{}
+	for rows.Next() {
+		var v models.EKYCVerification
+		if err := rows.Scan(
+			&v.ID,
+			&v.ProfileID,
+			&v.Source,
+			&v.ReferenceHash,
+			&v.DocumentHash,
+			&v.MobileHash,
+			&v.EmailHash,
+			&v.GeneratedAt,
+			&v.NameMatch,
+			&v.DateOfBirthMatch,
+			&v.AddressMatch,
+			&v.AadhaarMatch,
+			&v.MobileMatch,
+			&v.Verified,
+			&v.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
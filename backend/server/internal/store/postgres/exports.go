@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresExportRepo struct {
+	DB DBTX
+}
+
+const exportColumns = `id,user_id,status,blob_key,data_key,size,created_at,completed_at,expires_at,downloaded_at`
+
+func scanExport(row pgx.Row) (*models.Export, error) {
+	var e models.Export
+	if err := row.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.BlobKey,
+		&e.DataKey,
+		&e.Size,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+		&e.DownloadedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *PostgresExportRepo) Create(ctx context.Context, e *models.Export) error {
+	stored, err := scanExport(r.DB.QueryRow(ctx, `
+		INSERT INTO exports (user_id)
+		VALUES ($1)
+		RETURNING `+exportColumns,
+		e.UserID,
+	))
+	switch {
+	case isUniqueViolation(err):
+		return models.AlreadyExists
+	case isForeignKeyViolation(err):
+		return models.NotFound
+	case err != nil:
+		return err
+	}
+	*e = *stored
+	return nil
+}
+
+func (r *PostgresExportRepo) Get(ctx context.Context, userID, id int) (*models.Export, error) {
+	return scanExport(r.DB.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM exports
+		WHERE id=$1 AND user_id=$2
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+	`, id, userID))
+}
+
+func (r *PostgresExportRepo) Finish(ctx context.Context, e *models.Export) error {
+	stored, err := scanExport(r.DB.QueryRow(ctx, `
+		UPDATE exports
+		SET status=$1, blob_key=$2, data_key=$3, size=$4, expires_at=$5, completed_at=CURRENT_TIMESTAMP
+		WHERE id=$6 AND status='pending'
+		RETURNING `+exportColumns,
+		e.Status, e.BlobKey, e.DataKey, e.Size, e.ExpiresAt, e.ID,
+	))
+	if err != nil {
+		return err
+	}
+	*e = *stored
+	return nil
+}
+
+func (r *PostgresExportRepo) Download(ctx context.Context, userID, id int, at time.Time) (*models.Export, error) {
+	return scanExport(r.DB.QueryRow(ctx, `
+		UPDATE exports
+		SET status='downloaded', downloaded_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND user_id=$2 AND status='ready' AND expires_at>$3
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+		RETURNING `+exportColumns,
+		id, userID, at,
+	))
+}
+
+func (r *PostgresExportRepo) Expire(ctx context.Context, at time.Time) ([]models.Export, error) {
+	rows, err := r.DB.Query(ctx, `
+		UPDATE exports
+		SET status='expired'
+		WHERE status='ready'
+		AND (expires_at<=$1 OR user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL))
+		RETURNING `+exportColumns,
+		at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []models.Export
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, *e)
+	}
+	return expired, rows.Err()
+}
+
+func (r *PostgresExportRepo) Abandon(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE exports
+		SET status='failed', completed_at=CURRENT_TIMESTAMP
+		WHERE status='pending' AND created_at<$1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
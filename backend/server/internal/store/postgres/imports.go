@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresImportRepo struct {
+	DB DBTX
+}
+
+const importColumns = `id,admin_id,format,dry_run,status,records,line,checksum,users,profiles,failed,created_at,updated_at,completed_at`
+
+func scanImport(row pgx.Row) (*models.ImportJob, error) {
+	var j models.ImportJob
+	if err := row.Scan(
+		&j.ID,
+		&j.AdminID,
+		&j.Format,
+		&j.DryRun,
+		&j.Status,
+		&j.Records,
+		&j.Line,
+		&j.Checksum,
+		&j.Users,
+		&j.Profiles,
+		&j.Failed,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+		&j.CompletedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *PostgresImportRepo) Create(ctx context.Context, job *models.ImportJob) error {
+	stored, err := scanImport(r.DB.QueryRow(ctx, `
+		INSERT INTO import_jobs (admin_id,format,dry_run)
+		VALUES ($1,$2,$3)
+		RETURNING `+importColumns,
+		job.AdminID, job.Format, job.DryRun,
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+func (r *PostgresImportRepo) Get(ctx context.Context, id int) (*models.ImportJob, error) {
+	return scanImport(r.DB.QueryRow(ctx, `
+		SELECT `+importColumns+` FROM import_jobs WHERE id=$1
+	`, id))
+}
+
+// distinct returns the distinct non-empty values key picks out of rows.
+func distinct(rows []models.ImportRow, key func(models.ImportRow) string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, row := range rows {
+		if v := key(row); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (r *PostgresImportRepo) Existing(ctx context.Context, rows []models.ImportRow) (*models.ImportExisting, error) {
+	e := &models.ImportExisting{
+		Accounts:   map[string]int{},
+		Usernames:  map[string]bool{},
+		VIDs:       map[string]bool{},
+		SelfPhones: map[string]bool{},
+		Self:       map[int]bool{},
+		Primary:    map[int]bool{},
+		Aadhaar:    map[int][]string{},
+	}
+	emails := distinct(rows, func(row models.ImportRow) string { return row.Email })
+	usernames := distinct(rows, func(row models.ImportRow) string { return row.Username })
+	vids := distinct(rows, func(row models.ImportRow) string { return row.Profile.VIDIndex })
+	phones := distinct(rows, func(row models.ImportRow) string { return row.Profile.PhoneNumber })
+
+	// one round trip; kind says which lookup a row answers
+	query := `
+		SELECT 'account',id,email,false,false FROM users WHERE deleted_at IS NULL AND email=ANY($1)
+		UNION ALL
+		SELECT 'username',0,username,false,false FROM users WHERE deleted_at IS NULL AND username=ANY($2)
+		UNION ALL
+		SELECT 'vid',0,vid_index,false,false FROM profiles WHERE deleted_at IS NULL AND vid_index<>'' AND vid_index=ANY($3)
+		UNION ALL
+		SELECT 'phone',0,phone_number,false,false FROM profiles WHERE deleted_at IS NULL AND relationship='self' AND phone_number=ANY($4)
+		UNION ALL
+		SELECT 'profile',p.user_id,p.aadhaar_index,p.relationship='self',p.is_primary
+		FROM profiles p
+		JOIN users u ON u.id=p.user_id
+		WHERE p.deleted_at IS NULL AND u.deleted_at IS NULL AND u.email=ANY($1)
+	`
+	result, err := r.DB.Query(ctx, query, emails, usernames, vids, phones)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var kind, value string
+		var id int
+		var self, primary bool
+		if err := result.Scan(&kind, &id, &value, &self, &primary); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "account":
+			e.Accounts[value] = id
+		case "username":
+			e.Usernames[value] = true
+		case "vid":
+			e.VIDs[value] = true
+		case "phone":
+			e.SelfPhones[value] = true
+		case "profile":
+			e.Self[id] = e.Self[id] || self
+			e.Primary[id] = e.Primary[id] || primary
+			if value != "" {
+				e.Aadhaar[id] = append(e.Aadhaar[id], value)
+			}
+		}
+	}
+	return e, result.Err()
+}
+
+// Insert copies the batch in with COPY. COPY cannot return the IDs it
+// assigns, so they are taken from the sequences first and copied in with the
+// rows.
+func (r *PostgresImportRepo) Insert(ctx context.Context, job *models.ImportJob, batch *models.ImportBatch) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// claim the job first: a second run of the same batch waits on the row
+	// lock and then finds the records moved on
+	query := `
+		UPDATE import_jobs
+		SET records=records+$3,line=$4,checksum=$5,users=users+$6,profiles=profiles+$7,failed=failed+$8,updated_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND records=$2 AND status='running'
+		RETURNING ` + importColumns
+	stored, err := scanImport(tx.QueryRow(ctx, query,
+		job.ID, job.Records,
+		batch.Records, batch.Line, batch.Checksum, len(batch.Users), len(batch.Rows), len(batch.Errors),
+	))
+	if errors.Is(err, models.NotFound) {
+		if _, err := (&PostgresImportRepo{DB: tx}).Get(ctx, job.ID); err != nil {
+			return err
+		}
+		return models.VersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if !stored.DryRun {
+		if err := copyImportRows(ctx, tx, batch); err != nil {
+			if isUniqueViolation(err) {
+				return models.AlreadyExists
+			}
+			if isForeignKeyViolation(err) {
+				return models.NotFound
+			}
+			return err
+		}
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"import_errors"},
+		[]string{"job_id", "line", "field", "message"},
+		pgx.CopyFromSlice(len(batch.Errors), func(i int) ([]any, error) {
+			e := batch.Errors[i]
+			return []any{job.ID, e.Line, e.Field, e.Message}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+// nextIDs takes n values from the sequence behind table's id column.
+func nextIDs(ctx context.Context, tx pgx.Tx, table string, n int) ([]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT nextval(pg_get_serial_sequence($1,'id')) FROM generate_series(1,$2)
+	`, table, n)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+func copyImportRows(ctx context.Context, tx pgx.Tx, batch *models.ImportBatch) error {
+	userIDs, err := nextIDs(ctx, tx, "users", len(batch.Users))
+	if err != nil {
+		return err
+	}
+	accounts := map[string]int{}
+	for i := range batch.Users {
+		batch.Users[i].ID = userIDs[i]
+		accounts[batch.Users[i].Email] = userIDs[i]
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"users"},
+		[]string{"id", "email", "username", "password_hash", "role"},
+		pgx.CopyFromSlice(len(batch.Users), func(i int) ([]any, error) {
+			u := batch.Users[i]
+			return []any{u.ID, u.Email, u.Username, u.PasswordHash, u.Role}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	profileIDs, err := nextIDs(ctx, tx, "profiles", len(batch.Rows))
+	if err != nil {
+		return err
+	}
+	for i := range batch.Rows {
+		p := &batch.Rows[i].Profile
+		p.ID, p.Version = profileIDs[i], 1
+		if p.UserID == 0 {
+			p.UserID = accounts[batch.Rows[i].Email]
+		}
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"profiles"},
+		[]string{"id", "user_id", "full_name", "date_of_birth", "phone_number", "address", "aadhaar_number", "vid", "vid_index", "aadhaar_index", "phone_index", "aadhaar_form", "relationship", "is_primary"},
+		pgx.CopyFromSlice(len(batch.Rows), func(i int) ([]any, error) {
+			p := batch.Rows[i].Profile
+			return []any{
+				p.ID,
+				p.UserID,
+				p.FullName,
+				p.DateOfBirth,
+				p.PhoneNumber,
+				p.Address,
+				p.AadhaarNumber,
+				p.VID,
+				p.VIDIndex,
+				p.AadhaarIndex,
+				p.PhoneIndex,
+				p.AadhaarForm,
+				p.Relationship,
+				p.IsPrimary,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	return recordVersions(ctx, tx, models.ProfileCreated, profileIDs...)
+}
+
+func (r *PostgresImportRepo) Complete(ctx context.Context, job *models.ImportJob) error {
+	stored, err := scanImport(r.DB.QueryRow(ctx, `
+		UPDATE import_jobs
+		SET status='completed',updated_at=CURRENT_TIMESTAMP,completed_at=CURRENT_TIMESTAMP
+		WHERE id=$1
+		RETURNING `+importColumns,
+		job.ID,
+	))
+	if err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+func (r *PostgresImportRepo) Errors(ctx context.Context, id int) ([]models.ImportError, error) {
+	if _, err := r.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Query(ctx, `
+		SELECT line,field,message FROM import_errors WHERE job_id=$1 ORDER BY line
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.ImportError{}
+	for rows.Next() {
+		var e models.ImportError
+		if err := rows.Scan(&e.Line, &e.Field, &e.Message); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
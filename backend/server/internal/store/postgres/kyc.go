@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresKYCRepo struct {
+	DB DBTX
+}
+
+const kycColumns = `k.profile_id,p.user_id,k.status,k.reviewer_id,k.claimed_at,k.reason_code,k.note,
+	k.submitted_at,k.verified_at,k.version,k.updated_at`
+
+func scanKYC(row pgx.Row) (*models.KYC, error) {
+	var k models.KYC
+	if err := row.Scan(
+		&k.ProfileID,
+		&k.UserID,
+		&k.Status,
+		&k.ReviewerID,
+		&k.ClaimedAt,
+		&k.ReasonCode,
+		&k.Note,
+		&k.SubmittedAt,
+		&k.VerifiedAt,
+		&k.Version,
+		&k.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *PostgresKYCRepo) Get(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := scanKYC(r.DB.QueryRow(ctx, `
+		SELECT `+kycColumns+`
+		FROM profile_kyc k
+		JOIN profiles p ON p.id=k.profile_id
+		WHERE k.profile_id=$1 AND p.deleted_at IS NULL
+	`, profileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return k, err
+}
+
+func (r *PostgresKYCRepo) GetForUpdate(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := scanKYC(r.DB.QueryRow(ctx, `
+		SELECT `+kycColumns+`
+		FROM profile_kyc k
+		JOIN profiles p ON p.id=k.profile_id
+		WHERE k.profile_id=$1 AND p.deleted_at IS NULL
+		FOR UPDATE OF k
+	`, profileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return k, err
+}
+
+func (r *PostgresKYCRepo) Save(ctx context.Context, k *models.KYC) error {
+	var err error
+	if k.Version == 0 {
+		query:=`
+			INSERT INTO profile_kyc (profile_id,status,reviewer_id,claimed_at,reason_code,note,submitted_at,verified_at)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+			RETURNING version,updated_at
+		`
+		err = r.DB.QueryRow(
+			ctx,
+			query,
+			k.ProfileID,
+			k.Status,
+			k.ReviewerID,
+			k.ClaimedAt,
+			k.ReasonCode,
+			k.Note,
+			k.SubmittedAt,
+			k.VerifiedAt,
+		).Scan(&k.Version, &k.UpdatedAt)
+		if isUniqueViolation(err) {
+			// another request created the row first
+			return models.VersionConflict
+		}
+	} else {
+		query:=`
+			UPDATE profile_kyc
+			SET status=$2,reviewer_id=$3,claimed_at=$4,reason_code=$5,note=$6,submitted_at=$7,verified_at=$8,
+				version=version+1,updated_at=CURRENT_TIMESTAMP
+			WHERE profile_id=$1 AND version=$9
+			RETURNING version,updated_at
+		`
+		err = r.DB.QueryRow(
+			ctx,
+			query,
+			k.ProfileID,
+			k.Status,
+			k.ReviewerID,
+			k.ClaimedAt,
+			k.ReasonCode,
+			k.Note,
+			k.SubmittedAt,
+			k.VerifiedAt,
+			k.Version,
+		).Scan(&k.Version, &k.UpdatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.VersionConflict
+		}
+	}
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	return err
+}
+
+func (r *PostgresKYCRepo) Queue(ctx context.Context, limit int) ([]models.KYC, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+kycColumns+`
+		FROM profile_kyc k
+		JOIN profiles p ON p.id=k.profile_id
+		WHERE k.status IN ('submitted','under_review') AND p.deleted_at IS NULL
+		ORDER BY k.submitted_at,k.profile_id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.KYC{}
+	for rows.Next() {
+		k, err := scanKYC(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *k)
+	}
+	return out, rows.Err()
+}
+
+func (r *PostgresKYCRepo) Expire(ctx context.Context, verifiedBefore time.Time) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE profile_kyc
+		SET status='expired',version=version+1,updated_at=CURRENT_TIMESTAMP
+		WHERE status='verified' AND verified_at<$1
+	`, verifiedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
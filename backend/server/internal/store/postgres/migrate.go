@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLock is the advisory lock key held while migrations run, so that
+// several replicas starting at once apply each version exactly once.
+const migrationLock = 7_261_000
+
+var ErrUnknownVersion = errors.New("database has a migration this binary does not know about")
+
+type Migrator struct {
+	Pool       *pgxpool.Pool
+	Migrations []migrations.Migration
+}
+
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	all, err := migrations.All()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{Pool: pool, Migrations: all}, nil
+}
+
+// adoptable are the migrations whose tables databases set up before
+// migrations existed may already have, by the old init.sql or golang-migrate.
+var adoptable = []struct {
+	version int64
+	table   string
+}{
+	{1, "users"},
+	{2, "profiles"},
+	{3, "audit_log"},
+}
+
+func (m *Migrator) ensureMigrationsTable(ctx context.Context, conn *pgxpool.Conn) error {
+	// golang-migrate, which the README used to recommend, keeps (version, dirty)
+	// in a table of the same name. Move it aside instead of misreading it.
+	var legacy bool
+	if err := conn.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema=current_schema() AND table_name='schema_migrations' AND column_name='dirty'
+		)
+	`).Scan(&legacy); err != nil {
+		return err
+	}
+	if legacy {
+		if _, err := conn.Exec(ctx, `ALTER TABLE schema_migrations RENAME TO schema_migrations_golang_migrate`); err != nil {
+			return err
+		}
+	}
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return err
+	}
+
+	// A database that has the tables of the first migrations without a record
+	// of them was set up by hand; record them instead of failing to create
+	// the tables again. Later migrations adapt what they find.
+	for _, a := range adoptable {
+		mig, ok := m.migration(a.version)
+		if !ok {
+			continue
+		}
+		if _, err := conn.Exec(ctx, `
+			INSERT INTO schema_migrations (version,name)
+			SELECT $1::BIGINT,$2::TEXT WHERE to_regclass($3) IS NOT NULL
+		`, mig.Version, mig.Name, a.table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn, applied map[int64]time.Time) error) error {
+	conn, err := m.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	if err := m.ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for version := range applied {
+		if !m.known(version) {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	return fn(conn, applied)
+}
+
+func (m *Migrator) known(version int64) bool {
+	_, ok := m.migration(version)
+	return ok
+}
+
+func (m *Migrator) migration(version int64) (migrations.Migration, bool) {
+	for _, mig := range m.Migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return migrations.Migration{}, false
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]migrations.Status, error) {
+	var status []migrations.Status
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int64]time.Time) error {
+		for _, mig := range m.Migrations {
+			at, ok := applied[mig.Version]
+			status = append(status, migrations.Status{Migration: mig, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return status, err
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the migrations it applied. With dryRun nothing is executed and
+// the migrations that would have run are returned instead.
+func (m *Migrator) Up(ctx context.Context, dryRun bool) ([]migrations.Migration, error) {
+	var done []migrations.Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int64]time.Time) error {
+		for _, mig := range m.Migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if !dryRun {
+				if err := runMigration(ctx, conn, mig.Up, func(tx pgx.Tx) error {
+					_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version,name) VALUES ($1,$2)`, mig.Version, mig.Name)
+					return err
+				}); err != nil {
+					return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+				}
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int, dryRun bool) ([]migrations.Migration, error) {
+	var done []migrations.Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int64]time.Time) error {
+		for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.Migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if !dryRun {
+				if err := runMigration(ctx, conn, mig.Down, func(tx pgx.Tx) error {
+					_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version=$1`, mig.Version)
+					return err
+				}); err != nil {
+					return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+				}
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func runMigration(ctx context.Context, conn *pgxpool.Conn, sql string, record func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresPhotoRepo struct {
+	DB DBTX
+}
+
+const photoColumns = `ph.profile_id,ph.blob_prefix,ph.data_key,ph.updated_at`
+
+func scanPhoto(row pgx.Row) (*models.Photo, error) {
+	var p models.Photo
+	if err := row.Scan(&p.ProfileID, &p.BlobPrefix, &p.DataKey, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PostgresPhotoRepo) Get(ctx context.Context, profileID int) (*models.Photo, error) {
+	p, err := scanPhoto(r.DB.QueryRow(ctx, `
+		SELECT `+photoColumns+`
+		FROM profile_photos ph
+		JOIN profiles p ON p.id=ph.profile_id
+		WHERE ph.profile_id=$1 AND p.deleted_at IS NULL
+	`, profileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return p, err
+}
+
+func (r *PostgresPhotoRepo) Put(ctx context.Context, p *models.Photo) error {
+	query:=`
+		INSERT INTO profile_photos (profile_id,blob_prefix,data_key)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (profile_id) DO UPDATE
+		SET blob_prefix=EXCLUDED.blob_prefix,data_key=EXCLUDED.data_key,updated_at=CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+	err := r.DB.QueryRow(ctx, query, p.ProfileID, p.BlobPrefix, p.DataKey).Scan(&p.UpdatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresPhotoRepo) Delete(ctx context.Context, profileID int) error {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM profile_photos WHERE profile_id=$1`, profileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
+
+func (r *PostgresPhotoRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Photo, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+photoColumns+`
+		FROM profile_photos ph
+		JOIN profiles p ON p.id=ph.profile_id
+		WHERE p.deleted_at<$1
+		ORDER BY ph.profile_id
+	`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Photo{}
+	for rows.Next() {
+		p, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
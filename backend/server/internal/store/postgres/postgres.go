@@ -1,13 +1,64 @@
 package store
 
 import (
+	"context"
+
 	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DBTX is satisfied by both *pgxpool.Pool and pgx.Tx, so the same repository
+// code runs on the pool or inside a transaction. Begin on a pgx.Tx opens a
+// savepoint, which is what makes the repositories' own transactions nest.
+type DBTX interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func NewPostgresRepo(pool *pgxpool.Pool) *repository.Repository {
+	return newRepo(pool)
+}
+
+func newRepo(db DBTX) *repository.Repository {
 	return &repository.Repository{
-		Users:    &PostgresUserRepo{Pool: pool},
-		Profiles: &PostgresProfileRepo{Pool: pool},
+		Users:       &PostgresUserRepo{DB: db},
+		Profiles:    &PostgresProfileRepo{DB: db},
+		Addresses:   &PostgresAddressRepo{DB: db},
+		Documents:   &PostgresDocumentRepo{DB: db},
+		EKYC:        &PostgresEKYCRepo{DB: db},
+		KYC:         &PostgresKYCRepo{DB: db},
+		Attachments: &PostgresAttachmentRepo{DB: db},
+		Photos:      &PostgresPhotoRepo{DB: db},
+		Duplicates:  &PostgresDuplicateRepo{DB: db},
+		Imports:     &PostgresImportRepo{DB: db},
+		Exports:     &PostgresExportRepo{DB: db},
+		Consents:    &PostgresConsentRepo{DB: db},
+		ShareLinks:  &PostgresShareLinkRepo{DB: db},
+		Credentials: &PostgresCredentialRepo{DB: db},
+		Audit:       &PostgresAuditRepo{DB: db},
+		Sessions:    &PostgresSessionRepo{DB: db},
+		Tx:          &PostgresTransactor{DB: db},
+	}
+}
+
+type PostgresTransactor struct {
+	DB DBTX
+}
+
+func (t *PostgresTransactor) WithTx(ctx context.Context, fn func(tx *repository.Repository) error) error {
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// after Commit this is a no-op; on error or panic it undoes fn's work
+	defer tx.Rollback(ctx)
+
+	if err := fn(newRepo(tx)); err != nil {
+		return err
 	}
-}
\ No newline at end of file
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/repository/repotest"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestConformance runs against the database in TEST_DB_URL, which it migrates
+// and then empties before every subtest. Never point it at real data.
+func TestConformance(t *testing.T) {
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	m, err := NewMigrator(pool)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if _, err := m.Up(ctx, false); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		if _, err := pool.Exec(ctx, `
+			TRUNCATE users, profiles, profile_versions, addresses, identity_documents, ekyc_verifications, profile_kyc, attachments, profile_photos, profile_duplicates, import_jobs, import_errors, exports, consents, share_links, credentials, audit_log, audit_checkpoints, revoked_sessions
+			RESTART IDENTITY CASCADE
+		`); err != nil {
+			t.Fatalf("reset database: %v", err)
+		}
+		return NewPostgresRepo(pool)
+	})
+}
@@ -3,55 +3,144 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/Raaffs/profileManager/server/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 type PostgresProfileRepo struct {
-	Pool *pgxpool.Pool
+	DB DBTX
 }
 
-func (r *PostgresProfileRepo) GetByUserID(ctx context.Context, userID int) (*models.Profile, error) {
+const profileColumns = `id,user_id,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,vid_index,aadhaar_index,phone_index,aadhaar_form,relationship,is_primary,version,created_at,updated_at`
+
+func scanProfile(row pgx.Row) (*models.Profile, error) {
 	var p models.Profile
-	query:=`
-		SELECT 
-		user_id,
-		full_name,
-		date_of_birth,
-		phone_number,
-		address,
-		aadhaar_number
-		FROM profiles
-		WHERE user_id=$1
-	`
-     if err:=r.Pool.QueryRow(
-		ctx,
-		query,
-		userID,
-	).Scan(
+	if err := row.Scan(
+		&p.ID,
 		&p.UserID,
 		&p.FullName,
 		&p.DateOfBirth,
 		&p.PhoneNumber,
 		&p.Address,
 		&p.AadhaarNumber,
-	);err!=nil{
+		&p.VID,
+		&p.VIDIndex,
+		&p.AadhaarIndex,
+		&p.PhoneIndex,
+		&p.AadhaarForm,
+		&p.Relationship,
+		&p.IsPrimary,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// getProfile returns the live profile matching the condition, which may use
+// the args as $1, $2 and so on.
+func getProfile(ctx context.Context, db DBTX, where string, args ...any) (*models.Profile, error) {
+	query:=`
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND `+where
+	p, err := scanProfile(db.QueryRow(ctx, query, args...))
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows){
 			return nil, models.NotFound
 		}
 		return nil, err
 	}
-	return &p, nil
+	return p, nil
+}
+
+func (r *PostgresProfileRepo) GetByUserID(ctx context.Context, userID int) (*models.Profile, error) {
+	return getProfile(ctx, r.DB, `user_id=$1 AND is_primary`, userID)
+}
+
+func (r *PostgresProfileRepo) Get(ctx context.Context, userID, id int) (*models.Profile, error) {
+	return getProfile(ctx, r.DB, `user_id=$1 AND id=$2`, userID, id)
+}
+
+func (r *PostgresProfileRepo) List(ctx context.Context, userID int) ([]models.Profile, error) {
+	query:=`
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE user_id=$1 AND deleted_at IS NULL
+		ORDER BY is_primary DESC, id
+	`
+	rows, err := r.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []models.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *p)
+	}
+	return profiles, rows.Err()
+}
+
+// isUniqueViolation and isForeignKeyViolation match the postgres error codes
+// that the repositories translate into models.AlreadyExists and models.NotFound.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
 }
 
-func (r *PostgresProfileRepo) Create(ctx context.Context, profile models.Profile) error {
+// recordVersions copies the current state of the given profile rows into
+// profile_versions. It must run in the transaction that made the change, so
+// history can never disagree with the profile. Ciphertext is copied as is.
+func recordVersions(ctx context.Context, tx pgx.Tx, change string, profileIDs ...int) error {
+	if len(profileIDs) == 0 {
+		return nil
+	}
 	query:=`
-		INSERT INTO profiles (user_id,full_name,date_of_birth,phone_number,address,aadhaar_number)
-		VALUES ($1,$2,$3,$4,$5,$6)
+		INSERT INTO profile_versions
+			(profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,changed_at)
+		SELECT id,user_id,$1,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,CURRENT_TIMESTAMP
+		FROM profiles
+		WHERE id=ANY($2)
 	`
-	_,err:=r.Pool.Exec(
+	_, err := tx.Exec(ctx, query, change, profileIDs)
+	return err
+}
+
+// Create inserts the profile and fills in its ID and Version.
+func (r *PostgresProfileRepo) Create(ctx context.Context, profile *models.Profile) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	profile.AadhaarForm = models.AadhaarFormOf(profile.AadhaarNumber, profile.VID)
+	// the partial unique index on primaries settles two concurrent first profiles
+	query:=`
+		INSERT INTO profiles (user_id,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,vid_index,aadhaar_index,phone_index,aadhaar_form,relationship,is_primary)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,NOT EXISTS (
+			SELECT 1 FROM profiles WHERE user_id=$1 AND is_primary AND deleted_at IS NULL
+		))
+		RETURNING id,version,is_primary
+	`
+	err=tx.QueryRow(
 		ctx,
 		query,
 		profile.UserID,
@@ -60,48 +149,296 @@ func (r *PostgresProfileRepo) Create(ctx context.Context, profile models.Profile
 		profile.PhoneNumber,
 		profile.Address,
 		profile.AadhaarNumber,
-	)
+		profile.VID,
+		profile.VIDIndex,
+		profile.AadhaarIndex,
+		profile.PhoneIndex,
+		profile.AadhaarForm,
+		profile.Relationship,
+	).Scan(&profile.ID, &profile.Version, &profile.IsPrimary)
 	
 	if err!=nil{
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		if isUniqueViolation(err) {
 			return models.AlreadyExists
 		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileCreated, profile.ID); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit(ctx)
 }
 
-func (r *PostgresProfileRepo) Update(ctx context.Context, profile models.Profile) error {
-	query:=`
+// Update overwrites every editable field of the profile. See Patch for the
+// version check.
+func (r *PostgresProfileRepo) Update(ctx context.Context, profile *models.Profile) error {
+	return r.Patch(ctx, profile, models.ProfileFields)
+}
+
+// Patch writes only the named fields of profile, and only if the stored row is
+// still at profile.Version. On success the version is bumped. A profile that
+// exists but has moved on returns models.VersionConflict so callers can tell
+// lost updates from missing profiles.
+func (r *PostgresProfileRepo) Patch(ctx context.Context, profile *models.Profile, fields []string) error {
+	var set []string
+	var args []any
+	for _, field := range fields {
+		var value any
+		switch field {
+		case models.FieldFullName:
+			value = profile.FullName
+		case models.FieldDateOfBirth:
+			value = profile.DateOfBirth
+		case models.FieldAadhaarNumber:
+			args = append(args, profile.AadhaarIndex)
+			set = append(set, fmt.Sprintf("aadhaar_index=$%d", len(args)))
+			value = profile.AadhaarNumber
+		case models.FieldVID:
+			// the blind index always moves with the VID
+			args = append(args, profile.VIDIndex)
+			set = append(set, fmt.Sprintf("vid_index=$%d", len(args)))
+			value = profile.VID
+		case models.FieldPhoneNumber:
+			args = append(args, profile.PhoneIndex)
+			set = append(set, fmt.Sprintf("phone_index=$%d", len(args)))
+			value = profile.PhoneNumber
+		case models.FieldAddress:
+			value = profile.Address
+		default:
+			return fmt.Errorf("unknown profile field %q", field)
+		}
+		args = append(args, value)
+		// field names come from the switch above, never from the caller
+		set = append(set, fmt.Sprintf("%s=$%d", field, len(args)))
+	}
+	if slices.Contains(fields, models.FieldAadhaarNumber) || slices.Contains(fields, models.FieldVID) {
+		// profile carries both numbers, so the form follows from them
+		profile.AadhaarForm = models.AadhaarFormOf(profile.AadhaarNumber, profile.VID)
+		args = append(args, profile.AadhaarForm)
+		set = append(set, fmt.Sprintf("aadhaar_form=$%d", len(args)))
+	}
+	args = append(args, profile.UserID, profile.ID, profile.Version)
+	n := len(args)
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query:=fmt.Sprintf(`
 		UPDATE profiles
-		SET full_name=$1,
-		    date_of_birth=$2,
-			phone_number=$3,
-			address=$4,
-			aadhaar_number=$5
-		WHERE user_id=$6
-	`
-	_,err:=r.Pool.Exec(
-		ctx,
-		query,
-		profile.FullName,
-		profile.DateOfBirth,
-		profile.PhoneNumber,
-		profile.Address,
-		profile.AadhaarNumber,
-		profile.UserID,
-	);if err!=nil{
+		SET %s,
+			version=version+1,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE user_id=$%d AND deleted_at IS NULL AND id=$%d AND version=$%d
+		RETURNING version
+	`, strings.Join(set, ","), n-2, n-1, n)
+	err=tx.QueryRow(ctx, query, args...).Scan(&profile.Version);if err!=nil{
 		if errors.Is(err, pgx.ErrNoRows){
+			current, err := getProfile(ctx, tx, `user_id=$1 AND id=$2`, profile.UserID, profile.ID)
+			if err != nil {
+				return err
+			}
+			if current.Version != profile.Version {
+				return models.VersionConflict
+			}
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileUpdated, profile.ID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SetPrimary moves the primary flag to the given profile. The old primary is
+// cleared first, as the unique index is checked statement by statement.
+func (r *PostgresProfileRepo) SetPrimary(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE profiles
+		SET is_primary=FALSE
+		WHERE user_id=$1 AND is_primary AND deleted_at IS NULL AND id<>$2
+	`, userID, id)
+	if err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE profiles
+		SET is_primary=TRUE
+		WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL
+	`, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// Delete soft-deletes one of the user's profiles. It stays restorable until the
+// purge worker erases it after the retention period. A deleted primary hands
+// the flag on, so an account with live profiles always has a primary.
+func (r *PostgresProfileRepo) Delete(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query:=`
+		UPDATE profiles AS p
+		SET deleted_at=CURRENT_TIMESTAMP, is_primary=FALSE
+		FROM (SELECT is_primary FROM profiles WHERE id=$2) AS old
+		WHERE p.user_id=$1 AND p.id=$2 AND p.deleted_at IS NULL
+		RETURNING old.is_primary
+	`
+	var wasPrimary bool
+	if err := tx.QueryRow(ctx, query, userID, id).Scan(&wasPrimary); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return models.NotFound
 		}
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileDeleted, id); err != nil {
+		return err
+	}
+	if wasPrimary {
+		query=`
+			UPDATE profiles
+			SET is_primary=TRUE
+			WHERE id=(
+				SELECT id FROM profiles
+				WHERE user_id=$1 AND deleted_at IS NULL
+				ORDER BY relationship='self' DESC, id
+				LIMIT 1
+			)
+		`
+		if _, err := tx.Exec(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// Restore brings back one of the user's deleted profiles, provided the user is
+// live and the profile does not collide with a live one.
+func (r *PostgresProfileRepo) Restore(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query:=`
+		UPDATE profiles
+		SET deleted_at=NULL,
+			is_primary=NOT EXISTS (SELECT 1 FROM profiles WHERE user_id=$1 AND is_primary AND deleted_at IS NULL)
+		WHERE id=$2 AND user_id=$1 AND deleted_at IS NOT NULL
+		AND EXISTS (SELECT 1 FROM users WHERE id=$1 AND deleted_at IS NULL)
+		RETURNING id
+	`
+	if err := tx.QueryRow(ctx, query, userID, id).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
 			return models.AlreadyExists
 		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NotFound
+		}
 		return err
 	}
-	return nil
+	if err := recordVersions(ctx, tx, models.ProfileRestored, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Purge permanently erases profiles soft-deleted before the cutoff.
+func (r *PostgresProfileRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM profiles WHERE deleted_at<$1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PostgresProfileRepo) History(ctx context.Context, userID int) ([]models.ProfileVersion, error) {
+	query:=`
+		SELECT id,profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,changed_at
+		FROM profile_versions
+		WHERE user_id=$1
+		ORDER BY id
+	`
+	rows, err := r.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.ProfileVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
 }
 
-func (r *PostgresProfileRepo) Delete(ctx context.Context, userID int) error {
-	return nil
+// AsOf returns one of the user's profiles as it stood at the given time. A
+// profile that was deleted at that point counts as not found.
+func (r *PostgresProfileRepo) AsOf(ctx context.Context, userID, id int, at time.Time) (*models.ProfileVersion, error) {
+	query:=`
+		SELECT id,profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,changed_at
+		FROM profile_versions
+		WHERE user_id=$1 AND profile_id=$2 AND changed_at<=$3
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	`
+	v, err := scanVersion(r.DB.QueryRow(ctx, query, userID, id, at))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	if v.Change == models.ProfileDeleted {
+		return nil, models.NotFound
+	}
+	return v, nil
+}
+
+func scanVersion(row pgx.Row) (*models.ProfileVersion, error) {
+	var v models.ProfileVersion
+	if err := row.Scan(
+		&v.Version,
+		&v.Profile.ID,
+		&v.Profile.UserID,
+		&v.Change,
+		&v.Profile.FullName,
+		&v.Profile.DateOfBirth,
+		&v.Profile.PhoneNumber,
+		&v.Profile.Address,
+		&v.Profile.AadhaarNumber,
+		&v.Profile.VID,
+		&v.ChangedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &v, nil
 }
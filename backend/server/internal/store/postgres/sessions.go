@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresSessionRepo struct {
+	DB DBTX
+}
+
+func (r *PostgresSessionRepo) RevokeAll(ctx context.Context, userID int) error {
+	query := `
+		INSERT INTO revoked_sessions (user_id,revoked_at)
+		VALUES ($1,CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at=EXCLUDED.revoked_at
+	`
+	_, err := r.DB.Exec(ctx, query, userID)
+	return err
+}
+
+func (r *PostgresSessionRepo) RevokedAt(ctx context.Context, userID int) (time.Time, error) {
+	var at time.Time
+	err := r.DB.QueryRow(ctx, `SELECT revoked_at FROM revoked_sessions WHERE user_id=$1`, userID).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return at, err
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type PostgresShareLinkRepo struct {
+	DB DBTX
+}
+
+const shareLinkColumns = `id,user_id,profile_id,fields,pin_hash,pin_failures,accesses,last_accessed_at,created_at,expires_at,revoked_at`
+
+func scanShareLink(row pgx.Row) (*models.ShareLink, error) {
+	var l models.ShareLink
+	var fields string
+	if err := row.Scan(
+		&l.ID,
+		&l.UserID,
+		&l.ProfileID,
+		&fields,
+		&l.PINHash,
+		&l.PINFailures,
+		&l.Accesses,
+		&l.LastAccessedAt,
+		&l.CreatedAt,
+		&l.ExpiresAt,
+		&l.RevokedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	l.Fields = strings.Split(fields, ",")
+	return &l, nil
+}
+
+func (r *PostgresShareLinkRepo) Create(ctx context.Context, l *models.ShareLink) error {
+	stored, err := scanShareLink(r.DB.QueryRow(ctx, `
+		INSERT INTO share_links (user_id,profile_id,fields,pin_hash,expires_at)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING `+shareLinkColumns,
+		l.UserID, l.ProfileID, strings.Join(l.Fields, ","), l.PINHash, l.ExpiresAt,
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*l = *stored
+	return nil
+}
+
+func (r *PostgresShareLinkRepo) Get(ctx context.Context, id int) (*models.ShareLink, error) {
+	return scanShareLink(r.DB.QueryRow(ctx, `
+		SELECT `+shareLinkColumns+` FROM share_links WHERE id=$1
+	`, id))
+}
+
+func (r *PostgresShareLinkRepo) List(ctx context.Context, userID, profileID int) ([]models.ShareLink, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+shareLinkColumns+` FROM share_links
+		WHERE user_id=$1 AND profile_id=$2
+		ORDER BY id DESC
+	`, userID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.ShareLink
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+func (r *PostgresShareLinkRepo) Revoke(ctx context.Context, userID, id int) (*models.ShareLink, error) {
+	return scanShareLink(r.DB.QueryRow(ctx, `
+		UPDATE share_links SET revoked_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+		RETURNING `+shareLinkColumns,
+		id, userID,
+	))
+}
+
+func (r *PostgresShareLinkRepo) Accessed(ctx context.Context, id int, at time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE share_links SET accesses=accesses+1,last_accessed_at=$2 WHERE id=$1
+	`, id, at)
+	return err
+}
+
+func (r *PostgresShareLinkRepo) TakePINAttempt(ctx context.Context, id, max int) (int, error) {
+	var failures int
+	err := r.DB.QueryRow(ctx, `
+		UPDATE share_links SET pin_failures=pin_failures+1 WHERE id=$1 AND pin_failures<$2
+		RETURNING pin_failures
+	`, id, max).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.NotFound
+	}
+	return failures, err
+}
+
+func (r *PostgresShareLinkRepo) ReturnPINAttempt(ctx context.Context, id int) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE share_links SET pin_failures=pin_failures-1 WHERE id=$1 AND pin_failures>0
+	`, id)
+	return err
+}
+
+func (r *PostgresShareLinkRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM share_links WHERE expires_at<$1 OR revoked_at<$1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -3,28 +3,36 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/Raaffs/profileManager/server/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostgresUserRepo struct {
-	Pool *pgxpool.Pool
+	DB DBTX
 }
 
 func (r *PostgresUserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
 	var u models.User
 	query := `
-		SELECT id,email,username
+		SELECT id,email,username,password_hash,role,created_at,updated_at
 		FROM users
+		WHERE id=$1 AND deleted_at IS NULL
 	`
-	if err := r.Pool.QueryRow(ctx, query, id).Scan(
+	if err := r.DB.QueryRow(ctx, query, id).Scan(
 		&u.ID,
 		&u.Email,
 		&u.Username,
+		&u.PasswordHash,
+		&u.Role,
+		&u.CreatedAt,
+		&u.UpdatedAt,
 	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NotFound
+		}
 		return nil, err
 	}
 	return &u, nil
@@ -33,15 +41,16 @@ func (r *PostgresUserRepo) GetByID(ctx context.Context, id int) (*models.User, e
 func (r *PostgresUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var u models.User
 	query := `
-		SELECT id,email,username,password_hash
+		SELECT id,email,username,password_hash,role
 		FROM users
-		WHERE email=$1
+		WHERE email=$1 AND deleted_at IS NULL
 	`
-	if err := r.Pool.QueryRow(ctx, query, email).Scan(
+	if err := r.DB.QueryRow(ctx, query, email).Scan(
 		&u.ID,
 		&u.Email,
 		&u.Username,
 		&u.PasswordHash,
+		&u.Role,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, models.NotFound
@@ -55,14 +64,15 @@ func (r *PostgresUserRepo) Create(ctx context.Context, user *models.User) error
 	query := `
 		INSERT INTO users (email,username,password_hash)
 		VALUES ($1,$2,$3)
+		RETURNING id
 	`
-	_, err := r.Pool.Exec(
+	err := r.DB.QueryRow(
 		ctx,
 		query,
 		user.Email,
 		user.Username,
 		user.PasswordHash,
-	)
+	).Scan(&user.ID)
 
 	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
@@ -74,3 +84,117 @@ func (r *PostgresUserRepo) Create(ctx context.Context, user *models.User) error
 	return nil
 }
 
+func (r *PostgresUserRepo) SetRole(ctx context.Context, email string, role string) error {
+	query := `
+		UPDATE users
+		SET role=$1, updated_at=CURRENT_TIMESTAMP
+		WHERE email=$2 AND deleted_at IS NULL
+	`
+	tag, err := r.DB.Exec(ctx, query, role, email)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.NotFound
+	}
+	return nil
+}
+
+// Delete soft-deletes the user together with their live profiles. Both keep
+// the same deleted_at so that Restore can bring back exactly that set.
+func (r *PostgresUserRepo) Delete(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var deletedAt time.Time
+	err = tx.QueryRow(ctx, `
+		UPDATE users
+		SET deleted_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND deleted_at IS NULL
+		RETURNING deleted_at
+	`, id).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NotFound
+		}
+		return err
+	}
+	profileIDs, err := updateProfileIDs(ctx, tx, `
+		UPDATE profiles
+		SET deleted_at=$1
+		WHERE user_id=$2 AND deleted_at IS NULL
+		RETURNING id
+	`, deletedAt, id)
+	if err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileDeleted, profileIDs...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Restore undoes Delete for a user that has not been purged yet.
+func (r *PostgresUserRepo) Restore(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var deletedAt time.Time
+	err = tx.QueryRow(ctx, `
+		UPDATE users AS u
+		SET deleted_at=NULL
+		FROM (SELECT deleted_at FROM users WHERE id=$1) AS old
+		WHERE u.id=$1 AND u.deleted_at IS NOT NULL
+		RETURNING old.deleted_at
+	`, id).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NotFound
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	profileIDs, err := updateProfileIDs(ctx, tx, `
+		UPDATE profiles
+		SET deleted_at=NULL
+		WHERE user_id=$1 AND deleted_at=$2
+		RETURNING id
+	`, id, deletedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileRestored, profileIDs...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// updateProfileIDs runs an UPDATE ... RETURNING id on profiles and collects the ids.
+func updateProfileIDs(ctx context.Context, tx pgx.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// Purge permanently erases users soft-deleted before the cutoff. Their
+// profiles go with them through ON DELETE CASCADE.
+func (r *PostgresUserRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM users WHERE deleted_at<$1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AddressRepo struct {
+	DB *Handle
+}
+
+const addressColumns = `id,profile_id,type,line1,line2,locality,district,state,pin_code,created_at,updated_at`
+
+func scanAddress(row interface{ Scan(dest ...any) error }) (*models.Address, error) {
+	var a models.Address
+	if err := row.Scan(
+		&a.ID,
+		&a.ProfileID,
+		&a.Type,
+		&a.Line1,
+		&a.Line2,
+		&a.Locality,
+		&a.District,
+		&a.State,
+		&a.PinCode,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *AddressRepo) queryAddresses(ctx context.Context, query string, args ...any) ([]models.Address, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	return addresses, rows.Err()
+}
+
+func (r *AddressRepo) List(ctx context.Context, profileID int) ([]models.Address, error) {
+	return r.queryAddresses(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE profile_id=?
+		ORDER BY id
+	`, profileID)
+}
+
+func (r *AddressRepo) Create(ctx context.Context, address *models.Address) error {
+	created := now()
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO addresses (profile_id,type,line1,line2,locality,district,state,pin_code,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)
+		RETURNING id
+	`,
+		address.ProfileID,
+		address.Type,
+		address.Line1,
+		address.Line2,
+		address.Locality,
+		address.District,
+		address.State,
+		address.PinCode,
+		ts(created),
+		ts(created),
+	).Scan(&address.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	address.CreatedAt, address.UpdatedAt = created, created
+	return nil
+}
+
+func (r *AddressRepo) Update(ctx context.Context, address *models.Address) error {
+	updated := now()
+	err := r.DB.QueryRowContext(ctx, `
+		UPDATE addresses
+		SET type=?,line1=?,line2=?,locality=?,district=?,state=?,pin_code=?,updated_at=?
+		WHERE id=? AND profile_id=?
+		RETURNING created_at
+	`,
+		address.Type,
+		address.Line1,
+		address.Line2,
+		address.Locality,
+		address.District,
+		address.State,
+		address.PinCode,
+		ts(updated),
+		address.ID,
+		address.ProfileID,
+	).Scan(&address.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	address.UpdatedAt = updated
+	return nil
+}
+
+func (r *AddressRepo) Delete(ctx context.Context, profileID, id int) error {
+	return requireRow(r.DB.ExecContext(ctx, `DELETE FROM addresses WHERE id=? AND profile_id=?`, id, profileID))
+}
+
+func (r *AddressRepo) Unchecked(ctx context.Context, afterID, limit int) ([]models.Address, error) {
+	return r.queryAddresses(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE pin_code='' AND id>?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+}
@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AttachmentRepo struct {
+	DB *Handle
+}
+
+const attachmentColumns = `a.id,a.profile_id,a.kind,a.file_name,a.content_type,a.size,a.sha256,a.blob_key,a.data_key,a.created_at`
+
+func scanAttachment(row interface{ Scan(dest ...any) error }) (*models.Attachment, error) {
+	var a models.Attachment
+	if err := row.Scan(
+		&a.ID,
+		&a.ProfileID,
+		&a.Kind,
+		&a.FileName,
+		&a.ContentType,
+		&a.Size,
+		&a.SHA256,
+		&a.BlobKey,
+		&a.DataKey,
+		&a.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *AttachmentRepo) list(ctx context.Context, query string, args ...any) ([]models.Attachment, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func (r *AttachmentRepo) List(ctx context.Context, profileID int) ([]models.Attachment, error) {
+	return r.list(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.profile_id=?
+		ORDER BY a.id
+	`, profileID)
+}
+
+func (r *AttachmentRepo) Get(ctx context.Context, profileID, id int) (*models.Attachment, error) {
+	a, err := scanAttachment(r.DB.QueryRowContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		JOIN profiles p ON p.id=a.profile_id
+		WHERE a.id=? AND a.profile_id=? AND p.deleted_at IS NULL
+	`, id, profileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return a, err
+}
+
+func (r *AttachmentRepo) Create(ctx context.Context, a *models.Attachment) error {
+	created := now()
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO attachments (profile_id,kind,file_name,content_type,size,sha256,blob_key,data_key,created_at)
+		VALUES (?,?,?,?,?,?,?,?,?)
+		RETURNING id
+	`,
+		a.ProfileID,
+		a.Kind,
+		a.FileName,
+		a.ContentType,
+		a.Size,
+		a.SHA256,
+		a.BlobKey,
+		a.DataKey,
+		ts(created),
+	).Scan(&a.ID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	a.CreatedAt = created
+	return nil
+}
+
+func (r *AttachmentRepo) Delete(ctx context.Context, profileID, id int) error {
+	return requireRow(r.DB.ExecContext(ctx, `DELETE FROM attachments WHERE id=? AND profile_id=?`, id, profileID))
+}
+
+func (r *AttachmentRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Attachment, error) {
+	return r.list(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		JOIN profiles p ON p.id=a.profile_id
+		WHERE p.deleted_at<?
+		ORDER BY a.id
+	`, ts(before))
+}
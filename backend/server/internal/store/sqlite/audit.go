@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/audit"
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type AuditRepo struct {
+	DB *Handle
+}
+
+// Append reads the head and inserts in one transaction. SQLite takes the
+// write lock for the whole transaction, which serialises appends the way the
+// advisory lock does in postgres.
+func (r *AuditRepo) Append(ctx context.Context, rec *models.AuditRecord) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var head *models.AuditRecord
+	var last models.AuditRecord
+	err = tx.QueryRowContext(ctx, `
+		SELECT seq, hash
+		FROM audit_log
+		ORDER BY seq DESC
+		LIMIT 1
+	`).Scan(&last.Seq, &last.Hash)
+	switch {
+	case err == nil:
+		head = &last
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	audit.Seal(head, rec)
+	query := `
+		INSERT INTO audit_log (seq,user_id,action,details,created_at,prev_hash,hash)
+		VALUES (?,?,?,?,?,?,?)
+	`
+	if _, err := tx.ExecContext(
+		ctx,
+		query,
+		rec.Seq,
+		rec.UserID,
+		rec.Action,
+		rec.Details,
+		ts(rec.CreatedAt),
+		rec.PrevHash,
+		rec.Hash,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *AuditRepo) List(ctx context.Context, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	query := `
+		SELECT seq,user_id,action,details,created_at,prev_hash,hash
+		FROM audit_log
+		WHERE seq>?
+		ORDER BY seq
+		LIMIT ?
+	`
+	rows, err := r.DB.QueryContext(ctx, query, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+	for rows.Next() {
+		var rec models.AuditRecord
+		if err := rows.Scan(
+			&rec.Seq,
+			&rec.UserID,
+			&rec.Action,
+			&rec.Details,
+			&rec.CreatedAt,
+			&rec.PrevHash,
+			&rec.Hash,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (r *AuditRepo) ForUser(ctx context.Context, userID int, afterSeq int64, limit int) ([]models.AuditRecord, error) {
+	query := `
+		SELECT seq,user_id,action,details,created_at,prev_hash,hash
+		FROM audit_log
+		WHERE user_id=? AND seq>?
+		ORDER BY seq
+		LIMIT ?
+	`
+	rows, err := r.DB.QueryContext(ctx, query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AuditRecord
+	for rows.Next() {
+		var rec models.AuditRecord
+		if err := rows.Scan(
+			&rec.Seq,
+			&rec.UserID,
+			&rec.Action,
+			&rec.Details,
+			&rec.CreatedAt,
+			&rec.PrevHash,
+			&rec.Hash,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (r *AuditRepo) CreateCheckpoint(ctx context.Context, cp models.AuditCheckpoint) error {
+	query := `
+		INSERT INTO audit_checkpoints (seq,hash,signature,created_at)
+		VALUES (?,?,?,?)
+	`
+	_, err := r.DB.ExecContext(ctx, query, cp.Seq, cp.Hash, cp.Signature, ts(cp.CreatedAt))
+	return err
+}
+
+func (r *AuditRepo) Checkpoints(ctx context.Context) ([]models.AuditCheckpoint, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT seq,hash,signature,created_at
+		FROM audit_checkpoints
+		ORDER BY seq
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditCheckpoint
+	for rows.Next() {
+		var cp models.AuditCheckpoint
+		if err := rows.Scan(&cp.Seq, &cp.Hash, &cp.Signature, &cp.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ConsentRepo struct {
+	DB *Handle
+}
+
+const consentColumns = `id,user_id,purpose,notice_version,granted_at,withdrawn_at`
+
+func scanConsent(row interface{ Scan(dest ...any) error }) (*models.Consent, error) {
+	var c models.Consent
+	if err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Purpose,
+		&c.NoticeVersion,
+		&c.GrantedAt,
+		&c.WithdrawnAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Grant ends the current consent at the moment the new one starts.
+func (r *ConsentRepo) Grant(ctx context.Context, c *models.Consent) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	at := ts(now())
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE consents SET withdrawn_at=?
+		WHERE user_id=? AND purpose=? AND withdrawn_at IS NULL
+	`, at, c.UserID, c.Purpose); err != nil {
+		return err
+	}
+	stored, err := scanConsent(tx.QueryRowContext(ctx, `
+		INSERT INTO consents (user_id,purpose,notice_version,granted_at)
+		VALUES (?,?,?,?)
+		RETURNING `+consentColumns,
+		c.UserID, c.Purpose, c.NoticeVersion, at,
+	))
+	switch {
+	case isUniqueViolation(err):
+		return models.AlreadyExists
+	case isForeignKeyViolation(err):
+		return models.NotFound
+	case err != nil:
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*c = *stored
+	return nil
+}
+
+func (r *ConsentRepo) Withdraw(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRowContext(ctx, `
+		UPDATE consents SET withdrawn_at=?
+		WHERE user_id=? AND purpose=? AND withdrawn_at IS NULL
+		RETURNING `+consentColumns,
+		ts(now()), userID, purpose,
+	))
+}
+
+func (r *ConsentRepo) Current(ctx context.Context, userID int, purpose string) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRowContext(ctx, `
+		SELECT `+consentColumns+` FROM consents
+		WHERE user_id=? AND purpose=? AND withdrawn_at IS NULL
+	`, userID, purpose))
+}
+
+func (r *ConsentRepo) Get(ctx context.Context, userID, id int) (*models.Consent, error) {
+	return scanConsent(r.DB.QueryRowContext(ctx, `
+		SELECT `+consentColumns+` FROM consents WHERE id=? AND user_id=?
+	`, id, userID))
+}
+
+func (r *ConsentRepo) List(ctx context.Context, userID int) ([]models.Consent, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+consentColumns+` FROM consents WHERE user_id=? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []models.Consent
+	for rows.Next() {
+		c, err := scanConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, *c)
+	}
+	return consents, rows.Err()
+}
@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type CredentialRepo struct {
+	DB *Handle
+}
+
+// the references are cleared when a profile or account is purged
+const credentialColumns = `id,COALESCE(user_id,0),COALESCE(profile_id,0),fields,issued_at,expires_at,revoked_at`
+
+func scanCredential(row interface{ Scan(dest ...any) error }) (*models.Credential, error) {
+	var c models.Credential
+	var fields string
+	if err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ProfileID,
+		&fields,
+		&c.IssuedAt,
+		&c.ExpiresAt,
+		&c.RevokedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	c.Fields = strings.Split(fields, ",")
+	return &c, nil
+}
+
+func (r *CredentialRepo) Create(ctx context.Context, c *models.Credential) error {
+	stored, err := scanCredential(r.DB.QueryRowContext(ctx, `
+		INSERT INTO credentials (user_id,profile_id,fields,issued_at,expires_at)
+		VALUES (?,?,?,?,?)
+		RETURNING `+credentialColumns,
+		c.UserID, c.ProfileID, strings.Join(c.Fields, ","), ts(now()), ts(c.ExpiresAt),
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*c = *stored
+	return nil
+}
+
+func (r *CredentialRepo) Get(ctx context.Context, id int) (*models.Credential, error) {
+	return scanCredential(r.DB.QueryRowContext(ctx, `
+		SELECT `+credentialColumns+` FROM credentials WHERE id=?
+	`, id))
+}
+
+func (r *CredentialRepo) List(ctx context.Context, userID, profileID int) ([]models.Credential, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+credentialColumns+` FROM credentials
+		WHERE user_id=? AND profile_id=?
+		ORDER BY id DESC
+	`, userID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []models.Credential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *c)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *CredentialRepo) Revoke(ctx context.Context, userID, id int) (*models.Credential, error) {
+	return scanCredential(r.DB.QueryRowContext(ctx, `
+		UPDATE credentials SET revoked_at=?
+		WHERE id=? AND user_id=? AND revoked_at IS NULL
+		RETURNING `+credentialColumns,
+		ts(now()), id, userID,
+	))
+}
+
+func (r *CredentialRepo) RevokeProfile(ctx context.Context, profileID int) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE credentials SET revoked_at=? WHERE profile_id=? AND revoked_at IS NULL
+	`, ts(now()), profileID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *CredentialRepo) RevokeUser(ctx context.Context, userID int) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE credentials SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL
+	`, ts(now()), userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *CredentialRepo) Revoked(ctx context.Context, first, last int) ([]int, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id FROM credentials
+		WHERE id BETWEEN ? AND ? AND (revoked_at IS NOT NULL OR profile_id IS NULL)
+		ORDER BY id
+	`, first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
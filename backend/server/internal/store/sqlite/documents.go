@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type DocumentRepo struct {
+	DB *Handle
+}
+
+const documentColumns = `id,profile_id,type,number,number_index,expires_on,created_at,updated_at`
+
+func scanDocument(row interface{ Scan(dest ...any) error }) (*models.IdentityDocument, error) {
+	var d models.IdentityDocument
+	if err := row.Scan(
+		&d.ID,
+		&d.ProfileID,
+		&d.Type,
+		&d.Number,
+		&d.NumberIndex,
+		&d.ExpiresOn,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// optionalDate is date for a nullable DATE column.
+func optionalDate(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return date(*t)
+}
+
+func (r *DocumentRepo) List(ctx context.Context, profileID int) ([]models.IdentityDocument, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+documentColumns+`
+		FROM identity_documents
+		WHERE profile_id=?
+		ORDER BY id
+	`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.IdentityDocument{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *d)
+	}
+	return docs, rows.Err()
+}
+
+func (r *DocumentRepo) Get(ctx context.Context, profileID, id int) (*models.IdentityDocument, error) {
+	d, err := scanDocument(r.DB.QueryRowContext(ctx, `
+		SELECT `+documentColumns+`
+		FROM identity_documents
+		WHERE id=? AND profile_id=?
+	`, id, profileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return d, err
+}
+
+func (r *DocumentRepo) Create(ctx context.Context, doc *models.IdentityDocument) error {
+	created := now()
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO identity_documents (profile_id,type,number,number_index,expires_on,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?)
+		RETURNING id
+	`,
+		doc.ProfileID,
+		doc.Type,
+		doc.Number,
+		doc.NumberIndex,
+		optionalDate(doc.ExpiresOn),
+		ts(created),
+		ts(created),
+	).Scan(&doc.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	doc.CreatedAt, doc.UpdatedAt = created, created
+	return nil
+}
+
+func (r *DocumentRepo) Update(ctx context.Context, doc *models.IdentityDocument) error {
+	updated := now()
+	err := r.DB.QueryRowContext(ctx, `
+		UPDATE identity_documents
+		SET number=?,number_index=?,expires_on=?,updated_at=?
+		WHERE id=? AND profile_id=?
+		RETURNING type,created_at
+	`,
+		doc.Number,
+		doc.NumberIndex,
+		optionalDate(doc.ExpiresOn),
+		ts(updated),
+		doc.ID,
+		doc.ProfileID,
+	).Scan(&doc.Type, &doc.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	doc.UpdatedAt = updated
+	return nil
+}
+
+func (r *DocumentRepo) Delete(ctx context.Context, profileID, id int) error {
+	return requireRow(r.DB.ExecContext(ctx, `DELETE FROM identity_documents WHERE id=? AND profile_id=?`, id, profileID))
+}
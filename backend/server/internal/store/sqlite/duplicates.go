@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type DuplicateRepo struct {
+	DB *Handle
+}
+
+// duplicateColumns are unqualified: a RETURNING clause cannot name the table.
+const duplicateColumns = `id,profile_id,match_id,reasons,score,status,reviewer_id,note,created_at,resolved_at`
+
+func scanDuplicate(row interface{ Scan(dest ...any) error }) (*models.Duplicate, error) {
+	var d models.Duplicate
+	var reasons string
+	if err := row.Scan(
+		&d.ID,
+		&d.ProfileID,
+		&d.MatchID,
+		&reasons,
+		&d.Score,
+		&d.Status,
+		&d.ReviewerID,
+		&d.Note,
+		&d.CreatedAt,
+		&d.ResolvedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Reasons = strings.Split(reasons, ",")
+	return &d, nil
+}
+
+func scanProfiles(rows *sql.Rows, err error) ([]models.Profile, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+func (r *DuplicateRepo) Candidates(ctx context.Context, p *models.Profile, limit int) ([]models.Profile, error) {
+	return scanProfiles(r.DB.QueryContext(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND user_id<>?1 AND (
+			(?2<>'' AND aadhaar_index=?2) OR (?3<>'' AND phone_index=?3) OR date_of_birth=?4
+		)
+		ORDER BY (?2<>'' AND aadhaar_index=?2) DESC, (?3<>'' AND phone_index=?3) DESC, id
+		LIMIT ?5
+	`, p.UserID, p.AadhaarIndex, p.PhoneIndex, date(p.DateOfBirth), limit))
+}
+
+func (r *DuplicateRepo) Flag(ctx context.Context, d *models.Duplicate) error {
+	stored, err := scanDuplicate(r.DB.QueryRowContext(ctx, `
+		INSERT INTO profile_duplicates (profile_id,match_id,reasons,score,created_at)
+		VALUES (?,?,?,?,?)
+		ON CONFLICT (profile_id,match_id) DO UPDATE
+			SET reasons=excluded.reasons,score=excluded.score
+			WHERE status='pending'
+		RETURNING `+duplicateColumns,
+		d.ProfileID, d.MatchID, strings.Join(d.Reasons, ","), d.Score, ts(now()),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		// the pair was resolved, and the WHERE kept it as it was
+		stored, err = scanDuplicate(r.DB.QueryRowContext(ctx, `
+			SELECT `+duplicateColumns+` FROM profile_duplicates WHERE profile_id=? AND match_id=?
+		`, d.ProfileID, d.MatchID))
+	}
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*d = *stored
+	return nil
+}
+
+func (r *DuplicateRepo) Get(ctx context.Context, id int) (*models.Duplicate, error) {
+	d, err := scanDuplicate(r.DB.QueryRowContext(ctx, `
+		SELECT `+duplicateColumns+` FROM profile_duplicates WHERE id=?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return d, err
+}
+
+func (r *DuplicateRepo) Pair(ctx context.Context, d *models.Duplicate) ([]models.Profile, error) {
+	return scanProfiles(r.DB.QueryContext(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND id IN (?,?)
+		ORDER BY id
+	`, d.ProfileID, d.MatchID))
+}
+
+func (r *DuplicateRepo) Queue(ctx context.Context, limit int) ([]models.Duplicate, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+duplicateColumns+`
+		FROM profile_duplicates
+		WHERE status='pending'
+			AND profile_id IN (SELECT id FROM profiles WHERE deleted_at IS NULL)
+			AND match_id IN (SELECT id FROM profiles WHERE deleted_at IS NULL)
+		ORDER BY created_at,id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Duplicate{}
+	for rows.Next() {
+		d, err := scanDuplicate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (r *DuplicateRepo) Resolve(ctx context.Context, d *models.Duplicate) error {
+	stored, err := scanDuplicate(r.DB.QueryRowContext(ctx, `
+		UPDATE profile_duplicates
+		SET status=?,reviewer_id=?,note=?,resolved_at=?
+		WHERE id=? AND status='pending'
+		RETURNING `+duplicateColumns,
+		d.Status, d.ReviewerID, d.Note, ts(now()), d.ID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.Get(ctx, d.ID); err != nil {
+			return err
+		}
+		return models.VersionConflict
+	}
+	if err != nil {
+		return err
+	}
+	*d = *stored
+	return nil
+}
+
+func (r *DuplicateRepo) Unindexed(ctx context.Context, afterID, limit int) ([]models.Profile, error) {
+	return scanProfiles(r.DB.QueryContext(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND id>? AND ((aadhaar_number<>'' AND aadhaar_index='') OR phone_index='')
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit))
+}
+
+func (r *DuplicateRepo) SetIndexes(ctx context.Context, p *models.Profile) error {
+	return requireRow(r.DB.ExecContext(ctx, `
+		UPDATE profiles SET aadhaar_index=?,phone_index=? WHERE id=?
+	`, p.AadhaarIndex, p.PhoneIndex, p.ID))
+}
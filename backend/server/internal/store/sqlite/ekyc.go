@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type EKYCRepo struct {
+	DB *Handle
+}
+
+func (r *EKYCRepo) Create(ctx context.Context, v *models.EKYCVerification) error {
+	created := now()
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO ekyc_verifications (
+			profile_id,source,reference_hash,document_hash,mobile_hash,email_hash,generated_at,
+			name_match,date_of_birth_match,address_match,aadhaar_match,mobile_match,verified,created_at
+		)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		RETURNING id
+	`,
+		v.ProfileID,
+		v.Source,
+		v.ReferenceHash,
+		v.DocumentHash,
+		v.MobileHash,
+		v.EmailHash,
+		ts(v.GeneratedAt),
+		v.NameMatch,
+		v.DateOfBirthMatch,
+		v.AddressMatch,
+		v.AadhaarMatch,
+		v.MobileMatch,
+		v.Verified,
+		ts(created),
+	).Scan(&v.ID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	v.CreatedAt = created
+	return nil
+}
+
+func (r *EKYCRepo) List(ctx context.Context, profileID int) ([]models.EKYCVerification, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id,profile_id,source,reference_hash,document_hash,mobile_hash,email_hash,generated_at,
+			name_match,date_of_birth_match,address_match,aadhaar_match,mobile_match,verified,created_at
+		FROM ekyc_verifications
+		WHERE profile_id=?
+		ORDER BY id DESC
+	`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.EKYCVerification{}
+	for rows.Next() {
+		var v models.EKYCVerification
+		if err := rows.Scan(
+			&v.ID,
+			&v.ProfileID,
+			&v.Source,
+			&v.ReferenceHash,
+			&v.DocumentHash,
+			&v.MobileHash,
+			&v.EmailHash,
+			&v.GeneratedAt,
+			&v.NameMatch,
+			&v.DateOfBirthMatch,
+			&v.AddressMatch,
+			&v.AadhaarMatch,
+			&v.MobileMatch,
+			&v.Verified,
+			&v.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ExportRepo struct {
+	DB *Handle
+}
+
+const exportColumns = `id,user_id,status,blob_key,data_key,size,created_at,completed_at,expires_at,downloaded_at`
+
+func scanExport(row interface{ Scan(dest ...any) error }) (*models.Export, error) {
+	var e models.Export
+	if err := row.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.BlobKey,
+		&e.DataKey,
+		&e.Size,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+		&e.DownloadedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *ExportRepo) Create(ctx context.Context, e *models.Export) error {
+	stored, err := scanExport(r.DB.QueryRowContext(ctx, `
+		INSERT INTO exports (user_id,created_at)
+		VALUES (?,?)
+		RETURNING `+exportColumns,
+		e.UserID, ts(now()),
+	))
+	switch {
+	case isUniqueViolation(err):
+		return models.AlreadyExists
+	case isForeignKeyViolation(err):
+		return models.NotFound
+	case err != nil:
+		return err
+	}
+	*e = *stored
+	return nil
+}
+
+func (r *ExportRepo) Get(ctx context.Context, userID, id int) (*models.Export, error) {
+	return scanExport(r.DB.QueryRowContext(ctx, `
+		SELECT `+exportColumns+`
+		FROM exports
+		WHERE id=? AND user_id=?
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+	`, id, userID))
+}
+
+func (r *ExportRepo) Finish(ctx context.Context, e *models.Export) error {
+	stored, err := scanExport(r.DB.QueryRowContext(ctx, `
+		UPDATE exports
+		SET status=?, blob_key=?, data_key=?, size=?, expires_at=?, completed_at=?
+		WHERE id=? AND status='pending'
+		RETURNING `+exportColumns,
+		e.Status, e.BlobKey, e.DataKey, e.Size, optionalTS(e.ExpiresAt), ts(now()), e.ID,
+	))
+	if err != nil {
+		return err
+	}
+	*e = *stored
+	return nil
+}
+
+func (r *ExportRepo) Download(ctx context.Context, userID, id int, at time.Time) (*models.Export, error) {
+	return scanExport(r.DB.QueryRowContext(ctx, `
+		UPDATE exports
+		SET status='downloaded', downloaded_at=?
+		WHERE id=? AND user_id=? AND status='ready' AND expires_at>?
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+		RETURNING `+exportColumns,
+		ts(now()), id, userID, ts(at),
+	))
+}
+
+func (r *ExportRepo) Expire(ctx context.Context, at time.Time) ([]models.Export, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		UPDATE exports
+		SET status='expired'
+		WHERE status='ready'
+		AND (expires_at<=? OR user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL))
+		RETURNING `+exportColumns,
+		ts(at),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []models.Export
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, *e)
+	}
+	return expired, rows.Err()
+}
+
+func (r *ExportRepo) Abandon(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE exports
+		SET status='failed', completed_at=?
+		WHERE status='pending' AND created_at<?
+	`, ts(now()), ts(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
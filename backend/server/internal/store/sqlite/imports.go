@@ -0,0 +1,323 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ImportRepo struct {
+	DB *Handle
+}
+
+const importColumns = `id,admin_id,format,dry_run,status,records,line,checksum,users,profiles,failed,created_at,updated_at,completed_at`
+
+func scanImport(row interface{ Scan(dest ...any) error }) (*models.ImportJob, error) {
+	var j models.ImportJob
+	if err := row.Scan(
+		&j.ID,
+		&j.AdminID,
+		&j.Format,
+		&j.DryRun,
+		&j.Status,
+		&j.Records,
+		&j.Line,
+		&j.Checksum,
+		&j.Users,
+		&j.Profiles,
+		&j.Failed,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+		&j.CompletedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *ImportRepo) Create(ctx context.Context, job *models.ImportJob) error {
+	created := ts(now())
+	stored, err := scanImport(r.DB.QueryRowContext(ctx, `
+		INSERT INTO import_jobs (admin_id,format,dry_run,created_at,updated_at)
+		VALUES (?,?,?,?,?)
+		RETURNING `+importColumns,
+		job.AdminID, job.Format, job.DryRun, created, created,
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+func (r *ImportRepo) Get(ctx context.Context, id int) (*models.ImportJob, error) {
+	return scanImport(r.DB.QueryRowContext(ctx, `
+		SELECT `+importColumns+` FROM import_jobs WHERE id=?
+	`, id))
+}
+
+// distinct returns the distinct non-empty values key picks out of rows.
+func distinct(rows []models.ImportRow, key func(models.ImportRow) string) []any {
+	seen := map[string]bool{}
+	var out []any
+	for _, row := range rows {
+		if v := key(row); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// queryIn runs a query whose %s is filled with a placeholder for each value,
+// calling scan on each row. It does nothing for no values.
+func (r *ImportRepo) queryIn(ctx context.Context, query string, values []any, scan func(*sql.Rows) error) error {
+	if len(values) == 0 {
+		return nil
+	}
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(query, strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")), values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *ImportRepo) Existing(ctx context.Context, rows []models.ImportRow) (*models.ImportExisting, error) {
+	e := &models.ImportExisting{
+		Accounts:   map[string]int{},
+		Usernames:  map[string]bool{},
+		VIDs:       map[string]bool{},
+		SelfPhones: map[string]bool{},
+		Self:       map[int]bool{},
+		Primary:    map[int]bool{},
+		Aadhaar:    map[int][]string{},
+	}
+	err := r.queryIn(ctx, `
+		SELECT id,email FROM users WHERE deleted_at IS NULL AND email IN (%s)
+	`, distinct(rows, func(row models.ImportRow) string { return row.Email }), func(rows *sql.Rows) error {
+		var id int
+		var email string
+		err := rows.Scan(&id, &email)
+		e.Accounts[email] = id
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.queryIn(ctx, `
+		SELECT username FROM users WHERE deleted_at IS NULL AND username IN (%s)
+	`, distinct(rows, func(row models.ImportRow) string { return row.Username }), func(rows *sql.Rows) error {
+		var username string
+		err := rows.Scan(&username)
+		e.Usernames[username] = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.queryIn(ctx, `
+		SELECT vid_index FROM profiles WHERE deleted_at IS NULL AND vid_index IN (%s)
+	`, distinct(rows, func(row models.ImportRow) string { return row.Profile.VIDIndex }), func(rows *sql.Rows) error {
+		var index string
+		err := rows.Scan(&index)
+		e.VIDs[index] = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.queryIn(ctx, `
+		SELECT phone_number FROM profiles WHERE deleted_at IS NULL AND relationship='self' AND phone_number IN (%s)
+	`, distinct(rows, func(row models.ImportRow) string { return row.Profile.PhoneNumber }), func(rows *sql.Rows) error {
+		var phone string
+		err := rows.Scan(&phone)
+		e.SelfPhones[phone] = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []any
+	for _, id := range e.Accounts {
+		accounts = append(accounts, id)
+	}
+	err = r.queryIn(ctx, `
+		SELECT user_id,relationship='self',is_primary,aadhaar_index
+		FROM profiles
+		WHERE deleted_at IS NULL AND user_id IN (%s)
+	`, accounts, func(rows *sql.Rows) error {
+		var userID int
+		var self, primary bool
+		var index string
+		if err := rows.Scan(&userID, &self, &primary, &index); err != nil {
+			return err
+		}
+		e.Self[userID] = e.Self[userID] || self
+		e.Primary[userID] = e.Primary[userID] || primary
+		if index != "" {
+			e.Aadhaar[userID] = append(e.Aadhaar[userID], index)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *ImportRepo) Insert(ctx context.Context, job *models.ImportJob, batch *models.ImportBatch) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// claim the job first: a second run of the same batch stops here
+	created := now()
+	stored, err := scanImport(tx.QueryRowContext(ctx, `
+		UPDATE import_jobs
+		SET records=records+?,line=?,checksum=?,users=users+?,profiles=profiles+?,failed=failed+?,updated_at=?
+		WHERE id=? AND records=? AND status='running'
+		RETURNING `+importColumns,
+		batch.Records, batch.Line, batch.Checksum, len(batch.Users), len(batch.Rows), len(batch.Errors), ts(created),
+		job.ID, job.Records,
+	))
+	if errors.Is(err, models.NotFound) {
+		if _, err := (&ImportRepo{DB: tx}).Get(ctx, job.ID); err != nil {
+			return err
+		}
+		return models.VersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if !stored.DryRun {
+		if err := insertImportRows(ctx, tx, batch, created); err != nil {
+			if isUniqueViolation(err) {
+				return models.AlreadyExists
+			}
+			if isForeignKeyViolation(err) {
+				return models.NotFound
+			}
+			return err
+		}
+	}
+	for _, e := range batch.Errors {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO import_errors (job_id,line,field,message) VALUES (?,?,?,?)
+		`, job.ID, e.Line, e.Field, e.Message)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+func insertImportRows(ctx context.Context, tx *Handle, batch *models.ImportBatch, created time.Time) error {
+	accounts := map[string]int{}
+	for i := range batch.Users {
+		u := &batch.Users[i]
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO users (email,username,password_hash,role,created_at,updated_at)
+			VALUES (?,?,?,?,?,?)
+			RETURNING id
+		`, u.Email, u.Username, u.PasswordHash, u.Role, ts(created), ts(created)).Scan(&u.ID)
+		if err != nil {
+			return err
+		}
+		accounts[u.Email] = u.ID
+	}
+	ids := make([]int, 0, len(batch.Rows))
+	for i := range batch.Rows {
+		p := &batch.Rows[i].Profile
+		if p.UserID == 0 {
+			p.UserID = accounts[batch.Rows[i].Email]
+		}
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO profiles (user_id,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,vid_index,aadhaar_index,phone_index,aadhaar_form,relationship,is_primary,created_at,updated_at)
+			VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+			RETURNING id,version
+		`,
+			p.UserID,
+			p.FullName,
+			date(p.DateOfBirth),
+			p.PhoneNumber,
+			p.Address,
+			p.AadhaarNumber,
+			p.VID,
+			p.VIDIndex,
+			p.AadhaarIndex,
+			p.PhoneIndex,
+			p.AadhaarForm,
+			p.Relationship,
+			p.IsPrimary,
+			ts(created),
+			ts(created),
+		).Scan(&p.ID, &p.Version)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, p.ID)
+	}
+	return recordVersions(ctx, tx, models.ProfileCreated, created, ids...)
+}
+
+func (r *ImportRepo) Complete(ctx context.Context, job *models.ImportJob) error {
+	completed := ts(now())
+	stored, err := scanImport(r.DB.QueryRowContext(ctx, `
+		UPDATE import_jobs SET status='completed',updated_at=?,completed_at=? WHERE id=?
+		RETURNING `+importColumns,
+		completed, completed, job.ID,
+	))
+	if err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+func (r *ImportRepo) Errors(ctx context.Context, id int) ([]models.ImportError, error) {
+	if _, err := r.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT line,field,message FROM import_errors WHERE job_id=? ORDER BY line,rowid
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.ImportError{}
+	for rows.Next() {
+		var e models.ImportError
+		if err := rows.Scan(&e.Line, &e.Field, &e.Message); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type KYCRepo struct {
+	DB *Handle
+}
+
+const kycColumns = `k.profile_id,p.user_id,k.status,k.reviewer_id,k.claimed_at,k.reason_code,k.note,
+	k.submitted_at,k.verified_at,k.version,k.updated_at`
+
+func scanKYC(row interface{ Scan(dest ...any) error }) (*models.KYC, error) {
+	var k models.KYC
+	if err := row.Scan(
+		&k.ProfileID,
+		&k.UserID,
+		&k.Status,
+		&k.ReviewerID,
+		&k.ClaimedAt,
+		&k.ReasonCode,
+		&k.Note,
+		&k.SubmittedAt,
+		&k.VerifiedAt,
+		&k.Version,
+		&k.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// optionalTS is ts for a nullable TIMESTAMP column.
+func optionalTS(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return ts(*t)
+}
+
+func (r *KYCRepo) Get(ctx context.Context, profileID int) (*models.KYC, error) {
+	k, err := scanKYC(r.DB.QueryRowContext(ctx, `
+		SELECT `+kycColumns+`
+		FROM profile_kyc k
+		JOIN profiles p ON p.id=k.profile_id
+		WHERE k.profile_id=? AND p.deleted_at IS NULL
+	`, profileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return k, err
+}
+
+// GetForUpdate is Get: the database has a single connection, so a
+// transaction already excludes every other.
+func (r *KYCRepo) GetForUpdate(ctx context.Context, profileID int) (*models.KYC, error) {
+	return r.Get(ctx, profileID)
+}
+
+func (r *KYCRepo) Save(ctx context.Context, k *models.KYC) error {
+	updated := now()
+	var err error
+	if k.Version == 0 {
+		err = r.DB.QueryRowContext(ctx, `
+			INSERT INTO profile_kyc (
+				profile_id,status,reviewer_id,claimed_at,reason_code,note,submitted_at,verified_at,updated_at
+			)
+			VALUES (?,?,?,?,?,?,?,?,?)
+			RETURNING version
+		`,
+			k.ProfileID,
+			k.Status,
+			k.ReviewerID,
+			optionalTS(k.ClaimedAt),
+			k.ReasonCode,
+			k.Note,
+			optionalTS(k.SubmittedAt),
+			optionalTS(k.VerifiedAt),
+			ts(updated),
+		).Scan(&k.Version)
+		if isUniqueViolation(err) || isPrimaryKeyViolation(err) {
+			// another request created the row first
+			return models.VersionConflict
+		}
+	} else {
+		err = r.DB.QueryRowContext(ctx, `
+			UPDATE profile_kyc
+			SET status=?,reviewer_id=?,claimed_at=?,reason_code=?,note=?,submitted_at=?,verified_at=?,
+				version=version+1,updated_at=?
+			WHERE profile_id=? AND version=?
+			RETURNING version
+		`,
+			k.Status,
+			k.ReviewerID,
+			optionalTS(k.ClaimedAt),
+			k.ReasonCode,
+			k.Note,
+			optionalTS(k.SubmittedAt),
+			optionalTS(k.VerifiedAt),
+			ts(updated),
+			k.ProfileID,
+			k.Version,
+		).Scan(&k.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.VersionConflict
+		}
+	}
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	k.UpdatedAt = updated
+	return nil
+}
+
+func (r *KYCRepo) Queue(ctx context.Context, limit int) ([]models.KYC, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+kycColumns+`
+		FROM profile_kyc k
+		JOIN profiles p ON p.id=k.profile_id
+		WHERE k.status IN ('submitted','under_review') AND p.deleted_at IS NULL
+		ORDER BY k.submitted_at,k.profile_id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.KYC{}
+	for rows.Next() {
+		k, err := scanKYC(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *k)
+	}
+	return out, rows.Err()
+}
+
+func (r *KYCRepo) Expire(ctx context.Context, verifiedBefore time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE profile_kyc
+		SET status='expired',version=version+1,updated_at=?
+		WHERE status='verified' AND verified_at<?
+	`, ts(now()), ts(verifiedBefore))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
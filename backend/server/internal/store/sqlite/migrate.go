@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/migrations"
+)
+
+// The SQLite schema is versioned separately from the postgres one: the
+// dialects differ enough that sharing files would mean lowest-common-denominator SQL.
+//
+//go:embed migrations/*.sql
+var files embed.FS
+
+var ErrUnknownVersion = errors.New("database has a migration this binary does not know about")
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []migrations.Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	sub, err := fs.Sub(files, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	all, err := migrations.Load(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: all}, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	if _, err := m.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		if !m.known(version) {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, mig := range m.Migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]migrations.Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var status []migrations.Status
+	for _, mig := range m.Migrations {
+		at, ok := applied[mig.Version]
+		status = append(status, migrations.Status{Migration: mig, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction.
+// SQLite DDL is transactional, so a failed migration leaves no trace.
+func (m *Migrator) Up(ctx context.Context, dryRun bool) ([]migrations.Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []migrations.Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if !dryRun {
+			if err := m.run(ctx, mig.Up, `INSERT INTO schema_migrations (version,name,applied_at) VALUES (?,?,?)`,
+				mig.Version, mig.Name, ts(now())); err != nil {
+				return done, fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the latest steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int, dryRun bool) ([]migrations.Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []migrations.Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if !dryRun {
+			if err := m.run(ctx, mig.Down, `DELETE FROM schema_migrations WHERE version=?`, mig.Version); err != nil {
+				return done, fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+			}
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// run executes a migration script and its schema_migrations bookkeeping in
+// one transaction.
+func (m *Migrator) run(ctx context.Context, script string, record string, args ...any) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
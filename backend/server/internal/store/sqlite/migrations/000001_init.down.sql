@@ -0,0 +1,6 @@
+DROP TABLE revoked_sessions;
+DROP TABLE audit_checkpoints;
+DROP TABLE audit_log;
+DROP TABLE profile_versions;
+DROP TABLE profiles;
+DROP TABLE users;
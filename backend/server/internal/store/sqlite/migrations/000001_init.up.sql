@@ -0,0 +1,78 @@
+-- SQLite equivalent of the postgres schema up to its migration 000008.
+-- Timestamps are stored as UTC text in a fixed-width layout so that they
+-- sort and compare correctly; see ts() in the store.
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL,
+    username TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'support', 'admin')),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+-- Uniqueness only applies to live rows, as in postgres
+CREATE UNIQUE INDEX users_email_live_key ON users(email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_username_live_key ON users(username) WHERE deleted_at IS NULL;
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    full_name TEXT NOT NULL,
+    date_of_birth DATE NOT NULL,
+    -- AES-GCM ciphertext, base64 encoded
+    aadhaar_number TEXT NOT NULL,
+    phone_number TEXT NOT NULL,
+    address TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_profiles_user_id ON profiles(user_id);
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX idx_profiles_deleted_at ON profiles(deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE profile_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    change TEXT NOT NULL CHECK (change IN ('create', 'update', 'delete', 'restore')),
+    full_name TEXT NOT NULL,
+    date_of_birth DATE NOT NULL,
+    phone_number TEXT NOT NULL,
+    address TEXT,
+    aadhaar_number TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_profile_versions_user_changed ON profile_versions(user_id, changed_at);
+
+CREATE TABLE audit_log (
+    seq INTEGER PRIMARY KEY,
+    -- No foreign key: audit records must outlive the accounts they describe
+    user_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+
+CREATE TABLE audit_checkpoints (
+    seq INTEGER PRIMARY KEY,
+    hash TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE revoked_sessions (
+    user_id INTEGER PRIMARY KEY,
+    revoked_at TIMESTAMP NOT NULL
+);
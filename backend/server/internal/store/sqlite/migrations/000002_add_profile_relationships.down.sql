@@ -0,0 +1,9 @@
+DELETE FROM profiles WHERE deleted_at IS NULL AND NOT is_primary;
+
+DROP INDEX profiles_phone_number_live_key;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE deleted_at IS NULL;
+
+DROP INDEX profiles_primary_live_key;
+DROP INDEX profiles_self_live_key;
+ALTER TABLE profiles DROP COLUMN is_primary;
+ALTER TABLE profiles DROP COLUMN relationship;
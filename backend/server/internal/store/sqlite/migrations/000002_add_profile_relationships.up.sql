@@ -0,0 +1,17 @@
+-- Postgres migration 000009: several profiles per account, one of them primary.
+ALTER TABLE profiles
+    ADD COLUMN relationship TEXT NOT NULL DEFAULT 'self'
+    CHECK (relationship IN ('self', 'child', 'parent', 'spouse', 'ward'));
+ALTER TABLE profiles ADD COLUMN is_primary INTEGER NOT NULL DEFAULT 0;
+
+UPDATE profiles AS p
+SET relationship='ward'
+WHERE deleted_at IS NULL
+AND EXISTS (SELECT 1 FROM profiles AS o WHERE o.user_id=p.user_id AND o.deleted_at IS NULL AND o.id<p.id);
+UPDATE profiles SET is_primary=1 WHERE deleted_at IS NULL AND relationship='self';
+
+CREATE UNIQUE INDEX profiles_self_live_key ON profiles(user_id) WHERE relationship='self' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_primary_live_key ON profiles(user_id) WHERE is_primary AND deleted_at IS NULL;
+
+DROP INDEX profiles_phone_number_live_key;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE relationship='self' AND deleted_at IS NULL;
@@ -0,0 +1,22 @@
+-- Postgres migration 000010: structured addresses, seeded from profiles.address.
+CREATE TABLE addresses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('permanent', 'current', 'office')),
+    line1 TEXT NOT NULL,
+    line2 TEXT NOT NULL DEFAULT '',
+    locality TEXT NOT NULL DEFAULT '',
+    district TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL DEFAULT '',
+    pin_code TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (profile_id, type)
+);
+
+INSERT INTO addresses (profile_id,type,line1,created_at,updated_at)
+SELECT id,'permanent',SUBSTR(TRIM(address),1,200),updated_at,updated_at
+FROM profiles
+WHERE TRIM(COALESCE(address,''))<>'';
+
+CREATE INDEX idx_addresses_unchecked ON addresses(id) WHERE pin_code='';
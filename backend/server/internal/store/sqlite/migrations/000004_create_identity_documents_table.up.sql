@@ -0,0 +1,13 @@
+-- Postgres migration 000011: identity documents with a blind index per type.
+CREATE TABLE identity_documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('pan', 'passport', 'voter_id', 'driving_licence')),
+    number TEXT NOT NULL,
+    number_index TEXT NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (profile_id, type),
+    UNIQUE (type, number_index)
+);
@@ -0,0 +1,11 @@
+DROP TRIGGER profiles_aadhaar_or_vid_update;
+DROP TRIGGER profiles_aadhaar_or_vid_insert;
+ALTER TABLE profile_versions DROP COLUMN vid;
+
+DROP INDEX profiles_vid_index_live_key;
+DROP INDEX profiles_aadhaar_number_live_key;
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE deleted_at IS NULL;
+
+ALTER TABLE profiles DROP COLUMN aadhaar_form;
+ALTER TABLE profiles DROP COLUMN vid_index;
+ALTER TABLE profiles DROP COLUMN vid;
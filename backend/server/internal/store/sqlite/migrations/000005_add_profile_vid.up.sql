@@ -0,0 +1,25 @@
+-- Postgres migration 000012: Aadhaar Virtual IDs.
+ALTER TABLE profiles ADD COLUMN vid TEXT NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN vid_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE profiles
+    ADD COLUMN aadhaar_form TEXT NOT NULL DEFAULT 'aadhaar'
+    CHECK (aadhaar_form IN ('aadhaar', 'vid', 'both'));
+
+DROP INDEX profiles_aadhaar_number_live_key;
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE aadhaar_number<>'' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_vid_index_live_key ON profiles(vid_index) WHERE vid_index<>'' AND deleted_at IS NULL;
+
+ALTER TABLE profile_versions ADD COLUMN vid TEXT NOT NULL DEFAULT '';
+
+-- SQLite cannot add a table CHECK to an existing table, so triggers stand in
+-- for profiles_aadhaar_or_vid
+CREATE TRIGGER profiles_aadhaar_or_vid_insert BEFORE INSERT ON profiles
+WHEN NEW.aadhaar_number='' AND NEW.vid=''
+BEGIN
+    SELECT RAISE(ABORT, 'profile has neither an aadhaar number nor a VID');
+END;
+CREATE TRIGGER profiles_aadhaar_or_vid_update BEFORE UPDATE OF aadhaar_number, vid ON profiles
+WHEN NEW.aadhaar_number='' AND NEW.vid=''
+BEGIN
+    SELECT RAISE(ABORT, 'profile has neither an aadhaar number nor a VID');
+END;
@@ -0,0 +1 @@
+DROP TABLE ekyc_verifications;
@@ -0,0 +1,19 @@
+-- Postgres migration 000013: offline eKYC verifications, hashes only.
+CREATE TABLE ekyc_verifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    reference_hash TEXT NOT NULL,
+    document_hash TEXT NOT NULL,
+    mobile_hash TEXT NOT NULL DEFAULT '',
+    email_hash TEXT NOT NULL DEFAULT '',
+    generated_at TIMESTAMP NOT NULL,
+    name_match BOOLEAN NOT NULL,
+    date_of_birth_match BOOLEAN NOT NULL,
+    address_match BOOLEAN NOT NULL,
+    aadhaar_match BOOLEAN NOT NULL,
+    mobile_match BOOLEAN NOT NULL,
+    verified BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ekyc_verifications_profile_id_idx ON ekyc_verifications (profile_id);
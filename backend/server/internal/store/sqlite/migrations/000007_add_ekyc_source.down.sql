@@ -0,0 +1 @@
+ALTER TABLE ekyc_verifications DROP COLUMN source;
@@ -0,0 +1,4 @@
+-- Postgres migration 000014: where a verification came from.
+ALTER TABLE ekyc_verifications
+    ADD COLUMN source TEXT NOT NULL DEFAULT 'offline_xml'
+    CHECK (source IN ('offline_xml', 'secure_qr'));
@@ -0,0 +1,19 @@
+-- Postgres migration 000015: the KYC review state of each profile.
+CREATE TABLE profile_kyc (
+    profile_id INTEGER PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    status TEXT NOT NULL
+        CHECK (status IN ('draft', 'submitted', 'under_review', 'verified', 'rejected', 'expired')),
+    reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMP,
+    reason_code TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    submitted_at TIMESTAMP,
+    verified_at TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX profile_kyc_queue_idx ON profile_kyc (submitted_at)
+    WHERE status IN ('submitted', 'under_review');
+CREATE INDEX profile_kyc_verified_at_idx ON profile_kyc (verified_at)
+    WHERE status = 'verified';
@@ -0,0 +1 @@
+DROP TABLE profile_photos;
@@ -0,0 +1,7 @@
+-- Postgres migration 000017: where the photo of each profile is kept.
+CREATE TABLE profile_photos (
+    profile_id INTEGER PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    blob_prefix TEXT NOT NULL UNIQUE,
+    data_key TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,6 @@
+DROP TABLE profile_duplicates;
+DROP INDEX profiles_date_of_birth_idx;
+DROP INDEX profiles_phone_index_idx;
+DROP INDEX profiles_aadhaar_index_idx;
+ALTER TABLE profiles DROP COLUMN phone_index;
+ALTER TABLE profiles DROP COLUMN aadhaar_index;
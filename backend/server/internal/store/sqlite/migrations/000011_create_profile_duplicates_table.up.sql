@@ -0,0 +1,27 @@
+-- Postgres migration 000018: blind indexes for duplicate detection and the
+-- review queue of likely duplicates.
+ALTER TABLE profiles ADD COLUMN aadhaar_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN phone_index TEXT NOT NULL DEFAULT '';
+CREATE INDEX profiles_aadhaar_index_idx ON profiles(aadhaar_index) WHERE aadhaar_index<>'' AND deleted_at IS NULL;
+CREATE INDEX profiles_phone_index_idx ON profiles(phone_index) WHERE phone_index<>'' AND deleted_at IS NULL;
+CREATE INDEX profiles_date_of_birth_idx ON profiles(date_of_birth) WHERE deleted_at IS NULL;
+
+CREATE TABLE profile_duplicates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    match_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    reasons TEXT NOT NULL,
+    score REAL NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'duplicate', 'distinct')),
+    reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    CHECK (profile_id < match_id),
+    UNIQUE (profile_id, match_id)
+);
+
+CREATE INDEX profile_duplicates_match_id_idx ON profile_duplicates (match_id);
+CREATE INDEX profile_duplicates_queue_idx ON profile_duplicates (created_at)
+    WHERE status = 'pending';
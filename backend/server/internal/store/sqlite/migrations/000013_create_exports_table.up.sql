@@ -0,0 +1,17 @@
+-- Postgres migration 000020: personal data exports.
+CREATE TABLE exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed', 'downloaded', 'expired')),
+    blob_key TEXT NOT NULL DEFAULT '',
+    data_key TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    downloaded_at TIMESTAMP
+);
+
+CREATE INDEX exports_user_id_idx ON exports (user_id);
+CREATE UNIQUE INDEX exports_pending_idx ON exports (user_id) WHERE status='pending';
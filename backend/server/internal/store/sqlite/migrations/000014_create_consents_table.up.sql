@@ -0,0 +1,12 @@
+-- Postgres migration 000021: consent records.
+CREATE TABLE consents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    notice_version INTEGER NOT NULL CHECK (notice_version > 0),
+    granted_at TIMESTAMP NOT NULL,
+    withdrawn_at TIMESTAMP
+);
+
+CREATE INDEX consents_user_id_idx ON consents (user_id, id);
+CREATE UNIQUE INDEX consents_current_idx ON consents (user_id, purpose) WHERE withdrawn_at IS NULL;
@@ -0,0 +1,16 @@
+-- Postgres migration 000022: profile share links.
+CREATE TABLE share_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    fields TEXT NOT NULL,
+    pin_hash TEXT NOT NULL DEFAULT '',
+    pin_failures INTEGER NOT NULL DEFAULT 0,
+    accesses INTEGER NOT NULL DEFAULT 0,
+    last_accessed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX share_links_profile_id_idx ON share_links (profile_id, id);
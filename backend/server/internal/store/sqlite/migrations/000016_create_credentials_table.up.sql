@@ -0,0 +1,13 @@
+-- Postgres migration 000023: issued Verifiable Credentials.
+CREATE TABLE credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    profile_id INTEGER REFERENCES profiles(id) ON DELETE SET NULL,
+    fields TEXT NOT NULL,
+    issued_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX credentials_profile_id_idx ON credentials (profile_id, id);
+CREATE INDEX credentials_user_id_idx ON credentials (user_id);
@@ -0,0 +1 @@
+DROP INDEX profiles_user_aadhaar_index_live_key;
@@ -0,0 +1,3 @@
+-- Postgres migration 000025: each Aadhaar number once among an account's live
+-- profiles, by its blind index.
+CREATE UNIQUE INDEX profiles_user_aadhaar_index_live_key ON profiles(user_id, aadhaar_index) WHERE aadhaar_index<>'' AND deleted_at IS NULL;
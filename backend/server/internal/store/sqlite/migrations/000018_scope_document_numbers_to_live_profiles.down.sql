@@ -0,0 +1,18 @@
+DROP TRIGGER profiles_documents_deleted_at;
+CREATE TABLE identity_documents_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('pan', 'passport', 'voter_id', 'driving_licence')),
+    number TEXT NOT NULL,
+    number_index TEXT NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (profile_id, type),
+    UNIQUE (type, number_index)
+);
+-- fails while a deleted profile and a live one hold the same number
+INSERT INTO identity_documents_old (id,profile_id,type,number,number_index,expires_on,created_at,updated_at)
+SELECT id,profile_id,type,number,number_index,expires_on,created_at,updated_at FROM identity_documents;
+DROP TABLE identity_documents;
+ALTER TABLE identity_documents_old RENAME TO identity_documents;
@@ -0,0 +1,28 @@
+-- Postgres migration 000026: document numbers unique among live profiles
+-- only. SQLite cannot drop a table constraint, so the table is rebuilt.
+CREATE TABLE identity_documents_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id INTEGER NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('pan', 'passport', 'voter_id', 'driving_licence')),
+    number TEXT NOT NULL,
+    number_index TEXT NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    -- the profile's, kept in step by profiles_documents_deleted_at
+    deleted_at TIMESTAMP,
+    UNIQUE (profile_id, type)
+);
+INSERT INTO identity_documents_new (id,profile_id,type,number,number_index,expires_on,created_at,updated_at,deleted_at)
+SELECT d.id,d.profile_id,d.type,d.number,d.number_index,d.expires_on,d.created_at,d.updated_at,p.deleted_at
+FROM identity_documents d JOIN profiles p ON p.id=d.profile_id;
+DROP TABLE identity_documents;
+ALTER TABLE identity_documents_new RENAME TO identity_documents;
+
+CREATE UNIQUE INDEX identity_documents_number_index_live_key ON identity_documents(type, number_index) WHERE deleted_at IS NULL;
+
+CREATE TRIGGER profiles_documents_deleted_at AFTER UPDATE OF deleted_at ON profiles
+WHEN OLD.deleted_at IS NOT NEW.deleted_at
+BEGIN
+    UPDATE identity_documents SET deleted_at=NEW.deleted_at WHERE profile_id=NEW.id;
+END;
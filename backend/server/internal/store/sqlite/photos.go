@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type PhotoRepo struct {
+	DB *Handle
+}
+
+const photoColumns = `ph.profile_id,ph.blob_prefix,ph.data_key,ph.updated_at`
+
+func scanPhoto(row interface{ Scan(dest ...any) error }) (*models.Photo, error) {
+	var p models.Photo
+	if err := row.Scan(&p.ProfileID, &p.BlobPrefix, &p.DataKey, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PhotoRepo) Get(ctx context.Context, profileID int) (*models.Photo, error) {
+	p, err := scanPhoto(r.DB.QueryRowContext(ctx, `
+		SELECT `+photoColumns+`
+		FROM profile_photos ph
+		JOIN profiles p ON p.id=ph.profile_id
+		WHERE ph.profile_id=? AND p.deleted_at IS NULL
+	`, profileID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NotFound
+	}
+	return p, err
+}
+
+func (r *PhotoRepo) Put(ctx context.Context, p *models.Photo) error {
+	updated := now()
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO profile_photos (profile_id,blob_prefix,data_key,updated_at)
+		VALUES (?,?,?,?)
+		ON CONFLICT (profile_id) DO UPDATE
+		SET blob_prefix=excluded.blob_prefix,data_key=excluded.data_key,updated_at=excluded.updated_at
+	`, p.ProfileID, p.BlobPrefix, p.DataKey, ts(updated))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	p.UpdatedAt = updated
+	return nil
+}
+
+func (r *PhotoRepo) Delete(ctx context.Context, profileID int) error {
+	return requireRow(r.DB.ExecContext(ctx, `DELETE FROM profile_photos WHERE profile_id=?`, profileID))
+}
+
+func (r *PhotoRepo) Purgeable(ctx context.Context, before time.Time) ([]models.Photo, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+photoColumns+`
+		FROM profile_photos ph
+		JOIN profiles p ON p.id=ph.profile_id
+		WHERE p.deleted_at<?
+		ORDER BY ph.profile_id
+	`, ts(before))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Photo{}
+	for rows.Next() {
+		p, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
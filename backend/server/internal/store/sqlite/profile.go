@@ -0,0 +1,429 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ProfileRepo struct {
+	DB *Handle
+}
+
+const profileColumns = `id,user_id,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,vid_index,aadhaar_index,phone_index,aadhaar_form,relationship,is_primary,version,created_at,updated_at`
+
+func scanProfile(row interface{ Scan(dest ...any) error }) (*models.Profile, error) {
+	var p models.Profile
+	if err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.FullName,
+		&p.DateOfBirth,
+		&p.PhoneNumber,
+		&p.Address,
+		&p.AadhaarNumber,
+		&p.VID,
+		&p.VIDIndex,
+		&p.AadhaarIndex,
+		&p.PhoneIndex,
+		&p.AadhaarForm,
+		&p.Relationship,
+		&p.IsPrimary,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// getProfile returns the live profile matching the condition.
+func getProfile(ctx context.Context, q *Handle, where string, args ...any) (*models.Profile, error) {
+	p, err := scanProfile(q.QueryRowContext(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE deleted_at IS NULL AND `+where, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *ProfileRepo) GetByUserID(ctx context.Context, userID int) (*models.Profile, error) {
+	return getProfile(ctx, r.DB, `user_id=? AND is_primary`, userID)
+}
+
+func (r *ProfileRepo) Get(ctx context.Context, userID, id int) (*models.Profile, error) {
+	return getProfile(ctx, r.DB, `user_id=? AND id=?`, userID, id)
+}
+
+func (r *ProfileRepo) List(ctx context.Context, userID int) ([]models.Profile, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+profileColumns+`
+		FROM profiles
+		WHERE user_id=? AND deleted_at IS NULL
+		ORDER BY is_primary DESC, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []models.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *p)
+	}
+	return profiles, rows.Err()
+}
+
+// date formats a date of birth for a DATE column.
+func date(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// recordVersions copies the current state of the given profile rows into
+// profile_versions, in the transaction that made the change.
+func recordVersions(ctx context.Context, tx *Handle, change string, at time.Time, profileIDs ...int) error {
+	if len(profileIDs) == 0 {
+		return nil
+	}
+	args := []any{change, ts(at)}
+	for _, id := range profileIDs {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO profile_versions
+			(profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,changed_at)
+		SELECT id,user_id,?,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,?
+		FROM profiles
+		WHERE id IN (%s)
+	`, strings.TrimSuffix(strings.Repeat("?,", len(profileIDs)), ","))
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Create inserts the profile and fills in its ID and Version.
+func (r *ProfileRepo) Create(ctx context.Context, profile *models.Profile) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	profile.AadhaarForm = models.AadhaarFormOf(profile.AadhaarNumber, profile.VID)
+	created := now()
+	query := `
+		INSERT INTO profiles (user_id,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,vid_index,aadhaar_index,phone_index,aadhaar_form,relationship,is_primary,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,NOT EXISTS (
+			SELECT 1 FROM profiles WHERE user_id=? AND is_primary AND deleted_at IS NULL
+		),?,?)
+		RETURNING id,version,is_primary
+	`
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		profile.UserID,
+		profile.FullName,
+		date(profile.DateOfBirth),
+		profile.PhoneNumber,
+		profile.Address,
+		profile.AadhaarNumber,
+		profile.VID,
+		profile.VIDIndex,
+		profile.AadhaarIndex,
+		profile.PhoneIndex,
+		profile.AadhaarForm,
+		profile.Relationship,
+		profile.UserID,
+		ts(created),
+		ts(created),
+	).Scan(&profile.ID, &profile.Version, &profile.IsPrimary)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if isForeignKeyViolation(err) {
+			return models.NotFound
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileCreated, created, profile.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ProfileRepo) Update(ctx context.Context, profile *models.Profile) error {
+	return r.Patch(ctx, profile, models.ProfileFields)
+}
+
+// Patch writes only the named fields of profile, and only if the stored row is
+// still at profile.Version. See the postgres store for the error contract.
+func (r *ProfileRepo) Patch(ctx context.Context, profile *models.Profile, fields []string) error {
+	var set []string
+	var args []any
+	for _, field := range fields {
+		var value any
+		switch field {
+		case models.FieldFullName:
+			value = profile.FullName
+		case models.FieldDateOfBirth:
+			value = date(profile.DateOfBirth)
+		case models.FieldAadhaarNumber:
+			args = append(args, profile.AadhaarIndex)
+			set = append(set, "aadhaar_index=?")
+			value = profile.AadhaarNumber
+		case models.FieldVID:
+			args = append(args, profile.VIDIndex)
+			set = append(set, "vid_index=?")
+			value = profile.VID
+		case models.FieldPhoneNumber:
+			args = append(args, profile.PhoneIndex)
+			set = append(set, "phone_index=?")
+			value = profile.PhoneNumber
+		case models.FieldAddress:
+			value = profile.Address
+		default:
+			return fmt.Errorf("unknown profile field %q", field)
+		}
+		args = append(args, value)
+		// field names come from the switch above, never from the caller
+		set = append(set, field+"=?")
+	}
+	if slices.Contains(fields, models.FieldAadhaarNumber) || slices.Contains(fields, models.FieldVID) {
+		// profile carries both numbers, so the form follows from them
+		profile.AadhaarForm = models.AadhaarFormOf(profile.AadhaarNumber, profile.VID)
+		args = append(args, profile.AadhaarForm)
+		set = append(set, "aadhaar_form=?")
+	}
+	updated := now()
+	args = append(args, ts(updated), profile.UserID, profile.ID, profile.Version)
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE profiles
+		SET %s,
+			version=version+1,
+			updated_at=?
+		WHERE user_id=? AND deleted_at IS NULL AND id=? AND version=?
+		RETURNING version
+	`, strings.Join(set, ","))
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&profile.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			current, err := getProfile(ctx, tx, `user_id=? AND id=?`, profile.UserID, profile.ID)
+			if err != nil {
+				return err
+			}
+			if current.Version != profile.Version {
+				return models.VersionConflict
+			}
+			return models.NotFound
+		}
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileUpdated, updated, profile.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetPrimary moves the primary flag to the given profile.
+func (r *ProfileRepo) SetPrimary(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE profiles
+		SET is_primary=0
+		WHERE user_id=? AND is_primary AND deleted_at IS NULL AND id<>?
+	`, userID, id)
+	if err != nil {
+		return err
+	}
+	err = requireRow(tx.ExecContext(ctx, `
+		UPDATE profiles
+		SET is_primary=1
+		WHERE user_id=? AND id=? AND deleted_at IS NULL
+	`, userID, id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete soft-deletes one of the user's profiles, handing the primary flag on
+// as the postgres store does.
+func (r *ProfileRepo) Delete(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p, err := getProfile(ctx, tx, `user_id=? AND id=?`, userID, id)
+	if err != nil {
+		return err
+	}
+	deletedAt := now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE profiles
+		SET deleted_at=?, is_primary=0
+		WHERE id=?
+	`, ts(deletedAt), id)
+	if err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileDeleted, deletedAt, id); err != nil {
+		return err
+	}
+	if p.IsPrimary {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE profiles
+			SET is_primary=1
+			WHERE id=(
+				SELECT id FROM profiles
+				WHERE user_id=? AND deleted_at IS NULL
+				ORDER BY relationship='self' DESC, id
+				LIMIT 1
+			)
+		`, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Restore brings back one of the user's deleted profiles, provided the user is
+// live and the profile does not collide with a live one.
+func (r *ProfileRepo) Restore(ctx context.Context, userID, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE profiles
+		SET deleted_at=NULL,
+			is_primary=NOT EXISTS (SELECT 1 FROM profiles WHERE user_id=? AND is_primary AND deleted_at IS NULL)
+		WHERE id=? AND user_id=? AND deleted_at IS NOT NULL
+		AND EXISTS (SELECT 1 FROM users WHERE id=? AND deleted_at IS NULL)
+		RETURNING id
+	`
+	if err := tx.QueryRowContext(ctx, query, userID, id, userID, userID).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NotFound
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileRestored, now(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge permanently erases profiles soft-deleted before the cutoff.
+func (r *ProfileRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM profiles WHERE deleted_at<?`, ts(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const versionColumns = `id,profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,vid,changed_at`
+
+func (r *ProfileRepo) History(ctx context.Context, userID int) ([]models.ProfileVersion, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+versionColumns+`
+		FROM profile_versions
+		WHERE user_id=?
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.ProfileVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// AsOf returns one of the user's profiles as it stood at the given time. A
+// profile that was deleted at that point counts as not found.
+func (r *ProfileRepo) AsOf(ctx context.Context, userID, id int, at time.Time) (*models.ProfileVersion, error) {
+	v, err := scanVersion(r.DB.QueryRowContext(ctx, `
+		SELECT `+versionColumns+`
+		FROM profile_versions
+		WHERE user_id=? AND profile_id=? AND changed_at<=?
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	`, userID, id, ts(at)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	if v.Change == models.ProfileDeleted {
+		return nil, models.NotFound
+	}
+	return v, nil
+}
+
+func scanVersion(row interface{ Scan(dest ...any) error }) (*models.ProfileVersion, error) {
+	var v models.ProfileVersion
+	if err := row.Scan(
+		&v.Version,
+		&v.Profile.ID,
+		&v.Profile.UserID,
+		&v.Change,
+		&v.Profile.FullName,
+		&v.Profile.DateOfBirth,
+		&v.Profile.PhoneNumber,
+		&v.Profile.Address,
+		&v.Profile.AadhaarNumber,
+		&v.Profile.VID,
+		&v.ChangedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SessionRepo struct {
+	DB *Handle
+}
+
+func (r *SessionRepo) RevokeAll(ctx context.Context, userID int) error {
+	query := `
+		INSERT INTO revoked_sessions (user_id,revoked_at)
+		VALUES (?,?)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at=excluded.revoked_at
+	`
+	_, err := r.DB.ExecContext(ctx, query, userID, ts(now()))
+	return err
+}
+
+func (r *SessionRepo) RevokedAt(ctx context.Context, userID int) (time.Time, error) {
+	var at time.Time
+	err := r.DB.QueryRowContext(ctx, `SELECT revoked_at FROM revoked_sessions WHERE user_id=?`, userID).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return at, err
+}
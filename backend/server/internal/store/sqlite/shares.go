@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type ShareLinkRepo struct {
+	DB *Handle
+}
+
+const shareLinkColumns = `id,user_id,profile_id,fields,pin_hash,pin_failures,accesses,last_accessed_at,created_at,expires_at,revoked_at`
+
+func scanShareLink(row interface{ Scan(dest ...any) error }) (*models.ShareLink, error) {
+	var l models.ShareLink
+	var fields string
+	if err := row.Scan(
+		&l.ID,
+		&l.UserID,
+		&l.ProfileID,
+		&fields,
+		&l.PINHash,
+		&l.PINFailures,
+		&l.Accesses,
+		&l.LastAccessedAt,
+		&l.CreatedAt,
+		&l.ExpiresAt,
+		&l.RevokedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	l.Fields = strings.Split(fields, ",")
+	return &l, nil
+}
+
+func (r *ShareLinkRepo) Create(ctx context.Context, l *models.ShareLink) error {
+	stored, err := scanShareLink(r.DB.QueryRowContext(ctx, `
+		INSERT INTO share_links (user_id,profile_id,fields,pin_hash,created_at,expires_at)
+		VALUES (?,?,?,?,?,?)
+		RETURNING `+shareLinkColumns,
+		l.UserID, l.ProfileID, strings.Join(l.Fields, ","), l.PINHash, ts(now()), ts(l.ExpiresAt),
+	))
+	if isForeignKeyViolation(err) {
+		return models.NotFound
+	}
+	if err != nil {
+		return err
+	}
+	*l = *stored
+	return nil
+}
+
+func (r *ShareLinkRepo) Get(ctx context.Context, id int) (*models.ShareLink, error) {
+	return scanShareLink(r.DB.QueryRowContext(ctx, `
+		SELECT `+shareLinkColumns+` FROM share_links WHERE id=?
+	`, id))
+}
+
+func (r *ShareLinkRepo) List(ctx context.Context, userID, profileID int) ([]models.ShareLink, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+shareLinkColumns+` FROM share_links
+		WHERE user_id=? AND profile_id=?
+		ORDER BY id DESC
+	`, userID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.ShareLink
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+func (r *ShareLinkRepo) Revoke(ctx context.Context, userID, id int) (*models.ShareLink, error) {
+	return scanShareLink(r.DB.QueryRowContext(ctx, `
+		UPDATE share_links SET revoked_at=?
+		WHERE id=? AND user_id=? AND revoked_at IS NULL
+		RETURNING `+shareLinkColumns,
+		ts(now()), id, userID,
+	))
+}
+
+func (r *ShareLinkRepo) Accessed(ctx context.Context, id int, at time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `
+		UPDATE share_links SET accesses=accesses+1,last_accessed_at=? WHERE id=?
+	`, ts(at), id)
+	return err
+}
+
+func (r *ShareLinkRepo) TakePINAttempt(ctx context.Context, id, max int) (int, error) {
+	var failures int
+	err := r.DB.QueryRowContext(ctx, `
+		UPDATE share_links SET pin_failures=pin_failures+1 WHERE id=? AND pin_failures<?
+		RETURNING pin_failures
+	`, id, max).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.NotFound
+	}
+	return failures, err
+}
+
+func (r *ShareLinkRepo) ReturnPINAttempt(ctx context.Context, id int) error {
+	_, err := r.DB.ExecContext(ctx, `
+		UPDATE share_links SET pin_failures=pin_failures-1 WHERE id=? AND pin_failures>0
+	`, id)
+	return err
+}
+
+func (r *ShareLinkRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		DELETE FROM share_links WHERE expires_at<?1 OR revoked_at<?1
+	`, ts(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
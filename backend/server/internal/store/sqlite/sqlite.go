@@ -0,0 +1,127 @@
+// Package sqlite implements the repository interfaces on a single SQLite
+// file, for single-node deployments and developer laptops. It keeps the
+// schema, constraints and error mapping of the postgres store.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Open opens the database named by a sqlite: URL, either sqlite://PATH or
+// sqlite:PATH. sqlite::memory: gives a private in-memory database.
+func Open(ctx context.Context, dbURL string) (*sql.DB, error) {
+	path, ok := strings.CutPrefix(dbURL, "sqlite://")
+	if !ok {
+		path, ok = strings.CutPrefix(dbURL, "sqlite:")
+	}
+	if !ok || path == "" {
+		return nil, fmt.Errorf("not a sqlite URL: %q", dbURL)
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	if path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time. A single connection serialises
+	// writes the way the postgres store's row locks and advisory locks do,
+	// and keeps an in-memory database from splitting per connection.
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func NewRepo(db *sql.DB) *repository.Repository {
+	return newRepo(&Handle{db: db})
+}
+
+func newRepo(h *Handle) *repository.Repository {
+	return &repository.Repository{
+		Users:       &UserRepo{DB: h},
+		Profiles:    &ProfileRepo{DB: h},
+		Addresses:   &AddressRepo{DB: h},
+		Documents:   &DocumentRepo{DB: h},
+		EKYC:        &EKYCRepo{DB: h},
+		KYC:         &KYCRepo{DB: h},
+		Attachments: &AttachmentRepo{DB: h},
+		Photos:      &PhotoRepo{DB: h},
+		Duplicates:  &DuplicateRepo{DB: h},
+		Imports:     &ImportRepo{DB: h},
+		Exports:     &ExportRepo{DB: h},
+		Consents:    &ConsentRepo{DB: h},
+		ShareLinks:  &ShareLinkRepo{DB: h},
+		Credentials: &CredentialRepo{DB: h},
+		Audit:       &AuditRepo{DB: h},
+		Sessions:    &SessionRepo{DB: h},
+		Tx:          &Transactor{DB: h},
+	}
+}
+
+// timeLayout is fixed-width UTC, so stored timestamps compare correctly as
+// text, and is one the driver parses back into time.Time.
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+// ts formats a time for a TIMESTAMP column. Every timestamp is written
+// through it rather than CURRENT_TIMESTAMP, which only has second precision.
+func ts(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// now matches the precision of a postgres TIMESTAMPTZ.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// requireRow turns an Exec that matched no rows into models.NotFound.
+func requireRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.NotFound
+	}
+	return nil
+}
+
+// isUniqueViolation and isForeignKeyViolation match the SQLite extended
+// result codes that the repositories translate into models.AlreadyExists and
+// models.NotFound.
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isPrimaryKeyViolation matches a duplicate INTEGER PRIMARY KEY, which SQLite
+// reports apart from other unique constraints.
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Raaffs/profileManager/server/internal/repository"
+	"github.com/Raaffs/profileManager/server/internal/repository/repotest"
+)
+
+func openTestDB(t *testing.T) *Migrator {
+	t.Helper()
+	ctx := context.Background()
+	db, err := Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if _, err := m.Up(ctx, false); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	return m
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		return NewRepo(openTestDB(t).DB)
+	})
+}
+
+func TestMigrator_DownThenUp(t *testing.T) {
+	ctx := context.Background()
+	m := openTestDB(t)
+
+	down, err := m.Down(ctx, len(m.Migrations), false)
+	if err != nil || len(down) != len(m.Migrations) {
+		t.Fatalf("Down() = %d migrations, %v; want %d", len(down), err, len(m.Migrations))
+	}
+	up, err := m.Up(ctx, false)
+	if err != nil || len(up) != len(m.Migrations) {
+		t.Fatalf("Up() = %d migrations, %v; want %d", len(up), err, len(m.Migrations))
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Errorf("migration %d not applied after Up()", s.Version)
+		}
+	}
+}
+
+func TestOpen_RejectsOtherSchemes(t *testing.T) {
+	if _, err := Open(context.Background(), "postgres://localhost/db"); err == nil {
+		t.Error("Open(postgres URL) = nil error; want error")
+	}
+}
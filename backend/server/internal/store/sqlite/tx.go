@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Raaffs/profileManager/server/internal/repository"
+)
+
+// Handle is the database or an open transaction. Begin on a transaction opens
+// a savepoint, so the repositories' own transactions nest inside WithTx the
+// way pgx.Tx does for the postgres store.
+type Handle struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	depth int
+	ctx   context.Context
+	done  bool
+}
+
+func (h *Handle) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if h.tx != nil {
+		return h.tx.ExecContext(ctx, query, args...)
+	}
+	return h.db.ExecContext(ctx, query, args...)
+}
+
+func (h *Handle) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if h.tx != nil {
+		return h.tx.QueryContext(ctx, query, args...)
+	}
+	return h.db.QueryContext(ctx, query, args...)
+}
+
+func (h *Handle) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if h.tx != nil {
+		return h.tx.QueryRowContext(ctx, query, args...)
+	}
+	return h.db.QueryRowContext(ctx, query, args...)
+}
+
+func (h *Handle) savepoint() string {
+	return fmt.Sprintf("sp_%d", h.depth)
+}
+
+// Begin starts a transaction, or a savepoint when h already is one.
+func (h *Handle) Begin(ctx context.Context) (*Handle, error) {
+	if h.tx == nil {
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Handle{db: h.db, tx: tx, depth: 1, ctx: ctx}, nil
+	}
+	nested := &Handle{db: h.db, tx: h.tx, depth: h.depth + 1, ctx: ctx}
+	if _, err := h.tx.ExecContext(ctx, "SAVEPOINT "+nested.savepoint()); err != nil {
+		return nil, err
+	}
+	return nested, nil
+}
+
+func (h *Handle) Commit() error {
+	if h.done {
+		return sql.ErrTxDone
+	}
+	h.done = true
+	if h.depth == 1 {
+		return h.tx.Commit()
+	}
+	_, err := h.tx.ExecContext(h.ctx, "RELEASE SAVEPOINT "+h.savepoint())
+	return err
+}
+
+// Rollback undoes the transaction or savepoint. Like sql.Tx it is safe to
+// defer: after Commit it does nothing.
+func (h *Handle) Rollback() error {
+	if h.done {
+		return nil
+	}
+	h.done = true
+	if h.depth == 1 {
+		return h.tx.Rollback()
+	}
+	// ROLLBACK TO leaves the savepoint open, RELEASE then drops it
+	if _, err := h.tx.ExecContext(h.ctx, "ROLLBACK TO SAVEPOINT "+h.savepoint()); err != nil {
+		return err
+	}
+	_, err := h.tx.ExecContext(h.ctx, "RELEASE SAVEPOINT "+h.savepoint())
+	return err
+}
+
+type Transactor struct {
+	DB *Handle
+}
+
+func (t *Transactor) WithTx(ctx context.Context, fn func(tx *repository.Repository) error) error {
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(newRepo(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+type UserRepo struct {
+	DB *Handle
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, id int) (*models.User, error) {
+	var u models.User
+	query := `
+		SELECT id,email,username,password_hash,role,created_at,updated_at
+		FROM users
+		WHERE id=? AND deleted_at IS NULL
+	`
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&u.ID,
+		&u.Email,
+		&u.Username,
+		&u.PasswordHash,
+		&u.Role,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var u models.User
+	query := `
+		SELECT id,email,username,password_hash,role
+		FROM users
+		WHERE email=? AND deleted_at IS NULL
+	`
+	if err := r.DB.QueryRowContext(ctx, query, email).Scan(
+		&u.ID,
+		&u.Email,
+		&u.Username,
+		&u.PasswordHash,
+		&u.Role,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.NotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *models.User) error {
+	created := ts(now())
+	query := `
+		INSERT INTO users (email,username,password_hash,created_at,updated_at)
+		VALUES (?,?,?,?,?)
+		RETURNING id
+	`
+	err := r.DB.QueryRowContext(
+		ctx,
+		query,
+		user.Email,
+		user.Username,
+		user.PasswordHash,
+		created,
+		created,
+	).Scan(&user.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepo) SetRole(ctx context.Context, email string, role string) error {
+	query := `
+		UPDATE users
+		SET role=?, updated_at=?
+		WHERE email=? AND deleted_at IS NULL
+	`
+	return requireRow(r.DB.ExecContext(ctx, query, role, ts(now()), email))
+}
+
+// Delete soft-deletes the user together with their live profiles. Both keep
+// the same deleted_at so that Restore can bring back exactly that set.
+func (r *UserRepo) Delete(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deletedAt := now()
+	if err := requireRow(tx.ExecContext(ctx, `
+		UPDATE users
+		SET deleted_at=?
+		WHERE id=? AND deleted_at IS NULL
+	`, ts(deletedAt), id)); err != nil {
+		return err
+	}
+	profileIDs, err := updateProfileIDs(ctx, tx, `
+		UPDATE profiles
+		SET deleted_at=?
+		WHERE user_id=? AND deleted_at IS NULL
+		RETURNING id
+	`, ts(deletedAt), id)
+	if err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileDeleted, deletedAt, profileIDs...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore undoes Delete for a user that has not been purged yet.
+func (r *UserRepo) Restore(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// read deleted_at as stored, so the profile match below is exact
+	var deletedAt string
+	err = tx.QueryRowContext(ctx, `
+		SELECT CAST(deleted_at AS TEXT) FROM users WHERE id=? AND deleted_at IS NOT NULL
+	`, id).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.NotFound
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at=NULL WHERE id=?`, id); err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	profileIDs, err := updateProfileIDs(ctx, tx, `
+		UPDATE profiles
+		SET deleted_at=NULL
+		WHERE user_id=? AND deleted_at=?
+		RETURNING id
+	`, id, deletedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.AlreadyExists
+		}
+		return err
+	}
+	if err := recordVersions(ctx, tx, models.ProfileRestored, now(), profileIDs...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateProfileIDs runs an UPDATE ... RETURNING id on profiles and collects the ids.
+func updateProfileIDs(ctx context.Context, tx *Handle, query string, args ...any) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Purge permanently erases users soft-deleted before the cutoff. Their
+// profiles go with them through ON DELETE CASCADE.
+func (r *UserRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM users WHERE deleted_at<?`, ts(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,125 @@
+// Package takeout writes the archive a user downloads to get a copy of their
+// data: JSON files for machines, an HTML summary for people and the files
+// they uploaded, in a ZIP encrypted with a passphrase of their choosing.
+package takeout
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+)
+
+// Data is everything the archive holds about one account. Sensitive fields
+// must already be decrypted.
+type Data struct {
+	GeneratedAt time.Time
+	Account     models.User
+	Profiles    []Profile
+	Logins      []Login
+	// Consents is every consent given, including withdrawn ones.
+	Consents []models.Consent
+	// Audit is every audit record filed under the account, in chain order.
+	Audit []models.AuditRecord
+}
+
+// Profile is a profile with what hangs off it.
+type Profile struct {
+	models.Profile
+	Addresses   []models.Address          `json:"addresses"`
+	Documents   []models.IdentityDocument `json:"documents"`
+	KYC         *models.KYC               `json:"kyc,omitempty"`
+	EKYC        []models.EKYCVerification `json:"ekyc_verifications"`
+	Attachments []Attachment              `json:"attachments"`
+	Photo       *File                     `json:"photo,omitempty"`
+}
+
+// Attachment is an uploaded file with its contents. Path is where the file is
+// in the archive; Write sets it.
+type Attachment struct {
+	models.Attachment
+	Path string `json:"path"`
+	Data []byte `json:"-"`
+}
+
+// File is a file of the archive other than an attachment.
+type File struct {
+	Path string `json:"path"`
+	Data []byte `json:"-"`
+}
+
+// Login is one attempt to log in to the account.
+type Login struct {
+	At        time.Time `json:"at"`
+	Succeeded bool      `json:"succeeded"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+//go:embed summary.html
+var summaryHTML string
+
+var summary = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2 January 2006") },
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+}).Parse(summaryHTML))
+
+// Write writes the archive of d to w, encrypted with passphrase.
+func Write(w io.Writer, passphrase string, d *Data) error {
+	for i := range d.Profiles {
+		p := &d.Profiles[i]
+		for j := range p.Attachments {
+			a := &p.Attachments[j]
+			a.Path = fmt.Sprintf("attachments/%d/%d-%s", p.ID, a.ID, strings.ReplaceAll(a.FileName, "/", "_"))
+		}
+		if p.Photo != nil {
+			p.Photo.Path = fmt.Sprintf("photos/%d.jpg", p.ID)
+		}
+	}
+
+	z := newZipWriter(w, passphrase, d.GeneratedAt)
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"account.json", d.Account},
+		{"profiles.json", d.Profiles},
+		{"login_history.json", d.Logins},
+		{"consents.json", d.Consents},
+		{"audit_log.json", d.Audit},
+	} {
+		data, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := z.add(f.name, data); err != nil {
+			return err
+		}
+	}
+
+	var html strings.Builder
+	if err := summary.Execute(&html, d); err != nil {
+		return err
+	}
+	if err := z.add("summary.html", []byte(html.String())); err != nil {
+		return err
+	}
+
+	for _, p := range d.Profiles {
+		for _, a := range p.Attachments {
+			if err := z.add(a.Path, a.Data); err != nil {
+				return err
+			}
+		}
+		if p.Photo != nil {
+			if err := z.add(p.Photo.Path, p.Photo.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return z.close()
+}
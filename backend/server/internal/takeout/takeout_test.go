@@ -0,0 +1,109 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
+	"github.com/yeka/zip"
+)
+
+// openAE2 decrypts an AE-2 entry with the passphrase, reporting false when
+// the passphrase is refused.
+func openAE2(t *testing.T, f *zip.File, passphrase string) ([]byte, bool) {
+	t.Helper()
+	if !f.IsEncrypted() || !bytes.Contains(f.Extra, []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 3, 8, 0}) {
+		t.Fatalf("%s: not an AE-2 AES-256 entry: flags %#x, extra %x", f.Name, f.Flags, f.Extra)
+	}
+	f.SetPassword(passphrase)
+	r, err := f.Open()
+	if errors.Is(err, zip.ErrPassword) {
+		return nil, false
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", f.Name, err)
+	}
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", f.Name, err)
+	}
+	if uint64(len(plain)) != f.UncompressedSize64 {
+		t.Errorf("%s: %d bytes; header says %d", f.Name, len(plain), f.UncompressedSize64)
+	}
+	return plain, true
+}
+
+func TestWrite(t *testing.T) {
+	at := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	scan := bytes.Repeat([]byte("%PDF-1.7 scan "), 2000)
+	d := &Data{
+		GeneratedAt: at,
+		Account:     models.User{ID: 1, Email: "asha@example.com", Username: "asha", PasswordHash: "$2a$10$secret", Role: models.RoleUser, CreatedAt: at},
+		Profiles: []Profile{{
+			Profile:   models.Profile{ID: 3, FullName: "Asha <Rao>", AadhaarNumber: "234567890124", Relationship: models.RelationshipSelf, IsPrimary: true},
+			Documents: []models.IdentityDocument{{ID: 1, Type: models.DocumentPAN, Number: "ABCDE1234F"}},
+			Attachments: []Attachment{{
+				Attachment: models.Attachment{ID: 9, ProfileID: 3, Kind: models.AttachmentIDScan, FileName: "pan card.pdf", BlobKey: "attachments/3/abc"},
+				Data:       scan,
+			}},
+			Photo: &File{Data: []byte("jpeg")},
+		}},
+		Logins:   []Login{{At: at, Succeeded: true, IP: "203.0.113.7"}},
+		Consents: []models.Consent{{ID: 2, Purpose: "marketing", NoticeVersion: 1, GrantedAt: at, WithdrawnAt: &at}},
+		Audit:    []models.AuditRecord{{Seq: 1, UserID: 1, Action: "user.register", CreatedAt: at}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "correct horse battery", d); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a ZIP: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		data, ok := openAE2(t, f, "correct horse battery")
+		if !ok {
+			t.Fatalf("%s: the passphrase does not open it", f.Name)
+		}
+		files[f.Name] = data
+		if _, ok := openAE2(t, f, "wrong passphrase"); ok {
+			t.Errorf("%s: a wrong passphrase passed the check", f.Name)
+		}
+		if !f.ModTime().Equal(at) {
+			t.Errorf("%s: modified %v; want %v", f.Name, f.ModTime(), at)
+		}
+	}
+	for _, name := range []string{"account.json", "profiles.json", "login_history.json", "consents.json", "audit_log.json", "summary.html", "attachments/3/9-pan card.pdf", "photos/3.jpg"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+	if bytes.Contains(files["account.json"], []byte("secret")) {
+		t.Error("account.json has the password hash")
+	}
+	if !bytes.Equal(files["attachments/3/9-pan card.pdf"], scan) {
+		t.Error("the attachment does not round-trip")
+	}
+
+	var profiles []map[string]any
+	if err := json.Unmarshal(files["profiles.json"], &profiles); err != nil || len(profiles) != 1 {
+		t.Fatalf("profiles.json = %s: %v", files["profiles.json"], err)
+	}
+	if profiles[0]["aadhaar_number"] != "234567890124" || profiles[0]["attachments"].([]any)[0].(map[string]any)["path"] != "attachments/3/9-pan card.pdf" {
+		t.Errorf("profiles.json = %s", files["profiles.json"])
+	}
+	html := string(files["summary.html"])
+	for _, want := range []string{"Asha &lt;Rao&gt;", "ABCDE1234F", `href="attachments/3/9-pan%20card.pdf"`, "203.0.113.7", "marketing", "user.register"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("summary.html has no %q", want)
+		}
+	}
+}
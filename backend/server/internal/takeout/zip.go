@@ -0,0 +1,47 @@
+package takeout
+
+import (
+	"io"
+	"time"
+
+	"github.com/yeka/zip"
+)
+
+// The archive is a ZIP whose entries are encrypted the way WinZip does it
+// (AE-2, AES-256), which 7-Zip, WinZip, libarchive and the macOS Archive
+// Utility can open with the passphrase. The standard library knows nothing of
+// encryption, so the archive is written with github.com/yeka/zip, the fork of
+// archive/zip that the offline eKYC reader already uses.
+
+// flagUTF8 marks an entry name as UTF-8, which the writer does not set itself.
+const flagUTF8 = 0x800
+
+// zipWriter writes an encrypted ZIP.
+type zipWriter struct {
+	zw         *zip.Writer
+	passphrase string
+	modified   time.Time
+}
+
+func newZipWriter(w io.Writer, passphrase string, modified time.Time) *zipWriter {
+	return &zipWriter{zw: zip.NewWriter(w), passphrase: passphrase, modified: modified}
+}
+
+// add compresses, encrypts and writes one file. Every entry gets its own salt
+// and so its own keys.
+func (z *zipWriter) add(name string, data []byte) error {
+	fh := &zip.FileHeader{Name: name, Method: zip.Deflate, Flags: flagUTF8}
+	fh.SetModTime(z.modified)
+	fh.SetPassword(z.passphrase)
+	fh.SetEncryptionMethod(zip.AES256Encryption)
+	w, err := z.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (z *zipWriter) close() error {
+	return z.zw.Close()
+}
@@ -25,19 +25,30 @@ var verhoeffP = [8][10]int{
 	{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
 }
 
-// ValidateAadhaar performs the Verhoeff checksum check
-func ValidateAadhaar(aadhaar string) bool {
-	if len(aadhaar) != 12 {
-		return false
-	}
-
+// verhoeff reports whether a string of digits ends in a valid Verhoeff
+// check digit.
+func verhoeff(digits string) bool {
 	c := 0
-	for i := 0; i < len(aadhaar); i++ {
+	for i := 0; i < len(digits); i++ {
 		// Get digit from right to left
-		digit := int(aadhaar[len(aadhaar)-i-1] - '0')
+		digit := int(digits[len(digits)-i-1] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
 		c = verhoeffD[c][verhoeffP[i%8][digit]]
 	}
-	
-	// A valid Aadhaar results in a checksum of 0
+
+	// A valid number results in a checksum of 0
 	return c == 0
-}
\ No newline at end of file
+}
+
+// ValidateAadhaar performs the Verhoeff checksum check
+func ValidateAadhaar(aadhaar string) bool {
+	return len(aadhaar) == AADHAR_LENGTH && verhoeff(aadhaar)
+}
+
+// ValidateVID checks a 16-digit Aadhaar Virtual ID, which carries the same
+// Verhoeff check digit as the Aadhaar number it stands in for.
+func ValidateVID(vid string) bool {
+	return len(vid) == VID_LENGTH && verhoeff(vid)
+}
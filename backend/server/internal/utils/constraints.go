@@ -6,6 +6,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/Raaffs/profileManager/server/internal/models"
 )
 
 type ValidationError struct {
@@ -17,17 +19,23 @@ var(
 	MIN_NAME_LENGTH=3
 	MAX_NAME_LENGTH=40
 	AADHAR_LENGTH=12
+	VID_LENGTH=16
 	PHONE_NUMBER_LENGTH=10
 )
 
 var (
-	ErrNameOutofRange      	= ValidationError{"name", fmt.Sprintf("name should be between %d - %d characters")}
+	ErrNameOutofRange      	= ValidationError{"name", "name should be between %d - %d characters"}
 	ErrFieldRequired       	= ValidationError{"field", "this field cannot be empty"}
 	ErrInvalidEmail        	= ValidationError{"email", "invalid email address"}
 	ErrPasswordTooWeak     	= ValidationError{"password", "password is too weak, must include letters, numbers, and special characters"}
 	ErrInvalidPhone        	= ValidationError{"phone", "invalid phone number"}
 	ErrInvalidAadharNumber 	= ValidationError{"aadhar", "invalid aadhar number"}
+	ErrInvalidVID          	= ValidationError{"vid", "invalid VID, it must be 16 digits"}
+	ErrAadhaarOrVIDRequired	= ValidationError{"aadhar", "an aadhaar number or a VID is required"}
 	ErrInvalidDate         	= ValidationError{"date", "invalid date format"}
+	ErrInvalidRelationship 	= ValidationError{"relationship", "relationship must be one of self, child, parent, spouse, ward"}
+	ErrInvalidDocumentType 	= ValidationError{"type", "type must be one of pan, passport, voter_id, driving_licence"}
+	ErrInvalidDocumentNumber	= ValidationError{"number", "invalid %s number"}
 )
 
 func (v *Validator) NameLength(name string,min,max int) {
@@ -47,6 +55,14 @@ func (v *Validator)Aadhar(aadhar string){
 	)
 }
 
+func (v *Validator) VID(vid string) {
+	v.Check(
+		ValidateVID(vid),
+		ErrInvalidVID.Key,
+		ErrInvalidVID.Message,
+	)
+}
+
 func (v *Validator) Phone(phone string)  {
 	re := regexp.MustCompile(`^\+?(\d{1,3})?[-.\s]?\(?\d{1,4}?\)?[-.\s]?\d{1,4}[-.\s]?\d{1,9}$`)
 	v.Check(
@@ -71,6 +87,34 @@ func (v *Validator) Date(date string) {
     v.Check(err == nil, ErrInvalidDate.Key, "Date must be a real calendar date")
 }
 
+func (v *Validator) Relationship(relationship string) {
+	v.Check(
+		In(relationship, models.Relationships...),
+		ErrInvalidRelationship.Key,
+		ErrInvalidRelationship.Message,
+	)
+}
+
+// IdentityDocument checks a normalized document number against the format
+// of its type.
+func (v *Validator) IdentityDocument(docType, number string) {
+	valid := map[string]func(string) bool{
+		models.DocumentPAN:            ValidatePAN,
+		models.DocumentPassport:       ValidatePassport,
+		models.DocumentVoterID:        ValidateEPIC,
+		models.DocumentDrivingLicence: ValidateDrivingLicence,
+	}[docType]
+	if valid == nil {
+		v.AddError(ErrInvalidDocumentType.Key, ErrInvalidDocumentType.Message)
+		return
+	}
+	v.Check(
+		valid(number),
+		ErrInvalidDocumentNumber.Key,
+		fmt.Sprintf(ErrInvalidDocumentNumber.Message, strings.ReplaceAll(docType, "_", " ")),
+	)
+}
+
 func (v *Validator) Mail(email string) bool {
 	re := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
 	return re.MatchString(email)
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// NormalizeDocumentNumber upper-cases a document number and drops the spaces
+// and hyphens people type into it, so "mh14 2011-0062821" and
+// "MH1420110062821" are the same licence.
+func NormalizeDocumentNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ' || r == '-':
+			return -1
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, number)
+}
+
+// PANEntityTypes maps the fourth character of a PAN to the kind of holder it
+// was issued to.
+var PANEntityTypes = map[byte]string{
+	'P': "individual",
+	'C': "company",
+	'H': "hindu undivided family",
+	'F': "firm",
+	'A': "association of persons",
+	'T': "trust",
+	'B': "body of individuals",
+	'L': "local authority",
+	'J': "artificial juridical person",
+	'G': "government",
+}
+
+var panFormat = regexp.MustCompile(`^[A-Z]{5}[0-9]{4}[A-Z]$`)
+
+// ValidatePAN checks the AAAPA1234A layout of a PAN and that its fourth
+// character is a known entity type.
+func ValidatePAN(pan string) bool {
+	if !panFormat.MatchString(pan) {
+		return false
+	}
+	_, ok := PANEntityTypes[pan[3]]
+	return ok
+}
+
+// Indian passports are a letter followed by seven digits. Q, X and Z are not
+// issued as the series letter, and the digits neither start nor end with 0.
+var passportFormat = regexp.MustCompile(`^[A-PR-WY][1-9][0-9]{5}[1-9]$`)
+
+func ValidatePassport(passport string) bool {
+	return passportFormat.MatchString(passport)
+}
+
+// EPIC (voter ID) numbers are three letters followed by seven digits.
+var epicFormat = regexp.MustCompile(`^[A-Z]{3}[0-9]{7}$`)
+
+func ValidateEPIC(epic string) bool {
+	return epicFormat.MatchString(epic)
+}
+
+// DLStateCodes are the state and union territory codes that begin a driving
+// licence number, including ones that have since been replaced (OR, DN, DD)
+// because older licences still carry them.
+var DLStateCodes = []string{
+	"AN", "AP", "AR", "AS", "BR", "CG", "CH", "DD", "DL", "DN", "GA", "GJ",
+	"HP", "HR", "JH", "JK", "KA", "KL", "LA", "LD", "MH", "ML", "MN", "MP",
+	"MZ", "NL", "OD", "OR", "PB", "PY", "RJ", "SK", "TN", "TR", "TS", "UK",
+	"UP", "WB",
+}
+
+// A normalized licence number is the state code, a two digit RTO code, the
+// year of issue and a seven digit serial: MH14 2011 0062821.
+var dlFormat = regexp.MustCompile(`^([A-Z]{2})[0-9]{2}(19|20)[0-9]{2}[0-9]{7}$`)
+
+func ValidateDrivingLicence(dl string) bool {
+	m := dlFormat.FindStringSubmatch(dl)
+	return m != nil && slices.Contains(DLStateCodes, m[1])
+}
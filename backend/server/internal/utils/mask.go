@@ -0,0 +1,33 @@
+package utils
+
+import "strings"
+
+// MaskTail replaces every character except the last visible ones with 'X'.
+func MaskTail(value string, visible int) string {
+	if len(value) <= visible {
+		return strings.Repeat("X", len(value))
+	}
+	return strings.Repeat("X", len(value)-visible) + value[len(value)-visible:]
+}
+
+// MaskAadhaar formats an Aadhaar number the way UIDAI's masked Aadhaar does,
+// showing only the last four digits: XXXX XXXX 1234.
+func MaskAadhaar(aadhaar string) string {
+	if len(aadhaar) != AADHAR_LENGTH {
+		return MaskTail(aadhaar, 0)
+	}
+	return "XXXX XXXX " + aadhaar[8:]
+}
+
+// MaskVID shows only the last four digits of a VID: XXXX XXXX XXXX 1234.
+func MaskVID(vid string) string {
+	if len(vid) != VID_LENGTH {
+		return MaskTail(vid, 0)
+	}
+	return "XXXX XXXX XXXX " + vid[12:]
+}
+
+// MaskPhone keeps the last four digits of a phone number.
+func MaskPhone(phone string) string {
+	return MaskTail(phone, 4)
+}
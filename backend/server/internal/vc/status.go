@@ -0,0 +1,72 @@
+package vc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+)
+
+// ListSize is how many credentials one status list covers: 16 KiB of bits,
+// the smallest list StatusList2021 recommends, so that fetching a list says
+// little about which credential is being checked.
+const ListSize = 131072
+
+// Entry returns the status list and the index in it of the credential with
+// the given ID. IDs start at 1; list numbers too.
+func Entry(id int) (list, index int) {
+	return (id-1)/ListSize + 1, (id - 1) % ListSize
+}
+
+// ID is the inverse of Entry.
+func ID(list, index int) int {
+	return (list-1)*ListSize + index + 1
+}
+
+// Bitstring is the uncompressed bits of a status list. Bit 0 is the most
+// significant bit of the first byte.
+type Bitstring []byte
+
+func NewBitstring() Bitstring {
+	return make(Bitstring, ListSize/8)
+}
+
+func (b Bitstring) Set(index int) {
+	b[index/8] |= 0x80 >> (index % 8)
+}
+
+func (b Bitstring) Get(index int) bool {
+	return b[index/8]&(0x80>>(index%8)) != 0
+}
+
+// Encode returns the encodedList of a status list credential: the bits
+// gzipped and base64url encoded without padding.
+func (b Bitstring) Encode() (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeBitstring reverses Encode.
+func DecodeBitstring(encoded string) (Bitstring, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	// a list is never larger than ListSize bits; stop a gzip bomb there
+	bits, err := io.ReadAll(io.LimitReader(zr, ListSize/8+1))
+	if err != nil || len(bits) != ListSize/8 {
+		return nil, ErrInvalid
+	}
+	return bits, nil
+}
@@ -0,0 +1,255 @@
+// Package vc issues profiles as W3C Verifiable Credentials. Credentials
+// follow the VC Data Model 1.1 in its JWT encoding, are signed with Ed25519 by
+// a did:web issuer, and point at a StatusList2021 revocation list that the
+// issuer also signs.
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JSON-LD contexts the documents name.
+const (
+	ContextCredentials = "https://www.w3.org/2018/credentials/v1"
+	ContextStatusList  = "https://w3id.org/vc/status-list/2021/v1"
+	ContextDID         = "https://www.w3.org/ns/did/v1"
+	ContextJWS2020     = "https://w3id.org/security/suites/jws-2020/v1"
+)
+
+// Types of the credentials issued.
+const (
+	TypeCredential = "VerifiableCredential"
+	TypeProfile    = "VerifiedProfileCredential"
+	TypeStatusList = "StatusList2021Credential"
+)
+
+// PurposeRevocation is the only status purpose used: a set bit means the
+// credential was revoked, for good.
+const PurposeRevocation = "revocation"
+
+var (
+	ErrInvalid = errors.New("vc: invalid credential")
+	ErrExpired = errors.New("vc: credential has expired")
+	ErrDomain  = errors.New("vc: issuer domain must be a host name, optionally with a port")
+)
+
+// Issuer signs credentials as did:web:<domain>. Its DID document, status
+// lists and verification endpoint are served over https from that domain.
+type Issuer struct {
+	did    string
+	domain string
+	key    ed25519.PrivateKey
+}
+
+// NewIssuer takes the domain the issuer is reached at, such as
+// "id.example.com" or "localhost:8080".
+func NewIssuer(domain string, key ed25519.PrivateKey) (*Issuer, error) {
+	if domain == "" || strings.ContainsAny(domain, "/?#@ ") {
+		return nil, ErrDomain
+	}
+	// did:web percent-encodes the port separator
+	did := "did:web:" + strings.ReplaceAll(domain, ":", "%3A")
+	return &Issuer{did: did, domain: domain, key: key}, nil
+}
+
+// DID is the issuer's decentralized identifier.
+func (i *Issuer) DID() string {
+	return i.did
+}
+
+// KeyID names the verification method credentials are signed with.
+func (i *Issuer) KeyID() string {
+	return i.did + "#key-1"
+}
+
+// StatusListURL is where status list n is published.
+func (i *Issuer) StatusListURL(n int) string {
+	return "https://" + i.domain + "/api/credentials/status/" + strconv.Itoa(n)
+}
+
+// JWK is an Ed25519 public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+type VerificationMethod struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Controller   string `json:"controller"`
+	PublicKeyJWK JWK    `json:"publicKeyJwk"`
+}
+
+// Document is a DID document, served at /.well-known/did.json as did:web
+// requires.
+type Document struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+	AssertionMethod    []string             `json:"assertionMethod"`
+}
+
+func (i *Issuer) Document() Document {
+	pub := i.key.Public().(ed25519.PublicKey)
+	return Document{
+		Context: []string{ContextDID, ContextJWS2020},
+		ID:      i.did,
+		VerificationMethod: []VerificationMethod{{
+			ID:           i.KeyID(),
+			Type:         "JsonWebKey2020",
+			Controller:   i.did,
+			PublicKeyJWK: JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)},
+		}},
+		AssertionMethod: []string{i.KeyID()},
+	}
+}
+
+// Status is the credentialStatus of a credential: its bit in a status list.
+type Status struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	StatusPurpose        string `json:"statusPurpose"`
+	StatusListIndex      string `json:"statusListIndex"`
+	StatusListCredential string `json:"statusListCredential"`
+}
+
+// Index returns the position of the credential's bit in its list.
+func (s *Status) Index() (int, error) {
+	n, err := strconv.Atoi(s.StatusListIndex)
+	if err != nil || n < 0 || n >= ListSize {
+		return 0, ErrInvalid
+	}
+	return n, nil
+}
+
+// Body is the vc claim of a JWT-VC: the credential without the properties
+// the registered claims carry.
+type Body struct {
+	Context           []string       `json:"@context"`
+	Type              []string       `json:"type"`
+	CredentialSubject map[string]any `json:"credentialSubject"`
+	CredentialStatus  *Status        `json:"credentialStatus,omitempty"`
+}
+
+// Claims are the claims of a JWT-VC. iss is the issuer, nbf the issuance
+// date and exp the expiration date.
+type Claims struct {
+	jwt.RegisteredClaims
+	VC Body `json:"vc"`
+}
+
+// CredentialID returns the ID of the credential the claims were issued for,
+// from its status list and index; see Entry.
+func (c *Claims) CredentialID() (int, error) {
+	status := c.VC.CredentialStatus
+	if status == nil {
+		return 0, ErrInvalid
+	}
+	index, err := status.Index()
+	if err != nil {
+		return 0, err
+	}
+	_, n, _ := strings.Cut(status.StatusListCredential, "/api/credentials/status/")
+	list, err := strconv.Atoi(n)
+	if err != nil || list < 1 {
+		return 0, ErrInvalid
+	}
+	return ID(list, index), nil
+}
+
+// Issue signs a profile credential about subject, valid from issued until
+// expires. Its revocation bit is the one for id, see Entry.
+func (i *Issuer) Issue(subject map[string]any, id int, issued, expires time.Time) (string, error) {
+	list, index := Entry(id)
+	listURL := i.StatusListURL(list)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.did,
+			IssuedAt:  jwt.NewNumericDate(issued),
+			NotBefore: jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		VC: Body{
+			Context:           []string{ContextCredentials, ContextStatusList},
+			Type:              []string{TypeCredential, TypeProfile},
+			CredentialSubject: subject,
+			CredentialStatus: &Status{
+				ID:                   fmt.Sprintf("%s#%d", listURL, index),
+				Type:                 "StatusList2021Entry",
+				StatusPurpose:        PurposeRevocation,
+				StatusListIndex:      strconv.Itoa(index),
+				StatusListCredential: listURL,
+			},
+		},
+	}
+	return i.sign(claims)
+}
+
+// StatusList signs status list n, in which the given bits are set.
+func (i *Issuer) StatusList(n int, revoked []int, issued time.Time) (string, error) {
+	bits := NewBitstring()
+	for _, index := range revoked {
+		bits.Set(index)
+	}
+	encoded, err := bits.Encode()
+	if err != nil {
+		return "", err
+	}
+	listURL := i.StatusListURL(n)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.did,
+			ID:        listURL,
+			IssuedAt:  jwt.NewNumericDate(issued),
+			NotBefore: jwt.NewNumericDate(issued),
+		},
+		VC: Body{
+			Context: []string{ContextCredentials, ContextStatusList},
+			Type:    []string{TypeCredential, TypeStatusList},
+			CredentialSubject: map[string]any{
+				"id":            listURL + "#list",
+				"type":          "StatusList2021",
+				"statusPurpose": PurposeRevocation,
+				"encodedList":   encoded,
+			},
+		},
+	}
+	return i.sign(claims)
+}
+
+func (i *Issuer) sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = i.KeyID()
+	return token.SignedString(i.key)
+}
+
+// Verify checks that token is a credential this issuer signed and that it is
+// valid at now, and returns its claims. It does not check the status list;
+// the caller looks up the credential's status itself.
+func (i *Issuer) Verify(token string, now time.Time) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return i.key.Public(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(i.did),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return &claims, ErrExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &claims, nil
+}
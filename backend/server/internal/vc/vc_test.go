@@ -0,0 +1,125 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newIssuer(t *testing.T, domain string) *Issuer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewIssuer(domain, key)
+	if err != nil {
+		t.Fatalf("NewIssuer(%q) error = %v", domain, err)
+	}
+	return i
+}
+
+func TestNewIssuer(t *testing.T) {
+	i := newIssuer(t, "localhost:8080")
+	if i.DID() != "did:web:localhost%3A8080" || i.StatusListURL(2) != "https://localhost:8080/api/credentials/status/2" {
+		t.Errorf("DID() = %s, StatusListURL(2) = %s", i.DID(), i.StatusListURL(2))
+	}
+	doc := i.Document()
+	if doc.ID != i.DID() || doc.AssertionMethod[0] != i.KeyID() || len(doc.VerificationMethod[0].PublicKeyJWK.X) != 43 {
+		t.Errorf("Document() = %+v", doc)
+	}
+	for _, domain := range []string{"", "https://example.com", "example.com/users"} {
+		if _, err := NewIssuer(domain, nil); !errors.Is(err, ErrDomain) {
+			t.Errorf("NewIssuer(%q) error = %v; want %v", domain, err, ErrDomain)
+		}
+	}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	i := newIssuer(t, "id.example.com")
+	issued := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	expires := issued.AddDate(1, 0, 0)
+	token, err := i.Issue(map[string]any{"full_name": "Asha Rao"}, ListSize+3, issued, expires)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	claims, err := i.Verify(token, issued.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	status := claims.VC.CredentialStatus
+	if index, err := status.Index(); err != nil || index != 2 || status.StatusListCredential != i.StatusListURL(2) {
+		t.Errorf("credentialStatus = %+v; want index 2 of list 2", status)
+	}
+	if id, err := claims.CredentialID(); err != nil || id != ListSize+3 {
+		t.Errorf("CredentialID() = %d, %v; want %d", id, err, ListSize+3)
+	}
+	if claims.VC.CredentialSubject["full_name"] != "Asha Rao" || claims.VC.Type[1] != TypeProfile {
+		t.Errorf("vc = %+v", claims.VC)
+	}
+
+	if _, err := i.Verify(token, expires.Add(time.Second)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify(after expiry) error = %v; want %v", err, ErrExpired)
+	}
+	if _, err := newIssuer(t, "id.example.com").Verify(token, issued); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() with another key error = %v; want %v", err, ErrInvalid)
+	}
+	parts := strings.Split(token, ".")
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.Verify(hs, issued); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify(HS256) error = %v; want %v", err, ErrInvalid)
+	}
+	if _, err := i.Verify(parts[0]+"."+parts[1]+".", issued); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify(unsigned) error = %v; want %v", err, ErrInvalid)
+	}
+}
+
+func TestStatusList(t *testing.T) {
+	i := newIssuer(t, "id.example.com")
+	issued := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	token, err := i.StatusList(1, []int{0, 9, ListSize - 1}, issued)
+	if err != nil {
+		t.Fatalf("StatusList() error = %v", err)
+	}
+	claims, err := jwt.ParseWithClaims(token, &Claims{}, func(*jwt.Token) (any, error) { return i.key.Public(), nil })
+	if err != nil {
+		t.Fatalf("status list does not verify: %v", err)
+	}
+	subject := claims.Claims.(*Claims).VC.CredentialSubject
+	bits, err := DecodeBitstring(subject["encodedList"].(string))
+	if err != nil {
+		t.Fatalf("DecodeBitstring() error = %v", err)
+	}
+	for index, want := range map[int]bool{0: true, 1: false, 8: false, 9: true, ListSize - 2: false, ListSize - 1: true} {
+		if bits.Get(index) != want {
+			t.Errorf("bit %d = %v; want %v", index, !want, want)
+		}
+	}
+	if bits[1] != 0x40 {
+		t.Errorf("byte 1 = %#x; want bit 9 to be its second most significant bit", bits[1])
+	}
+	if _, err := DecodeBitstring("bm90IGd6aXA"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeBitstring(garbage) error = %v; want %v", err, ErrInvalid)
+	}
+}
+
+func TestEntry(t *testing.T) {
+	for _, id := range []int{1, 2, ListSize, ListSize + 1, 5*ListSize + 17} {
+		list, index := Entry(id)
+		if ID(list, index) != id || index < 0 || index >= ListSize {
+			t.Errorf("Entry(%d) = %d, %d; ID() of it = %d", id, list, index, ID(list, index))
+		}
+	}
+	if list, index := Entry(1); list != 1 || index != 0 {
+		t.Errorf("Entry(1) = %d, %d; want 1, 0", list, index)
+	}
+}
@@ -0,0 +1,19 @@
+CREATE TABLE audit_log (
+    seq BIGINT PRIMARY KEY,
+    -- No foreign key: audit records must outlive the accounts they describe
+    user_id INTEGER NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE TABLE audit_checkpoints (
+    seq BIGINT PRIMARY KEY,
+    hash CHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
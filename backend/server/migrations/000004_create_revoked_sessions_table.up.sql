@@ -0,0 +1,5 @@
+CREATE TABLE revoked_sessions (
+    -- No foreign key: revocation has to outlive a deleted account
+    user_id INTEGER PRIMARY KEY,
+    revoked_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Soft-deleted rows would violate the restored constraints, so drop them first
+DELETE FROM profiles WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_profiles_deleted_at;
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+DROP INDEX IF EXISTS profiles_phone_number_live_key;
+DROP INDEX IF EXISTS profiles_aadhaar_number_live_key;
+ALTER TABLE profiles ADD CONSTRAINT profiles_phone_number_key UNIQUE (phone_number);
+ALTER TABLE profiles ADD CONSTRAINT profiles_aadhaar_number_key UNIQUE (aadhaar_number);
+
+DROP INDEX IF EXISTS users_username_live_key;
+DROP INDEX IF EXISTS users_email_live_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE profiles DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE profiles ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Uniqueness only applies to live rows, so a soft-deleted account does not
+-- block a new registration while it waits to be purged.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+CREATE UNIQUE INDEX users_email_live_key ON users(email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_username_live_key ON users(username) WHERE deleted_at IS NULL;
+
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_aadhaar_number_key;
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_phone_number_key;
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE deleted_at IS NULL;
+
+-- The purge worker scans for rows past the retention period
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_profiles_deleted_at ON profiles(deleted_at) WHERE deleted_at IS NOT NULL;
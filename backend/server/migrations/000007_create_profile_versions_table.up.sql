@@ -0,0 +1,31 @@
+CREATE TABLE profile_versions (
+    id BIGSERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    change VARCHAR(20) NOT NULL CHECK (change IN ('create', 'update', 'delete', 'restore')),
+    full_name VARCHAR(255) NOT NULL,
+    date_of_birth DATE NOT NULL,
+    phone_number VARCHAR(20) NOT NULL,
+    address TEXT,
+    -- Same AES-GCM ciphertext as profiles.aadhaar_number, never decrypted here
+    aadhaar_number TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL,
+
+    -- History is personal data too, so it is purged along with the profile
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX idx_profile_versions_user_changed ON profile_versions(user_id, changed_at);
+
+-- Seed history with the current state so point-in-time queries have a base
+INSERT INTO profile_versions
+    (profile_id,user_id,change,full_name,date_of_birth,phone_number,address,aadhaar_number,changed_at)
+SELECT id,user_id,'create',full_name,date_of_birth,phone_number,address,aadhaar_number,COALESCE(updated_at,created_at,CURRENT_TIMESTAMP)
+FROM profiles;
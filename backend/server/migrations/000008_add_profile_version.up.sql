@@ -0,0 +1,2 @@
+-- Row version for optimistic concurrency, bumped by every update
+ALTER TABLE profiles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
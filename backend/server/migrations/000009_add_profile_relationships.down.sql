@@ -0,0 +1,10 @@
+-- Only the primary profile of each account survives going back to one profile per user
+DELETE FROM profiles WHERE deleted_at IS NULL AND NOT is_primary;
+
+DROP INDEX IF EXISTS profiles_phone_number_live_key;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS profiles_primary_live_key;
+DROP INDEX IF EXISTS profiles_self_live_key;
+ALTER TABLE profiles DROP COLUMN IF EXISTS is_primary;
+ALTER TABLE profiles DROP COLUMN IF EXISTS relationship;
@@ -0,0 +1,24 @@
+-- An account can hold several profiles: its own and those of family members
+-- and dependents it manages. Exactly one live profile per account is primary.
+ALTER TABLE profiles
+    ADD COLUMN relationship VARCHAR(20) NOT NULL DEFAULT 'self'
+    CHECK (relationship IN ('self', 'child', 'parent', 'spouse', 'ward'));
+ALTER TABLE profiles ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Nothing used to stop a second live profile, though none could be read back.
+-- Keep the oldest as the account's own and file any others as wards.
+UPDATE profiles AS p
+SET relationship='ward'
+WHERE deleted_at IS NULL
+AND EXISTS (SELECT 1 FROM profiles AS o WHERE o.user_id=p.user_id AND o.deleted_at IS NULL AND o.id<p.id);
+UPDATE profiles
+SET is_primary=TRUE
+WHERE deleted_at IS NULL AND relationship='self';
+
+CREATE UNIQUE INDEX profiles_self_live_key ON profiles(user_id) WHERE relationship='self' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_primary_live_key ON profiles(user_id) WHERE is_primary AND deleted_at IS NULL;
+
+-- Dependents often share the account holder's phone, so the number is only
+-- unique among people's own profiles
+DROP INDEX IF EXISTS profiles_phone_number_live_key;
+CREATE UNIQUE INDEX profiles_phone_number_live_key ON profiles(phone_number) WHERE relationship='self' AND deleted_at IS NULL;
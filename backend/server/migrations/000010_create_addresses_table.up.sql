@@ -0,0 +1,31 @@
+CREATE TABLE addresses (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('permanent', 'current', 'office')),
+    line1 VARCHAR(200) NOT NULL,
+    line2 VARCHAR(200) NOT NULL DEFAULT '',
+    locality VARCHAR(100) NOT NULL DEFAULT '',
+    district VARCHAR(100) NOT NULL DEFAULT '',
+    state VARCHAR(100) NOT NULL DEFAULT '',
+    -- Empty only for addresses copied from profiles.address below
+    pin_code VARCHAR(6) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    CONSTRAINT addresses_profile_type_key UNIQUE (profile_id, type)
+);
+
+-- The free-text address becomes the permanent address, unparsed. The
+-- backfill-addresses command fills in the PIN code, district and state where
+-- the text contains a known PIN. profiles.address stays for older clients.
+INSERT INTO addresses (profile_id,type,line1,created_at,updated_at)
+SELECT id,'permanent',LEFT(TRIM(address),200),COALESCE(updated_at,CURRENT_TIMESTAMP),COALESCE(updated_at,CURRENT_TIMESTAMP)
+FROM profiles
+WHERE TRIM(COALESCE(address,''))<>'';
+
+-- Rows still to be backfilled
+CREATE INDEX idx_addresses_unchecked ON addresses(id) WHERE pin_code='';
@@ -0,0 +1,20 @@
+CREATE TABLE identity_documents (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('pan', 'passport', 'voter_id', 'driving_licence')),
+    -- AES-GCM ciphertext, base64 encoded
+    number TEXT NOT NULL,
+    -- HMAC-SHA256 of the type and normalized number, hex encoded. The
+    -- ciphertext differs on every write, so uniqueness is enforced here.
+    number_index CHAR(64) NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    CONSTRAINT identity_documents_profile_type_key UNIQUE (profile_id, type),
+    CONSTRAINT identity_documents_number_index_key UNIQUE (type, number_index)
+);
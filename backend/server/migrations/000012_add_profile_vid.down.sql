@@ -0,0 +1,11 @@
+ALTER TABLE profile_versions DROP COLUMN IF EXISTS vid;
+
+DROP INDEX IF EXISTS profiles_vid_index_live_key;
+DROP INDEX IF EXISTS profiles_aadhaar_number_live_key;
+-- fails while VID-only profiles exist, which would otherwise lose their identifier
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE deleted_at IS NULL;
+
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_aadhaar_or_vid;
+ALTER TABLE profiles DROP COLUMN IF EXISTS aadhaar_form;
+ALTER TABLE profiles DROP COLUMN IF EXISTS vid_index;
+ALTER TABLE profiles DROP COLUMN IF EXISTS vid;
@@ -0,0 +1,16 @@
+-- A profile may carry a 16-digit Aadhaar Virtual ID instead of, or as well
+-- as, the Aadhaar number. Both are AES-GCM ciphertext; an absent one is ''.
+ALTER TABLE profiles ADD COLUMN vid TEXT NOT NULL DEFAULT '';
+-- HMAC-SHA256 of the VID, hex encoded, see cipher.BlindIndex
+ALTER TABLE profiles ADD COLUMN vid_index VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE profiles
+    ADD COLUMN aadhaar_form VARCHAR(10) NOT NULL DEFAULT 'aadhaar'
+    CHECK (aadhaar_form IN ('aadhaar', 'vid', 'both'));
+ALTER TABLE profiles ADD CONSTRAINT profiles_aadhaar_or_vid CHECK (aadhaar_number<>'' OR vid<>'');
+
+-- VID-only profiles all store an empty Aadhaar number
+DROP INDEX IF EXISTS profiles_aadhaar_number_live_key;
+CREATE UNIQUE INDEX profiles_aadhaar_number_live_key ON profiles(aadhaar_number) WHERE aadhaar_number<>'' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX profiles_vid_index_live_key ON profiles(vid_index) WHERE vid_index<>'' AND deleted_at IS NULL;
+
+ALTER TABLE profile_versions ADD COLUMN vid TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,28 @@
+-- One row per offline eKYC file checked against a profile. The document
+-- itself is never stored: only hashes that identify it, the hashes of the
+-- mobile number and email it carries, and the outcome of each comparison.
+CREATE TABLE ekyc_verifications (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    -- SHA-256 of the reference ID and of the signed XML, hex encoded
+    reference_hash CHAR(64) NOT NULL,
+    document_hash CHAR(64) NOT NULL,
+    -- as found in the document, salted with the share code by UIDAI
+    mobile_hash TEXT NOT NULL DEFAULT '',
+    email_hash TEXT NOT NULL DEFAULT '',
+    generated_at TIMESTAMPTZ NOT NULL,
+    name_match BOOLEAN NOT NULL,
+    date_of_birth_match BOOLEAN NOT NULL,
+    address_match BOOLEAN NOT NULL,
+    aadhaar_match BOOLEAN NOT NULL,
+    mobile_match BOOLEAN NOT NULL,
+    verified BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX ekyc_verifications_profile_id_idx ON ekyc_verifications (profile_id);
@@ -0,0 +1 @@
+ALTER TABLE ekyc_verifications DROP COLUMN IF EXISTS source;
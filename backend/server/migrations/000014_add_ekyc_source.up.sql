@@ -0,0 +1,4 @@
+-- Verifications now also come from the Secure QR code on Aadhaar letters.
+ALTER TABLE ekyc_verifications
+    ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'offline_xml'
+    CHECK (source IN ('offline_xml', 'secure_qr'));
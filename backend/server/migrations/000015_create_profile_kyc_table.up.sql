@@ -0,0 +1,32 @@
+-- The KYC review state of each profile. Profiles without a row are in draft.
+-- Which transitions are allowed is enforced by the application, so only the
+-- states themselves are checked here.
+CREATE TABLE profile_kyc (
+    profile_id INTEGER PRIMARY KEY,
+    status VARCHAR(20) NOT NULL
+        CHECK (status IN ('draft', 'submitted', 'under_review', 'verified', 'rejected', 'expired')),
+    -- the support user who has the profile claimed, while under review
+    reviewer_id INTEGER,
+    claimed_at TIMESTAMPTZ,
+    reason_code VARCHAR(40) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    submitted_at TIMESTAMPTZ,
+    verified_at TIMESTAMPTZ,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    -- a purged reviewer leaves the claim open for someone else
+    CONSTRAINT fk_reviewer
+        FOREIGN KEY(reviewer_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX profile_kyc_queue_idx ON profile_kyc (submitted_at)
+    WHERE status IN ('submitted', 'under_review');
+CREATE INDEX profile_kyc_verified_at_idx ON profile_kyc (verified_at)
+    WHERE status = 'verified';
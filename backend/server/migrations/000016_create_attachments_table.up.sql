@@ -0,0 +1,23 @@
+-- Files uploaded to profiles. The files live in the blob store; this table
+-- holds what is needed to find, decrypt and describe them.
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('address_proof', 'id_scan', 'other')),
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    -- SHA-256 of the plaintext, hex encoded
+    sha256 CHAR(64) NOT NULL,
+    blob_key TEXT NOT NULL UNIQUE,
+    -- the file's AES-256 data key, encrypted with the master key
+    data_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX attachments_profile_id_idx ON attachments (profile_id);
@@ -0,0 +1,14 @@
+-- Where the photo of each profile is kept in the blob store.
+CREATE TABLE profile_photos (
+    profile_id INTEGER PRIMARY KEY,
+    -- the sizes are at blob_prefix/<size>.jpg
+    blob_prefix TEXT NOT NULL UNIQUE,
+    -- the AES-256 data key of every size, encrypted with the master key
+    data_key TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE
+);
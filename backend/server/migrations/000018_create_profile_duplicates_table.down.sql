@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS profile_duplicates;
+DROP INDEX IF EXISTS profiles_date_of_birth_idx;
+DROP INDEX IF EXISTS profiles_phone_index_idx;
+DROP INDEX IF EXISTS profiles_aadhaar_index_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS phone_index;
+ALTER TABLE profiles DROP COLUMN IF EXISTS aadhaar_index;
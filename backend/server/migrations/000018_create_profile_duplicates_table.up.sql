@@ -0,0 +1,46 @@
+-- Blind indexes of the Aadhaar number and phone number, HMAC-SHA256 hex
+-- encoded, see cipher.BlindIndex. They are not unique: a match only sends the
+-- pair to review. Existing rows get them on their next write or from the
+-- backfill-indexes command.
+ALTER TABLE profiles ADD COLUMN aadhaar_index VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN phone_index VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX profiles_aadhaar_index_idx ON profiles(aadhaar_index) WHERE aadhaar_index<>'' AND deleted_at IS NULL;
+CREATE INDEX profiles_phone_index_idx ON profiles(phone_index) WHERE phone_index<>'' AND deleted_at IS NULL;
+CREATE INDEX profiles_date_of_birth_idx ON profiles(date_of_birth) WHERE deleted_at IS NULL;
+
+-- Pairs of profiles that look like the same person, for admin review.
+CREATE TABLE profile_duplicates (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL,
+    match_id INTEGER NOT NULL,
+    -- comma separated: aadhaar, phone, name_dob
+    reasons TEXT NOT NULL,
+    -- Jaro-Winkler similarity of the normalized names
+    score DOUBLE PRECISION NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'duplicate', 'distinct')),
+    reviewer_id INTEGER,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMPTZ,
+
+    -- each pair is stored once, lower ID first
+    CONSTRAINT profile_duplicates_order CHECK (profile_id < match_id),
+    CONSTRAINT profile_duplicates_pair_key UNIQUE (profile_id, match_id),
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_match
+        FOREIGN KEY(match_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_reviewer
+        FOREIGN KEY(reviewer_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX profile_duplicates_match_id_idx ON profile_duplicates (match_id);
+CREATE INDEX profile_duplicates_queue_idx ON profile_duplicates (created_at)
+    WHERE status = 'pending';
@@ -0,0 +1,42 @@
+-- Bulk imports of accounts and profiles. Progress is saved with each batch so
+-- an interrupted import can be resumed from the last saved record.
+CREATE TABLE import_jobs (
+    id SERIAL PRIMARY KEY,
+    -- NULL for imports run from the command line
+    admin_id INTEGER,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'ndjson')),
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(10) NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed')),
+    -- records read so far, the line the last one ended on, and a SHA-256
+    -- chained over them
+    records INTEGER NOT NULL DEFAULT 0,
+    line INTEGER NOT NULL DEFAULT 0,
+    checksum CHAR(64) NOT NULL DEFAULT '',
+    users INTEGER NOT NULL DEFAULT 0,
+    profiles INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_admin
+        FOREIGN KEY(admin_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+-- The error report: one row per rejected field, never the rejected value.
+CREATE TABLE import_errors (
+    job_id INTEGER NOT NULL,
+    line INTEGER NOT NULL,
+    field VARCHAR(50) NOT NULL,
+    message TEXT NOT NULL,
+
+    CONSTRAINT fk_job
+        FOREIGN KEY(job_id)
+        REFERENCES import_jobs(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX import_errors_job_id_idx ON import_errors (job_id, line);
@@ -0,0 +1,26 @@
+-- Copies of their data that users asked for. The archive is built in the
+-- background and kept, sealed, in the blob store until it is downloaded once
+-- or expires.
+CREATE TABLE exports (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed', 'downloaded', 'expired')),
+    blob_key TEXT NOT NULL DEFAULT '',
+    -- the archive's data key, wrapped with the master key
+    data_key TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    downloaded_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX exports_user_id_idx ON exports (user_id);
+-- one export at a time per user
+CREATE UNIQUE INDEX exports_pending_idx ON exports (user_id) WHERE status='pending';
@@ -0,0 +1,20 @@
+-- Consent to each purpose personal data is processed for, with the version of
+-- the notice that was shown. Rows are never updated except to record a
+-- withdrawal, so the history of every purpose is kept.
+CREATE TABLE consents (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    notice_version INTEGER NOT NULL CHECK (notice_version > 0),
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    withdrawn_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX consents_user_id_idx ON consents (user_id, id);
+-- one current consent per purpose
+CREATE UNIQUE INDEX consents_current_idx ON consents (user_id, purpose) WHERE withdrawn_at IS NULL;
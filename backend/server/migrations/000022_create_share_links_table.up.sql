@@ -0,0 +1,28 @@
+-- Links that show chosen fields of a profile to anyone holding the URL, until
+-- they expire or are revoked. The URL is signed, so the ids cannot be guessed.
+CREATE TABLE share_links (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    profile_id INTEGER NOT NULL,
+    -- comma-separated, in models.ShareFields order
+    fields TEXT NOT NULL,
+    -- bcrypt hash of the optional PIN
+    pin_hash TEXT NOT NULL DEFAULT '',
+    pin_failures INTEGER NOT NULL DEFAULT 0,
+    accesses INTEGER NOT NULL DEFAULT 0,
+    last_accessed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX share_links_profile_id_idx ON share_links (profile_id, id);
@@ -0,0 +1,25 @@
+-- Verifiable Credentials issued for profiles. The signed credentials are not
+-- stored. Rows are kept after their profile is purged, with the references
+-- cleared, so the revocation status list never un-revokes a credential.
+CREATE TABLE credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER,
+    profile_id INTEGER,
+    -- comma-separated, in models.ShareFields order
+    fields TEXT NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL,
+    CONSTRAINT fk_profile
+        FOREIGN KEY(profile_id)
+        REFERENCES profiles(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX credentials_profile_id_idx ON credentials (profile_id, id);
+CREATE INDEX credentials_user_id_idx ON credentials (user_id);
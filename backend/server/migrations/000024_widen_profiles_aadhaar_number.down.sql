@@ -0,0 +1,3 @@
+-- Fails while any stored ciphertext is longer than 20 characters, rather than
+-- truncating it.
+ALTER TABLE profiles ALTER COLUMN aadhaar_number TYPE VARCHAR(20);
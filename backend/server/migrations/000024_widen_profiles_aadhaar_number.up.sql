@@ -0,0 +1,4 @@
+-- The Aadhaar number is stored as base64 AES-GCM ciphertext, which does not
+-- fit the VARCHAR(20) of 000002. Databases created by the old init.sql already
+-- have TEXT, for which this is a no-op.
+ALTER TABLE profiles ALTER COLUMN aadhaar_number TYPE TEXT;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS profiles_user_aadhaar_index_live_key;
@@ -0,0 +1,6 @@
+-- An account holds each Aadhaar number on one live profile at most. The
+-- ciphertext is salted with a fresh nonce, so profiles_aadhaar_number_live_key
+-- never sees two equal numbers; the blind index does. Profiles without an
+-- index yet are left out until they are next saved or backfilled. Fails while
+-- an account already has two live profiles with the same number.
+CREATE UNIQUE INDEX profiles_user_aadhaar_index_live_key ON profiles(user_id, aadhaar_index) WHERE aadhaar_index<>'' AND deleted_at IS NULL;
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS profiles_documents_deleted_at ON profiles;
+DROP FUNCTION IF EXISTS identity_documents_follow_profile();
+DROP INDEX IF EXISTS identity_documents_number_index_live_key;
+-- fails while a deleted profile and a live one hold the same number
+ALTER TABLE identity_documents ADD CONSTRAINT identity_documents_number_index_key UNIQUE (type, number_index);
+ALTER TABLE identity_documents DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,23 @@
+-- A document number is unique among live profiles only, so deleting a profile
+-- frees its documents' numbers for another profile straight away rather than
+-- at the purge. identity_documents carries its profile's deleted_at for the
+-- partial index, kept in step by a trigger. Restoring a profile whose number
+-- has been taken since fails on the index.
+ALTER TABLE identity_documents ADD COLUMN deleted_at TIMESTAMPTZ;
+UPDATE identity_documents d SET deleted_at=p.deleted_at
+FROM profiles p
+WHERE p.id=d.profile_id AND p.deleted_at IS NOT NULL;
+
+ALTER TABLE identity_documents DROP CONSTRAINT identity_documents_number_index_key;
+CREATE UNIQUE INDEX identity_documents_number_index_live_key ON identity_documents(type, number_index) WHERE deleted_at IS NULL;
+
+CREATE FUNCTION identity_documents_follow_profile() RETURNS trigger AS $$
+BEGIN
+    UPDATE identity_documents SET deleted_at=NEW.deleted_at WHERE profile_id=NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER profiles_documents_deleted_at AFTER UPDATE OF deleted_at ON profiles
+FOR EACH ROW WHEN (OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+EXECUTE FUNCTION identity_documents_follow_profile();
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestAll_EmbeddedMigrationsArePaired(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All() error = %v", err)
+	}
+	if len(all) == 0 {
+		t.Fatal("All() returned no migrations")
+	}
+	for i, mig := range all {
+		if i > 0 && mig.Version <= all[i-1].Version {
+			t.Errorf("migration %d is out of order after %d", mig.Version, all[i-1].Version)
+		}
+	}
+}
+
+func TestLoad_MissingDown_Error(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_init.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"000001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+		"000002_more.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+	}
+	if _, err := Load(fsys); err == nil {
+		t.Errorf("Load() without a down file = nil error; want error")
+	}
+}
+
+func TestLoad_OrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_late.up.sql":    {Data: []byte("up")},
+		"000010_late.down.sql":  {Data: []byte("down")},
+		"000002_early.up.sql":   {Data: []byte("up")},
+		"000002_early.down.sql": {Data: []byte("down")},
+		"README.md":             {Data: []byte("ignored")},
+	}
+	all, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(all) != 2 || all[0].Name != "early" || all[1].Version != 10 {
+		t.Errorf("Load() = %+v; want early(2) then late(10)", all)
+	}
+}
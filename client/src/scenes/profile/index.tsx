@@ -41,6 +41,8 @@ function Profile() {
   const [errorStatus, setErrorStatus] = useState<"404" | "500" | null>(null);
   const [isEditMode, setIsEditMode] = useState(false);
   const [hasExistingProfile, setHasExistingProfile] = useState(false);
+  // ETag of the profile version being edited, sent back as If-Match on update
+  const [etag, setEtag] = useState<string | null>(null);
   const [serverMsg, setServerMsg] = useState<{ type: "success" | "error"; text: string } | null>(null);
 
   const formik = useFormik<ProfileData>({
@@ -61,10 +63,14 @@ function Profile() {
         };
 
         if (hasExistingProfile) {
-          await api.put("restricted/profile", payload);
+          const res = await api.put("restricted/profile", payload, {
+            headers: { "If-Match": etag ?? "" },
+          });
+          setEtag(res.headers["etag"] ?? null);
           setServerMsg({ type: "success", text: "Profile updated successfully!" });
         } else {
-          await api.post("restricted/profile", payload);
+          const res = await api.post("restricted/profile", payload);
+          setEtag(res.headers["etag"] ?? null);
           setServerMsg({ type: "success", text: "Profile created successfully!" });
           setHasExistingProfile(true);
         }
@@ -97,6 +103,7 @@ function Profile() {
             date_of_birth: res.data.date_of_birth ? res.data.date_of_birth.split("T")[0] : ""
           };
           formik.setValues(formattedData);
+          setEtag(res.headers["etag"] ?? null);
           setHasExistingProfile(true);
           setIsEditMode(false);
         } else {
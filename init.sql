@@ -1,30 +0,0 @@
-DROP TABLE IF EXISTS users CASCADE;
-DROP TABLE IF EXISTS profiles CASCADE;
-CREATE TABLE users (
-    id SERIAL PRIMARY KEY,
-    email VARCHAR(255) NOT NULL UNIQUE,
-    username VARCHAR(100) NOT NULL UNIQUE,
-    password_hash TEXT NOT NULL,
-    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE profiles (
-    id SERIAL PRIMARY KEY,
-    user_id INTEGER NOT NULL,
-    full_name VARCHAR(255) NOT NULL,
-    date_of_birth DATE NOT NULL,
-    aadhaar_number TEXT NOT NULL UNIQUE,
-    phone_number VARCHAR(20) NOT NULL UNIQUE,
-    address TEXT,
-    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-    
-    -- Links profile to the users table
-    CONSTRAINT fk_user 
-        FOREIGN KEY(user_id) 
-        REFERENCES users(id) 
-        ON DELETE CASCADE
-);
-
-CREATE INDEX idx_profiles_user_id ON profiles(user_id);
\ No newline at end of file